@@ -10,7 +10,7 @@ defmodule MultiAgentCoder.Merge.Parsers.GoParser do
 
   require Logger
 
-  @parser_script_path Path.join([__DIR__, "scripts", "go_parser.go"])
+  @parser_dir Path.join([__DIR__, "scripts", "go_parser"])
 
   @impl true
   def parse(content) do
@@ -24,6 +24,22 @@ defmodule MultiAgentCoder.Merge.Parsers.GoParser do
     end
   end
 
+  @doc """
+  Parses several files with a single parser process, instead of one per
+  file. Takes `{path, content}` pairs (or a map of path to content) and
+  returns a map of each path to `{:ok, ast}` or `{:error, reason}`.
+  """
+  def parse_files(files) do
+    case call_go_parser_batch(files) do
+      {:ok, results} ->
+        {:ok, results}
+
+      {:error, reason} ->
+        Logger.warning("Go batch parsing failed: #{reason}")
+        {:error, reason}
+    end
+  end
+
   @impl true
   def extract_functions(ast) do
     Map.get(ast, "functions", [])
@@ -76,36 +92,54 @@ defmodule MultiAgentCoder.Merge.Parsers.GoParser do
     try do
       File.write!(temp_file, content)
 
-      # First, try to compile the parser if it doesn't exist
-      compiled_parser = @parser_script_path <> ".bin"
+      {cmd, args} = parser_command([temp_file])
+
+      case System.cmd(cmd, args, stderr_to_stdout: true) do
+        {output, 0} ->
+          case Jason.decode(output) do
+            {:ok, parsed} -> {:ok, parsed}
+            {:error, _} -> {:error, "Failed to decode parser output"}
+          end
 
-      unless File.exists?(compiled_parser) do
-        case System.cmd("go", ["build", "-o", compiled_parser, @parser_script_path],
-               stderr_to_stdout: true
-             ) do
-          {_, 0} -> :ok
-          {error, _} -> Logger.warning("Failed to compile Go parser: #{error}")
-        end
+        {error_output, _} ->
+          {:error, "Parser execution failed: #{error_output}"}
       end
+    rescue
+      error ->
+        {:error, "Parser error: #{inspect(error)}"}
+    after
+      File.rm(temp_file)
+    end
+  end
+
+  # Everything goes in one temporary directory, named by position so the
+  # batch entries map back to the caller's paths
+  defp call_go_parser_batch(files) do
+    temp_dir =
+      Path.join(System.tmp_dir!(), "go_parse_batch_#{:erlang.unique_integer([:positive])}")
+
+    try do
+      File.mkdir_p!(temp_dir)
 
-      # Run the parser
-      parser_cmd =
-        if File.exists?(compiled_parser),
-          do: compiled_parser,
-          else: "go run " <> @parser_script_path
+      names =
+        files
+        |> Enum.with_index()
+        |> Map.new(fn {{path, content}, index} ->
+          temp_file = Path.join(temp_dir, "#{index}.go")
+          File.write!(temp_file, content)
+          {temp_file, path}
+        end)
 
-      {cmd, args} =
-        if File.exists?(compiled_parser) do
-          {compiled_parser, [temp_file]}
-        else
-          {"go", ["run", @parser_script_path, temp_file]}
-        end
+      {cmd, args} = parser_command([temp_dir])
 
       case System.cmd(cmd, args, stderr_to_stdout: true) do
         {output, 0} ->
           case Jason.decode(output) do
-            {:ok, parsed} -> {:ok, parsed}
-            {:error, _} -> {:error, "Failed to decode parser output"}
+            {:ok, %{"results" => results}} ->
+              {:ok, Map.new(results, &batch_entry(&1, names))}
+
+            _ ->
+              {:error, "Failed to decode parser output"}
           end
 
         {error_output, _} ->
@@ -115,21 +149,66 @@ defmodule MultiAgentCoder.Merge.Parsers.GoParser do
       error ->
         {:error, "Parser error: #{inspect(error)}"}
     after
-      File.rm(temp_file)
+      File.rm_rf(temp_dir)
+    end
+  end
+
+  defp batch_entry(%{"path" => temp_file} = entry, names) do
+    path = Map.get(names, temp_file, temp_file)
+
+    case entry do
+      %{"result" => result} -> {path, {:ok, result}}
+      %{"error" => error} -> {path, {:error, error}}
     end
   end
 
+  # Builds the parser binary on first use and falls back to go run
+  defp parser_command(args) do
+    compiled_parser = @parser_dir <> ".bin"
+
+    unless File.exists?(compiled_parser) do
+      case System.cmd("go", ["build", "-o", compiled_parser | parser_sources()],
+             stderr_to_stdout: true
+           ) do
+        {_, 0} -> :ok
+        {error, _} -> Logger.warning("Failed to compile Go parser: #{error}")
+      end
+    end
+
+    if File.exists?(compiled_parser) do
+      {compiled_parser, args}
+    else
+      {"go", ["run" | parser_sources()] ++ ["--" | args]}
+    end
+  end
+
+  # The parser has no go.mod, so it is built from its file list
+  defp parser_sources do
+    Path.join(@parser_dir, "*.go")
+    |> Path.wildcard()
+    |> Enum.reject(&String.ends_with?(&1, "_test.go"))
+  end
+
   defp normalize_function(func_data) when is_map(func_data) do
     %{
       name: Map.get(func_data, "name", "unknown"),
       arity: Map.get(func_data, "arity", 0),
-      params: Map.get(func_data, "params", []),
+      params: Enum.map(Map.get(func_data, "params", []), &param_name/1),
       ast: func_data,
       exported: Map.get(func_data, "exported", false),
-      receiver: Map.get(func_data, "receiver")
+      receiver: Map.get(func_data, "receiver"),
+      type_params: Map.get(func_data, "type_params", []),
+      signature: Map.get(func_data, "signature"),
+      complexity: Map.get(func_data, "complexity", 1),
+      cognitive_complexity: Map.get(func_data, "cognitive_complexity", 0)
     }
   end
 
+  # Parameters are {name, type} objects; unnamed ones go by their type
+  defp param_name(%{"name" => name}) when is_binary(name), do: name
+  defp param_name(%{"type" => type}), do: type
+  defp param_name(param) when is_binary(param), do: param
+
   defp normalize_type(type_data) when is_map(type_data) do
     %{
       name: Map.get(type_data, "name", "unknown"),
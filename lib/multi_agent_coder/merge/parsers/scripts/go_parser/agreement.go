@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+)
+
+// AgreementReport compares the exported symbols of several candidates for
+// the same file, symbol by symbol, in the order the candidates first
+// declare them
+type AgreementReport struct {
+	Candidates []ComposeCandidate `json:"candidates"`
+	Symbols    []SymbolAgreement  `json:"symbols"`
+	Summary    AgreementSummary   `json:"summary"`
+}
+
+// SymbolAgreement is an exported symbol and how the candidates defining it
+// agree. Status is identical when they all have the same code, ignoring
+// formatting and comments; compatible when the code differs under the same
+// signature, a function's or method's header or the members a struct or
+// interface has in common; and conflicting otherwise. A symbol only one
+// candidate defines is identical. Versions groups the candidates by their
+// code, the most common first, and Members lists the struct or interface
+// members the candidates give different types.
+type SymbolAgreement struct {
+	Symbol      string          `json:"symbol"`
+	Kind        string          `json:"kind"`
+	Status      string          `json:"status"`
+	DefinedBy   []string        `json:"defined_by"`
+	MissingFrom []string        `json:"missing_from"`
+	Versions    []SymbolVersion `json:"versions"`
+	Members     []string        `json:"conflicting_members,omitempty"`
+}
+
+// SymbolVersion is one version of a symbol, the candidates that have it and
+// its one-line signature
+type SymbolVersion struct {
+	Candidates []string `json:"candidates"`
+	Signature  string   `json:"signature"`
+}
+
+// AgreementSummary counts the symbols by status, and those every candidate
+// defines
+type AgreementSummary struct {
+	Symbols     int `json:"symbols"`
+	Identical   int `json:"identical"`
+	Compatible  int `json:"compatible"`
+	Conflicting int `json:"conflicting"`
+	Unanimous   int `json:"unanimous"`
+}
+
+func runAgreement(args []string) int {
+	flags := flag.NewFlagSet("agreement", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(positional) < 2 {
+		return fail("Usage: agreement [name=]candidate.go [name=]candidate.go ...")
+	}
+
+	candidates, files, err := loadCandidates(positional)
+	if err != nil {
+		return fail("Failed to load %v", err)
+	}
+	return printJSON(compareCandidates(candidates, files))
+}
+
+// agreementDecl is a candidate's declaration of a symbol
+type agreementDecl struct {
+	candidate int
+	file      *editFile
+	decl      symbolDecl
+}
+
+// compareCandidates groups each exported symbol's declarations across the
+// candidates and classifies how they agree
+func compareCandidates(candidates []ComposeCandidate, files []*editFile) *AgreementReport {
+	report := &AgreementReport{Candidates: candidates, Symbols: []SymbolAgreement{}}
+	byName := map[string][]agreementDecl{}
+	order := []string{}
+	for i, file := range files {
+		symbols, names := changeSymbols(file)
+		for _, name := range names {
+			if !symbolExported(name) {
+				continue
+			}
+			if _, ok := byName[name]; !ok {
+				order = append(order, name)
+			}
+			byName[name] = append(byName[name], agreementDecl{candidate: i, file: file, decl: symbols[name]})
+		}
+	}
+
+	for _, name := range order {
+		decls := byName[name]
+		agreement := SymbolAgreement{Symbol: name, Kind: decls[0].decl.kind, DefinedBy: []string{}, MissingFrom: []string{}, Versions: []SymbolVersion{}}
+		defined := map[int]bool{}
+		versions := map[string]int{}
+		for _, d := range decls {
+			defined[d.candidate] = true
+			agreement.DefinedBy = append(agreement.DefinedBy, candidates[d.candidate].Name)
+			code := agreementCode(d)
+			if _, ok := versions[code]; !ok {
+				versions[code] = len(agreement.Versions)
+				agreement.Versions = append(agreement.Versions, SymbolVersion{Candidates: []string{}, Signature: symbolSignature(d.decl)})
+			}
+			version := &agreement.Versions[versions[code]]
+			version.Candidates = append(version.Candidates, candidates[d.candidate].Name)
+		}
+		for i, candidate := range candidates {
+			if !defined[i] {
+				agreement.MissingFrom = append(agreement.MissingFrom, candidate.Name)
+			}
+		}
+		sort.SliceStable(agreement.Versions, func(i, j int) bool {
+			return len(agreement.Versions[i].Candidates) > len(agreement.Versions[j].Candidates)
+		})
+
+		agreement.Status = "identical"
+		if len(agreement.Versions) > 1 {
+			agreement.Status, agreement.Members = agreementCompatibility(decls)
+		}
+		report.Symbols = append(report.Symbols, agreement)
+
+		report.Summary.Symbols++
+		switch agreement.Status {
+		case "identical":
+			report.Summary.Identical++
+		case "compatible":
+			report.Summary.Compatible++
+		default:
+			report.Summary.Conflicting++
+		}
+		if len(agreement.MissingFrom) == 0 {
+			report.Summary.Unanimous++
+		}
+	}
+	return report
+}
+
+func agreementCode(d agreementDecl) string {
+	return d.decl.kind + " " + normalizedCode(d.file.fset, d.decl.node)
+}
+
+// normalizedCode is a declaration's formatted code without its comments,
+// with whitespace normalized so line breaks do not tell versions apart
+func normalizedCode(fset *token.FileSet, node ast.Node) string {
+	code := withoutDocs(node)
+	if fn, ok := node.(*ast.FuncDecl); ok {
+		copied := *fn
+		copied.Doc = nil
+		code = &copied
+	}
+	return normalizeWhitespace(formatNode(fset, code))
+}
+
+// agreementCompatibility classifies declarations that differ: functions
+// and methods are compatible with the same header, and structs or
+// interfaces when every member they share has the same type, the
+// conflicting members being returned otherwise
+func agreementCompatibility(decls []agreementDecl) (string, []string) {
+	first := decls[0].decl
+	for _, d := range decls[1:] {
+		if d.decl.kind != first.kind || (first.fn == nil) != (d.decl.fn == nil) {
+			return "conflicting", nil
+		}
+	}
+
+	if first.fn != nil {
+		for _, d := range decls[1:] {
+			if funcSignature(d.decl.fn) != funcSignature(first.fn) {
+				return "conflicting", nil
+			}
+		}
+		return "compatible", nil
+	}
+
+	if declTypeSpec(first) == nil {
+		return "conflicting", nil
+	}
+	kind := extractType(declTypeSpec(first)).Kind
+	members := map[string]string{}
+	conflicting := map[string]bool{}
+	for _, d := range decls {
+		spec := declTypeSpec(d.decl)
+		if spec == nil {
+			return "conflicting", nil
+		}
+		info := extractType(spec)
+		if info.Kind != kind {
+			return "conflicting", nil
+		}
+		own := map[string]string{}
+		for _, field := range info.Fields {
+			own[field.Name] = field.Type + " " + field.Tag
+		}
+		if iface, ok := spec.Type.(*ast.InterfaceType); ok {
+			for _, method := range iface.Methods.List {
+				for _, name := range method.Names {
+					own[name.Name] = types.ExprString(method.Type)
+				}
+			}
+		}
+		for _, embedded := range info.Embedded {
+			if _, ok := own[embedded]; !ok {
+				own[embedded] = embedded
+			}
+		}
+		for name, typ := range own {
+			if seen, ok := members[name]; ok && seen != typ {
+				conflicting[name] = true
+			}
+			members[name] = typ
+		}
+	}
+	if len(conflicting) > 0 {
+		return "conflicting", sortedKeys(conflicting)
+	}
+	return "compatible", nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"go/parser"
+	"go/token"
+	"os"
+)
+
+// ApplyResult reports the outcome of applying a diff to a Go file
+type ApplyResult struct {
+	Target     string       `json:"target"`
+	Output     string       `json:"output,omitempty"`
+	Written    bool         `json:"written"`
+	Hunks      []HunkResult `json:"hunks"`
+	ParseError string       `json:"parse_error,omitempty"`
+	TypeErrors []Diagnostic `json:"type_errors"`
+	Source     string       `json:"source,omitempty"`
+}
+
+func runApply(args []string) int {
+	var patchPath, outputPath string
+	dryRun := false
+
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&patchPath, "patch", "", "unified diff to apply")
+	flags.StringVar(&outputPath, "o", "", "write the result here instead of over the target")
+	flags.BoolVar(&dryRun, "dry-run", false, "validate without writing; the result source is returned in the output")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	if patchPath == "" || len(positional) != 1 {
+		return fail("Usage: apply --patch change.diff [-o out.go] [--dry-run] target.go")
+	}
+
+	target := positional[0]
+	if outputPath == "" {
+		outputPath = target
+	}
+
+	diff, err := os.ReadFile(patchPath)
+	if err != nil {
+		return fail("Failed to read patch: %v", err)
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil {
+		return fail("Failed to read file: %v", err)
+	}
+
+	patches, err := parseUnifiedDiff(string(diff))
+	if err != nil {
+		return fail("Invalid patch: %v", err)
+	}
+
+	patch, err := selectPatch(patches, target)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	patched, hunks := applyHunks(string(content), patch)
+	result := &ApplyResult{
+		Target:     target,
+		Hunks:      hunks,
+		TypeErrors: []Diagnostic{},
+	}
+
+	applied := true
+	for _, h := range hunks {
+		applied = applied && h.Applied
+	}
+
+	// Only output that parses may be written; type errors are reported but
+	// do not block the write, since imports may not resolve outside a module
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, target, patched, parser.ParseComments)
+	if err != nil {
+		result.ParseError = err.Error()
+	} else {
+		result.TypeErrors = typeCheckFile(fset, file)
+	}
+
+	if dryRun {
+		result.Source = patched
+	} else if applied && result.ParseError == "" {
+		if err := os.WriteFile(outputPath, []byte(patched), 0644); err != nil {
+			return fail("Failed to write output: %v", err)
+		}
+		result.Output = outputPath
+		result.Written = true
+	}
+
+	code := printJSON(result)
+	if code == 0 && (!applied || result.ParseError != "") {
+		return 1
+	}
+	return code
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyHunks(t *testing.T) {
+	source := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	tests := []struct {
+		name string
+		diff string
+		want string
+		hunk HunkResult
+	}{
+		{
+			name: "exact",
+			diff: "@@ -3,3 +3,3 @@\n c\n-d\n+D\n e\n",
+			want: "a\nb\nc\nD\ne\nf\ng\nh\n",
+			hunk: HunkResult{Applied: true, Line: 3},
+		},
+		{
+			name: "offset",
+			diff: "@@ -1,3 +1,3 @@\n c\n-d\n+D\n e\n",
+			want: "a\nb\nc\nD\ne\nf\ng\nh\n",
+			hunk: HunkResult{Applied: true, Line: 3, Offset: 2},
+		},
+		{
+			name: "offset before the stated line",
+			diff: "@@ -6,3 +6,3 @@\n a\n-b\n+B\n c\n",
+			want: "a\nB\nc\nd\ne\nf\ng\nh\n",
+			hunk: HunkResult{Applied: true, Line: 1, Offset: -5},
+		},
+		{
+			name: "fuzz over stale context",
+			diff: "@@ -3,3 +3,3 @@\n x\n-d\n+D\n y\n",
+			want: "a\nb\nc\nD\ne\nf\ng\nh\n",
+			hunk: HunkResult{Applied: true, Line: 4, Fuzz: 2},
+		},
+		{
+			name: "whitespace",
+			diff: "@@ -3,3 +3,3 @@\n c\n- d \n+D\n e\n",
+			want: "a\nb\nc\nD\ne\nf\ng\nh\n",
+			hunk: HunkResult{Applied: true, Line: 3, Loose: true},
+		},
+		{
+			name: "insertion",
+			diff: "@@ -2,0 +3,1 @@\n+bb\n",
+			want: "a\nb\nbb\nc\nd\ne\nf\ng\nh\n",
+			hunk: HunkResult{Applied: true, Line: 3},
+		},
+		{
+			name: "no match",
+			diff: "@@ -3,3 +3,3 @@\n c\n-zzz\n+D\n e\n",
+			want: source,
+			hunk: HunkResult{Error: "hunk does not match near line 3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := parseUnifiedDiff(tt.diff)
+			if err != nil {
+				t.Fatalf("parseUnifiedDiff: %v", err)
+			}
+			got, hunks := applyHunks(source, &patches[0])
+			if got != tt.want {
+				t.Errorf("applyHunks = %q, want %q", got, tt.want)
+			}
+			if len(hunks) != 1 || hunks[0] != tt.hunk {
+				t.Errorf("hunks = %+v, want [%+v]", hunks, tt.hunk)
+			}
+		})
+	}
+}
+
+func TestRunApply(t *testing.T) {
+	source := "package p\n\nfunc F() int {\n\treturn 1\n}\n"
+	tests := []struct {
+		name       string
+		diff       string
+		code       int
+		written    bool
+		parseError bool
+	}{
+		{
+			name:    "applies",
+			diff:    "--- a/p.go\n+++ b/p.go\n@@ -3,3 +3,3 @@\n func F() int {\n-\treturn 1\n+\treturn 2\n }\n",
+			code:    0,
+			written: true,
+		},
+		{
+			name:       "output does not parse",
+			diff:       "--- a/p.go\n+++ b/p.go\n@@ -3,3 +3,3 @@\n func F() int {\n-\treturn 1\n+\treturn (1\n }\n",
+			code:       1,
+			parseError: true,
+		},
+		{
+			name: "hunk does not apply",
+			diff: "--- a/p.go\n+++ b/p.go\n@@ -3,3 +3,3 @@\n func F() int {\n-\treturn 3\n+\treturn 2\n }\n",
+			code: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target, patch := filepath.Join(dir, "p.go"), filepath.Join(dir, "change.diff")
+			if err := os.WriteFile(target, []byte(source), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(patch, []byte(tt.diff), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			code, output := captureStdout(t, func() int {
+				return runApply([]string{"--patch", patch, target})
+			})
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+			var result ApplyResult
+			if err := json.Unmarshal(output, &result); err != nil {
+				t.Fatalf("output %q: %v", output, err)
+			}
+			if result.Written != tt.written || (result.ParseError != "") != tt.parseError {
+				t.Errorf("written, parse_error = %v, %q, want %v, %v", result.Written, result.ParseError, tt.written, tt.parseError)
+			}
+			content, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unchanged := string(content) == source; unchanged == tt.written {
+				t.Errorf("target after apply = %q", content)
+			}
+		})
+	}
+}
+
+// captureStdout runs fn with the standard output redirected, and returns its
+// exit code and what it printed
+func captureStdout(t *testing.T, fn func() int) (int, []byte) {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stdout := os.Stdout
+	os.Stdout = file
+	code := fn()
+	os.Stdout = stdout
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, []byte(strings.TrimSpace(string(output)))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AssertionUsage reports which assertion libraries a test file uses and,
+// with --test-convention, how that compares with the repository's tests
+type AssertionUsage struct {
+	Libraries  []AssertionLibrary   `json:"libraries"`
+	Convention *AssertionConvention `json:"convention,omitempty"`
+}
+
+// AssertionLibrary is one library and the number of its calls in the file.
+// The standard library is reported as "testing" when t.Error/t.Fatal style
+// calls are used.
+type AssertionLibrary struct {
+	Name   string `json:"name"`
+	Import string `json:"import,omitempty"`
+	Uses   int    `json:"uses"`
+}
+
+// AssertionConvention compares the file with the other test files of the
+// repository. Libraries counts the surveyed files using each library and
+// Dominant is the most common one.
+type AssertionConvention struct {
+	Files      int            `json:"files"`
+	Libraries  map[string]int `json:"libraries"`
+	Dominant   string         `json:"dominant"`
+	Consistent bool           `json:"consistent"`
+	Message    string         `json:"message"`
+}
+
+// assertionLibraries maps import paths to library names. Paths match by
+// prefix so major-version suffixes are covered.
+var assertionLibraries = []struct {
+	prefix string
+	name   string
+}{
+	{"github.com/stretchr/testify/assert", "testify/assert"},
+	{"github.com/stretchr/testify/require", "testify/require"},
+	{"github.com/onsi/gomega", "gomega"},
+	{"github.com/google/go-cmp/cmp", "go-cmp"},
+	{"github.com/frankban/quicktest", "quicktest"},
+	{"github.com/matryer/is", "is"},
+	{"gotest.tools", "gotest.tools"},
+}
+
+// testingFailures are the *testing.T methods that report a failure
+var testingFailures = []string{"Error", "Errorf", "Fatal", "Fatalf", "Fail", "FailNow"}
+
+// gomegaMatchers are the entry points used with a dot import of gomega
+var gomegaMatchers = []string{"Expect", "Ω", "Eventually", "Consistently"}
+
+// detectAssertions returns the assertion usage of a file importing
+// "testing", or nil for other files
+func detectAssertions(file *ast.File) *AssertionUsage {
+	if !contains(importPaths(file), "testing") {
+		return nil
+	}
+
+	usage := &AssertionUsage{Libraries: []AssertionLibrary{}}
+	names := map[string]int{}
+	dotImports := map[string]int{}
+
+	for _, imp := range file.Imports {
+		path := strings.Trim(imp.Path.Value, `"`)
+		name := assertionLibraryName(path)
+		if name == "" {
+			continue
+		}
+		// A trailing major version such as /v2 is not the package name
+		elements := strings.Split(path, "/")
+		local := elements[len(elements)-1]
+		if isMajorVersion(local) && len(elements) > 1 {
+			local = elements[len(elements)-2]
+		}
+		if imp.Name != nil {
+			local = imp.Name.Name
+		}
+		index := len(usage.Libraries)
+		usage.Libraries = append(usage.Libraries, AssertionLibrary{Name: name, Import: path})
+		if local == "." {
+			dotImports[name] = index
+		} else {
+			names[local] = index
+		}
+	}
+
+	testingCalls := 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		switch fun := call.Fun.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := fun.X.(*ast.Ident); ok {
+				if index, ok := names[x.Name]; ok {
+					usage.Libraries[index].Uses++
+					return true
+				}
+			}
+			if contains(testingFailures, fun.Sel.Name) {
+				testingCalls++
+			}
+		case *ast.Ident:
+			if index, ok := dotImports["gomega"]; ok && contains(gomegaMatchers, fun.Name) {
+				usage.Libraries[index].Uses++
+			}
+		}
+		return true
+	})
+
+	if testingCalls > 0 {
+		usage.Libraries = append(usage.Libraries, AssertionLibrary{Name: "testing", Uses: testingCalls})
+	}
+	return usage
+}
+
+func assertionLibraryName(path string) string {
+	for _, lib := range assertionLibraries {
+		if path == lib.prefix || strings.HasPrefix(path, lib.prefix+"/") {
+			return lib.name
+		}
+	}
+	return ""
+}
+
+func isMajorVersion(element string) bool {
+	if len(element) < 2 || element[0] != 'v' {
+		return false
+	}
+	for _, r := range element[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func importPaths(file *ast.File) []string {
+	paths := []string{}
+	for _, imp := range file.Imports {
+		paths = append(paths, strings.Trim(imp.Path.Value, `"`))
+	}
+	return paths
+}
+
+// compareAssertionConvention surveys the test files matched by patterns,
+// other than path itself, and checks that the file only uses libraries the
+// repository already uses
+func compareAssertionConvention(usage *AssertionUsage, path string, patterns []string) (*AssertionConvention, error) {
+	files, err := collectGoFiles(patterns, true)
+	if err != nil {
+		return nil, err
+	}
+	self, _ := filepath.Abs(path)
+
+	convention := &AssertionConvention{Libraries: map[string]int{}}
+	fset := token.NewFileSet()
+	for _, other := range files {
+		if !strings.HasSuffix(other, "_test.go") {
+			continue
+		}
+		if abs, _ := filepath.Abs(other); abs == self {
+			continue
+		}
+		file, err := parser.ParseFile(fset, other, nil, 0)
+		if err != nil {
+			// A broken neighbour says nothing about the convention
+			continue
+		}
+		otherUsage := detectAssertions(file)
+		if otherUsage == nil {
+			continue
+		}
+		convention.Files++
+		for _, lib := range otherUsage.Libraries {
+			convention.Libraries[lib.Name]++
+		}
+	}
+
+	libraries := make([]string, 0, len(convention.Libraries))
+	for name := range convention.Libraries {
+		libraries = append(libraries, name)
+	}
+	sort.Slice(libraries, func(i, j int) bool {
+		a, b := libraries[i], libraries[j]
+		if convention.Libraries[a] != convention.Libraries[b] {
+			return convention.Libraries[a] > convention.Libraries[b]
+		}
+		return a < b
+	})
+	if len(libraries) > 0 {
+		convention.Dominant = libraries[0]
+	}
+
+	if convention.Files == 0 {
+		convention.Consistent = true
+		convention.Message = "no other test files to compare with"
+		return convention, nil
+	}
+
+	foreign := []string{}
+	for _, lib := range usage.Libraries {
+		if convention.Libraries[lib.Name] == 0 {
+			foreign = append(foreign, lib.Name)
+		}
+	}
+
+	convention.Consistent = len(foreign) == 0
+	if convention.Consistent {
+		convention.Message = fmt.Sprintf("matches the repository's test files (mostly %s)", convention.Dominant)
+	} else {
+		convention.Message = fmt.Sprintf("uses %s, which no other test file in the repository uses; the convention is %s",
+			strings.Join(foreign, ", "), convention.Dominant)
+	}
+	return convention, nil
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// SourceDiff is the semantic difference between two Go files: the
+// functions, types and package-level values added, removed, renamed or
+// modified, and the imports added, removed or given another name.
+// Reformatting and comments alone are not changes, except to doc comments;
+// FormattingOnly counts the declarations written differently that are
+// therefore left out.
+type SourceDiff struct {
+	Old            string     `json:"old"`
+	New            string     `json:"new"`
+	Equal          bool       `json:"equal"`
+	FormattingOnly int        `json:"formatting_only"`
+	Package        *Rename    `json:"package,omitempty"`
+	Functions      DeclDiff   `json:"functions"`
+	Types          DeclDiff   `json:"types"`
+	Values         DeclDiff   `json:"values"`
+	Imports        ImportDiff `json:"imports"`
+}
+
+// Rename is a name that changed
+type Rename struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// DeclDiff lists the declarations of one sort that differ. A declaration
+// removed and another added with the same persistent ID is a rename.
+type DeclDiff struct {
+	Added    []DeclSummary `json:"added"`
+	Removed  []DeclSummary `json:"removed"`
+	Renamed  []DeclRename  `json:"renamed"`
+	Modified []DeclChange  `json:"modified"`
+}
+
+// DeclSummary is a declaration only one side has, with its one-line
+// signature and its line on that side
+type DeclSummary struct {
+	Name      string `json:"name"`
+	ID        string `json:"id,omitempty"`
+	Kind      string `json:"kind"`
+	Signature string `json:"signature"`
+	Line      int    `json:"line"`
+}
+
+// DeclRename is a declaration whose code stayed the same under a new name
+type DeclRename struct {
+	Old     string `json:"old"`
+	New     string `json:"new"`
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	OldLine int    `json:"old_line"`
+	NewLine int    `json:"new_line"`
+}
+
+// DeclChange is a declaration both sides have that changed: its aspects, as
+// describe-change names them, the signatures when they differ, and for a
+// struct or interface its fields and methods added, removed and changed
+type DeclChange struct {
+	Name         string      `json:"name"`
+	Kind         string      `json:"kind"`
+	Aspects      []string    `json:"aspects"`
+	OldSignature string      `json:"old_signature,omitempty"`
+	NewSignature string      `json:"new_signature,omitempty"`
+	OldID        string      `json:"old_id,omitempty"`
+	NewID        string      `json:"new_id,omitempty"`
+	OldLine      int         `json:"old_line"`
+	NewLine      int         `json:"new_line"`
+	Members      *MemberDiff `json:"members,omitempty"`
+}
+
+// MemberDiff lists the fields of a struct or methods of an interface, by
+// name, that one side has and the other does not, or for fields, whose type
+// or tag changed. Embedded types are named after the type.
+type MemberDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// ImportDiff lists the imports by path; Renamed are those imported under
+// another name
+type ImportDiff struct {
+	Added   []ImportChange `json:"added"`
+	Removed []ImportChange `json:"removed"`
+	Renamed []ImportChange `json:"renamed"`
+}
+
+// ImportChange is an import path with the name it is imported under, if
+// it has one, and the name it had for a renamed import
+type ImportChange struct {
+	Path    string `json:"path"`
+	Name    string `json:"name,omitempty"`
+	OldName string `json:"old_name,omitempty"`
+}
+
+func runDiff(args []string) int {
+	jobs, strict := runtime.NumCPU(), false
+
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.IntVar(&jobs, "jobs", jobs, "with two directories, packages to diff in parallel")
+	flags.BoolVar(&strict, "strict", false, "with two directories, fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(positional) != 2 {
+		return fail("Usage: diff old.go new.go, or two directories")
+	}
+
+	if treeRoots(positional[0], positional[1]) {
+		tree, err := diffTrees(positional[0], positional[1], jobs)
+		if err != nil {
+			return fail("Diff failed: %v", err)
+		}
+		if err := strictFailure(tree.Errors, strict); err != nil {
+			return fail("Diff failed: %v", err)
+		}
+		return printJSON(tree)
+	}
+
+	oldFile, err := loadEditFile(positional[0])
+	if err != nil {
+		return fail("Failed to load %s: %v", positional[0], err)
+	}
+	newFile, err := loadEditFile(positional[1])
+	if err != nil {
+		return fail("Failed to load %s: %v", positional[1], err)
+	}
+	return printJSON(diffSources(oldFile, newFile))
+}
+
+// diffSources compares two parsed files declaration by declaration, pairing
+// them by name
+func diffSources(oldFile, newFile *editFile) *SourceDiff {
+	diff := &SourceDiff{
+		Old:       oldFile.path,
+		New:       newFile.path,
+		Functions: newDeclDiff(),
+		Types:     newDeclDiff(),
+		Values:    newDeclDiff(),
+		Imports:   ImportDiff{Added: []ImportChange{}, Removed: []ImportChange{}, Renamed: []ImportChange{}},
+	}
+	if oldFile.file.Name.Name != newFile.file.Name.Name {
+		diff.Package = &Rename{Old: oldFile.file.Name.Name, New: newFile.file.Name.Name}
+	}
+
+	oldSymbols, oldOrder := changeSymbols(oldFile)
+	newSymbols, newOrder := changeSymbols(newFile)
+	oldIDs := symbolIDsByName(oldFile.fset, oldFile.file)
+	newIDs := symbolIDsByName(newFile.fset, newFile.file)
+	sortOf := func(kind string) *DeclDiff {
+		switch kind {
+		case "func", "method":
+			return &diff.Functions
+		case "type":
+			return &diff.Types
+		}
+		return &diff.Values
+	}
+
+	// Names only the new side has, by ID, to pair removals with
+	added := map[string]string{}
+	for _, name := range newOrder {
+		if _, ok := oldSymbols[name]; !ok && newIDs[name] != "" {
+			if _, taken := added[newIDs[name]]; !taken {
+				added[newIDs[name]] = name
+			}
+		}
+	}
+	renamed := map[string]bool{}
+
+	for _, name := range oldOrder {
+		decl := oldSymbols[name]
+		next, ok := newSymbols[name]
+		if !ok {
+			if newName, ok := added[oldIDs[name]]; ok && !renamed[newName] && newSymbols[newName].kind == decl.kind {
+				renamed[newName] = true
+				sortOf(decl.kind).Renamed = append(sortOf(decl.kind).Renamed, DeclRename{Old: name, New: newName, ID: oldIDs[name], Kind: decl.kind, OldLine: symbolLine(oldFile, decl), NewLine: symbolLine(newFile, newSymbols[newName])})
+				continue
+			}
+			sortOf(decl.kind).Removed = append(sortOf(decl.kind).Removed, declSummary(oldFile, decl, oldIDs[name]))
+			continue
+		}
+
+		aspects := changedAspects(oldFile, newFile, decl, next)
+		if decl.kind != next.kind && !contains(aspects, "definition") {
+			aspects = append([]string{"definition"}, aspects...)
+		}
+		if len(aspects) == 0 {
+			if symbolText(oldFile, decl) != symbolText(newFile, next) {
+				diff.FormattingOnly++
+			}
+			continue
+		}
+		change := DeclChange{Name: name, Kind: next.kind, Aspects: aspects, OldLine: symbolLine(oldFile, decl), NewLine: symbolLine(newFile, next)}
+		if oldSignature, newSignature := symbolSignature(decl), symbolSignature(next); oldSignature != newSignature {
+			change.OldSignature, change.NewSignature = oldSignature, newSignature
+		}
+		if oldIDs[name] != newIDs[name] {
+			change.OldID, change.NewID = oldIDs[name], newIDs[name]
+		}
+		if before, after := declTypeSpec(decl), declTypeSpec(next); before != nil && after != nil {
+			change.Members = diffMembers(extractType(before), extractType(after))
+		}
+		sortOf(next.kind).Modified = append(sortOf(next.kind).Modified, change)
+	}
+	for _, name := range newOrder {
+		if _, ok := oldSymbols[name]; !ok && !renamed[name] {
+			decl := newSymbols[name]
+			sortOf(decl.kind).Added = append(sortOf(decl.kind).Added, declSummary(newFile, decl, newIDs[name]))
+		}
+	}
+
+	before, after := fileImportSpecs(oldFile.file), fileImportSpecs(newFile.file)
+	for _, path := range sortedKeys(setOfKeys(after)) {
+		oldName, ok := before[path]
+		switch {
+		case !ok:
+			diff.Imports.Added = append(diff.Imports.Added, ImportChange{Path: path, Name: after[path]})
+		case oldName != after[path]:
+			diff.Imports.Renamed = append(diff.Imports.Renamed, ImportChange{Path: path, Name: after[path], OldName: oldName})
+		}
+	}
+	for _, path := range sortedKeys(setOfKeys(before)) {
+		if _, ok := after[path]; !ok {
+			diff.Imports.Removed = append(diff.Imports.Removed, ImportChange{Path: path, Name: before[path]})
+		}
+	}
+
+	diff.Equal = diff.Package == nil && diff.Functions.empty() && diff.Types.empty() && diff.Values.empty() &&
+		len(diff.Imports.Added)+len(diff.Imports.Removed)+len(diff.Imports.Renamed) == 0
+	return diff
+}
+
+func newDeclDiff() DeclDiff {
+	return DeclDiff{Added: []DeclSummary{}, Removed: []DeclSummary{}, Renamed: []DeclRename{}, Modified: []DeclChange{}}
+}
+
+func (d DeclDiff) empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Renamed)+len(d.Modified) == 0
+}
+
+func declSummary(file *editFile, decl symbolDecl, id string) DeclSummary {
+	return DeclSummary{Name: decl.name, ID: id, Kind: decl.kind, Signature: symbolSignature(decl), Line: symbolLine(file, decl)}
+}
+
+func symbolText(file *editFile, decl symbolDecl) string {
+	return file.source[file.offset(decl.node.Pos()):file.offset(decl.node.End())]
+}
+
+func symbolLine(file *editFile, decl symbolDecl) int {
+	return file.fset.Position(decl.node.Pos()).Line
+}
+
+// symbolSignature renders a declaration on one line, as the outline does
+func symbolSignature(decl symbolDecl) string {
+	if decl.fn != nil {
+		return funcSignature(decl.fn)
+	}
+	spec, ok := decl.node.(ast.Spec)
+	if gen, isGen := decl.node.(*ast.GenDecl); isGen && len(gen.Specs) > 0 {
+		spec, ok = gen.Specs[0], true
+	}
+	if !ok {
+		return ""
+	}
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return typeSignature(s)
+	case *ast.ValueSpec:
+		for i, name := range s.Names {
+			if name.Name == decl.name {
+				return valueSignature(decl.kind, s, i)
+			}
+		}
+	}
+	return ""
+}
+
+// declTypeSpec returns the spec of a declared struct or interface
+func declTypeSpec(decl symbolDecl) *ast.TypeSpec {
+	node := decl.node
+	if gen, ok := node.(*ast.GenDecl); ok && len(gen.Specs) > 0 {
+		node = gen.Specs[0]
+	}
+	spec, ok := node.(*ast.TypeSpec)
+	if !ok {
+		return nil
+	}
+	switch spec.Type.(type) {
+	case *ast.StructType, *ast.InterfaceType:
+		return spec
+	}
+	return nil
+}
+
+// diffMembers compares the fields of two structs or the methods of two
+// interfaces, or returns nil when the kinds differ or nothing changed
+func diffMembers(before, after TypeInfo) *MemberDiff {
+	if before.Kind != after.Kind {
+		return nil
+	}
+	members := func(info TypeInfo) (map[string]string, []string) {
+		index, order := map[string]string{}, []string{}
+		for _, field := range info.Fields {
+			index[field.Name] = field.Type + " " + field.Tag
+			order = append(order, field.Name)
+		}
+		for _, method := range info.Methods {
+			index[method] = method
+			order = append(order, method)
+		}
+		for _, embedded := range info.Embedded {
+			if _, ok := index[embedded]; !ok {
+				index[embedded] = embedded
+				order = append(order, embedded)
+			}
+		}
+		return index, order
+	}
+	oldMembers, oldOrder := members(before)
+	newMembers, newOrder := members(after)
+
+	diff := &MemberDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for _, name := range newOrder {
+		if _, ok := oldMembers[name]; !ok {
+			diff.Added = append(diff.Added, name)
+		}
+	}
+	for _, name := range oldOrder {
+		next, ok := newMembers[name]
+		switch {
+		case !ok:
+			diff.Removed = append(diff.Removed, name)
+		case next != oldMembers[name]:
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed) == 0 {
+		return nil
+	}
+	return diff
+}
+
+// fileImportSpecs maps the import paths of a file to the names they are
+// imported under, "" for none
+func fileImportSpecs(file *ast.File) map[string]string {
+	imports := map[string]string{}
+	for _, imp := range file.Imports {
+		name := ""
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		imports[strings.Trim(imp.Path.Value, `"`)] = name
+	}
+	return imports
+}
+
+func setOfKeys(m map[string]string) map[string]bool {
+	set := map[string]bool{}
+	for key := range m {
+		set[key] = true
+	}
+	return set
+}
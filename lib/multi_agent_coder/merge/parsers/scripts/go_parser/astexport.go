@@ -0,0 +1,125 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+)
+
+// ASTExport is the syntax tree of a file for tooling outside the parser.
+// Depth is the number of levels rendered with their fields, 0 for all of
+// them.
+type ASTExport struct {
+	Depth int      `json:"depth"`
+	Root  *ASTNode `json:"root"`
+}
+
+// ASTNode is one go/ast node: its type name without the package, such as
+// FuncDecl or BinaryExpr, its span, and its fields by their go/ast names.
+// Child nodes are ASTNodes or lists of them; names, literal values and
+// operators are strings. Nodes below the depth limit are Truncated and
+// have no fields.
+type ASTNode struct {
+	Kind string `json:"kind"`
+	SourceSpan
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	Truncated bool                   `json:"truncated,omitempty"`
+}
+
+// astSkippedFields are left out of the export: the resolver's objects and
+// scopes, which form cycles, and the File lists that repeat what the
+// declarations already hold
+var astSkippedFields = map[string]bool{"Obj": true, "Scope": true, "Unresolved": true, "Imports": true, "Comments": true}
+
+var (
+	astNodeType  = reflect.TypeOf((*ast.Node)(nil)).Elem()
+	astPosType   = reflect.TypeOf(token.NoPos)
+	astTokenType = reflect.TypeOf(token.ILLEGAL)
+)
+
+// buildASTExport parses content within the same limits as the analysis, so
+// the rendering's recursion stays bounded
+func buildASTExport(content []byte, depth int, limits SourceLimits) (*ASTExport, error) {
+	if err := checkTokenLimits(content, limits); err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTreeLimits(fset, file, limits); err != nil {
+		return nil, err
+	}
+	return &ASTExport{Depth: depth, Root: exportNode(fset, file, depth, 1)}, nil
+}
+
+// exportNode renders node, at level counting from 1 for the file, with its
+// fields while level is within depth
+func exportNode(fset *token.FileSet, node ast.Node, depth, level int) *ASTNode {
+	value := reflect.ValueOf(node)
+	out := &ASTNode{Kind: reflect.Indirect(value).Type().Name(), SourceSpan: sourceSpan(fset, node)}
+	if depth > 0 && level > depth {
+		out.Truncated = true
+		return out
+	}
+
+	fields := map[string]interface{}{}
+	structValue := reflect.Indirect(value)
+	for i := 0; i < structValue.NumField(); i++ {
+		field := structValue.Type().Field(i)
+		if astSkippedFields[field.Name] || field.Type == astPosType {
+			continue
+		}
+		if rendered := exportValue(fset, structValue.Field(i), depth, level); rendered != nil {
+			fields[field.Name] = rendered
+		}
+	}
+	if len(fields) > 0 {
+		out.Fields = fields
+	}
+	return out
+}
+
+// exportValue renders a field of a node, or returns nil for a nil node, an
+// empty list or an empty string
+func exportValue(fset *token.FileSet, value reflect.Value, depth, level int) interface{} {
+	switch {
+	case value.Type() == astTokenType:
+		return value.Interface().(token.Token).String()
+	case value.Type().Implements(astNodeType) || value.Kind() == reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		node, ok := value.Interface().(ast.Node)
+		if !ok {
+			return nil
+		}
+		return exportNode(fset, node, depth, level+1)
+	}
+
+	switch value.Kind() {
+	case reflect.Slice:
+		if value.Len() == 0 {
+			return nil
+		}
+		items := []interface{}{}
+		for i := 0; i < value.Len(); i++ {
+			if item := exportValue(fset, value.Index(i), depth, level); item != nil {
+				items = append(items, item)
+			}
+		}
+		return items
+	case reflect.String:
+		if value.String() == "" {
+			return nil
+		}
+		return value.String()
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Int:
+		return value.Int()
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// BatchResult is the parse output when several files or directories are
+// given. A file that cannot be read or parsed gets an error entry instead of
+// failing the run.
+type BatchResult struct {
+	Results []FileResult `json:"results"`
+	Summary BatchSummary `json:"summary"`
+}
+
+// FileResult is the outcome for one file of a batch: its Result, or the
+// error that prevented it and, for a file that does not parse, its
+// recovered outline, or for one over a size limit, the limit
+type FileResult struct {
+	Path     string            `json:"path"`
+	Result   *Result           `json:"result,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Fallback *RecoveredOutline `json:"fallback,omitempty"`
+	Limit    *LimitExceeded    `json:"limit,omitempty"`
+}
+
+// BatchSummary counts the files of a batch by outcome
+type BatchSummary struct {
+	Files     int `json:"files"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// FileError records a file skipped by a multi-file command because it could
+// not be read or parsed
+type FileError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// isBatch reports whether the parse arguments name more than a single file:
+// several paths, a directory or a "..." pattern
+func isBatch(args []string) bool {
+	if len(args) != 1 {
+		return true
+	}
+	if strings.HasSuffix(args[0], "...") {
+		return true
+	}
+	info, err := os.Stat(args[0])
+	return err == nil && info.IsDir()
+}
+
+// analyzeBatch parses every Go file matched by patterns. With opts.strict
+// the first failing file aborts the batch.
+func analyzeBatch(patterns []string, opts options) (*BatchResult, error) {
+	batch := &BatchResult{Results: []FileResult{}}
+	record := func(entry FileResult, err error) error {
+		return batch.record(entry, err, opts.strict)
+	}
+
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		// A missing path is one failed entry, not a failed batch
+		files, err := collectGoFiles([]string{pattern}, true)
+		if err != nil {
+			if err := record(FileResult{Path: pattern}, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		for _, path := range files {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			entry := FileResult{Path: path}
+			content, err := os.ReadFile(path)
+			if err == nil {
+				if entry.Result, err = analyzeSource(path, content, opts); err != nil {
+					entry.Fallback, entry.Limit = parseFallback(content, err)
+				}
+			}
+			if err := record(entry, err); err != nil {
+				return nil, err
+			}
+		}
+	}
+	coupleBatch(batch)
+	return batch, nil
+}
+
+// sourceFile is one file of a multi-file stdin payload
+type sourceFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// readSourceFiles decodes a multi-file stdin payload: a JSON array of
+// {"path", "content"} objects, or an object holding that array as "files"
+func readSourceFiles(r io.Reader) ([]sourceFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []sourceFile
+	if err := json.Unmarshal(data, &files); err != nil {
+		var payload struct {
+			Files []sourceFile `json:"files"`
+		}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, fmt.Errorf("expected a JSON list of {path, content} objects: %v", err)
+		}
+		files = payload.Files
+	}
+
+	for i, file := range files {
+		if file.Path == "" {
+			return nil, fmt.Errorf("file %d has no path", i)
+		}
+	}
+	return files, nil
+}
+
+// analyzeSourceFiles parses in-memory files as analyzeBatch parses files on
+// disk. Paths only name the entries; annotations that need the file on disk
+// fail for that entry.
+func analyzeSourceFiles(files []sourceFile, opts options) (*BatchResult, error) {
+	batch := &BatchResult{Results: []FileResult{}}
+	seen := map[string]bool{}
+	for _, file := range files {
+		entry := FileResult{Path: file.Path}
+		var err error
+		if seen[file.Path] {
+			err = fmt.Errorf("duplicate path in input")
+		} else if entry.Result, err = analyzeSource(file.Path, []byte(file.Content), opts); err != nil {
+			entry.Fallback, entry.Limit = parseFallback([]byte(file.Content), err)
+		}
+		seen[file.Path] = true
+		if err := batch.record(entry, err, opts.strict); err != nil {
+			return nil, err
+		}
+	}
+	coupleBatch(batch)
+	return batch, nil
+}
+
+// record adds entry to the batch, or the error that prevented it. With
+// strict set the error is returned instead, aborting the batch.
+func (b *BatchResult) record(entry FileResult, err error, strict bool) error {
+	if err != nil {
+		if strict {
+			return fmt.Errorf("%s: %v", entry.Path, err)
+		}
+		entry.Error = err.Error()
+		b.Summary.Failed++
+	} else {
+		b.Summary.Succeeded++
+	}
+	b.Summary.Files++
+	b.Results = append(b.Results, entry)
+	return nil
+}
+
+// strictFailure turns the first skipped file of a multi-file command into
+// an error when failures are fatal
+func strictFailure(errors []FileError, strict bool) error {
+	if !strict || len(errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", errors[0].Path, errors[0].Error)
+}
+
+// budgetViolations counts the size budget violations across the batch
+func (b *BatchResult) budgetViolations() int {
+	count := 0
+	for _, entry := range b.Results {
+		if entry.Result != nil {
+			count += len(entry.Result.BudgetViolations)
+		}
+	}
+	return count
+}
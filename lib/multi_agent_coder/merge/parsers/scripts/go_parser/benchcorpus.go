@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// BenchReport measures the default analysis over a corpus of files. Each
+// iteration parses every file once; latencies are per file and read into
+// memory beforehand, so disk speed is not measured.
+type BenchReport struct {
+	Files      int              `json:"files"`
+	Bytes      int              `json:"bytes"`
+	Iterations int              `json:"iterations"`
+	Failed     int              `json:"failed"`
+	DurationMS float64          `json:"duration_ms"`
+	Throughput BenchRate        `json:"throughput"`
+	Latency    BenchLatency     `json:"latency"`
+	Memory     BenchMemory      `json:"memory"`
+	Slowest    []BenchSample    `json:"slowest"`
+	Errors     []FileError      `json:"errors"`
+	Runtime    BenchEnvironment `json:"runtime"`
+}
+
+// BenchRate is the corpus throughput over all iterations, from the time
+// spent analyzing
+type BenchRate struct {
+	FilesPerSec float64 `json:"files_per_sec"`
+	MBPerSec    float64 `json:"mb_per_sec"`
+}
+
+// BenchLatency gives per-file analysis times in milliseconds
+type BenchLatency struct {
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+	Mean float64 `json:"mean_ms"`
+}
+
+// BenchMemory is the allocation done by the analysis, from the runtime's
+// statistics before and after the run, and the largest heap seen after a
+// file
+type BenchMemory struct {
+	AllocatedBytes   uint64 `json:"allocated_bytes"`
+	Allocations      uint64 `json:"allocations"`
+	BytesPerFile     uint64 `json:"bytes_per_file"`
+	PeakHeapBytes    uint64 `json:"peak_heap_bytes"`
+	GarbageCollected uint32 `json:"gc_cycles"`
+}
+
+// BenchSample is one file's slowest analysis
+type BenchSample struct {
+	Path  string  `json:"path"`
+	Bytes int     `json:"bytes"`
+	MS    float64 `json:"ms"`
+}
+
+// BenchEnvironment identifies what the numbers were measured on
+type BenchEnvironment struct {
+	GoVersion  string `json:"go_version"`
+	GOOS       string `json:"goos"`
+	GOARCH     string `json:"goarch"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+}
+
+// benchSlowest bounds the files listed as slowest
+const benchSlowest = 10
+
+func runBenchCorpus(args []string) int {
+	iterations := 1
+
+	flags := flag.NewFlagSet("benchcorpus", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.IntVar(&iterations, "iterations", 1, "times to analyze the whole corpus")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if iterations < 1 {
+		return fail("--iterations must be at least 1")
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	paths, err := collectGoFiles(patterns, true)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+	if len(paths) == 0 {
+		return fail("No Go files in the corpus")
+	}
+
+	return printJSON(benchCorpus(paths, iterations))
+}
+
+func benchCorpus(paths []string, iterations int) *BenchReport {
+	report := &BenchReport{
+		Iterations: iterations,
+		Slowest:    []BenchSample{},
+		Errors:     []FileError{},
+		Runtime:    BenchEnvironment{GoVersion: runtime.Version(), GOOS: runtime.GOOS, GOARCH: runtime.GOARCH, GOMAXPROCS: runtime.GOMAXPROCS(0)},
+	}
+
+	type corpusFile struct {
+		path    string
+		content []byte
+	}
+	files := []corpusFile{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			report.Errors = append(report.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+		files = append(files, corpusFile{path, content})
+		report.Bytes += len(content)
+	}
+	report.Files = len(files)
+
+	opts := defaultOptions()
+	latencies := []float64{}
+	slowest := map[string]BenchSample{}
+	failed := map[string]bool{}
+
+	runtime.GC()
+	var before, after, sample runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	for i := 0; i < iterations; i++ {
+		for _, file := range files {
+			began := time.Now()
+			_, err := analyzeSource(file.path, file.content, opts)
+			ms := float64(time.Since(began).Microseconds()) / 1000
+			latencies = append(latencies, ms)
+
+			if err != nil && !failed[file.path] {
+				failed[file.path] = true
+				report.Errors = append(report.Errors, FileError{Path: file.path, Error: err.Error()})
+			}
+			if ms > slowest[file.path].MS {
+				slowest[file.path] = BenchSample{Path: file.path, Bytes: len(file.content), MS: ms}
+			}
+			// Sampled outside the file's timed span
+			runtime.ReadMemStats(&sample)
+			report.Memory.PeakHeapBytes = max(report.Memory.PeakHeapBytes, sample.HeapAlloc)
+		}
+	}
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	report.Failed = len(failed)
+	report.DurationMS = float64(elapsed.Microseconds()) / 1000
+
+	sort.Float64s(latencies)
+	total := 0.0
+	for _, ms := range latencies {
+		total += ms
+	}
+	// Throughput is over the analysis time alone, without the heap sampling
+	if seconds := total / 1000; seconds > 0 {
+		report.Throughput.FilesPerSec = float64(len(latencies)) / seconds
+		report.Throughput.MBPerSec = float64(report.Bytes*iterations) / (1 << 20) / seconds
+	}
+	if len(latencies) > 0 {
+		report.Latency = BenchLatency{
+			P50:  percentile(latencies, 50),
+			P90:  percentile(latencies, 90),
+			P99:  percentile(latencies, 99),
+			Max:  latencies[len(latencies)-1],
+			Mean: total / float64(len(latencies)),
+		}
+	}
+
+	report.Memory.AllocatedBytes = after.TotalAlloc - before.TotalAlloc
+	report.Memory.Allocations = after.Mallocs - before.Mallocs
+	report.Memory.GarbageCollected = after.NumGC - before.NumGC
+	if len(latencies) > 0 {
+		report.Memory.BytesPerFile = report.Memory.AllocatedBytes / uint64(len(latencies))
+	}
+
+	for _, s := range slowest {
+		report.Slowest = append(report.Slowest, s)
+	}
+	sort.Slice(report.Slowest, func(i, j int) bool {
+		if report.Slowest[i].MS != report.Slowest[j].MS {
+			return report.Slowest[i].MS > report.Slowest[j].MS
+		}
+		return report.Slowest[i].Path < report.Slowest[j].Path
+	})
+	report.Slowest = report.Slowest[:min(benchSlowest, len(report.Slowest))]
+	return report
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted values
+func percentile(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
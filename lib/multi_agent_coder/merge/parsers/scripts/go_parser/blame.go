@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BlameInfo describes the most recent commit touching a symbol's lines
+type BlameInfo struct {
+	Commit      string `json:"commit"`
+	Author      string `json:"author"`
+	AuthorEmail string `json:"author_email"`
+	Time        string `json:"time"`
+	AgeDays     int    `json:"age_days"`
+	Uncommitted bool   `json:"uncommitted,omitempty"`
+}
+
+// blameCommit holds the porcelain headers of a single commit
+type blameCommit struct {
+	sha   string
+	name  string
+	email string
+	time  int64
+}
+
+// zeroSHA is the commit id git blame reports for uncommitted lines
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// annotateBlame runs git blame over path once and attaches, to every
+// function and type, the newest commit among the lines it spans
+func annotateBlame(result *Result, path string) error {
+	lines, err := blameLines(path)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range result.Functions {
+		result.Functions[i].Blame = newestBlame(lines, result.Functions[i].SourceSpan, now)
+	}
+	for i := range result.Structs {
+		result.Structs[i].Blame = newestBlame(lines, result.Structs[i].SourceSpan, now)
+	}
+	for i := range result.Interfaces {
+		result.Interfaces[i].Blame = newestBlame(lines, result.Interfaces[i].SourceSpan, now)
+	}
+	return nil
+}
+
+// blameLines returns the commit responsible for each line of path, indexed
+// from 1
+func blameLines(path string) ([]*blameCommit, error) {
+	output, err := runGit(path, "blame", "--porcelain", "--", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseBlamePorcelain(output), nil
+}
+
+func parseBlamePorcelain(output []byte) []*blameCommit {
+	commits := map[string]*blameCommit{}
+	lines := []*blameCommit{nil}
+
+	var current *blameCommit
+	var finalLine int
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "\t") {
+			for len(lines) <= finalLine {
+				lines = append(lines, nil)
+			}
+			lines[finalLine] = current
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && len(fields[0]) == 40 {
+			sha := fields[0]
+			finalLine, _ = strconv.Atoi(fields[2])
+			current = commits[sha]
+			if current == nil {
+				current = &blameCommit{sha: sha}
+				commits[sha] = current
+			}
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "author "):
+			current.name = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "author-mail "):
+			current.email = strings.Trim(strings.TrimPrefix(line, "author-mail "), "<>")
+		case strings.HasPrefix(line, "author-time "):
+			current.time, _ = strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64)
+		}
+	}
+
+	return lines
+}
+
+func newestBlame(lines []*blameCommit, span SourceSpan, now time.Time) *BlameInfo {
+	var newest *blameCommit
+	for line := span.Line; line <= span.EndLine && line < len(lines); line++ {
+		commit := lines[line]
+		if commit == nil {
+			continue
+		}
+		if newest == nil || commit.time > newest.time {
+			newest = commit
+		}
+	}
+
+	if newest == nil {
+		return nil
+	}
+
+	modified := time.Unix(newest.time, 0)
+	info := &BlameInfo{
+		Commit:      newest.sha,
+		Author:      newest.name,
+		AuthorEmail: newest.email,
+		Time:        modified.UTC().Format(time.RFC3339),
+		AgeDays:     int(now.Sub(modified).Hours() / 24),
+	}
+	if newest.sha == zeroSHA {
+		info.Uncommitted = true
+	}
+	return info
+}
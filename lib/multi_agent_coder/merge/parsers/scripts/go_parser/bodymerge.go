@@ -0,0 +1,349 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// BodyMerge is the statement-level three-way merge of one function changed
+// by two candidates with the same signature. Source is the merged function,
+// with diff3-style markers around each conflict when Merged is false.
+type BodyMerge struct {
+	Function      string         `json:"function"`
+	Merged        bool           `json:"merged"`
+	Source        string         `json:"source"`
+	OursChanges   int            `json:"ours_changes"`
+	TheirsChanges int            `json:"theirs_changes"`
+	Conflicts     []BodyConflict `json:"conflicts"`
+	Output        string         `json:"output,omitempty"`
+	Written       bool           `json:"written"`
+}
+
+// BodyConflict is a run of statements both sides changed differently. Lines
+// are those of the ours side's statements; for a deletion they point at the
+// statement that follows.
+type BodyConflict struct {
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Base      string `json:"base"`
+	Ours      string `json:"ours"`
+	Theirs    string `json:"theirs"`
+}
+
+// bodyStmt is a statement with the comments and blank lines before it, as
+// the text that is merged, and its normalized form for comparison
+type bodyStmt struct {
+	stmt ast.Stmt
+	text string
+	key  string
+}
+
+// bodySide is one version of the function being merged
+type bodySide struct {
+	file *editFile
+	fn   *ast.FuncDecl
+}
+
+func runMergeBody(args []string) int {
+	var name, outputPath string
+
+	flags := flag.NewFlagSet("merge-body", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&name, "name", "", "function or method to merge, e.g. ParseConfig or Server.Start")
+	flags.StringVar(&outputPath, "o", "", "write the ours file with the merged function here when there are no conflicts")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if name == "" || len(positional) != 3 {
+		return fail("Usage: merge-body --name Func [-o out.go] base.go ours.go theirs.go")
+	}
+
+	sides := make([]*bodySide, 3)
+	for i, path := range positional {
+		file, err := loadSnippet(path)
+		if err != nil {
+			return fail("Failed to load %s: %v", path, err)
+		}
+		sides[i] = &bodySide{file: file, fn: findFuncDecl(file.file, normalizeSymbolName(name))}
+	}
+	base, ours, theirs := sides[0], sides[1], sides[2]
+	if ours.fn == nil || theirs.fn == nil || ours.fn.Body == nil || theirs.fn.Body == nil {
+		return fail("%s must have a body in both ours and theirs", name)
+	}
+	if ours.signature() != theirs.signature() {
+		return fail("%s has different signatures in ours and theirs; merge the declarations instead", name)
+	}
+
+	result := mergeFunctionBodies(base, ours, theirs)
+	result.Function = symbolName(ours.fn)
+
+	if outputPath != "" && result.Merged {
+		source := ours.file.source[:ours.file.offset(ours.fn.Pos())] + result.Source + ours.file.source[ours.file.offset(ours.fn.End()):]
+		if _, err := parser.ParseFile(token.NewFileSet(), outputPath, source, parser.ParseComments); err != nil {
+			return fail("Merged source does not parse: %v", err)
+		}
+		if err := os.WriteFile(outputPath, []byte(source), 0644); err != nil {
+			return fail("Failed to write %s: %v", outputPath, err)
+		}
+		result.Output, result.Written = outputPath, true
+	}
+	return printJSON(result)
+}
+
+func findFuncDecl(file *ast.File, name string) *ast.FuncDecl {
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && symbolName(fn) == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// signature is the function's header as written, without its body
+func (s *bodySide) signature() string {
+	return normalizeWhitespace(s.file.source[s.file.offset(s.fn.Pos()):s.file.offset(s.fn.Body.Lbrace)])
+}
+
+// mergeFunctionBodies merges the statements of the two sides against base,
+// which may lack the function or its body
+func mergeFunctionBodies(base, ours, theirs *bodySide) *BodyMerge {
+	result := &BodyMerge{Conflicts: []BodyConflict{}}
+
+	var baseStmts []bodyStmt
+	if base.fn != nil && base.fn.Body != nil {
+		baseStmts = base.statements(base.fn.Body)
+	}
+	body := mergeBlock(result, base, ours, theirs, baseStmts, ours.statements(ours.fn.Body), theirs.statements(theirs.fn.Body))
+	body = joinMerged(body, ours.file.source[ours.file.offset(lastEnd(ours.fn.Body)):ours.file.offset(ours.fn.Body.Rbrace)])
+
+	result.Source = ours.file.source[ours.file.offset(ours.fn.Pos()):ours.file.offset(ours.fn.Body.Lbrace)+1] + body + "}"
+	result.Merged = len(result.Conflicts) == 0
+	return result
+}
+
+// statements splits a block into its statements, each carrying the text
+// between the previous statement and its own end
+func (s *bodySide) statements(block *ast.BlockStmt) []bodyStmt {
+	stmts := []bodyStmt{}
+	start := block.Lbrace + 1
+	for _, stmt := range block.List {
+		text := s.file.source[s.file.offset(start):s.file.offset(stmt.End())]
+		stmts = append(stmts, bodyStmt{stmt: stmt, text: text, key: normalizeWhitespace(text)})
+		start = stmt.End()
+	}
+	return stmts
+}
+
+// lastEnd is where the text after a block's last statement begins
+func lastEnd(block *ast.BlockStmt) token.Pos {
+	if len(block.List) == 0 {
+		return block.Lbrace + 1
+	}
+	return block.List[len(block.List)-1].End()
+}
+
+// mergeBlock runs a diff3 merge over three statement lists: runs between the
+// statements all sides kept take whichever side changed them, and conflict
+// only when both did so differently. A conflict on a single compound
+// statement whose header both sides kept is merged inside its block.
+func mergeBlock(result *BodyMerge, base, ours, theirs *bodySide, baseStmts, oursStmts, theirsStmts []bodyStmt) string {
+	toOurs := matchStatements(baseStmts, oursStmts)
+	toTheirs := matchStatements(baseStmts, theirsStmts)
+
+	merged := ""
+	i, j, k := 0, 0, 0
+	for {
+		// The next base statement kept by both sides, past the current run
+		next := len(baseStmts)
+		for n := i; n < len(baseStmts); n++ {
+			if o, ok := toOurs[n]; ok && o >= j {
+				if t, ok := toTheirs[n]; ok && t >= k {
+					next = n
+					break
+				}
+			}
+		}
+		o, t := len(oursStmts), len(theirsStmts)
+		if next < len(baseStmts) {
+			o, t = toOurs[next], toTheirs[next]
+		}
+
+		merged = joinMerged(merged, mergeRun(result, base, ours, theirs, baseStmts[i:next], oursStmts[j:o], theirsStmts[k:t]))
+		if next == len(baseStmts) {
+			return merged
+		}
+		merged = joinMerged(merged, oursStmts[o].text)
+		i, j, k = next+1, o+1, t+1
+	}
+}
+
+// mergeRun resolves one run of statements between stable ones, taking the
+// side that changed it or, when both did, merging statement by statement or
+// inside a shared compound statement before declaring a conflict
+func mergeRun(result *BodyMerge, base, ours, theirs *bodySide, baseRun, oursRun, theirsRun []bodyStmt) string {
+	baseKey, oursKey, theirsKey := runKey(baseRun), runKey(oursRun), runKey(theirsRun)
+	switch {
+	case oursKey == theirsKey:
+		if oursKey != baseKey {
+			result.OursChanges++
+			result.TheirsChanges++
+		}
+		return runText(oursRun)
+	case oursKey == baseKey:
+		result.TheirsChanges++
+		return runText(theirsRun)
+	case theirsKey == baseKey:
+		result.OursChanges++
+		return runText(oursRun)
+	}
+
+	// Statements edited in place on both sides line up one to one
+	if len(baseRun) > 1 && len(oursRun) == len(baseRun) && len(theirsRun) == len(baseRun) {
+		merged := ""
+		for i := range baseRun {
+			merged = joinMerged(merged, mergeRun(result, base, ours, theirs, baseRun[i:i+1], oursRun[i:i+1], theirsRun[i:i+1]))
+		}
+		return merged
+	}
+
+	if len(baseRun) == 1 && len(oursRun) == 1 && len(theirsRun) == 1 {
+		baseBlock, baseHead := base.splitCompound(baseRun[0])
+		oursBlock, oursHead := ours.splitCompound(oursRun[0])
+		theirsBlock, theirsHead := theirs.splitCompound(theirsRun[0])
+		if baseBlock != nil && oursBlock != nil && theirsBlock != nil && baseHead == oursHead && oursHead == theirsHead {
+			inner := mergeBlock(result, base, ours, theirs, base.statements(baseBlock), ours.statements(oursBlock), theirs.statements(theirsBlock))
+			src := ours.file.source
+			stmtStart := ours.file.offset(oursRun[0].stmt.Pos())
+			prefix := oursRun[0].text[:len(oursRun[0].text)-(ours.file.offset(oursRun[0].stmt.End())-stmtStart)]
+			return joinMerged(prefix+src[stmtStart:ours.file.offset(oursBlock.Lbrace)+1]+inner,
+				src[ours.file.offset(lastEnd(oursBlock)):ours.file.offset(oursRun[0].stmt.End())])
+		}
+	}
+
+	conflict := BodyConflict{Base: dedentRun(baseRun), Ours: dedentRun(oursRun), Theirs: dedentRun(theirsRun)}
+	if len(oursRun) > 0 {
+		conflict.StartLine = ours.file.fset.Position(oursRun[0].stmt.Pos()).Line
+		conflict.EndLine = ours.file.fset.Position(oursRun[len(oursRun)-1].stmt.End()).Line
+	}
+	result.Conflicts = append(result.Conflicts, conflict)
+	return "\n<<<<<<< ours" + markedRun(oursRun) + "\n||||||| base" + markedRun(baseRun) + "\n=======" + markedRun(theirsRun) + "\n>>>>>>> theirs\n"
+}
+
+// markedRun is a run's text as it goes between conflict markers, starting on
+// a line of its own even when it shared a line with the brace, as in a
+// one-line function
+func markedRun(run []bodyStmt) string {
+	text := runText(run)
+	if text == "" || strings.HasPrefix(strings.TrimLeft(text, " \t"), "\n") {
+		return text
+	}
+	return "\n" + strings.TrimLeft(text, " \t;")
+}
+
+// joinMerged appends text to merged output. After a conflict's closing
+// marker, which ends its line, the line break or separator text starts with
+// is dropped, so one-line bodies do not glue code to the marker.
+func joinMerged(merged, text string) string {
+	if strings.HasSuffix(merged, ">>>>>>> theirs\n") {
+		text = strings.TrimPrefix(strings.TrimLeft(text, " \t;"), "\n")
+	}
+	return merged + text
+}
+
+// splitCompound returns the block of a statement that has exactly one, and
+// the statement's text outside that block
+func (s *bodySide) splitCompound(stmt bodyStmt) (*ast.BlockStmt, string) {
+	var block *ast.BlockStmt
+	switch node := stmt.stmt.(type) {
+	case *ast.BlockStmt:
+		block = node
+	case *ast.ForStmt:
+		block = node.Body
+	case *ast.RangeStmt:
+		block = node.Body
+	case *ast.IfStmt:
+		if node.Else == nil {
+			block = node.Body
+		}
+	}
+	if block == nil {
+		return nil, ""
+	}
+	head := s.file.source[s.file.offset(stmt.stmt.Pos()):s.file.offset(block.Lbrace)] + s.file.source[s.file.offset(block.Rbrace)+1:s.file.offset(stmt.stmt.End())]
+	return block, normalizeWhitespace(head)
+}
+
+// matchStatements maps base statement indexes to the indexes of the equal
+// statements of other along their longest common subsequence
+func matchStatements(base, other []bodyStmt) map[int]int {
+	n, m := len(base), len(other)
+	lengths := make([][]int, n+1)
+	for i := range lengths {
+		lengths[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if base[i].key == other[j].key {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	matches := map[int]int{}
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case base[i].key == other[j].key:
+			matches[i] = j
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return matches
+}
+
+func runKey(run []bodyStmt) string {
+	keys := make([]string, len(run))
+	for i, stmt := range run {
+		keys[i] = stmt.key
+	}
+	return strings.Join(keys, "\n")
+}
+
+func runText(run []bodyStmt) string {
+	var b strings.Builder
+	for _, stmt := range run {
+		b.WriteString(stmt.text)
+	}
+	return b.String()
+}
+
+// dedentRun returns a run's statements without the common indentation, for
+// display in a conflict record
+func dedentRun(run []bodyStmt) string {
+	lines := strings.Split(strings.Trim(runText(run), "\n"), "\n")
+	indent, found := "", false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !found || len(lead) < len(indent) {
+			indent, found = lead, true
+		}
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, indent)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// assertMarkerLines fails unless every conflict marker in source is on a
+// line of its own
+func assertMarkerLines(t *testing.T, source string) {
+	t.Helper()
+	for _, line := range strings.Split(source, "\n") {
+		for _, marker := range []string{"<<<<<<< ours", "||||||| base", "=======", ">>>>>>> theirs"} {
+			if strings.Contains(line, marker[:7]) && line != marker {
+				t.Errorf("marker shares its line: %q\n%s", line, source)
+			}
+		}
+	}
+}
+
+func TestMergeFunctionBodies(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		merged             bool
+		conflicts          int
+		want               string
+	}{
+		{
+			name:      "one-line bodies",
+			base:      "func A() int { return 1 }",
+			ours:      "func A() int { return 2 }",
+			theirs:    "func A() int { return 3 }",
+			conflicts: 1,
+			want:      "func A() int {\n<<<<<<< ours\nreturn 2\n||||||| base\nreturn 1\n=======\nreturn 3\n>>>>>>> theirs\n}",
+		},
+		{
+			name:      "one-line body with a kept statement",
+			base:      "func A() int { x := 0; return x + 1 }",
+			ours:      "func A() int { x := 0; return x + 2 }",
+			theirs:    "func A() int { x := 0; return x + 3 }",
+			conflicts: 1,
+			want:      "func A() int { x := 0\n<<<<<<< ours\nreturn x + 2\n||||||| base\nreturn x + 1\n=======\nreturn x + 3\n>>>>>>> theirs\n}",
+		},
+		{
+			name:      "multi-line bodies",
+			base:      "func B() int {\n\tx := 0\n\treturn x + 1\n}",
+			ours:      "func B() int {\n\tx := 0\n\treturn x + 2\n}",
+			theirs:    "func B() int {\n\tx := 0\n\treturn x + 3\n}",
+			conflicts: 1,
+			want:      "func B() int {\n\tx := 0\n<<<<<<< ours\n\treturn x + 2\n||||||| base\n\treturn x + 1\n=======\n\treturn x + 3\n>>>>>>> theirs\n}",
+		},
+		{
+			name:      "conflict followed by a statement",
+			base:      "func B() {\n\ta(1)\n\tb()\n}",
+			ours:      "func B() {\n\ta(2)\n\tb()\n}",
+			theirs:    "func B() {\n\ta(3)\n\tb()\n}",
+			conflicts: 1,
+			want:      "func B() {\n<<<<<<< ours\n\ta(2)\n||||||| base\n\ta(1)\n=======\n\ta(3)\n>>>>>>> theirs\n\tb()\n}",
+		},
+		{
+			name:   "no conflict",
+			base:   "func B() {\n\ta()\n\tb()\n\tc()\n}",
+			ours:   "func B() {\n\ta(1)\n\tb()\n\tc()\n}",
+			theirs: "func B() {\n\ta()\n\tb()\n\tc(3)\n}",
+			merged: true,
+			want:   "func B() {\n\ta(1)\n\tb()\n\tc(3)\n}",
+		},
+		{
+			name:   "one-line bodies without a conflict",
+			base:   "func A() int { return 1 }",
+			ours:   "func A() int { return 2 }",
+			theirs: "func A() int { return 1 }",
+			merged: true,
+			want:   "func A() int { return 2 }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			side := func(path, source string) *bodySide {
+				file := mustEditFile(t, path, "package p\n\n"+source+"\n")
+				return &bodySide{file: file, fn: file.file.Decls[0].(*ast.FuncDecl)}
+			}
+			result := mergeFunctionBodies(side("base.go", tt.base), side("ours.go", tt.ours), side("theirs.go", tt.theirs))
+			if result.Merged != tt.merged || len(result.Conflicts) != tt.conflicts {
+				t.Errorf("merged = %v with %d conflicts, want %v with %d", result.Merged, len(result.Conflicts), tt.merged, tt.conflicts)
+			}
+			if result.Source != tt.want {
+				t.Errorf("source =\n%s\nwant\n%s", result.Source, tt.want)
+			}
+			assertMarkerLines(t, result.Source)
+			if tt.merged {
+				if _, err := parser.ParseFile(token.NewFileSet(), "", "package p\n\n"+result.Source, 0); err != nil {
+					t.Errorf("merged source does not parse: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+)
+
+// Config is the go_parser configuration file, passed with --config
+type Config struct {
+	Budgets  *SizeBudgets   `json:"budgets"`
+	Licenses *LicensePolicy `json:"licenses"`
+}
+
+// SizeBudgets are the code-size limits generated code must stay within. A
+// zero limit is not checked.
+type SizeBudgets struct {
+	MaxFunctionLines int `json:"max_function_lines"`
+	MaxFileLines     int `json:"max_file_lines"`
+	MaxParameters    int `json:"max_parameters"`
+	MaxNesting       int `json:"max_nesting"`
+}
+
+// BudgetViolation is one limit exceeded. Rule is the SizeBudgets field name;
+// Symbol is empty for file-level rules.
+type BudgetViolation struct {
+	Rule    string `json:"rule"`
+	Symbol  string `json:"symbol,omitempty"`
+	Line    int    `json:"line"`
+	EndLine int    `json:"end_line"`
+	Value   int    `json:"value"`
+	Limit   int    `json:"limit"`
+	Message string `json:"message"`
+
+	span SourceSpan
+}
+
+// loadConfig reads a configuration file, rejecting unknown settings so that
+// a misspelled budget is not silently ignored
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	config := &Config{}
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// checkBudgets measures file against budgets
+func checkBudgets(fset *token.FileSet, file *ast.File, budgets *SizeBudgets) []BudgetViolation {
+	violations := []BudgetViolation{}
+	check := func(rule, symbol string, span SourceSpan, value, limit int, what string) {
+		if limit <= 0 || value <= limit {
+			return
+		}
+		subject := "file"
+		if symbol != "" {
+			subject = symbol
+		}
+		violations = append(violations, BudgetViolation{
+			Rule:    rule,
+			Symbol:  symbol,
+			Line:    span.Line,
+			EndLine: span.EndLine,
+			Value:   value,
+			Limit:   limit,
+			Message: fmt.Sprintf("%s has %d %s, over the budget of %d", subject, value, what, limit),
+			span:    span,
+		})
+	}
+
+	lines := fset.File(file.Pos()).LineCount()
+	check("max_file_lines", "", SourceSpan{Line: 1, EndLine: lines}, lines, budgets.MaxFileLines, "lines")
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		span := sourceSpan(fset, fn)
+		name := symbolName(fn)
+		check("max_function_lines", name, span, span.EndLine-span.Line+1, budgets.MaxFunctionLines, "lines")
+		check("max_parameters", name, span, parameterCount(fn.Type), budgets.MaxParameters, "parameters")
+		if fn.Body != nil {
+			check("max_nesting", name, span, nestingDepth(fn.Body), budgets.MaxNesting, "levels of nesting")
+		}
+	}
+	return violations
+}
+
+// parameterCount counts a function's parameters, a variadic one included
+func parameterCount(fn *ast.FuncType) int {
+	count := 0
+	for _, field := range fn.Params.List {
+		count += max(1, len(field.Names))
+	}
+	return count
+}
+
+// nestingDepth returns the deepest nesting of control statements in body.
+// An else-if continues its if statement rather than nesting inside it, and
+// function literals count as a level.
+func nestingDepth(body *ast.BlockStmt) int {
+	deepest := 0
+	var visit func(n ast.Node, depth int)
+	visit = func(n ast.Node, depth int) {
+		ast.Inspect(n, func(child ast.Node) bool {
+			if child == nil || child == n {
+				return true
+			}
+			switch node := child.(type) {
+			case *ast.IfStmt:
+				for node != nil {
+					deepest = max(deepest, depth+1)
+					visit(node.Body, depth+1)
+					switch els := node.Else.(type) {
+					case *ast.IfStmt:
+						node = els
+						continue
+					case *ast.BlockStmt:
+						visit(els, depth+1)
+					}
+					node = nil
+				}
+				return false
+			case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt, *ast.FuncLit:
+				deepest = max(deepest, depth+1)
+				visit(node, depth+1)
+				return false
+			}
+			return true
+		})
+	}
+	visit(body, 0)
+	return deepest
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// buildCallGraph maps each function and method the file declares, methods
+// as Type.Method, to the ones of the file it calls or refers to, in its body
+// and function literals, so the helpers a function needs can travel with
+// it. Functions resolve by the file scope; a method called on the caller's
+// own receiver resolves to its receiver type's, and any other selector to
+// every method of that name the file declares.
+func buildCallGraph(file *ast.File) map[string][]string {
+	graph := map[string][]string{}
+	methodsByName := map[string][]string{}
+	declared := map[string]bool{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Name.Name == "_" {
+			continue
+		}
+		name := symbolName(fn)
+		declared[name] = true
+		graph[name] = []string{}
+		if fn.Recv != nil {
+			methodsByName[fn.Name.Name] = append(methodsByName[fn.Name.Name], name)
+		}
+	}
+
+	qualifiers := map[string]bool{}
+	for _, imp := range file.Imports {
+		info := importInfo{path: strings.Trim(imp.Path.Value, `"`)}
+		if imp.Name != nil {
+			info.name = imp.Name.Name
+		}
+		qualifiers[info.localName()] = true
+	}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil || fn.Name.Name == "_" {
+			continue
+		}
+		caller := symbolName(fn)
+		receiver, recvVar := receiverTypeName(fn), receiverVarName(fn)
+		calls := map[string]bool{}
+		for _, callee := range graph[caller] {
+			calls[callee] = true
+		}
+
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch expr := n.(type) {
+			case *ast.SelectorExpr:
+				x, isIdent := expr.X.(*ast.Ident)
+				switch {
+				case isIdent && x.Obj == nil && qualifiers[x.Name]:
+					return false
+				case isIdent && recvVar != "" && x.Name == recvVar && declared[receiver+"."+expr.Sel.Name]:
+					calls[receiver+"."+expr.Sel.Name] = true
+				case isIdent && declared[x.Name+"."+expr.Sel.Name]:
+					// A method expression such as T.Method
+					calls[x.Name+"."+expr.Sel.Name] = true
+				default:
+					for _, method := range methodsByName[expr.Sel.Name] {
+						calls[method] = true
+					}
+				}
+				ast.Inspect(expr.X, func(n ast.Node) bool {
+					if ident, ok := n.(*ast.Ident); ok && localFunc(file, ident) {
+						calls[ident.Name] = true
+					}
+					return true
+				})
+				return false
+			case *ast.Ident:
+				if localFunc(file, expr) {
+					calls[expr.Name] = true
+				}
+			}
+			return true
+		})
+
+		graph[caller] = sortedKeys(calls)
+	}
+	return graph
+}
+
+// localFunc reports whether ident refers to a function the file declares
+func localFunc(file *ast.File, ident *ast.Ident) bool {
+	obj := file.Scope.Lookup(ident.Name)
+	return obj != nil && obj == ident.Obj && obj.Kind == ast.Fun
+}
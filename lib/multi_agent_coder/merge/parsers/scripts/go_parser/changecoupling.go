@@ -0,0 +1,386 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChangeCoupling relates candidate file versions that only compile when
+// applied together. Groups partitions the candidates into the sets a merge
+// planner should apply atomically; a candidate coupled to nothing is a group
+// of its own.
+type ChangeCoupling struct {
+	Candidates []CandidateChange `json:"candidates"`
+	Couplings  []ChangeDepend    `json:"couplings"`
+	Groups     [][]string        `json:"groups"`
+	Errors     []FileError       `json:"errors"`
+}
+
+// CandidateChange is the package-level names a candidate adds to and removes
+// from its file, compared with the file on disk
+type CandidateChange struct {
+	Path    string   `json:"path"`
+	Package string   `json:"package"`
+	New     bool     `json:"new"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// ChangeDepend says From cannot be applied without To. Reason is
+// requires_added when From uses names only To declares, drops_used when From
+// removes names only To's current version uses, and moves when From takes
+// over declarations To removes.
+type ChangeDepend struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Reason  string   `json:"reason"`
+	Symbols []string `json:"symbols"`
+}
+
+func runChangeCoupling(args []string) int {
+	stdinFiles := false
+
+	flags := flag.NewFlagSet("change-coupling", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.BoolVar(&stdinFiles, "stdin-files", false, "read the candidates from stdin as a JSON list of {path, content} objects")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	files := []sourceFile{}
+	if stdinFiles {
+		if len(positional) > 0 {
+			return fail("--stdin-files takes no arguments")
+		}
+		if files, err = readSourceFiles(os.Stdin); err != nil {
+			return fail("Invalid stdin payload: %v", err)
+		}
+	}
+	for _, arg := range positional {
+		target, candidate, ok := strings.Cut(arg, "=")
+		if !ok {
+			return fail("Expected target.go=candidate.go, got %s", arg)
+		}
+		content, err := os.ReadFile(candidate)
+		if err != nil {
+			return fail("Failed to read candidate: %v", err)
+		}
+		files = append(files, sourceFile{Path: target, Content: string(content)})
+	}
+	if len(files) == 0 {
+		return fail("No candidates given")
+	}
+
+	return printJSON(coupleChanges(files))
+}
+
+// changeSide is one candidate: its file as it is on disk, if it exists, and
+// as proposed
+type changeSide struct {
+	path       string
+	dir        string
+	importPath string
+	base       *ast.File
+	next       *ast.File
+}
+
+// changedPackage collects the declarations of one package before and after
+// the candidates are applied, by the file declaring them
+type changedPackage struct {
+	before map[string][]string
+	after  map[string][]string
+}
+
+// coupleChanges compares each package the candidates touch as it is on disk
+// with how it would be after applying all of them, and couples a candidate
+// to the others it needs to keep the package, and its importers among the
+// candidates, compiling.
+func coupleChanges(files []sourceFile) *ChangeCoupling {
+	report := &ChangeCoupling{Candidates: []CandidateChange{}, Couplings: []ChangeDepend{}, Groups: [][]string{}, Errors: []FileError{}}
+	fset := token.NewFileSet()
+
+	sides := []*changeSide{}
+	byPath := map[string]*changeSide{}
+	for _, file := range files {
+		path := filepath.Clean(file.Path)
+		next, err := parser.ParseFile(fset, path, file.Content, parser.SkipObjectResolution)
+		if err != nil {
+			report.Errors = append(report.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+		side := &changeSide{path: path, dir: filepath.Dir(path), next: next}
+		if _, err := os.Stat(path); err == nil {
+			if side.base, err = parser.ParseFile(fset, path, nil, parser.SkipObjectResolution); err != nil {
+				report.Errors = append(report.Errors, FileError{Path: path, Error: err.Error()})
+			}
+		}
+		root, modulePath, _ := findModule(side.dir)
+		side.importPath = packageImportPath(root, modulePath, side.dir)
+		sides = append(sides, side)
+		byPath[path] = side
+	}
+
+	// Declarations per package, keyed by directory and package name
+	packages := map[string]*changedPackage{}
+	packageKey := func(dir string, file *ast.File) string {
+		return dir + "|" + file.Name.Name
+	}
+	pkgOf := func(key string) *changedPackage {
+		if packages[key] == nil {
+			packages[key] = &changedPackage{before: map[string][]string{}, after: map[string][]string{}}
+		}
+		return packages[key]
+	}
+	loaded := map[string]bool{}
+	for _, side := range sides {
+		if loaded[side.dir] {
+			continue
+		}
+		loaded[side.dir] = true
+		paths, _ := filepath.Glob(filepath.Join(side.dir, "*.go"))
+		for _, path := range paths {
+			path = filepath.Clean(path)
+			if byPath[path] != nil {
+				continue
+			}
+			file, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+			if err != nil {
+				continue
+			}
+			pkg := pkgOf(packageKey(side.dir, file))
+			for name := range packageDecls(file) {
+				pkg.before[name] = append(pkg.before[name], path)
+				pkg.after[name] = append(pkg.after[name], path)
+			}
+		}
+	}
+	for _, side := range sides {
+		if side.base != nil {
+			pkg := pkgOf(packageKey(side.dir, side.base))
+			for name := range packageDecls(side.base) {
+				pkg.before[name] = append(pkg.before[name], side.path)
+			}
+		}
+		pkg := pkgOf(packageKey(side.dir, side.next))
+		for name := range packageDecls(side.next) {
+			pkg.after[name] = append(pkg.after[name], side.path)
+		}
+	}
+
+	// Dependencies between candidates, with the names behind each
+	links := map[[3]string]map[string]bool{}
+	link := func(from, to, reason, name string) {
+		if from == to {
+			return
+		}
+		key := [3]string{from, to, reason}
+		if links[key] == nil {
+			links[key] = map[string]bool{}
+		}
+		links[key][name] = true
+	}
+	// provider returns the candidate that alone declares name after the
+	// change, when nothing declared it before
+	provider := func(pkg *changedPackage, name string) string {
+		if pkg == nil || len(pkg.before[name]) > 0 || len(pkg.after[name]) != 1 || byPath[pkg.after[name][0]] == nil {
+			return ""
+		}
+		return pkg.after[name][0]
+	}
+
+	for _, side := range sides {
+		change := CandidateChange{Path: side.path, Package: side.importPath, New: side.base == nil, Added: []string{}, Removed: []string{}}
+		nextDecls := packageDecls(side.next)
+		baseDecls := map[string]bool{}
+		if side.base != nil {
+			baseDecls = packageDecls(side.base)
+		}
+		for _, name := range sortedKeys(nextDecls) {
+			if !baseDecls[name] {
+				change.Added = append(change.Added, name)
+			}
+		}
+		for _, name := range sortedKeys(baseDecls) {
+			if !nextDecls[name] {
+				change.Removed = append(change.Removed, name)
+			}
+		}
+		report.Candidates = append(report.Candidates, change)
+
+		own := packages[packageKey(side.dir, side.next)]
+		for name := range packageUses(side.next) {
+			if to := provider(own, name); to != "" {
+				link(side.path, to, "requires_added", name)
+			}
+		}
+		for importPath, names := range qualifiedUses(side.next) {
+			for _, other := range sides {
+				if other.importPath != importPath || strings.HasSuffix(other.next.Name.Name, "_test") {
+					continue
+				}
+				for name := range names {
+					if to := provider(packages[packageKey(other.dir, other.next)], name); to != "" {
+						link(side.path, to, "requires_added", name)
+					}
+				}
+			}
+		}
+
+		if side.base == nil {
+			continue
+		}
+		basePkg := packages[packageKey(side.dir, side.base)]
+		for _, name := range change.Removed {
+			// Moved to another candidate of the package
+			if after := basePkg.after[name]; len(after) == 1 && byPath[after[0]] != nil {
+				link(after[0], side.path, "moves", name)
+				continue
+			}
+			if len(basePkg.after[name]) > 0 {
+				continue
+			}
+			for _, other := range sides {
+				if other == side || other.base == nil || packageKey(other.dir, other.base) != packageKey(side.dir, side.base) {
+					continue
+				}
+				if packageUses(other.base)[name] && !packageUses(other.next)[name] {
+					link(side.path, other.path, "drops_used", name)
+				}
+			}
+		}
+	}
+
+	keys := make([][3]string, 0, len(links))
+	for key := range links {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		for k := 0; k < 3; k++ {
+			if keys[i][k] != keys[j][k] {
+				return keys[i][k] < keys[j][k]
+			}
+		}
+		return false
+	})
+
+	// Candidates linked in either direction go in the same group
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(path string) string {
+		if parent[path] == "" || parent[path] == path {
+			return path
+		}
+		parent[path] = find(parent[path])
+		return parent[path]
+	}
+	for _, key := range keys {
+		report.Couplings = append(report.Couplings, ChangeDepend{From: key[0], To: key[1], Reason: key[2], Symbols: sortedKeys(links[key])})
+		if a, b := find(key[0]), find(key[1]); a != b {
+			parent[a] = b
+		}
+	}
+
+	groups := map[string][]string{}
+	for _, side := range sides {
+		root := find(side.path)
+		groups[root] = append(groups[root], side.path)
+	}
+	for _, group := range groups {
+		sort.Strings(group)
+		report.Groups = append(report.Groups, group)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		return report.Groups[i][0] < report.Groups[j][0]
+	})
+	return report
+}
+
+// packageDecls returns the package-level names a file declares, methods as
+// Type.Method
+func packageDecls(file *ast.File) map[string]bool {
+	names := map[string]bool{}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Name.Name != "init" && decl.Name.Name != "_" {
+				names[symbolName(decl)] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names[spec.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						if name.Name != "_" {
+							names[name.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// packageUses returns the unqualified identifiers of a file that may refer
+// to package-level names. Local names are included too; they only matter
+// when the package declares the same name.
+func packageUses(file *ast.File) map[string]bool {
+	names := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.SelectorExpr:
+			ast.Inspect(node.X, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok {
+					names[ident.Name] = true
+				}
+				return true
+			})
+			return false
+		case *ast.Ident:
+			names[node.Name] = true
+		}
+		return true
+	})
+	return names
+}
+
+// qualifiedUses returns the names a file uses from each package it imports
+func qualifiedUses(file *ast.File) map[string]map[string]bool {
+	local := map[string]string{}
+	for _, imp := range file.Imports {
+		info := importInfo{path: strings.Trim(imp.Path.Value, `"`)}
+		if imp.Name != nil {
+			info.name = imp.Name.Name
+		}
+		local[info.localName()] = info.path
+	}
+
+	uses := map[string]map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && local[x.Name] != "" {
+			path := local[x.Name]
+			if uses[path] == nil {
+				uses[path] = map[string]bool{}
+			}
+			uses[path][sel.Sel.Name] = true
+		}
+		return true
+	})
+	return uses
+}
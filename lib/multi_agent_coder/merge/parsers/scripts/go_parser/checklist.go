@@ -0,0 +1,243 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ReviewChecklist is what the person approving a merge should look at, from
+// the difference between the tree before and after it: conflict markers left
+// behind, new dependencies, new side effects, changes to the exported API
+// and new or rewritten functions no test reaches. Items are grouped by
+// category in that order; Summary is describe-change's subject line.
+type ReviewChecklist struct {
+	Summary string          `json:"summary"`
+	Items   []ChecklistItem `json:"items"`
+	Errors  []FileError     `json:"errors"`
+}
+
+// ChecklistItem is one thing to check. Category is conflict_markers,
+// new_dependency, new_side_effect, api_change or untested; Symbol is set for
+// items about a declaration.
+type ChecklistItem struct {
+	Category string `json:"category"`
+	File     string `json:"file,omitempty"`
+	Symbol   string `json:"symbol,omitempty"`
+	Message  string `json:"message"`
+}
+
+// checklistCategories orders the items and titles their sections when
+// rendered
+var checklistCategories = []struct{ name, title string }{
+	{"conflict_markers", "Unresolved conflicts"},
+	{"new_dependency", "New dependencies"},
+	{"new_side_effect", "New side effects"},
+	{"api_change", "API changes"},
+	{"untested", "Untested functions"},
+}
+
+func runChecklist(args []string) int {
+	format := "json"
+	strict := false
+
+	flags := flag.NewFlagSet("checklist", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&format, "format", "json", "output format: json or markdown")
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if format != "json" && format != "markdown" {
+		return fail("Invalid format: %s", format)
+	}
+	if len(positional) != 2 {
+		return fail("Usage: checklist old/ new/, or two files")
+	}
+
+	checklist, err := buildChecklist(positional[0], positional[1])
+	if err != nil {
+		return fail("Checklist failed: %v", err)
+	}
+	if err := strictFailure(checklist.Errors, strict); err != nil {
+		return fail("Checklist failed: %v", err)
+	}
+
+	if format == "markdown" {
+		fmt.Print(checklist.markdown())
+		return 0
+	}
+	return printJSON(checklist)
+}
+
+// buildChecklist derives the items from describeChange's comparison of the
+// two trees, the conflict markers and go.mod of the new one and its test map
+func buildChecklist(oldRoot, newRoot string) (*ReviewChecklist, error) {
+	description, err := describeChange(oldRoot, newRoot)
+	if err != nil {
+		return nil, err
+	}
+	checklist := &ReviewChecklist{Items: []ChecklistItem{}, Errors: description.Errors}
+	add := func(category, file, symbol, message string) {
+		checklist.Items = append(checklist.Items, ChecklistItem{Category: category, File: file, Symbol: symbol, Message: message})
+	}
+
+	newFiles, err := changeTreeFiles(newRoot)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for path := range newFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	// Files with markers do not parse, so they are found by reading them
+	for _, path := range paths {
+		content, err := os.ReadFile(newFiles[path])
+		if err == nil && hasConflictMarkers(string(content)) {
+			add("conflict_markers", path, "", fmt.Sprintf("%s still has merge conflict markers", path))
+		}
+	}
+
+	for _, note := range description.Notes {
+		switch note.Kind {
+		case "import_added":
+			if strings.HasSuffix(note.File, "_test.go") {
+				continue
+			}
+			add("new_dependency", note.File, "", fmt.Sprintf("%s now imports %s", note.File, note.Effect))
+		case "effect_added":
+			add("new_side_effect", note.File, note.Symbol, note.Note)
+		}
+	}
+	for _, requirement := range changedRequirements(oldRoot, newRoot) {
+		add("new_dependency", "go.mod", "", requirement)
+	}
+
+	for _, symbol := range description.Symbols {
+		if !symbol.Exported || strings.HasSuffix(symbol.File, "_test.go") {
+			continue
+		}
+		switch {
+		case symbol.Change == "added":
+			add("api_change", symbol.File, symbol.Name, fmt.Sprintf("new exported %s %s", symbol.Kind, symbol.Name))
+		case symbol.Change == "removed":
+			add("api_change", symbol.File, symbol.Name, fmt.Sprintf("exported %s %s was removed, which breaks its callers", symbol.Kind, symbol.Name))
+		case contains(symbol.Aspects, "signature") || contains(symbol.Aspects, "definition"):
+			add("api_change", symbol.File, symbol.Name, fmt.Sprintf("exported %s %s has a new %s", symbol.Kind, symbol.Name, aspectNoun(symbol.Kind)))
+		}
+	}
+
+	treeDir := newRoot
+	if info, err := os.Stat(newRoot); err == nil && !info.IsDir() {
+		treeDir = filepath.Dir(newRoot)
+	}
+	untested, err := untestedFunctions(treeDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, symbol := range description.Symbols {
+		if symbol.Kind != "func" && symbol.Kind != "method" {
+			continue
+		}
+		if symbol.Change != "added" && !contains(symbol.Aspects, "body") {
+			continue
+		}
+		if untested[filepath.Join(treeDir, filepath.Dir(symbol.File))+"\x00"+symbol.Name] {
+			state := "rewritten"
+			if symbol.Change == "added" {
+				state = "new"
+			}
+			add("untested", symbol.File, symbol.Name, fmt.Sprintf("%s is %s and no test reaches it", symbol.Name, state))
+		}
+	}
+
+	rank := map[string]int{}
+	for i, category := range checklistCategories {
+		rank[category.name] = i
+	}
+	sort.SliceStable(checklist.Items, func(i, j int) bool {
+		return rank[checklist.Items[i].Category] < rank[checklist.Items[j].Category]
+	})
+	checklist.Summary = description.Summary
+	return checklist, nil
+}
+
+// changedRequirements words the modules the new go.mod requires that the old
+// one did not, or at another version; there are none unless both roots are
+// module directories
+func changedRequirements(oldRoot, newRoot string) []string {
+	before, err := readModuleRequires(filepath.Join(oldRoot, "go.mod"))
+	if err != nil {
+		return nil
+	}
+	after, err := readModuleRequires(filepath.Join(newRoot, "go.mod"))
+	if err != nil {
+		return nil
+	}
+	modules := []string{}
+	for module := range after {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+
+	requirements := []string{}
+	for _, module := range modules {
+		old, ok := before[module]
+		switch {
+		case !ok:
+			requirements = append(requirements, fmt.Sprintf("requires %s %s", module, after[module]))
+		case old != after[module]:
+			requirements = append(requirements, fmt.Sprintf("requires %s %s instead of %s", module, after[module], old))
+		}
+	}
+	return requirements
+}
+
+// untestedFunctions indexes the functions under dir that no test reaches by
+// their directory and name
+func untestedFunctions(dir string) (map[string]bool, error) {
+	testMap, err := buildTestMap([]string{filepath.Join(dir, "...")})
+	if err != nil {
+		return nil, err
+	}
+	untested := map[string]bool{}
+	for _, pkg := range testMap.Packages {
+		for _, name := range pkg.Untested {
+			untested[filepath.Clean(pkg.Dir)+"\x00"+name] = true
+		}
+	}
+	return untested, nil
+}
+
+// markdown renders the checklist as task lists under a heading per category
+func (c *ReviewChecklist) markdown() string {
+	var b strings.Builder
+	b.WriteString("## Review checklist\n\n")
+	b.WriteString(c.Summary + "\n")
+	for _, category := range checklistCategories {
+		started := false
+		for _, item := range c.Items {
+			if item.Category != category.name {
+				continue
+			}
+			if !started {
+				fmt.Fprintf(&b, "\n### %s\n\n", category.title)
+				started = true
+			}
+			fmt.Fprintf(&b, "- [ ] %s\n", item.Message)
+		}
+	}
+	if len(c.Errors) > 0 {
+		b.WriteString("\n### Files that could not be analyzed\n\n")
+		for _, e := range c.Errors {
+			fmt.Fprintf(&b, "- [ ] %s: %s\n", e.Path, e.Error)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChurnInfo reports how often a file and its functions changed within the
+// history window
+type ChurnInfo struct {
+	Window    string          `json:"window"`
+	Since     string          `json:"since"`
+	File      FileChurn       `json:"file"`
+	Functions []FunctionChurn `json:"functions"`
+}
+
+// FileChurn summarizes the commits touching a file
+type FileChurn struct {
+	Commits      int `json:"commits"`
+	Authors      int `json:"authors"`
+	LinesAdded   int `json:"lines_added"`
+	LinesDeleted int `json:"lines_deleted"`
+}
+
+// FunctionChurn counts the commits touching a function's current lines,
+// traced back through history with git log -L
+type FunctionChurn struct {
+	Name     string  `json:"name"`
+	Receiver *string `json:"receiver,omitempty"`
+	Commits  int     `json:"commits"`
+}
+
+// parseWindow accepts Go durations plus day ("30d") and week ("12w") units
+func parseWindow(window string) (time.Duration, error) {
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+
+	if n := len(window); n > 1 {
+		if unit, ok := units[window[n-1]]; ok {
+			count, err := strconv.Atoi(window[:n-1])
+			if err != nil || count <= 0 {
+				return 0, fmt.Errorf("invalid window %q", window)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid window %q", window)
+	}
+	return duration, nil
+}
+
+// annotateChurn adds the churn section for path over the given window
+func annotateChurn(result *Result, path, window string) error {
+	duration, err := parseWindow(window)
+	if err != nil {
+		return err
+	}
+	since := time.Now().Add(-duration)
+
+	fileChurn, err := computeFileChurn(path, since)
+	if err != nil {
+		return err
+	}
+
+	churn := &ChurnInfo{
+		Window:    window,
+		Since:     since.UTC().Format(time.RFC3339),
+		File:      fileChurn,
+		Functions: []FunctionChurn{},
+	}
+
+	for _, fn := range result.Functions {
+		commits := 0
+		if fileChurn.Commits > 0 {
+			commits, err = computeLineRangeChurn(path, fn.SourceSpan, since)
+			if err != nil {
+				return err
+			}
+		}
+		churn.Functions = append(churn.Functions, FunctionChurn{
+			Name:     fn.Name,
+			Receiver: fn.Receiver,
+			Commits:  commits,
+		})
+	}
+
+	result.Churn = churn
+	return nil
+}
+
+func computeFileChurn(path string, since time.Time) (FileChurn, error) {
+	churn := FileChurn{}
+
+	output, err := runGit(path, "log", "--since="+since.Format(time.RFC3339),
+		"--format=commit%x09%H%x09%ae", "--numstat", "--", filepath.Base(path))
+	if err != nil {
+		return churn, err
+	}
+
+	authors := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		switch {
+		case len(fields) == 3 && fields[0] == "commit":
+			churn.Commits++
+			authors[fields[2]] = true
+		case len(fields) == 3:
+			// numstat reports "-" for binary changes
+			added, _ := strconv.Atoi(fields[0])
+			deleted, _ := strconv.Atoi(fields[1])
+			churn.LinesAdded += added
+			churn.LinesDeleted += deleted
+		}
+	}
+	churn.Authors = len(authors)
+
+	return churn, nil
+}
+
+// computeLineRangeChurn counts the commits since the given time that touched
+// the lines in span, following them through earlier revisions of the file
+func computeLineRangeChurn(path string, span SourceSpan, since time.Time) (int, error) {
+	if span.Line <= 0 {
+		return 0, nil
+	}
+
+	output, err := runGit(path, "log", "--since="+since.Format(time.RFC3339),
+		"--format=commit%x09%H",
+		fmt.Sprintf("-L%d,%d:%s", span.Line, span.EndLine, filepath.Base(path)))
+	if err != nil {
+		// The range does not exist in the committed file, so as far as
+		// history is concerned these lines are new
+		return 0, nil
+	}
+
+	commits := 0
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "commit\t") {
+			commits++
+		}
+	}
+	return commits, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Ownership is the CODEOWNERS rule that applies to a file. Path is the file
+// relative to the repository root; an unowned file has no owners and no
+// pattern.
+type Ownership struct {
+	Path    string   `json:"path"`
+	Owners  []string `json:"owners"`
+	Pattern string   `json:"pattern,omitempty"`
+	Line    int      `json:"line,omitempty"`
+}
+
+// CodeOwners is a parsed CODEOWNERS file. root is the repository root the
+// patterns are relative to.
+type CodeOwners struct {
+	root  string
+	rules []codeOwnersRule
+}
+
+type codeOwnersRule struct {
+	pattern string
+	owners  []string
+	line    int
+	match   *regexp.Regexp
+}
+
+// loadCodeOwners reads a CODEOWNERS file in GitHub syntax. The repository
+// root is the file's directory, or its parent when the file is in .github or
+// docs.
+func loadCodeOwners(path string) (*CodeOwners, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Dir(abs)
+	if base := filepath.Base(root); base == ".github" || base == "docs" {
+		root = filepath.Dir(root)
+	}
+
+	owners := &CodeOwners{root: root}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		// Comments, and GitLab section headers, which carry no pattern
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[") {
+			continue
+		}
+
+		rule := codeOwnersRule{pattern: fields[0], owners: []string{}, line: line}
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "#") {
+				break
+			}
+			rule.owners = append(rule.owners, owner)
+		}
+		if rule.match, err = compileCodeOwnersPattern(rule.pattern); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		owners.rules = append(owners.rules, rule)
+	}
+	return owners, scanner.Err()
+}
+
+// compileCodeOwnersPattern translates a gitignore-style pattern: a leading or
+// inner slash anchors it at the root, a trailing slash matches only
+// directories, * stays within a path segment and ** spans segments. Patterns
+// naming a directory also match everything below it.
+func compileCodeOwnersPattern(pattern string) (*regexp.Regexp, error) {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	trimmed := strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(trimmed, "/")
+	trimmed = strings.TrimPrefix(trimmed, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(trimmed); i++ {
+		switch rest := trimmed[i:]; {
+		case strings.HasPrefix(rest, "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(rest, "**"):
+			b.WriteString(".*")
+			i++
+		case rest[0] == '*':
+			b.WriteString("[^/]*")
+		case rest[0] == '?':
+			b.WriteString("[^/]")
+		case rest[0] == '\\' && len(rest) > 1:
+			b.WriteString(regexp.QuoteMeta(rest[1:2]))
+			i++
+		default:
+			b.WriteString(regexp.QuoteMeta(rest[:1]))
+		}
+	}
+	if dirOnly {
+		b.WriteString("/.*$")
+	} else {
+		b.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(b.String())
+}
+
+// owner returns the ownership of path. As on GitHub, the last matching rule
+// wins.
+func (c *CodeOwners) owner(path string) *Ownership {
+	rel := filepath.ToSlash(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		if r, err := filepath.Rel(c.root, abs); err == nil && !strings.HasPrefix(r, "..") {
+			rel = filepath.ToSlash(r)
+		}
+	}
+
+	ownership := &Ownership{Path: rel, Owners: []string{}}
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if rule := c.rules[i]; rule.match.MatchString(rel) {
+			ownership.Owners, ownership.Pattern, ownership.Line = rule.owners, rule.pattern, rule.line
+			break
+		}
+	}
+	return ownership
+}
+
+// annotateOwnership adds the ownership section for path and copies its
+// owners onto every function and type, so that symbols can be routed
+// without looking the file up again
+func annotateOwnership(result *Result, path string, owners *CodeOwners) {
+	result.Ownership = owners.owner(path)
+	for i := range result.Functions {
+		result.Functions[i].Owners = result.Ownership.Owners
+	}
+	for i := range result.Structs {
+		result.Structs[i].Owners = result.Ownership.Owners
+	}
+	for i := range result.Interfaces {
+		result.Interfaces[i].Owners = result.Ownership.Owners
+	}
+}
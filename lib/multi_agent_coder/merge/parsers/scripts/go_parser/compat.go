@@ -0,0 +1,130 @@
+package main
+
+// compatOutputs registers, per --compat mode, the legacy output of each
+// command that has one
+var compatOutputs = map[string]map[string]interface{}{
+	"v1": {"parse": ResultV1{}},
+}
+
+// ResultV1 is the original parse output: the symbol lists, dependencies,
+// side effects and complexity, without any of the later sections. It keeps
+// its own types so later changes to Result cannot leak into it.
+type ResultV1 struct {
+	Functions    []FunctionInfoV1   `json:"functions"`
+	Structs      []TypeInfoV1       `json:"structs"`
+	Interfaces   []TypeInfoV1       `json:"interfaces"`
+	Imports      []string           `json:"imports"`
+	Dependencies []DependencyInfoV1 `json:"dependencies"`
+	SideEffects  []string           `json:"side_effects"`
+	Complexity   int                `json:"complexity"`
+}
+
+// FunctionInfoV1 is a function in the v1 shape, with parameters as names
+type FunctionInfoV1 struct {
+	Name     string   `json:"name"`
+	Arity    int      `json:"arity"`
+	Params   []string `json:"params"`
+	Exported bool     `json:"exported"`
+	Receiver *string  `json:"receiver,omitempty"`
+}
+
+// TypeInfoV1 is a struct or interface in the v1 shape
+type TypeInfoV1 struct {
+	Name     string   `json:"name"`
+	Exported bool     `json:"exported"`
+	Kind     string   `json:"kind"`
+	Fields   []string `json:"fields,omitempty"`
+	Methods  []string `json:"methods,omitempty"`
+}
+
+// DependencyInfoV1 is a function call in the v1 shape
+type DependencyInfoV1 struct {
+	Function string  `json:"function"`
+	Package  *string `json:"package,omitempty"`
+}
+
+// compatOutput converts result to the shape selected by mode; "" keeps the
+// current shape
+func compatOutput(result *Result, mode string) interface{} {
+	if mode == "v1" {
+		return resultV1(result)
+	}
+	return result
+}
+
+func resultV1(result *Result) *ResultV1 {
+	v1 := &ResultV1{
+		Functions:    []FunctionInfoV1{},
+		Structs:      typesV1(result.Structs),
+		Interfaces:   typesV1(result.Interfaces),
+		Imports:      result.Imports,
+		Dependencies: []DependencyInfoV1{},
+		SideEffects:  sideEffectsV1(result.SideEffects),
+		Complexity:   result.Complexity,
+	}
+	for _, fn := range result.Functions {
+		v1.Functions = append(v1.Functions, FunctionInfoV1{
+			Name:     fn.Name,
+			Arity:    fn.Arity,
+			Params:   paramsV1(fn.Params),
+			Exported: fn.Exported,
+			Receiver: fn.Receiver,
+		})
+	}
+	for _, dep := range result.Dependencies {
+		v1.Dependencies = append(v1.Dependencies, DependencyInfoV1{Function: dep.Function, Package: dep.Package})
+	}
+	return v1
+}
+
+// fieldsV1 gives the names of the fields, leaving out embedded ones as v1
+// did
+func fieldsV1(fields []FieldInfo) []string {
+	v1 := []string{}
+	for _, field := range fields {
+		if !field.Embedded {
+			v1 = append(v1, field.Name)
+		}
+	}
+	return v1
+}
+
+// paramsV1 gives each parameter's name, or its type when it has none
+func paramsV1(params []ParamInfo) []string {
+	v1 := []string{}
+	for _, param := range params {
+		if param.Name != "" {
+			v1 = append(v1, param.Name)
+		} else {
+			v1 = append(v1, param.Type)
+		}
+	}
+	return v1
+}
+
+func typesV1(infos []TypeInfo) []TypeInfoV1 {
+	v1 := []TypeInfoV1{}
+	for _, info := range infos {
+		v1 = append(v1, TypeInfoV1{
+			Name:     info.Name,
+			Exported: info.Exported,
+			Kind:     info.Kind,
+			Fields:   fieldsV1(info.Fields),
+			Methods:  info.Methods,
+		})
+	}
+	return v1
+}
+
+// sideEffectsV1 folds the side effect categories into v1's single
+// "io_operation", which covered the file and console calls. v1 did not
+// detect network calls, so they are left out rather than reported as I/O.
+func sideEffectsV1(categories []string) []string {
+	effects := []string{}
+	for _, category := range categories {
+		if category == "filesystem" || category == "console" {
+			return append(effects, "io_operation")
+		}
+	}
+	return effects
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCompatV1Golden compares --compat v1 with the output of the original
+// parser, saved next to each file in testdata/compat
+func TestCompatV1Golden(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "compat", "*.go"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no golden files: %v", err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden, err := os.ReadFile(strings.TrimSuffix(path, ".go") + ".v1.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want bytes.Buffer
+			if err := json.Compact(&want, golden); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := analyzeSource(path, content, defaultOptions())
+			if err != nil {
+				t.Fatalf("analyzeSource: %v", err)
+			}
+			got, err := json.Marshal(compatOutput(result, "v1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want.Bytes()) {
+				t.Errorf("v1 output differs from the original parser's\n got: %s\nwant: %s", got, want.Bytes())
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// complexityIncrement returns how much a node adds to cyclomatic complexity
+func complexityIncrement(n ast.Node) int {
+	switch node := n.(type) {
+	case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt:
+		return 1
+
+	case *ast.CaseClause:
+		if len(node.List) > 0 {
+			return 1
+		}
+
+	case *ast.BinaryExpr:
+		if node.Op == token.LAND || node.Op == token.LOR {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// functionComplexity computes the cyclomatic complexity of a single function,
+// counting the same constructs as the file-wide total
+func functionComplexity(fn *ast.FuncDecl) int {
+	complexity := 1
+	if fn.Body != nil {
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			complexity += complexityIncrement(n)
+			return true
+		})
+	}
+	return complexity
+}
+
+// cognitiveComplexity scores how hard a function is to follow, after
+// SonarSource's cognitive complexity: each break in the linear flow (if,
+// else, switch, select, loop, goto, labeled branch) costs one plus its
+// nesting depth, except else and else-if which cost one; each run of the
+// same boolean operator costs one; and a direct recursive call costs one.
+// Function literals deepen the nesting without costing anything themselves.
+func cognitiveComplexity(fn *ast.FuncDecl) int {
+	if fn.Body == nil {
+		return 0
+	}
+
+	total := 0
+	chained := map[ast.Expr]bool{}
+	var visit func(n ast.Node, nesting int)
+	visitIf := func(stmt *ast.IfStmt, nesting int) {
+		total += 1 + nesting
+		for {
+			visit(stmt.Init, nesting)
+			visit(stmt.Cond, nesting)
+			visit(stmt.Body, nesting+1)
+			switch els := stmt.Else.(type) {
+			case *ast.IfStmt:
+				total++
+				stmt = els
+				continue
+			case *ast.BlockStmt:
+				total++
+				visit(els, nesting+1)
+			}
+			return
+		}
+	}
+
+	visit = func(n ast.Node, nesting int) {
+		if n == nil {
+			return
+		}
+		ast.Inspect(n, func(child ast.Node) bool {
+			switch node := child.(type) {
+			case *ast.IfStmt:
+				visitIf(node, nesting)
+				return false
+			case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+				total += 1 + nesting
+				ast.Inspect(node, func(part ast.Node) bool {
+					if part != nil && part != node {
+						visit(part, nesting+1)
+						return false
+					}
+					return true
+				})
+				return false
+			case *ast.FuncLit:
+				visit(node.Body, nesting+1)
+				return false
+			case *ast.BranchStmt:
+				if node.Tok == token.GOTO || node.Label != nil {
+					total++
+				}
+			case *ast.BinaryExpr:
+				if (node.Op == token.LAND || node.Op == token.LOR) && !chained[node] {
+					total += booleanSequences(node, chained)
+				}
+			case *ast.CallExpr:
+				if ident, ok := node.Fun.(*ast.Ident); ok && fn.Recv == nil && ident.Name == fn.Name.Name {
+					total++
+				}
+			}
+			return true
+		})
+	}
+
+	visit(fn.Body, 0)
+	return total
+}
+
+// booleanSequences counts the runs of like operators in a chain of && and
+// ||, so a && b && c costs one and a && b || c two. The chain's inner
+// operators are added to chained so that they are not counted again.
+func booleanSequences(expr ast.Expr, chained map[ast.Expr]bool) int {
+	ops := []token.Token{}
+	var flatten func(e ast.Expr)
+	flatten = func(e ast.Expr) {
+		e = ast.Unparen(e)
+		if bin, ok := e.(*ast.BinaryExpr); ok && (bin.Op == token.LAND || bin.Op == token.LOR) {
+			chained[bin] = true
+			flatten(bin.X)
+			ops = append(ops, bin.Op)
+			flatten(bin.Y)
+		}
+	}
+	flatten(expr)
+
+	sequences := 0
+	for i, op := range ops {
+		if i == 0 || op != ops[i-1] {
+			sequences++
+		}
+	}
+	return sequences
+}
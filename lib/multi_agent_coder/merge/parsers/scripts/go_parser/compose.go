@@ -0,0 +1,446 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ComposeResult is a file composed from the declarations of several
+// candidates, with the origin of each declaration. Provenance is the sidecar
+// the origins were written to and ProvenanceDB the store they were recorded
+// in, if any.
+type ComposeResult struct {
+	Package      string              `json:"package"`
+	Candidates   []ComposeCandidate  `json:"candidates"`
+	Declarations []DeclarationOrigin `json:"declarations"`
+	Conflicts    []ComposeConflict   `json:"conflicts"`
+	Imports      []string            `json:"imports"`
+	Output       string              `json:"output,omitempty"`
+	Written      bool                `json:"written"`
+	Provenance   string              `json:"provenance,omitempty"`
+	ProvenanceDB string              `json:"provenance_db,omitempty"`
+	Source       string              `json:"source,omitempty"`
+}
+
+// ComposeCandidate is a candidate file and the name its declarations are
+// attributed to, such as the provider that wrote it
+type ComposeCandidate struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// DeclarationOrigin records which candidate contributed a declaration of the
+// composed file. Lines are those of the composed file, doc comment included;
+// Hash identifies the declaration's code, ignoring formatting and comments;
+// IDs are the persistent IDs of its symbols, in the order of Symbols.
+type DeclarationOrigin struct {
+	Symbols   []string `json:"symbols"`
+	IDs       []string `json:"ids"`
+	Kind      string   `json:"kind"`
+	Candidate string   `json:"candidate"`
+	StartLine int      `json:"start_line"`
+	EndLine   int      `json:"end_line"`
+	Hash      string   `json:"hash"`
+}
+
+// ProvenanceSidecar is the JSON written next to a composed file by
+// --provenance, so later queries can attribute its code to a candidate
+// without the origins being written into the source
+type ProvenanceSidecar struct {
+	File         string              `json:"file"`
+	Candidates   []ComposeCandidate  `json:"candidates"`
+	Declarations []DeclarationOrigin `json:"declarations"`
+}
+
+// composeUnit is a top-level declaration of a candidate with the names it
+// declares. specs are the names of each spec of a parenthesized group.
+type composeUnit struct {
+	candidate int
+	decl      ast.Decl
+	names     []string
+	specs     [][]string
+	// Specs of the group kept, when it is split
+	kept []int
+}
+
+// originDirective prefixes the origin comments of --origin-comments. As a
+// directive it is left out of the declaration's documentation.
+const originDirective = "//origin:candidate "
+
+func runCompose(args []string) int {
+	var outputPath, provenancePath, dbPath, task string
+	var picks stringList
+	comments, dryRun := false, false
+
+	flags := flag.NewFlagSet("compose", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.Var(&picks, "pick", "take a symbol from a candidate instead of the first that declares it, as Symbol=name (repeatable)")
+	flags.StringVar(&outputPath, "o", "", "write the composed file here")
+	flags.StringVar(&provenancePath, "provenance", "", "write the declarations' origins to this JSON sidecar")
+	flags.BoolVar(&comments, "origin-comments", false, "also mark each declaration's origin with a "+strings.TrimSpace(originDirective)+" comment")
+	flags.StringVar(&dbPath, "provenance-db", "", "append the declarations' origins to this provenance store")
+	flags.StringVar(&task, "task", "", "task ID to record in the provenance store")
+	flags.BoolVar(&dryRun, "dry-run", false, "do not write; the composed source is returned in the output")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(positional) < 1 {
+		return fail("Usage: compose [--pick Symbol=name ...] [-o out.go] [--provenance out.json] [--origin-comments] [--provenance-db store.jsonl [--task id]] [--dry-run] [name=]candidate.go ...")
+	}
+
+	candidates, files, err := loadCandidates(positional)
+	if err != nil {
+		return fail("Failed to load %v", err)
+	}
+
+	chosen := map[string]int{}
+	for _, pick := range picks {
+		symbol, name, ok := strings.Cut(pick, "=")
+		index := -1
+		for i, candidate := range candidates {
+			if candidate.Name == name {
+				index = i
+			}
+		}
+		if !ok || index < 0 {
+			return fail("Invalid --pick %s: expected Symbol=name of a candidate", pick)
+		}
+		chosen[normalizeSymbolName(symbol)] = index
+	}
+
+	result, err := composeCandidates(candidates, files, chosen, comments)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	dir := ""
+	if outputPath != "" {
+		dir = filepath.Dir(outputPath)
+	}
+	if composed, err := parseEditSource(outputPath, result.Source); err == nil {
+		rankConflicts(result.Conflicts, composed, dir, outputPath)
+	}
+
+	if outputPath != "" && !dryRun {
+		if err := os.WriteFile(outputPath, []byte(result.Source), 0644); err != nil {
+			return fail("Failed to write %s: %v", outputPath, err)
+		}
+		result.Output, result.Written = outputPath, true
+	}
+	if provenancePath != "" {
+		sidecar := ProvenanceSidecar{File: result.Output, Candidates: result.Candidates, Declarations: result.Declarations}
+		data, err := json.MarshalIndent(sidecar, "", "  ")
+		if err != nil {
+			return fail("Failed to encode provenance: %v", err)
+		}
+		if err := os.WriteFile(provenancePath, append(data, '\n'), 0644); err != nil {
+			return fail("Failed to write %s: %v", provenancePath, err)
+		}
+		result.Provenance = provenancePath
+	}
+	// Only a merge that was written is recorded
+	if dbPath != "" && result.Written {
+		if err := recordProvenance(dbPath, result, task); err != nil {
+			return fail("Failed to record provenance: %v", err)
+		}
+		result.ProvenanceDB = dbPath
+	}
+	if result.Written {
+		result.Source = ""
+	}
+	return printJSON(result)
+}
+
+// loadCandidates loads candidate files given as name=path, or as a path
+// named after the file
+func loadCandidates(args []string) ([]ComposeCandidate, []*editFile, error) {
+	candidates := []ComposeCandidate{}
+	files := []*editFile{}
+	for _, arg := range args {
+		candidate := ComposeCandidate{Path: arg}
+		if name, path, ok := strings.Cut(arg, "="); ok {
+			candidate = ComposeCandidate{Name: name, Path: path}
+		} else {
+			candidate.Name = strings.TrimSuffix(filepath.Base(arg), ".go")
+		}
+		file, err := loadSnippet(candidate.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", candidate.Path, err)
+		}
+		candidates = append(candidates, candidate)
+		files = append(files, file)
+	}
+	return candidates, files, nil
+}
+
+// composeCandidates builds a file of every top-level declaration of the
+// candidates, each symbol taken from the candidate chosen for it or else
+// from the first that declares it. Declarations keep the order in which the
+// candidates first declare them, and the imports are those the declarations
+// use, plus the blank imports of the contributing candidates. The package
+// and the comments ahead of it are the first candidate's.
+func composeCandidates(candidates []ComposeCandidate, files []*editFile, chosen map[string]int, comments bool) (*ComposeResult, error) {
+	declared := map[string]map[int]bool{}
+	// The hash of each candidate's code for a name, to tell conflicts
+	versions := map[string]map[int]string{}
+	picked := map[string]bool{}
+	for name := range chosen {
+		picked[name] = true
+	}
+	order := map[string]int{}
+	units := []composeUnit{}
+	for i, file := range files {
+		for _, decl := range file.file.Decls {
+			unit := composeUnit{candidate: i, decl: decl}
+			if gen, ok := decl.(*ast.GenDecl); ok {
+				if gen.Tok == token.IMPORT {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					unit.specs = append(unit.specs, specNames(spec))
+					unit.names = append(unit.names, specNames(spec)...)
+					for _, name := range specNames(spec) {
+						recordVersion(versions, name, i, declHash(file, spec))
+					}
+				}
+			} else {
+				unit.names = []string{symbolName(decl.(*ast.FuncDecl))}
+				recordVersion(versions, unit.names[0], i, declHash(file, decl))
+			}
+			for _, name := range unit.names {
+				if _, ok := order[name]; !ok {
+					order[name] = len(order)
+					declared[name] = map[int]bool{}
+				}
+				declared[name][i] = true
+			}
+			units = append(units, unit)
+		}
+	}
+
+	for name, i := range chosen {
+		if !declared[name][i] {
+			return nil, fmt.Errorf("%s does not declare %s", candidates[i].Name, name)
+		}
+	}
+	for name, from := range declared {
+		if _, ok := chosen[name]; !ok {
+			for i := range files {
+				if from[i] {
+					chosen[name] = i
+					break
+				}
+			}
+		}
+	}
+
+	// A group keeps the specs whose names are taken from its candidate. A
+	// spec is taken whole, and a group of constants that repeat the previous
+	// value is not split, since that would renumber its iota.
+	kept := []composeUnit{}
+	for _, unit := range units {
+		if len(unit.specs) == 0 {
+			if chosen[unit.names[0]] == unit.candidate {
+				kept = append(kept, unit)
+			}
+			continue
+		}
+		for j, names := range unit.specs {
+			from := map[int]bool{}
+			for _, name := range names {
+				from[chosen[name]] = true
+			}
+			if len(from) > 1 {
+				return nil, fmt.Errorf("%s are declared together in %s and cannot come from different candidates", strings.Join(names, ", "), candidates[unit.candidate].Name)
+			}
+			if from[unit.candidate] {
+				unit.kept = append(unit.kept, j)
+			}
+		}
+		if len(unit.kept) == 0 {
+			continue
+		}
+		if len(unit.kept) < len(unit.specs) && repeatsValues(unit.decl.(*ast.GenDecl)) {
+			return nil, fmt.Errorf("the constants %s of %s share an iota sequence and cannot come from different candidates", strings.Join(unit.names, ", "), candidates[unit.candidate].Name)
+		}
+		kept = append(kept, unit)
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("the candidates have no declarations")
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return order[kept[i].names[0]] < order[kept[j].names[0]] })
+
+	imports := map[string]bool{}
+	contributing := map[int]bool{}
+	for _, unit := range kept {
+		contributing[unit.candidate] = true
+		for _, imp := range requiredImports(files[unit.candidate].file, unit.decl) {
+			imports[imp.spec()] = true
+		}
+	}
+	for i := range contributing {
+		for _, imp := range files[i].file.Imports {
+			if imp.Name != nil && imp.Name.Name == "_" {
+				imports[importInfo{name: "_", path: strings.Trim(imp.Path.Value, `"`)}.spec()] = true
+			}
+		}
+	}
+	specs := sortedKeys(imports)
+
+	first := files[0]
+	var b strings.Builder
+	b.WriteString(first.source[:first.offset(first.file.Package)])
+	b.WriteString("package " + first.file.Name.Name + "\n")
+	if len(specs) > 0 {
+		b.WriteString("\n" + importGroup(groupImportSpecs(specs)) + "\n")
+	}
+	for _, unit := range kept {
+		b.WriteString("\n")
+		if comments {
+			b.WriteString(originDirective + candidates[unit.candidate].Name + "\n")
+		}
+		b.WriteString(unit.text(files[unit.candidate]) + "\n")
+	}
+
+	formatted, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("composed file does not parse: %v", err)
+	}
+	composed, err := parseEditSource("", string(formatted))
+	if err != nil {
+		return nil, fmt.Errorf("composed file does not parse: %v", err)
+	}
+
+	result := &ComposeResult{
+		Package:      first.file.Name.Name,
+		Candidates:   candidates,
+		Declarations: []DeclarationOrigin{},
+		Conflicts:    composeConflicts(candidates, versions, chosen, picked, order),
+		Imports:      specs,
+		Source:       composed.source,
+	}
+	decls := []ast.Decl{}
+	for _, decl := range composed.file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); !ok || gen.Tok != token.IMPORT {
+			decls = append(decls, decl)
+		}
+	}
+	ids := symbolIDsByName(composed.fset, composed.file)
+	// Each unit was written as one declaration, in order
+	for i, unit := range kept {
+		decl := decls[i]
+		start := decl.Pos()
+		if doc := declDoc(decl); doc != nil {
+			start = doc.Pos()
+		}
+		symbols := unit.keptNames()
+		declIDs := []string{}
+		for _, name := range symbols {
+			declIDs = append(declIDs, ids[name])
+		}
+		result.Declarations = append(result.Declarations, DeclarationOrigin{
+			Symbols:   symbols,
+			IDs:       declIDs,
+			Kind:      declKind(decl),
+			Candidate: candidates[unit.candidate].Name,
+			StartLine: composed.fset.Position(start).Line,
+			EndLine:   composed.fset.Position(decl.End()).Line,
+			Hash:      declHash(composed, decl),
+		})
+	}
+	return result, nil
+}
+
+// declHash identifies a declaration by its code, formatted and without its
+// comments, so the same declaration hashes the same in every file
+func declHash(file *editFile, node ast.Node) string {
+	sum := sha256.Sum256([]byte(formatNode(file.fset, withoutDocs(node))))
+	return hex.EncodeToString(sum[:8])
+}
+
+// text is the unit's declaration as written, with its doc comment, and with
+// only the kept specs of a split group
+func (u composeUnit) text(file *editFile) string {
+	start := file.offset(u.decl.Pos())
+	if doc := declDoc(u.decl); doc != nil {
+		start = file.offset(doc.Pos())
+	}
+	gen, ok := u.decl.(*ast.GenDecl)
+	if !ok || len(u.kept) == len(u.specs) {
+		return file.source[start:file.offset(u.decl.End())]
+	}
+
+	var b strings.Builder
+	b.WriteString(file.source[start:file.offset(gen.Lparen)] + "(\n")
+	for _, j := range u.kept {
+		spec := gen.Specs[j]
+		from := file.offset(spec.Pos())
+		if doc := specDoc(spec); doc != nil {
+			from = file.offset(doc.Pos())
+		}
+		end := spec.End()
+		if comment := specComment(spec); comment != nil {
+			end = comment.End()
+		}
+		b.WriteString("\t" + file.source[from:file.offset(end)] + "\n")
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+func (u composeUnit) keptNames() []string {
+	if len(u.specs) == 0 {
+		return u.names
+	}
+	names := []string{}
+	for _, j := range u.kept {
+		names = append(names, u.specs[j]...)
+	}
+	return names
+}
+
+func specComment(spec ast.Spec) *ast.CommentGroup {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Comment
+	case *ast.ValueSpec:
+		return s.Comment
+	}
+	return nil
+}
+
+// repeatsValues reports whether a constant group has specs that repeat the
+// previous spec's values
+func repeatsValues(gen *ast.GenDecl) bool {
+	if gen.Tok != token.CONST {
+		return false
+	}
+	for _, spec := range gen.Specs {
+		if value, ok := spec.(*ast.ValueSpec); ok && len(value.Values) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func declKind(decl ast.Decl) string {
+	if fn, ok := decl.(*ast.FuncDecl); ok {
+		if fn.Recv != nil {
+			return "method"
+		}
+		return "func"
+	}
+	return strings.ToLower(decl.(*ast.GenDecl).Tok.String())
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"go/ast"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ComposeConflict is a symbol the candidates declare differently, so the
+// version compose took was a decision: Candidates are those that declare
+// it, Versions how many different ones they have, and Chosen the one taken,
+// by --pick when Picked is set. Conflicts are ranked by Risk, the blast
+// radius of taking the wrong version: the symbol's FanIn, its references
+// in the composed file and the other files of the output's package, plus 3
+// when it is Exported and 2 when no test of the package refers to it, since
+// nothing would catch the mistake. Tests lists those that do.
+type ComposeConflict struct {
+	Symbol     string   `json:"symbol"`
+	Kind       string   `json:"kind"`
+	Candidates []string `json:"candidates"`
+	Versions   int      `json:"versions"`
+	Chosen     string   `json:"chosen"`
+	Picked     bool     `json:"picked,omitempty"`
+	Exported   bool     `json:"exported"`
+	FanIn      int      `json:"fan_in"`
+	Tests      []string `json:"tests"`
+	Risk       int      `json:"risk"`
+}
+
+func recordVersion(versions map[string]map[int]string, name string, candidate int, hash string) {
+	if versions[name] == nil {
+		versions[name] = map[int]string{}
+	}
+	// A candidate declaring a name twice keeps its first version, as compose
+	// takes it
+	if _, ok := versions[name][candidate]; !ok {
+		versions[name][candidate] = hash
+	}
+}
+
+// composeConflicts lists the names declared by several candidates in more
+// than one version, in declaration order; rankConflicts fills in their
+// blast radius
+func composeConflicts(candidates []ComposeCandidate, versions map[string]map[int]string, chosen map[string]int, picked map[string]bool, order map[string]int) []ComposeConflict {
+	conflicts := []ComposeConflict{}
+	for name, byCandidate := range versions {
+		distinct := map[string]bool{}
+		declaring := []int{}
+		for i, hash := range byCandidate {
+			distinct[hash] = true
+			declaring = append(declaring, i)
+		}
+		if len(distinct) < 2 {
+			continue
+		}
+		sort.Ints(declaring)
+		conflict := ComposeConflict{Symbol: name, Candidates: []string{}, Versions: len(distinct), Chosen: candidates[chosen[name]].Name, Picked: picked[name], Exported: symbolExported(name), Tests: []string{}}
+		for _, i := range declaring {
+			conflict.Candidates = append(conflict.Candidates, candidates[i].Name)
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return order[conflicts[i].Symbol] < order[conflicts[j].Symbol] })
+	return conflicts
+}
+
+// rankConflicts counts the references to each conflicting symbol in the
+// composed file and, when dir is set, the other files of its package, finds
+// the tests there that refer to it, and orders the conflicts riskiest first
+func rankConflicts(conflicts []ComposeConflict, composed *editFile, dir, output string) {
+	if len(conflicts) == 0 {
+		return
+	}
+	files := []*ast.File{composed.file}
+	tests := []*ast.File{}
+	if dir != "" {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for _, path := range paths {
+			if same, _ := sameFile(path, output); same {
+				continue
+			}
+			file, err := loadEditFile(path)
+			if err != nil {
+				continue
+			}
+			if strings.HasSuffix(path, "_test.go") {
+				tests = append(tests, file.file)
+			} else {
+				files = append(files, file.file)
+			}
+		}
+	}
+
+	for i := range conflicts {
+		conflict := &conflicts[i]
+		if decl := findSymbol(composed.file, conflict.Symbol); decl != nil {
+			conflict.Kind = decl.kind
+		}
+		for _, file := range files {
+			conflict.FanIn += countReferences(file, conflict.Symbol)
+		}
+		for _, file := range tests {
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if ok && isTestFunc(fn) && countReferences(fn, conflict.Symbol) > 0 {
+					conflict.Tests = append(conflict.Tests, fn.Name.Name)
+				}
+			}
+		}
+		conflict.Risk = conflict.FanIn
+		if conflict.Exported {
+			conflict.Risk += 3
+		}
+		if len(conflict.Tests) == 0 {
+			conflict.Risk += 2
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool { return conflicts[i].Risk > conflicts[j].Risk })
+}
+
+// countReferences counts the uses of a top-level name under node, other than
+// its declaration: identifiers for functions, types and values, selectors
+// for methods, named T.M
+func countReferences(node ast.Node, name string) int {
+	member := ""
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		member = name[i+1:]
+	}
+	count := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			// The declaration's own name is not a use
+			if n.Body != nil {
+				ast.Inspect(n.Body, func(inner ast.Node) bool {
+					count += referenceAt(inner, name, member)
+					return true
+				})
+			}
+			if n.Recv != nil {
+				count += countReferences(n.Recv, name)
+			}
+			count += countReferences(n.Type, name)
+			return false
+		case *ast.TypeSpec:
+			count += countReferences(n.Type, name)
+			return false
+		case *ast.ValueSpec:
+			if n.Type != nil {
+				count += countReferences(n.Type, name)
+			}
+			for _, value := range n.Values {
+				count += countReferences(value, name)
+			}
+			return false
+		}
+		count += referenceAt(n, name, member)
+		return true
+	})
+	return count
+}
+
+func referenceAt(n ast.Node, name, member string) int {
+	if member != "" {
+		if sel, ok := n.(*ast.SelectorExpr); ok && sel.Sel.Name == member {
+			return 1
+		}
+		return 0
+	}
+	if ident, ok := n.(*ast.Ident); ok && ident.Name == name {
+		return 1
+	}
+	return 0
+}
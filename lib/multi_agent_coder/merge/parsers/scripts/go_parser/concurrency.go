@@ -0,0 +1,109 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// ConcurrencyInfo counts the concurrency constructs of a function, including
+// those in its function literals. Sync lists the synchronization types and
+// functions it refers to, qualified by their package's name whatever it is
+// imported as, as in "sync.WaitGroup" or "atomic.AddInt64".
+type ConcurrencyInfo struct {
+	Goroutines int      `json:"goroutines"`
+	Sends      int      `json:"sends"`
+	Receives   int      `json:"receives"`
+	Selects    int      `json:"selects"`
+	Channels   int      `json:"channels"`
+	Locks      int      `json:"locks"`
+	Sync       []string `json:"sync"`
+}
+
+// syncPackages are the packages whose types and functions synchronize
+// goroutines
+var syncPackages = map[string]bool{
+	"sync":                               true,
+	"sync/atomic":                        true,
+	"golang.org/x/sync/errgroup":         true,
+	"golang.org/x/sync/semaphore":        true,
+	"golang.org/x/sync/singleflight":     true,
+	"golang.org/x/sync/syncmap":          true,
+	"github.com/sourcegraph/conc":        true,
+	"github.com/sourcegraph/conc/pool":   true,
+	"github.com/sourcegraph/conc/stream": true,
+}
+
+// syncImportNames maps the local names of the file's imports of
+// syncPackages to the packages' own names
+func syncImportNames(file *ast.File) map[string]string {
+	names := map[string]string{}
+	for _, imp := range file.Imports {
+		info := importInfo{path: strings.Trim(imp.Path.Value, `"`)}
+		if imp.Name != nil {
+			info.name = imp.Name.Name
+		}
+		if syncPackages[info.path] {
+			names[info.localName()] = importInfo{path: info.path}.localName()
+		}
+	}
+	return names
+}
+
+// functionConcurrency reports the goroutines a function starts, its channel
+// operations, the channels it makes and its Lock and RLock calls, which are
+// counted by name since the mutex is often a field declared elsewhere. It
+// returns nil for a function that uses none of them.
+func functionConcurrency(fn *ast.FuncDecl, syncNames map[string]string) *ConcurrencyInfo {
+	if fn.Body == nil {
+		return nil
+	}
+
+	info := &ConcurrencyInfo{}
+	sync := map[string]bool{}
+	ast.Inspect(fn, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.GoStmt:
+			info.Goroutines++
+		case *ast.SendStmt:
+			info.Sends++
+		case *ast.UnaryExpr:
+			if node.Op == token.ARROW {
+				info.Receives++
+			}
+		case *ast.SelectStmt:
+			info.Selects++
+		case *ast.CallExpr:
+			switch fun := node.Fun.(type) {
+			case *ast.Ident:
+				if fun.Name == "make" && fun.Obj == nil && len(node.Args) > 0 {
+					if _, ok := node.Args[0].(*ast.ChanType); ok {
+						info.Channels++
+					}
+				}
+			case *ast.SelectorExpr:
+				if (fun.Sel.Name == "Lock" || fun.Sel.Name == "RLock") && len(node.Args) == 0 {
+					info.Locks++
+				}
+			}
+		case *ast.SelectorExpr:
+			if pkg, ok := node.X.(*ast.Ident); ok && pkg.Obj == nil && syncNames[pkg.Name] != "" {
+				sync[syncNames[pkg.Name]+"."+node.Sel.Name] = true
+			}
+		}
+		return true
+	})
+
+	for name := range sync {
+		info.Sync = append(info.Sync, name)
+	}
+	if info.Goroutines+info.Sends+info.Receives+info.Selects+info.Channels+info.Locks+len(info.Sync) == 0 {
+		return nil
+	}
+	if info.Sync == nil {
+		info.Sync = []string{}
+	}
+	sort.Strings(info.Sync)
+	return info
+}
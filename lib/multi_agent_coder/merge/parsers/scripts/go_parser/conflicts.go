@@ -0,0 +1,323 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// ConflictRegion is a single <<<<<<< / ======= / >>>>>>> block found in the
+// input, with the declarations each side contributes to it
+type ConflictRegion struct {
+	StartLine   int              `json:"start_line"`
+	EndLine     int              `json:"end_line"`
+	OursLabel   string           `json:"ours_label"`
+	TheirsLabel string           `json:"theirs_label"`
+	BaseLabel   string           `json:"base_label,omitempty"`
+	Ours        ConflictSide     `json:"ours"`
+	Theirs      ConflictSide     `json:"theirs"`
+	Base        *ConflictSide    `json:"base,omitempty"`
+	Symbols     []ConflictSymbol `json:"symbols"`
+}
+
+// ConflictSide holds the text of one side of a conflict region and the
+// declarations overlapping it once that side is applied to the whole file
+type ConflictSide struct {
+	Source       string   `json:"source"`
+	Declarations []string `json:"declarations"`
+	ParseError   string   `json:"parse_error,omitempty"`
+}
+
+// ConflictSymbol compares a declaration across both sides of a region.
+// Status is identical, modified, ours_only or theirs_only.
+type ConflictSymbol struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Status string `json:"status"`
+}
+
+// conflictBlock is a parsed marker block with the raw lines of each side
+type conflictBlock struct {
+	startLine int
+	endLine   int
+	labels    [3]string
+	sides     [3][]string
+	hasBase   bool
+}
+
+const (
+	sideOurs = iota
+	sideTheirs
+	sideBase
+)
+
+// hasConflictMarkers reports whether content contains a complete marker block
+func hasConflictMarkers(content string) bool {
+	_, blocks := splitConflictBlocks(content)
+	return len(blocks) > 0
+}
+
+// resolveConflicts analyzes every conflict block in content and returns the
+// file with all blocks resolved to "ours", for the main analysis, together
+// with the per-region breakdown
+func resolveConflicts(content string) (string, []ConflictRegion) {
+	segments, blocks := splitConflictBlocks(content)
+
+	ours := newSideVersion(segments, blocks, sideOurs)
+	theirs := newSideVersion(segments, blocks, sideTheirs)
+
+	var base *sideVersion
+	for _, block := range blocks {
+		if block.hasBase {
+			base = newSideVersion(segments, blocks, sideBase)
+			break
+		}
+	}
+
+	regions := []ConflictRegion{}
+	for i, block := range blocks {
+		region := ConflictRegion{
+			StartLine:   block.startLine,
+			EndLine:     block.endLine,
+			OursLabel:   block.labels[sideOurs],
+			TheirsLabel: block.labels[sideTheirs],
+			Ours:        ours.side(i),
+			Theirs:      theirs.side(i),
+		}
+		if block.hasBase && base != nil {
+			region.BaseLabel = block.labels[sideBase]
+			baseSide := base.side(i)
+			region.Base = &baseSide
+		}
+		region.Symbols = compareConflictSides(ours.declsIn(i), theirs.declsIn(i))
+		regions = append(regions, region)
+	}
+
+	return ours.source, regions
+}
+
+// splitConflictBlocks separates content into the plain segments between
+// blocks and the blocks themselves; len(segments) == len(blocks)+1
+func splitConflictBlocks(content string) ([]string, []conflictBlock) {
+	lines := strings.SplitAfter(content, "\n")
+	segments := []string{}
+	blocks := []conflictBlock{}
+
+	var plain strings.Builder
+	var current *conflictBlock
+	side := sideOurs
+
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case current == nil && strings.HasPrefix(trimmed, "<<<<<<<"):
+			current = &conflictBlock{startLine: i + 1}
+			current.labels[sideOurs] = markerLabel(trimmed)
+			side = sideOurs
+
+		case current != nil && strings.HasPrefix(trimmed, "|||||||"):
+			current.labels[sideBase] = markerLabel(trimmed)
+			current.hasBase = true
+			side = sideBase
+
+		case current != nil && trimmed == "=======":
+			side = sideTheirs
+
+		case current != nil && strings.HasPrefix(trimmed, ">>>>>>>"):
+			current.labels[sideTheirs] = markerLabel(trimmed)
+			current.endLine = i + 1
+			segments = append(segments, plain.String())
+			plain.Reset()
+			blocks = append(blocks, *current)
+			current = nil
+
+		case current != nil:
+			current.sides[side] = append(current.sides[side], line)
+
+		default:
+			plain.WriteString(line)
+		}
+	}
+
+	// An unterminated block is left as plain text
+	if current != nil {
+		for _, side := range []int{sideOurs, sideBase, sideTheirs} {
+			for _, line := range current.sides[side] {
+				plain.WriteString(line)
+			}
+		}
+	}
+	segments = append(segments, plain.String())
+
+	return segments, blocks
+}
+
+func markerLabel(line string) string {
+	return strings.TrimSpace(strings.TrimLeft(line, "<|>"))
+}
+
+// sideVersion is the whole file with every block resolved to one side
+type sideVersion struct {
+	source   string
+	texts    []string
+	spans    []SourceSpan
+	fset     *token.FileSet
+	file     *ast.File
+	parseErr error
+}
+
+func newSideVersion(segments []string, blocks []conflictBlock, side int) *sideVersion {
+	v := &sideVersion{}
+
+	var b strings.Builder
+	line := 1
+	for i, segment := range segments {
+		b.WriteString(segment)
+		line += strings.Count(segment, "\n")
+		if i >= len(blocks) {
+			break
+		}
+
+		text := strings.Join(blocks[i].sides[side], "")
+		count := strings.Count(text, "\n")
+		v.texts = append(v.texts, text)
+		v.spans = append(v.spans, SourceSpan{Line: line, EndLine: line + count - 1})
+		b.WriteString(text)
+		line += count
+	}
+
+	v.source = b.String()
+	v.fset = token.NewFileSet()
+	v.file, v.parseErr = parser.ParseFile(v.fset, "", v.source, parser.ParseComments)
+	return v
+}
+
+func (v *sideVersion) side(i int) ConflictSide {
+	side := ConflictSide{
+		Source:       v.texts[i],
+		Declarations: []string{},
+	}
+	if v.parseErr != nil {
+		side.ParseError = v.parseErr.Error()
+		return side
+	}
+	for _, decl := range v.declsIn(i) {
+		side.Declarations = append(side.Declarations, decl.key)
+	}
+	return side
+}
+
+// conflictDecl is a declaration overlapping a region, with its source text
+// used to decide whether both sides agree
+type conflictDecl struct {
+	key  string
+	name string
+	kind string
+	text string
+}
+
+// declsIn returns the declarations of this version overlapping region i
+func (v *sideVersion) declsIn(i int) []conflictDecl {
+	decls := []conflictDecl{}
+	if v.parseErr != nil || v.file == nil {
+		return decls
+	}
+
+	span := v.spans[i]
+	overlaps := func(node ast.Node) bool {
+		start := v.fset.Position(node.Pos()).Line
+		end := v.fset.Position(node.End()).Line
+		return start <= span.EndLine && end >= span.Line
+	}
+	text := func(node ast.Node) string {
+		return v.source[v.fset.Position(node.Pos()).Offset:v.fset.Position(node.End()).Offset]
+	}
+
+	for _, decl := range v.file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !overlaps(d) {
+				continue
+			}
+			name, kind := d.Name.Name, "func"
+			if receiver := receiverTypeName(d); receiver != "" {
+				name, kind = receiver+"."+name, "method"
+			}
+			decls = append(decls, conflictDecl{key: kind + " " + name, name: name, kind: kind, text: text(d)})
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if !overlaps(spec) {
+					continue
+				}
+				kind := strings.ToLower(d.Tok.String())
+				for _, name := range specNames(spec) {
+					decls = append(decls, conflictDecl{key: kind + " " + name, name: name, kind: kind, text: text(spec)})
+				}
+			}
+		}
+	}
+
+	return decls
+}
+
+func specNames(spec ast.Spec) []string {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return []string{s.Name.Name}
+	case *ast.ValueSpec:
+		names := []string{}
+		for _, name := range s.Names {
+			names = append(names, name.Name)
+		}
+		return names
+	case *ast.ImportSpec:
+		return []string{strings.Trim(s.Path.Value, `"`)}
+	}
+	return nil
+}
+
+func compareConflictSides(ours, theirs []conflictDecl) []ConflictSymbol {
+	byKey := map[string]*[2]*conflictDecl{}
+	keys := []string{}
+
+	for idx, decls := range [][]conflictDecl{ours, theirs} {
+		for i := range decls {
+			decl := &decls[i]
+			if byKey[decl.key] == nil {
+				byKey[decl.key] = &[2]*conflictDecl{}
+				keys = append(keys, decl.key)
+			}
+			byKey[decl.key][idx] = decl
+		}
+	}
+	sort.Strings(keys)
+
+	symbols := []ConflictSymbol{}
+	for _, key := range keys {
+		pair := byKey[key]
+		decl := pair[0]
+		if decl == nil {
+			decl = pair[1]
+		}
+
+		status := "modified"
+		switch {
+		case pair[1] == nil:
+			status = "ours_only"
+		case pair[0] == nil:
+			status = "theirs_only"
+		case normalizeWhitespace(pair[0].text) == normalizeWhitespace(pair[1].text):
+			status = "identical"
+		}
+
+		symbols = append(symbols, ConflictSymbol{Name: decl.name, Kind: decl.kind, Status: status})
+	}
+	return symbols
+}
+
+func normalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
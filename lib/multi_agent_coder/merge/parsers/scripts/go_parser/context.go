@@ -0,0 +1,378 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ContextPack is the set of declarations to show a model alongside a target
+// file: what the target refers to in its own module and the interfaces its
+// types implement, cut down to fit a token budget
+type ContextPack struct {
+	Target       string            `json:"target"`
+	Tokenizer    string            `json:"tokenizer"`
+	Budget       int               `json:"budget"`
+	TargetTokens int               `json:"target_tokens"`
+	Used         int               `json:"used"`
+	Slices       []ContextSlice    `json:"slices"`
+	Omitted      []ContextOmission `json:"omitted"`
+}
+
+// ContextSlice is one declaration. Reason is referenced (References counts
+// the target's uses), method (a method of a relevant type the target calls
+// by name) or implements (an interface a type of the target satisfies). Form
+// is full, or signature when only a function's header and doc fit.
+type ContextSlice struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	File       string `json:"file"`
+	Package    string `json:"package"`
+	Reason     string `json:"reason"`
+	Form       string `json:"form"`
+	Line       int    `json:"line"`
+	EndLine    int    `json:"end_line"`
+	References int    `json:"references"`
+	Tokens     int    `json:"tokens"`
+	Source     string `json:"source"`
+}
+
+// ContextOmission is a relevant declaration that did not fit the budget
+type ContextOmission struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+	Tokens int    `json:"tokens"`
+}
+
+func runContext(args []string) int {
+	target := ""
+	budget := 8000
+	tokenizerName := defaultTokenizer
+
+	flags := flag.NewFlagSet("context", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&target, "target", "", "file the context is for")
+	flags.IntVar(&budget, "budget", 8000, "tokens the selected slices may use")
+	flags.StringVar(&tokenizerName, "tokenizer", defaultTokenizer, "heuristic to count tokens with: "+strings.Join(tokenizerNames(), ", "))
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if target == "" {
+		return fail("--target is required")
+	}
+	if _, ok := tokenizers[tokenizerName]; !ok {
+		return fail("Invalid tokenizer: %s", tokenizerName)
+	}
+
+	pack, err := packContext(target, budget, tokenizerName)
+	if err != nil {
+		return fail("Context failed: %v", err)
+	}
+	return printJSON(pack)
+}
+
+// contextCandidate is a declaration considered for the pack
+type contextCandidate struct {
+	decl       symbolDecl
+	file       *ast.File
+	pkg        string
+	reason     string
+	references int
+}
+
+// packContext ranks the candidates, references by use count first, then
+// methods and implemented interfaces, and adds each in full, or as a
+// signature, while the budget allows
+func packContext(target string, budget int, tokenizerName string) (*ContextPack, error) {
+	tokens := tokenizers[tokenizerName]
+	dir := filepath.Dir(target)
+	root, modulePath, err := findModule(dir)
+	if err != nil {
+		return nil, err
+	}
+	index := &repoIndex{root: root, fset: token.NewFileSet(), files: map[string]*indexedFile{}}
+	file, err := index.load(target)
+	if err != nil {
+		return nil, err
+	}
+	source, err := os.ReadFile(target)
+	if err != nil {
+		return nil, err
+	}
+
+	pack := &ContextPack{Target: target, Tokenizer: tokenizerName, Budget: budget, TargetTokens: tokens.count(string(source)), Slices: []ContextSlice{}, Omitted: []ContextOmission{}}
+
+	// Declarations of the target's package and of the module packages it
+	// imports, by package import path and name
+	decls := map[string]map[string]contextCandidate{}
+	addPackage := func(importPath string, files []*ast.File) {
+		if decls[importPath] != nil {
+			return
+		}
+		decls[importPath] = map[string]contextCandidate{}
+		testTarget := strings.HasSuffix(target, "_test.go")
+		for _, f := range files {
+			if f == file || (!testTarget && strings.HasSuffix(index.fset.Position(f.Package).Filename, "_test.go")) {
+				continue
+			}
+			for _, decl := range topLevelSymbols(f) {
+				decls[importPath][decl.name] = contextCandidate{decl: decl, file: f, pkg: importPath}
+			}
+		}
+	}
+	ownPath := packageImportPath(root, modulePath, dir)
+	addPackage(ownPath, index.packageFiles(dir, file.Name.Name))
+
+	qualifiers := map[string]string{}
+	for _, imp := range file.Imports {
+		info := importInfo{path: strings.Trim(imp.Path.Value, `"`)}
+		if imp.Name != nil {
+			info.name = imp.Name.Name
+		}
+		if modulePath == "" || (info.path != modulePath && !strings.HasPrefix(info.path, modulePath+"/")) {
+			continue
+		}
+		if _, files := index.importedPackage(packageSourceDir(info.path, dir)); files != nil {
+			addPackage(info.path, files)
+			qualifiers[info.localName()] = info.path
+		}
+	}
+
+	own := map[string]bool{}
+	for _, decl := range topLevelSymbols(file) {
+		own[decl.name] = true
+	}
+
+	counts := map[[2]string]int{}
+	selected := map[string]bool{}
+	selectors := map[*ast.Ident]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.SelectorExpr:
+			if x, ok := node.X.(*ast.Ident); ok && qualifiers[x.Name] != "" && x.Obj == nil {
+				counts[[2]string{qualifiers[x.Name], node.Sel.Name}]++
+				return false
+			}
+			selected[node.Sel.Name] = true
+			selectors[node.Sel] = true
+		case *ast.Ident:
+			if node.Obj == nil && !own[node.Name] && !selectors[node] && node != file.Name {
+				counts[[2]string{ownPath, node.Name}]++
+			}
+		}
+		return true
+	})
+
+	candidates := []contextCandidate{}
+	chosen := map[*ast.File]map[string]bool{}
+	choose := func(c contextCandidate) {
+		if chosen[c.file] == nil {
+			chosen[c.file] = map[string]bool{}
+		}
+		if !chosen[c.file][c.decl.name] {
+			chosen[c.file][c.decl.name] = true
+			candidates = append(candidates, c)
+		}
+	}
+
+	referenced := []contextCandidate{}
+	for key, count := range counts {
+		if c, ok := decls[key[0]][key[1]]; ok {
+			c.reason, c.references = "referenced", count
+			referenced = append(referenced, c)
+		}
+	}
+	sort.Slice(referenced, func(i, j int) bool {
+		if referenced[i].references != referenced[j].references {
+			return referenced[i].references > referenced[j].references
+		}
+		return referenced[i].decl.name < referenced[j].decl.name
+	})
+	for _, c := range referenced {
+		choose(c)
+	}
+
+	// Methods called by name on the referenced types and the target's own
+	relevantTypes := map[string]bool{}
+	for name := range own {
+		relevantTypes[name] = true
+	}
+	for _, c := range referenced {
+		if c.decl.kind == "type" {
+			relevantTypes[c.decl.name] = true
+		}
+	}
+	for _, importPath := range sortedDeclPackages(decls) {
+		for _, name := range sortedCandidateNames(decls[importPath]) {
+			c := decls[importPath][name]
+			owner, method, isMethod := strings.Cut(name, ".")
+			if isMethod && c.decl.kind == "method" && relevantTypes[owner] && selected[method] {
+				c.reason = "method"
+				choose(c)
+			}
+		}
+	}
+
+	// Interfaces whose methods the target's types all have, by name
+	methodSets := map[string]map[string]bool{}
+	addMethod := func(name string) {
+		if owner, method, ok := strings.Cut(name, "."); ok && own[owner] {
+			if methodSets[owner] == nil {
+				methodSets[owner] = map[string]bool{}
+			}
+			methodSets[owner][method] = true
+		}
+	}
+	for name := range own {
+		addMethod(name)
+	}
+	for name := range decls[ownPath] {
+		addMethod(name)
+	}
+	for _, importPath := range sortedDeclPackages(decls) {
+		for _, name := range sortedCandidateNames(decls[importPath]) {
+			c := decls[importPath][name]
+			methods := interfaceMethodNames(c.decl)
+			if len(methods) == 0 {
+				continue
+			}
+			for _, set := range methodSets {
+				if containsAll(set, methods) {
+					c.reason = "implements"
+					choose(c)
+					break
+				}
+			}
+		}
+	}
+
+	for _, c := range candidates {
+		slice := contextSlice(index.fset, c, tokens)
+		switch {
+		case pack.Used+slice.Tokens <= budget:
+		case c.decl.fn != nil && c.decl.fn.Body != nil:
+			slice = contextSignature(index.fset, c, slice, tokens)
+			if pack.Used+slice.Tokens <= budget {
+				break
+			}
+			fallthrough
+		default:
+			pack.Omitted = append(pack.Omitted, ContextOmission{Name: slice.Name, File: slice.File, Reason: slice.Reason, Tokens: slice.Tokens})
+			continue
+		}
+		pack.Used += slice.Tokens
+		pack.Slices = append(pack.Slices, slice)
+	}
+	return pack, nil
+}
+
+// contextSlice is the full text of a candidate, with its doc comment
+func contextSlice(fset *token.FileSet, c contextCandidate, tokens tokenizer) ContextSlice {
+	start := c.decl.node.Pos()
+	if c.decl.doc != nil {
+		start = c.decl.doc.Pos()
+	}
+	path := fset.Position(start).Filename
+	text := nodeSource(fset, path, start, c.decl.node.End())
+	return ContextSlice{
+		Name:       c.decl.name,
+		Kind:       c.decl.kind,
+		File:       path,
+		Package:    c.pkg,
+		Reason:     c.reason,
+		Form:       "full",
+		Line:       fset.Position(start).Line,
+		EndLine:    fset.Position(c.decl.node.End()).Line,
+		References: c.references,
+		Tokens:     tokens.count(text),
+		Source:     text,
+	}
+}
+
+// contextSignature cuts a function slice down to its doc comment and header
+func contextSignature(fset *token.FileSet, c contextCandidate, slice ContextSlice, tokens tokenizer) ContextSlice {
+	start := c.decl.node.Pos()
+	if c.decl.doc != nil {
+		start = c.decl.doc.Pos()
+	}
+	text := strings.TrimSpace(nodeSource(fset, slice.File, start, c.decl.fn.Body.Lbrace))
+	slice.Form = "signature"
+	slice.EndLine = fset.Position(c.decl.fn.Body.Lbrace).Line
+	slice.Source = text
+	slice.Tokens = tokens.count(text)
+	return slice
+}
+
+// nodeSource returns the bytes of path between two positions
+func nodeSource(fset *token.FileSet, path string, start, end token.Pos) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	from, to := fset.Position(start).Offset, fset.Position(end).Offset
+	if from < 0 || to > len(data) || from > to {
+		return ""
+	}
+	return string(data[from:to])
+}
+
+// interfaceMethodNames returns the explicit methods of an interface type
+// declaration, or nil for any other declaration
+func interfaceMethodNames(decl symbolDecl) []string {
+	var spec *ast.TypeSpec
+	switch node := decl.node.(type) {
+	case *ast.TypeSpec:
+		spec = node
+	case *ast.GenDecl:
+		spec, _ = node.Specs[0].(*ast.TypeSpec)
+	}
+	if spec == nil {
+		return nil
+	}
+	iface, ok := spec.Type.(*ast.InterfaceType)
+	if !ok {
+		return nil
+	}
+	names := []string{}
+	for _, field := range iface.Methods.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+func containsAll(set map[string]bool, names []string) bool {
+	for _, name := range names {
+		if !set[name] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedDeclPackages(decls map[string]map[string]contextCandidate) []string {
+	paths := make([]string, 0, len(decls))
+	for path := range decls {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func sortedCandidateNames(decls map[string]contextCandidate) []string {
+	names := make([]string, 0, len(decls))
+	for name := range decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,731 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FunctionContract is what the tests of a package expect of one function
+// or method, to give providers as explicit requirements: a case per call a
+// test checks, each case of a table-driven test its own, and as Invariants
+// the expectations every case shares
+type FunctionContract struct {
+	Function   string         `json:"function"`
+	Tests      []string       `json:"tests"`
+	Cases      []ContractCase `json:"cases"`
+	Invariants []string       `json:"invariants"`
+}
+
+// ContractCase is one checked call: the call as the test makes it, with the
+// values of its table case filled in, the variables the test assigns the
+// results to, and Expect, the conditions on them that hold when the test
+// passes, as Go expressions. Name is the table case's name, if it has one.
+type ContractCase struct {
+	Test    string   `json:"test"`
+	Name    string   `json:"name,omitempty"`
+	File    string   `json:"file"`
+	Line    int      `json:"line"`
+	Call    string   `json:"call"`
+	Results []string `json:"results"`
+	Expect  []string `json:"expect"`
+}
+
+// contractCase is a case of a test table: its name and the source of each
+// field's value
+type contractCase struct {
+	name   string
+	fields map[string]string
+}
+
+// contractScan extracts the contracts of one test file. loopVar is the
+// variable a loop over a test table binds to each case, and cases the cases.
+type contractScan struct {
+	file      *editFile
+	test      string
+	functions map[string]bool
+	methods   map[string][]string
+	tables    map[string][]contractCase
+	loopVar   string
+	cases     []contractCase
+	found     map[string]*FunctionContract
+	order     []string
+}
+
+// inverseComparisons maps each comparison to the one that holds when it
+// does not
+var inverseComparisons = map[token.Token]token.Token{
+	token.EQL: token.NEQ, token.NEQ: token.EQL,
+	token.LSS: token.GEQ, token.GEQ: token.LSS,
+	token.GTR: token.LEQ, token.LEQ: token.GTR,
+}
+
+// assertionConditions maps testify assertions, by the arguments after the
+// *testing.T, to the condition they check
+var assertionConditions = map[string]func(args []string) string{
+	"Equal":       func(a []string) string { return a[1] + " == " + a[0] },
+	"EqualValues": func(a []string) string { return a[1] + " == " + a[0] },
+	"Exactly":     func(a []string) string { return a[1] + " == " + a[0] },
+	"NotEqual":    func(a []string) string { return a[1] + " != " + a[0] },
+	"Nil":         func(a []string) string { return a[0] + " == nil" },
+	"NoError":     func(a []string) string { return a[0] + " == nil" },
+	"NotNil":      func(a []string) string { return a[0] + " != nil" },
+	"Error":       func(a []string) string { return a[0] + " != nil" },
+	"True":        func(a []string) string { return a[0] },
+	"False":       func(a []string) string { return "!(" + a[0] + ")" },
+	"Len":         func(a []string) string { return "len(" + a[0] + ") == " + a[1] },
+	"ErrorIs":     func(a []string) string { return "errors.Is(" + a[0] + ", " + a[1] + ")" },
+	"EqualError":  func(a []string) string { return a[0] + ".Error() == " + a[1] },
+}
+
+// assertionArity is the number of arguments after the *testing.T each
+// assertion needs
+var assertionArity = map[string]int{"Equal": 2, "EqualValues": 2, "Exactly": 2, "NotEqual": 2, "Len": 2, "ErrorIs": 2, "EqualError": 2}
+
+// extractContracts reads the tests of the file's package, the file itself
+// if it is a test file and the _test.go files next to it otherwise, and
+// returns the contracts of the functions and methods they check: those of
+// the file, or of the package's other files for a test file
+func extractContracts(file *ast.File, path string) []FunctionContract {
+	if path == "" || path == stdinPath {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	testPaths := []string{path}
+	targets := []*ast.File{file}
+	if isTestFile(path) {
+		targets = nil
+		sources, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for _, source := range sources {
+			if isTestFile(source) {
+				continue
+			}
+			if parsed, err := loadEditFile(source); err == nil {
+				targets = append(targets, parsed.file)
+			}
+		}
+	} else {
+		testPaths, _ = filepath.Glob(filepath.Join(dir, "*_test.go"))
+	}
+
+	scan := &contractScan{functions: map[string]bool{}, methods: map[string][]string{}, found: map[string]*FunctionContract{}}
+	for _, target := range targets {
+		for _, decl := range target.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if fn.Recv == nil {
+				scan.functions[fn.Name.Name] = true
+			} else {
+				scan.methods[fn.Name.Name] = append(scan.methods[fn.Name.Name], symbolName(fn))
+			}
+		}
+	}
+
+	for _, testPath := range testPaths {
+		testFile, err := loadEditFile(testPath)
+		if err != nil {
+			continue
+		}
+		scan.file = testFile
+		for _, decl := range testFile.file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && isTestFunc(fn) && fn.Body != nil {
+				scan.test, scan.tables, scan.loopVar, scan.cases = fn.Name.Name, map[string][]contractCase{}, "", nil
+				scan.block(fn.Body.List)
+			}
+		}
+	}
+
+	contracts := []FunctionContract{}
+	for _, name := range scan.order {
+		contract := scan.found[name]
+		contract.Invariants = sharedExpectations(contract.Cases)
+		contracts = append(contracts, *contract)
+	}
+	return contracts
+}
+
+// block scans a list of statements for test tables, loops over them and
+// checked calls, descending into nested blocks and t.Run closures
+func (s *contractScan) block(stmts []ast.Stmt) {
+	for i, stmt := range stmts {
+		s.recordTable(stmt)
+		if assign, ok := stmt.(*ast.AssignStmt); ok {
+			if call := s.assignedCall(assign); call != nil {
+				s.check(call, assignedNames(assign), stmts[i+1:])
+			}
+		}
+		switch st := stmt.(type) {
+		case *ast.IfStmt:
+			if assign, ok := st.Init.(*ast.AssignStmt); ok {
+				if call := s.assignedCall(assign); call != nil {
+					s.check(call, assignedNames(assign), []ast.Stmt{&ast.IfStmt{Cond: st.Cond, Body: st.Body}})
+				}
+			}
+			if call := s.targetCallIn(st.Cond); call != nil && failingBlock(st.Body) {
+				s.check(call, nil, []ast.Stmt{st})
+			}
+			s.block(st.Body.List)
+			if st.Else != nil {
+				s.block([]ast.Stmt{st.Else})
+			}
+		case *ast.ExprStmt:
+			if call, ok := st.X.(*ast.CallExpr); ok {
+				if assertionName(call) != "" {
+					if target := s.targetCallIn(call); target != nil {
+						s.check(target, nil, []ast.Stmt{st})
+					}
+				}
+				for _, arg := range call.Args {
+					if lit, ok := arg.(*ast.FuncLit); ok {
+						s.block(lit.Body.List)
+					}
+				}
+			}
+		case *ast.BlockStmt:
+			s.block(st.List)
+		case *ast.ForStmt:
+			s.block(st.Body.List)
+		case *ast.RangeStmt:
+			s.rangeLoop(st)
+		}
+	}
+}
+
+// rangeLoop scans a loop, with each case of the table it ranges over
+func (s *contractScan) rangeLoop(loop *ast.RangeStmt) {
+	var cases []contractCase
+	switch x := loop.X.(type) {
+	case *ast.Ident:
+		cases = s.tables[x.Name]
+	case *ast.CompositeLit:
+		cases = s.tableCases(x)
+	}
+	value, ok := loop.Value.(*ast.Ident)
+	if cases == nil || !ok {
+		s.block(loop.Body.List)
+		return
+	}
+	outerVar, outerCases := s.loopVar, s.cases
+	s.loopVar, s.cases = value.Name, cases
+	s.block(loop.Body.List)
+	s.loopVar, s.cases = outerVar, outerCases
+}
+
+// recordTable remembers a variable assigned a slice or map of struct
+// literals, the usual test table
+func (s *contractScan) recordTable(stmt ast.Stmt) {
+	var names []*ast.Ident
+	var values []ast.Expr
+	switch st := stmt.(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range st.Lhs {
+			ident, _ := lhs.(*ast.Ident)
+			names = append(names, ident)
+		}
+		values = st.Rhs
+	case *ast.DeclStmt:
+		gen, ok := st.Decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			return
+		}
+		for _, spec := range gen.Specs {
+			if value, ok := spec.(*ast.ValueSpec); ok && len(value.Names) == len(value.Values) {
+				names = append(names, value.Names...)
+				values = append(values, value.Values...)
+			}
+		}
+	}
+	for i, value := range values {
+		if lit, ok := value.(*ast.CompositeLit); ok && i < len(names) && names[i] != nil {
+			if cases := s.tableCases(lit); cases != nil {
+				s.tables[names[i].Name] = cases
+			}
+		}
+	}
+}
+
+// tableCases reads the cases of a []struct{...} or map[string]struct{...}
+// literal, with positional fields named after the struct's fields. A case
+// is named by its map key or its name, desc or title field.
+func (s *contractScan) tableCases(lit *ast.CompositeLit) []contractCase {
+	var elem ast.Expr
+	switch t := lit.Type.(type) {
+	case *ast.ArrayType:
+		elem = t.Elt
+	case *ast.MapType:
+		elem = t.Value
+	default:
+		return nil
+	}
+	if star, ok := elem.(*ast.StarExpr); ok {
+		elem = star.X
+	}
+	structType, ok := elem.(*ast.StructType)
+	if !ok {
+		return nil
+	}
+	fieldNames := []string{}
+	fieldTypes := map[string]ast.Expr{}
+	for _, field := range structType.Fields.List {
+		for _, name := range field.Names {
+			fieldNames = append(fieldNames, name.Name)
+			fieldTypes[name.Name] = field.Type
+		}
+	}
+
+	cases := []contractCase{}
+	for _, element := range lit.Elts {
+		c := contractCase{fields: map[string]string{}}
+		if kv, ok := element.(*ast.KeyValueExpr); ok {
+			c.name = unquote(s.text(kv.Key))
+			element = kv.Value
+		}
+		if unary, ok := element.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+			element = unary.X
+		}
+		caseLit, ok := element.(*ast.CompositeLit)
+		if !ok {
+			continue
+		}
+		for j, field := range caseLit.Elts {
+			if kv, ok := field.(*ast.KeyValueExpr); ok {
+				if key, ok := kv.Key.(*ast.Ident); ok {
+					c.fields[key.Name] = s.text(kv.Value)
+				}
+			} else if j < len(fieldNames) {
+				c.fields[fieldNames[j]] = s.text(field)
+			}
+		}
+		// A field a case leaves out has its zero value
+		for _, field := range fieldNames {
+			if _, ok := c.fields[field]; !ok {
+				if zero := zeroValue(fieldTypes[field]); zero != "" {
+					c.fields[field] = zero
+				}
+			}
+		}
+		for _, key := range []string{"name", "desc", "title"} {
+			if value, ok := c.fields[key]; ok && c.name == "" {
+				c.name = unquote(value)
+			}
+		}
+		cases = append(cases, c)
+	}
+	return cases
+}
+
+// assignedCall returns the call of a function or method under test that
+// is the only value of an assignment
+func (s *contractScan) assignedCall(assign *ast.AssignStmt) *ast.CallExpr {
+	if len(assign.Rhs) != 1 {
+		return nil
+	}
+	call, ok := assign.Rhs[0].(*ast.CallExpr)
+	if !ok || s.target(call) == "" {
+		return nil
+	}
+	return call
+}
+
+// target names the function or method under test a call calls, or is
+// empty. A method is recognized by its name when one type has it.
+func (s *contractScan) target(call *ast.CallExpr) string {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		if s.functions[fun.Name] {
+			return fun.Name
+		}
+	case *ast.SelectorExpr:
+		// pkg.Func from an external test package
+		if ident, ok := fun.X.(*ast.Ident); ok && s.functions[fun.Sel.Name] && ident.Obj == nil {
+			return fun.Sel.Name
+		}
+		if methods := s.methods[fun.Sel.Name]; len(methods) == 1 {
+			return methods[0]
+		}
+	}
+	return ""
+}
+
+// targetCallIn finds the first call under test in an expression
+func (s *contractScan) targetCallIn(expr ast.Expr) *ast.CallExpr {
+	var found *ast.CallExpr
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && found == nil && s.target(call) != "" {
+			found = call
+		}
+		return found == nil
+	})
+	return found
+}
+
+// check records a case for each table case, or one outside a table loop,
+// of a call whose results go to results, with the expectations the
+// statements after it place on them. Scanning stops at a statement that
+// assigns the results again.
+func (s *contractScan) check(call *ast.CallExpr, results []string, after []ast.Stmt) {
+	watched := map[string]bool{}
+	for _, name := range results {
+		if name != "_" {
+			watched[name] = true
+		}
+	}
+	relevant := func(expr ast.Node) bool {
+		return mentions(expr, watched) || containsNode(expr, call)
+	}
+
+	conditions := []ast.Expr{}
+	checks := []*ast.CallExpr{}
+	bindings := map[string]ast.Expr{}
+	for _, stmt := range after {
+		if assign, ok := stmt.(*ast.AssignStmt); ok && reassigns(assign, watched) {
+			break
+		}
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch st := n.(type) {
+			case *ast.IfStmt:
+				if assign, ok := st.Init.(*ast.AssignStmt); ok && len(assign.Lhs) == len(assign.Rhs) {
+					for i, lhs := range assign.Lhs {
+						if ident, ok := lhs.(*ast.Ident); ok {
+							bindings[ident.Name] = assign.Rhs[i]
+						}
+					}
+				}
+				if failingBlock(st.Body) && (relevant(st.Cond) || boundRelevant(st.Cond, bindings, relevant)) {
+					conditions = append(conditions, st.Cond)
+				}
+			case *ast.CallExpr:
+				if assertionName(st) != "" && relevant(st) {
+					checks = append(checks, st)
+				}
+			}
+			return true
+		})
+	}
+
+	cases := s.cases
+	if s.loopVar == "" || !mentionsSelectorOf(call, s.loopVar) && !anyMentionsSelectorOf(conditions, checks, s.loopVar) {
+		cases = []contractCase{{}}
+	}
+	name := s.target(call)
+	for _, c := range cases {
+		expect := []string{}
+		for _, cond := range conditions {
+			expect = append(expect, simplifyCondition(s.negate(cond, c, bindings)))
+		}
+		for _, assertion := range checks {
+			if condition := s.assertion(assertion, c, bindings); condition != "" {
+				expect = append(expect, simplifyCondition(condition))
+			}
+		}
+		if len(expect) == 0 {
+			continue
+		}
+		s.add(name, ContractCase{
+			Test:    s.test,
+			Name:    c.name,
+			File:    s.file.path,
+			Line:    s.file.fset.Position(call.Pos()).Line,
+			Call:    s.render(call, c, bindings),
+			Results: append([]string{}, results...),
+			Expect:  expect,
+		})
+	}
+}
+
+func (s *contractScan) add(name string, c ContractCase) {
+	contract := s.found[name]
+	if contract == nil {
+		contract = &FunctionContract{Function: name, Tests: []string{}, Cases: []ContractCase{}}
+		s.found[name] = contract
+		s.order = append(s.order, name)
+	}
+	if !contains(contract.Tests, c.Test) {
+		contract.Tests = append(contract.Tests, c.Test)
+	}
+	contract.Cases = append(contract.Cases, c)
+}
+
+// negate renders the condition under which a failing if does not fail
+func (s *contractScan) negate(cond ast.Expr, c contractCase, bindings map[string]ast.Expr) string {
+	switch e := cond.(type) {
+	case *ast.ParenExpr:
+		return s.negate(e.X, c, bindings)
+	case *ast.UnaryExpr:
+		if e.Op == token.NOT {
+			return s.render(e.X, c, bindings)
+		}
+	case *ast.BinaryExpr:
+		if op, ok := inverseComparisons[e.Op]; ok {
+			return s.render(e.X, c, bindings) + " " + op.String() + " " + s.render(e.Y, c, bindings)
+		}
+	}
+	return "!(" + s.render(cond, c, bindings) + ")"
+}
+
+// assertion renders the condition a testify assertion checks
+func (s *contractScan) assertion(call *ast.CallExpr, c contractCase, bindings map[string]ast.Expr) string {
+	name := assertionName(call)
+	arity := assertionArity[name]
+	if arity == 0 {
+		arity = 1
+	}
+	if len(call.Args) < arity+1 {
+		return ""
+	}
+	args := []string{}
+	for _, arg := range call.Args[1 : arity+1] {
+		args = append(args, s.render(arg, c, bindings))
+	}
+	return assertionConditions[name](args)
+}
+
+// assertionName is the testify assertion a call makes, as assert.X or
+// require.X, or empty
+func assertionName(call *ast.CallExpr) string {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok || (pkg.Name != "assert" && pkg.Name != "require") || assertionConditions[sel.Sel.Name] == nil {
+		return ""
+	}
+	return sel.Sel.Name
+}
+
+// render is an expression's source with the table case's values in place
+// of the loop variable's fields and if-bound variables in place of their
+// values
+func (s *contractScan) render(node ast.Node, c contractCase, bindings map[string]ast.Expr) string {
+	type span struct {
+		start, end int
+		text       string
+	}
+	spans := []span{}
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.SelectorExpr:
+			if ident, ok := e.X.(*ast.Ident); ok && ident.Name == s.loopVar && c.fields != nil {
+				if value, ok := c.fields[e.Sel.Name]; ok {
+					spans = append(spans, span{s.file.offset(e.Pos()), s.file.offset(e.End()), value})
+				}
+				return false
+			}
+			ast.Inspect(e.X, visit)
+			return false
+		case *ast.Ident:
+			if bound, ok := bindings[e.Name]; ok {
+				spans = append(spans, span{s.file.offset(e.Pos()), s.file.offset(e.End()), s.render(bound, c, nil)})
+			}
+		}
+		return true
+	}
+	ast.Inspect(node, visit)
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var b strings.Builder
+	at := s.file.offset(node.Pos())
+	for _, sp := range spans {
+		b.WriteString(s.file.source[at:sp.start])
+		b.WriteString(sp.text)
+		at = sp.end
+	}
+	b.WriteString(s.file.source[at:s.file.offset(node.End())])
+	return b.String()
+}
+
+func (s *contractScan) text(node ast.Node) string {
+	return s.file.source[s.file.offset(node.Pos()):s.file.offset(node.End())]
+}
+
+// sharedExpectations lists the expectations every case of several has
+func sharedExpectations(cases []ContractCase) []string {
+	shared := []string{}
+	if len(cases) < 2 {
+		return shared
+	}
+	for _, expect := range cases[0].Expect {
+		everywhere := true
+		for _, c := range cases[1:] {
+			everywhere = everywhere && contains(c.Expect, expect)
+		}
+		if everywhere && !contains(shared, expect) {
+			shared = append(shared, expect)
+		}
+	}
+	return shared
+}
+
+// simplifyCondition drops the comparison of a condition with true, and
+// turns one with false into its negation
+func simplifyCondition(condition string) string {
+	unwrap := func(s string) string {
+		if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+			return s[1 : len(s)-1]
+		}
+		return s
+	}
+	switch {
+	case strings.HasSuffix(condition, " == true"), strings.HasSuffix(condition, " != false"):
+		return unwrap(condition[:len(condition)-len(" == true")])
+	case strings.HasSuffix(condition, " == false"), strings.HasSuffix(condition, " != true"):
+		inner := unwrap(condition[:len(condition)-len(" == false")])
+		if expr, err := parser.ParseExpr(inner); err == nil {
+			if binary, ok := expr.(*ast.BinaryExpr); ok && inverseComparisons[binary.Op] != token.ILLEGAL {
+				at := int(binary.OpPos) - 1
+				return inner[:at] + inverseComparisons[binary.Op].String() + inner[at+len(binary.Op.String()):]
+			}
+		}
+		return "!(" + inner + ")"
+	}
+	return condition
+}
+
+// zeroValue is the zero value of a type as Go source, or empty when the
+// type's declaration would be needed to tell it
+func zeroValue(typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "bool":
+			return "false"
+		case "string":
+			return `""`
+		case "error", "any":
+			return "nil"
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+			"float32", "float64", "complex64", "complex128", "byte", "rune":
+			return "0"
+		}
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "nil"
+		}
+	case *ast.StarExpr, *ast.MapType, *ast.FuncType, *ast.InterfaceType, *ast.ChanType:
+		return "nil"
+	}
+	return ""
+}
+
+// failingBlock reports whether a block fails the test
+func failingBlock(block *ast.BlockStmt) bool {
+	failing := false
+	ast.Inspect(block, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok && contains(testingFailures, sel.Sel.Name) {
+				failing = true
+			}
+		}
+		return !failing
+	})
+	return failing
+}
+
+// mentions reports whether an expression refers to any of the names,
+// other than as a field or method name
+func mentions(node ast.Node, names map[string]bool) bool {
+	if len(names) == 0 {
+		return false
+	}
+	found := false
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(e.X, visit)
+			return false
+		case *ast.Ident:
+			found = found || names[e.Name]
+		}
+		return !found
+	}
+	ast.Inspect(node, visit)
+	return found
+}
+
+// boundRelevant reports whether a condition refers to a variable bound by
+// an if statement to a relevant value
+func boundRelevant(cond ast.Expr, bindings map[string]ast.Expr, relevant func(ast.Node) bool) bool {
+	names := map[string]bool{}
+	for name, value := range bindings {
+		if relevant(value) {
+			names[name] = true
+		}
+	}
+	return mentions(cond, names)
+}
+
+func containsNode(root, node ast.Node) bool {
+	found := false
+	ast.Inspect(root, func(n ast.Node) bool {
+		found = found || n == node
+		return !found
+	})
+	return found
+}
+
+// mentionsSelectorOf reports whether a node selects a field of the named
+// variable
+func mentionsSelectorOf(node ast.Node, name string) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Name == name {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func anyMentionsSelectorOf(conditions []ast.Expr, checks []*ast.CallExpr, name string) bool {
+	for _, cond := range conditions {
+		if mentionsSelectorOf(cond, name) {
+			return true
+		}
+	}
+	for _, check := range checks {
+		if mentionsSelectorOf(check, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func reassigns(assign *ast.AssignStmt, names map[string]bool) bool {
+	for _, lhs := range assign.Lhs {
+		if ident, ok := lhs.(*ast.Ident); ok && names[ident.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+func assignedNames(assign *ast.AssignStmt) []string {
+	names := []string{}
+	for _, lhs := range assign.Lhs {
+		if ident, ok := lhs.(*ast.Ident); ok {
+			names = append(names, ident.Name)
+		} else {
+			names = append(names, types.ExprString(lhs))
+		}
+	}
+	return names
+}
+
+func unquote(s string) string {
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return s
+}
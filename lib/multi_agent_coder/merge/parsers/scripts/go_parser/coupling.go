@@ -0,0 +1,371 @@
+package main
+
+import (
+	"go/ast"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CouplingInfo holds fan-in/fan-out metrics for the analyzed set of files
+type CouplingInfo struct {
+	Functions []FunctionCoupling `json:"functions"`
+	Packages  []PackageCoupling  `json:"packages"`
+}
+
+// FunctionCoupling represents the callers and callees of a single function
+type FunctionCoupling struct {
+	Name     string  `json:"name"`
+	Receiver *string `json:"receiver,omitempty"`
+	FanIn    int     `json:"fan_in"`
+	FanOut   int     `json:"fan_out"`
+}
+
+// PackageCoupling represents afferent (incoming) and efferent (outgoing)
+// package dependencies, plus the resulting instability ratio Ce/(Ca+Ce)
+type PackageCoupling struct {
+	Package     string  `json:"package"`
+	Afferent    int     `json:"afferent"`
+	Efferent    int     `json:"efferent"`
+	Instability float64 `json:"instability"`
+}
+
+// QualityScore combines normalized 0-1 quality dimensions into one score
+type QualityScore struct {
+	Score      float64            `json:"score"`
+	Dimensions map[string]float64 `json:"dimensions"`
+}
+
+// funcKey identifies a function or method within a package
+type funcKey struct {
+	pkg      string
+	receiver string
+	name     string
+}
+
+// computeCoupling calculates function and package coupling across files.
+// Calls are resolved by name only: plain calls bind to functions of the same
+// package, and selector calls bind to methods declared on the caller's own
+// receiver or, failing that, to the only method in the set with that name.
+func computeCoupling(files []*ast.File) *CouplingInfo {
+	info := &CouplingInfo{
+		Functions: []FunctionCoupling{},
+		Packages:  []PackageCoupling{},
+	}
+
+	declared := map[funcKey]bool{}
+	receivers := map[funcKey]string{}
+	methodsByName := map[string][]funcKey{}
+	order := []funcKey{}
+
+	for _, file := range files {
+		pkg := file.Name.Name
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			key := funcKey{pkg: pkg, receiver: receiverTypeName(fn), name: fn.Name.Name}
+			if declared[key] {
+				continue
+			}
+			declared[key] = true
+			receivers[key] = receiverExpr(fn)
+			order = append(order, key)
+			if key.receiver != "" {
+				methodsByName[key.name] = append(methodsByName[key.name], key)
+			}
+		}
+	}
+
+	callers := map[funcKey]map[funcKey]bool{}
+	callees := map[funcKey]map[string]bool{}
+
+	for _, file := range files {
+		pkg := file.Name.Name
+		imports := importNames(file)
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			caller := funcKey{pkg: pkg, receiver: receiverTypeName(fn), name: fn.Name.Name}
+			recvVar := receiverVarName(fn)
+			if callees[caller] == nil {
+				callees[caller] = map[string]bool{}
+			}
+
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+
+				callees[caller][getFuncName(call.Fun)] = true
+
+				var target funcKey
+				switch fun := call.Fun.(type) {
+				case *ast.Ident:
+					target = funcKey{pkg: pkg, name: fun.Name}
+				case *ast.SelectorExpr:
+					x, isIdent := fun.X.(*ast.Ident)
+					if isIdent && imports[x.Name] {
+						return true
+					}
+					if isIdent && x.Name == recvVar {
+						target = funcKey{pkg: pkg, receiver: caller.receiver, name: fun.Sel.Name}
+					} else if candidates := methodsByName[fun.Sel.Name]; len(candidates) == 1 {
+						target = candidates[0]
+					}
+				}
+
+				if declared[target] && target != caller {
+					if callers[target] == nil {
+						callers[target] = map[funcKey]bool{}
+					}
+					callers[target][caller] = true
+				}
+				return true
+			})
+		}
+	}
+
+	for _, key := range order {
+		fc := FunctionCoupling{
+			Name:   key.name,
+			FanIn:  len(callers[key]),
+			FanOut: len(callees[key]),
+		}
+		if key.receiver != "" {
+			receiver := receivers[key]
+			fc.Receiver = &receiver
+		}
+		info.Functions = append(info.Functions, fc)
+	}
+
+	info.Packages = computePackageCoupling(files)
+	return info
+}
+
+// computePackageCoupling counts distinct imports per package (efferent) and
+// how many other packages in the set import it (afferent). A package matches
+// an import path when the path ends with the package name.
+func computePackageCoupling(files []*ast.File) []PackageCoupling {
+	imports := map[string]map[string]bool{}
+	packages := []string{}
+
+	for _, file := range files {
+		pkg := file.Name.Name
+		if imports[pkg] == nil {
+			imports[pkg] = map[string]bool{}
+			packages = append(packages, pkg)
+		}
+		for _, imp := range file.Imports {
+			imports[pkg][strings.Trim(imp.Path.Value, `"`)] = true
+		}
+	}
+
+	sort.Strings(packages)
+	result := []PackageCoupling{}
+
+	for _, pkg := range packages {
+		afferent := 0
+		for _, other := range packages {
+			if other == pkg {
+				continue
+			}
+			for path := range imports[other] {
+				if path == pkg || strings.HasSuffix(path, "/"+pkg) {
+					afferent++
+					break
+				}
+			}
+		}
+
+		efferent := len(imports[pkg])
+		instability := 0.0
+		if afferent+efferent > 0 {
+			instability = roundTo(float64(efferent)/float64(afferent+efferent), 3)
+		}
+
+		result = append(result, PackageCoupling{
+			Package:     pkg,
+			Afferent:    afferent,
+			Efferent:    efferent,
+			Instability: instability,
+		})
+	}
+
+	return result
+}
+
+// coupleBatch recouples the files of a batch over each other, which parsing
+// them one at a time cannot: fan-in counts the callers in the other files of
+// a function's package directory, and package afferent coupling the other
+// packages of the batch. The fan_in of feature vectors follows.
+func coupleBatch(batch *BatchResult) {
+	type packageDir struct{ dir, name string }
+	groups := map[packageDir][]*ast.File{}
+	all := []*ast.File{}
+	for _, entry := range batch.Results {
+		if entry.Result == nil || entry.Result.file == nil || entry.Result.Coupling == nil {
+			continue
+		}
+		key := packageDir{dir: filepath.Dir(entry.Path), name: entry.Result.file.Name.Name}
+		groups[key] = append(groups[key], entry.Result.file)
+		all = append(all, entry.Result.file)
+	}
+	if len(all) < 2 {
+		return
+	}
+
+	fanIn := map[packageDir]map[[2]string]int{}
+	for key, files := range groups {
+		fanIn[key] = map[[2]string]int{}
+		for _, fc := range computeCoupling(files).Functions {
+			fanIn[key][couplingKey(fc.Name, fc.Receiver)] = fc.FanIn
+		}
+	}
+	packages := map[string]PackageCoupling{}
+	for _, pkg := range computePackageCoupling(all) {
+		packages[pkg.Package] = pkg
+	}
+
+	fanInFeature := -1
+	for i, name := range featureNames {
+		if name == "fan_in" {
+			fanInFeature = i
+		}
+	}
+	for _, entry := range batch.Results {
+		result := entry.Result
+		if result == nil || result.file == nil || result.Coupling == nil {
+			continue
+		}
+		counts := fanIn[packageDir{dir: filepath.Dir(entry.Path), name: result.file.Name.Name}]
+		for j := range result.Coupling.Functions {
+			fc := &result.Coupling.Functions[j]
+			fc.FanIn = counts[couplingKey(fc.Name, fc.Receiver)]
+		}
+		for j, pkg := range result.Coupling.Packages {
+			result.Coupling.Packages[j] = packages[pkg.Package]
+		}
+		if result.FeatureVectors != nil {
+			for _, vector := range result.FeatureVectors.Functions {
+				vector.Vector[fanInFeature] = float64(counts[couplingKey(vector.Name, vector.Receiver)])
+			}
+		}
+	}
+}
+
+// couplingKey identifies a function of a package by name and receiver
+func couplingKey(name string, receiver *string) [2]string {
+	key := [2]string{name, ""}
+	if receiver != nil {
+		key[1] = *receiver
+	}
+	return key
+}
+
+// computeQuality derives the candidate quality score. Each dimension is 1.0
+// up to a comfortable average and falls linearly to 0.0 at a hard limit.
+func computeQuality(result *Result) *QualityScore {
+	functions := len(result.Functions)
+	if functions == 0 {
+		functions = 1
+	}
+
+	avgComplexity := 1 + float64(result.Complexity-1)/float64(functions)
+	cognitive := 0
+	for _, fn := range result.Functions {
+		cognitive += fn.CognitiveComplexity
+	}
+	avgCognitive := float64(cognitive) / float64(functions)
+
+	avgFanOut := 0.0
+	if result.Coupling != nil && len(result.Coupling.Functions) > 0 {
+		total := 0
+		for _, fc := range result.Coupling.Functions {
+			total += fc.FanOut
+		}
+		avgFanOut = float64(total) / float64(len(result.Coupling.Functions))
+	}
+
+	dimensions := map[string]float64{
+		"complexity":           linearScore(avgComplexity, 5, 20),
+		"cognitive_complexity": linearScore(avgCognitive, 7, 25),
+		"coupling":             linearScore(avgFanOut, 5, 20),
+	}
+	if result.TestHygiene != nil {
+		dimensions["test_quality"] = result.TestHygiene.Score
+	}
+
+	return &QualityScore{
+		Score:      averageScore(dimensions),
+		Dimensions: dimensions,
+	}
+}
+
+func linearScore(value, comfortable, limit float64) float64 {
+	if value <= comfortable {
+		return 1.0
+	}
+	if value >= limit {
+		return 0.0
+	}
+	return roundTo(1-(value-comfortable)/(limit-comfortable), 3)
+}
+
+func averageScore(dimensions map[string]float64) float64 {
+	if len(dimensions) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, score := range dimensions {
+		total += score
+	}
+	return roundTo(total/float64(len(dimensions)), 3)
+}
+
+func roundTo(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
+
+// importNames returns the local names under which a file's imports are
+// referenced, using the last path element when there is no explicit alias
+func importNames(file *ast.File) map[string]bool {
+	names := map[string]bool{}
+	for _, imp := range file.Imports {
+		path := strings.Trim(imp.Path.Value, `"`)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// receiverExpr returns the receiver type as written, e.g. "*Store", matching
+// FunctionInfo.Receiver
+func receiverExpr(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	return getTypeName(fn.Recv.List[0].Type)
+}
+
+// receiverTypeName returns the receiver's base type name without a pointer
+func receiverTypeName(fn *ast.FuncDecl) string {
+	return strings.TrimPrefix(receiverExpr(fn), "*")
+}
+
+func receiverVarName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 || len(fn.Recv.List[0].Names) == 0 {
+		return ""
+	}
+	return fn.Recv.List[0].Names[0].Name
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestCoupleBatch(t *testing.T) {
+	files := []sourceFile{
+		{Path: "store/store.go", Content: "package store\n\nfunc Open() {}\n\nfunc helper() {}\n"},
+		{Path: "store/cache.go", Content: "package store\n\nfunc Cached() { helper(); Open() }\n"},
+		{Path: "api/api.go", Content: "package api\n\nimport \"example.com/app/store\"\n\nfunc Serve() { store.Open() }\n"},
+		// Same package name in another directory, not coupled to store/
+		{Path: "other/store/store.go", Content: "package store\n\nfunc Use() { helper() }\n\nfunc helper() {}\n"},
+	}
+	opts := defaultOptions()
+	opts.features = true
+	batch, err := analyzeSourceFiles(files, opts)
+	if err != nil {
+		t.Fatalf("analyzeSourceFiles: %v", err)
+	}
+
+	fanIn := func(path, name string) int {
+		for _, entry := range batch.Results {
+			if entry.Path != path {
+				continue
+			}
+			for _, fc := range entry.Result.Coupling.Functions {
+				if fc.Name == name {
+					return fc.FanIn
+				}
+			}
+		}
+		t.Fatalf("%s has no function %s", path, name)
+		return 0
+	}
+	tests := []struct {
+		path, name string
+		want       int
+	}{
+		{"store/store.go", "Open", 1},
+		{"store/store.go", "helper", 1},
+		{"store/cache.go", "Cached", 0},
+		{"other/store/store.go", "helper", 1},
+	}
+	for _, tt := range tests {
+		if got := fanIn(tt.path, tt.name); got != tt.want {
+			t.Errorf("%s %s: fan_in = %d, want %d", tt.path, tt.name, got, tt.want)
+		}
+	}
+
+	store := batch.Results[0].Result
+	if packages := store.Coupling.Packages; len(packages) != 1 || packages[0].Afferent != 1 {
+		t.Errorf("store packages = %+v, want afferent 1", packages)
+	}
+	for _, vector := range store.FeatureVectors.Functions {
+		if vector.Name == "Open" && vector.Vector[14] != 1 {
+			t.Errorf("Open fan_in feature = %v, want 1", vector.Vector[14])
+		}
+	}
+}
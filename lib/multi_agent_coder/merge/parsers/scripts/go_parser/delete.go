@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func runDeleteSymbol(args []string) int {
+	var name, outputPath string
+	dryRun := false
+
+	flags := flag.NewFlagSet("delete-symbol", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&name, "name", "", "declaration to delete, e.g. legacyHelper or Server.stop")
+	flags.StringVar(&outputPath, "o", "", "write the result here instead of over the target")
+	flags.BoolVar(&dryRun, "dry-run", false, "do not write; the result source is returned in the output")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	if name == "" || len(positional) == 0 {
+		return fail("Usage: delete-symbol target.go --name Symbol [files or ./... to check for references] [-o out.go] [--dry-run]")
+	}
+
+	target := positional[0]
+	if outputPath == "" {
+		outputPath = target
+	}
+
+	// References are checked in the given file set, or the target's own
+	// package directory when none is given
+	patterns := positional[1:]
+	if len(patterns) == 0 {
+		patterns = []string{filepath.Dir(target)}
+	}
+	paths, err := collectGoFiles(append(patterns, target), true)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+
+	file, err := loadEditFile(target)
+	if err != nil {
+		return fail("Failed to load target: %v", err)
+	}
+
+	decl := findSymbol(file.file, name)
+	if decl == nil {
+		return fail("%s not found in %s", name, target)
+	}
+
+	lookup, err := newReferenceTarget(file, decl)
+	if err != nil {
+		return fail("Failed to resolve package: %v", err)
+	}
+	refs, err := findReferences(paths, lookup)
+	if err != nil {
+		return fail("Failed to check references: %v", err)
+	}
+
+	result := &EditResult{Target: target, Symbol: decl.name, AddedImports: []string{}, References: refs}
+	if len(refs) > 0 {
+		result.blockedByError = true
+		return printEditResult(result)
+	}
+
+	source, removed, err := deleteSymbol(file, decl)
+	if err != nil {
+		return fail("%v", err)
+	}
+	result.RemovedImports = removed
+
+	if err := finishEdit(result, source, outputPath, dryRun); err != nil {
+		return fail("%v", err)
+	}
+	return printEditResult(result)
+}
+
+// deleteSymbol removes decl with its doc comment and trailing comment, and
+// drops any imports only it used
+func deleteSymbol(file *editFile, decl *symbolDecl) (string, []string, error) {
+	if spec, ok := decl.node.(*ast.ValueSpec); ok && len(spec.Names) > 1 {
+		return "", nil, fmt.Errorf("%s shares a declaration with %d other names; edit it with replace-symbol", decl.name, len(spec.Names)-1)
+	}
+
+	start, end := file.declRange(decl, true)
+	source := removeLines(file.source, start, end)
+
+	edited, err := parseEditSource(file.path, source)
+	if err != nil {
+		return "", nil, fmt.Errorf("deleting %s leaves %s unparseable: %v", decl.name, file.path, err)
+	}
+
+	unused := orphanedImports(file, decl.node, edited)
+	return removeImports(edited, unused), unused, nil
+}
+
+// orphanedImports lists the imports of file that node used and edited, the
+// file once node is removed or replaced, no longer uses
+func orphanedImports(file *editFile, node ast.Node, edited *editFile) []string {
+	stillUsed := map[string]bool{}
+	for _, imp := range requiredImports(edited.file, edited.file) {
+		stillUsed[imp.path] = true
+	}
+	unused := []string{}
+	for _, imp := range requiredImports(file.file, node) {
+		if !stillUsed[imp.path] {
+			unused = append(unused, imp.path)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// removeLines cuts [start, end) out of source, widened to whole lines, and
+// collapses the blank lines left on either side into one
+func removeLines(source string, start, end int) string {
+	start = strings.LastIndex(source[:start], "\n") + 1
+	if i := strings.Index(source[end:], "\n"); i >= 0 {
+		end += i + 1
+	} else {
+		end = len(source)
+	}
+
+	before := source[:start]
+	after := source[end:]
+	if strings.HasSuffix(before, "\n\n") || before == "" {
+		after = strings.TrimLeft(after, "\n")
+	}
+	if after == "" {
+		before = strings.TrimRight(before, "\n") + "\n"
+	}
+	return before + after
+}
+
+// removeImports deletes the import specs for paths, and any import
+// declaration left empty
+func removeImports(file *editFile, paths []string) string {
+	if len(paths) == 0 {
+		return file.source
+	}
+	drop := map[string]bool{}
+	for _, path := range paths {
+		drop[path] = true
+	}
+
+	type cut struct{ start, end int }
+	cuts := []cut{}
+	for _, decl := range file.file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+
+		kept := 0
+		specCuts := []cut{}
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			if !drop[strings.Trim(imp.Path.Value, `"`)] {
+				kept++
+				continue
+			}
+			start := file.offset(imp.Pos())
+			if imp.Doc != nil {
+				start = file.offset(imp.Doc.Pos())
+			}
+			specCuts = append(specCuts, cut{start, file.offset(imp.End())})
+		}
+
+		if kept == 0 && len(specCuts) > 0 {
+			cuts = append(cuts, cut{file.offset(gen.Pos()), file.offset(gen.End())})
+		} else {
+			cuts = append(cuts, specCuts...)
+		}
+	}
+
+	source := file.source
+	for i := len(cuts) - 1; i >= 0; i-- {
+		source = removeLines(source, cuts[i].start, cuts[i].end)
+	}
+	return source
+}
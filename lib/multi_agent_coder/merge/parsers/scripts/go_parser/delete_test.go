@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInsertDeleteRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		symbol  string
+		imports string
+	}{
+		{"function", "package p\n\nfunc G() int { return 1 }\n", "G", ""},
+		{"method", "package p\n\nfunc (c Config) Len() int { return len(c.Name) }\n", "Config.Len", ""},
+		{"type", "package p\n\ntype Options struct{ Debug bool }\n", "Options", ""},
+		{"const", "package p\n\nconst Limit = 10\n", "Limit", ""},
+		{"function with an import", "package p\n\nimport \"strings\"\n\nfunc Upper(s string) string { return strings.ToUpper(s) }\n", "Upper", "strings"},
+	}
+
+	for _, tt := range tests {
+		for _, policy := range insertPolicies {
+			t.Run(tt.name+"/"+policy, func(t *testing.T) {
+				file := mustEditFile(t, "target.go", editTarget)
+				inserted, _, added, err := insertSymbols(file, mustEditFile(t, "snippet.go", tt.snippet), "", policy)
+				if err != nil {
+					t.Fatalf("insertSymbols: %v", err)
+				}
+				if got := strings.Trim(strings.Join(added, ","), `"`); got != tt.imports {
+					t.Errorf("added imports = %q, want %q", got, tt.imports)
+				}
+
+				edited := mustEditFile(t, "target.go", inserted)
+				decl := findSymbol(edited.file, tt.symbol)
+				if decl == nil {
+					t.Fatalf("%s not found after insertion:\n%s", tt.symbol, inserted)
+				}
+				deleted, removed, err := deleteSymbol(edited, decl)
+				if err != nil {
+					t.Fatalf("deleteSymbol: %v", err)
+				}
+				if got := strings.Join(removed, ","); got != tt.imports {
+					t.Errorf("removed imports = %q, want %q", got, tt.imports)
+				}
+				assertEquivalent(t, deleted, editTarget)
+			})
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DependencyImpact is the work list of a dependency upgrade: the exported
+// API the new version of a module removes or changes from the version
+// required today, and the places in the analyzed files that use it.
+// NewModule is set when the module path changes, as for a major version.
+type DependencyImpact struct {
+	Module      string        `json:"module"`
+	NewModule   string        `json:"new_module,omitempty"`
+	FromVersion string        `json:"from_version"`
+	ToVersion   string        `json:"to_version"`
+	Changes     []APIChange   `json:"changes"`
+	Sites       []ImpactSite  `json:"sites"`
+	Summary     ImpactSummary `json:"summary"`
+	Errors      []FileError   `json:"errors"`
+}
+
+// APIChange is an exported symbol, or a whole package when Symbol is
+// empty, of the old version that the new one removes or declares with
+// another signature. Package is the import path below the module root,
+// empty for the root package; methods are named Type.Method.
+type APIChange struct {
+	Package      string `json:"package"`
+	Symbol       string `json:"symbol,omitempty"`
+	Kind         string `json:"kind"`
+	Change       string `json:"change"`
+	OldSignature string `json:"old_signature,omitempty"`
+	NewSignature string `json:"new_signature,omitempty"`
+}
+
+// ImpactSite is a use of a removed or changed symbol. Match is qualified
+// for a reference through the package's import, import for an import of a
+// removed package or of a module whose path changes, and name for a
+// method call found by its name alone, which may be another type's method.
+type ImpactSite struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Package string `json:"package"`
+	Symbol  string `json:"symbol,omitempty"`
+	Change  string `json:"change"`
+	Match   string `json:"match"`
+}
+
+// ImpactSummary counts the changes and the sites and files affected
+type ImpactSummary struct {
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+	Sites   int `json:"sites"`
+	Files   int `json:"files"`
+}
+
+// apiEntry is an exported symbol of a package and its signature
+type apiEntry struct {
+	kind      string
+	signature string
+}
+
+// majorSuffix matches the /vN suffix of a module path from v2 on
+var majorSuffix = regexp.MustCompile(`/v[2-9][0-9]*$`)
+
+func runDepImpact(args []string) int {
+	var module, from string
+
+	flags := flag.NewFlagSet("depimpact", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&module, "module", "", "module upgraded to, as path@version; a partial version such as v2 picks the newest cached one")
+	flags.StringVar(&from, "from", "", "version upgraded from (default: the version go.mod requires)")
+
+	patterns, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if module == "" || !strings.Contains(module, "@") {
+		return fail("Usage: depimpact --module path@version [--from version] [./...]")
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	newPath, newSpec := strings.SplitN(module, "@", 2)[0], module
+	newDir, newVersion, err := findCachedModule(newSpec)
+	if err != nil && !majorSuffix.MatchString(newPath) {
+		// foo@v2 is published as the module foo/v2
+		major := strings.SplitN(strings.SplitN(module, "@", 2)[1], ".", 2)[0]
+		if retryDir, retryVersion, retryErr := findCachedModule(newPath + "/" + major + "@" + strings.SplitN(module, "@", 2)[1]); retryErr == nil {
+			newPath, newDir, newVersion, err = newPath+"/"+major, retryDir, retryVersion, nil
+		}
+	}
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	oldPath := majorSuffix.ReplaceAllString(newPath, "")
+	if from == "" {
+		start := strings.TrimSuffix(patterns[0], "...")
+		if info, err := os.Stat(start); err != nil || !info.IsDir() {
+			start = filepath.Dir(start)
+		}
+		root, _, err := findModule(start)
+		if err != nil || root == "" {
+			return fail("No go.mod found to read the current version from; pass --from")
+		}
+		requires, err := readModuleRequires(filepath.Join(root, "go.mod"))
+		if err != nil {
+			return fail("Failed to read go.mod: %v", err)
+		}
+		// The current version may still be required under the new path
+		// or, before a major upgrade, under an older major's
+		for _, path := range sortedKeys(setOfKeys(requires)) {
+			if path == newPath || majorSuffix.ReplaceAllString(path, "") == oldPath {
+				oldPath, from = path, requires[path]
+			}
+		}
+		if from == "" {
+			return fail("go.mod does not require %s; pass --from", oldPath)
+		}
+	} else if _, _, err := findCachedModule(newPath + "@" + from); err == nil {
+		oldPath = newPath
+	}
+	oldDir, oldVersion, err := findCachedModule(oldPath + "@" + from)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	oldAPI, err := summarizeModule(oldPath, oldVersion, oldDir, nil, false)
+	if err != nil {
+		return fail("Failed to summarize %s@%s: %v", oldPath, oldVersion, err)
+	}
+	newAPI, err := summarizeModule(newPath, newVersion, newDir, nil, false)
+	if err != nil {
+		return fail("Failed to summarize %s@%s: %v", newPath, newVersion, err)
+	}
+
+	files, err := collectGoFiles(patterns, true)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+
+	impact := &DependencyImpact{Module: oldPath, FromVersion: oldVersion, ToVersion: newVersion, Changes: compareModuleAPIs(oldAPI, newAPI), Sites: []ImpactSite{}, Errors: []FileError{}}
+	if newPath != oldPath {
+		impact.NewModule = newPath
+	}
+	findImpactSites(impact, files)
+	return printJSON(impact)
+}
+
+// compareModuleAPIs lists what the old API has that the new one removes or
+// gives another signature, the packages paired by their path below the
+// module root
+func compareModuleAPIs(oldAPI, newAPI *DependencySummary) []APIChange {
+	relative := func(summary *DependencySummary, importPath string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(importPath, summary.Module), "/")
+	}
+	newPackages := map[string]PackageAPI{}
+	for _, pkg := range newAPI.Packages {
+		newPackages[relative(newAPI, pkg.Path)] = pkg
+	}
+
+	changes := []APIChange{}
+	for _, pkg := range oldAPI.Packages {
+		rel := relative(oldAPI, pkg.Path)
+		newPkg, ok := newPackages[rel]
+		if !ok {
+			changes = append(changes, APIChange{Package: rel, Kind: "package", Change: "removed"})
+			continue
+		}
+		oldSymbols, newSymbols := apiSymbols(pkg), apiSymbols(newPkg)
+		names := []string{}
+		for name := range oldSymbols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			old := oldSymbols[name]
+			updated, ok := newSymbols[name]
+			switch {
+			case !ok:
+				changes = append(changes, APIChange{Package: rel, Symbol: name, Kind: old.kind, Change: "removed", OldSignature: old.signature})
+			case normalizeWhitespace(updated.signature) != normalizeWhitespace(old.signature):
+				changes = append(changes, APIChange{Package: rel, Symbol: name, Kind: old.kind, Change: "changed", OldSignature: old.signature, NewSignature: updated.signature})
+			}
+		}
+	}
+	return changes
+}
+
+// apiSymbols indexes a package's exported API by name, methods as
+// Type.Method and constructors as the functions they are
+func apiSymbols(pkg PackageAPI) map[string]apiEntry {
+	symbols := map[string]apiEntry{}
+	for _, value := range pkg.Constants {
+		for _, name := range value.Names {
+			symbols[name] = apiEntry{kind: "const", signature: value.Signature}
+		}
+	}
+	for _, value := range pkg.Variables {
+		for _, name := range value.Names {
+			symbols[name] = apiEntry{kind: "var", signature: value.Signature}
+		}
+	}
+	for _, fn := range pkg.Functions {
+		symbols[fn.Name] = apiEntry{kind: "func", signature: fn.Signature}
+	}
+	for _, typ := range pkg.Types {
+		symbols[typ.Name] = apiEntry{kind: "type", signature: typ.Signature}
+		for _, fn := range typ.Constructors {
+			symbols[fn.Name] = apiEntry{kind: "func", signature: fn.Signature}
+		}
+		for _, method := range typ.Methods {
+			symbols[typ.Name+"."+method.Name] = apiEntry{kind: "method", signature: method.Signature}
+		}
+	}
+	return symbols
+}
+
+// findImpactSites lists the uses of the changes in files that import a
+// package of the module, and counts them into the summary
+func findImpactSites(impact *DependencyImpact, files []string) {
+	byPackage := map[string]map[string]APIChange{}
+	methods := map[string]map[string][]APIChange{}
+	for _, change := range impact.Changes {
+		if change.Change == "removed" {
+			impact.Summary.Removed++
+		} else {
+			impact.Summary.Changed++
+		}
+		if byPackage[change.Package] == nil {
+			byPackage[change.Package] = map[string]APIChange{}
+			methods[change.Package] = map[string][]APIChange{}
+		}
+		byPackage[change.Package][change.Symbol] = change
+		if change.Kind == "method" {
+			name := change.Symbol[strings.Index(change.Symbol, ".")+1:]
+			methods[change.Package][name] = append(methods[change.Package][name], change)
+		}
+	}
+
+	affected := map[string]bool{}
+	for _, path := range files {
+		file, err := loadEditFile(path)
+		if err != nil {
+			impact.Errors = append(impact.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+		site := func(node ast.Node, change APIChange, match string) {
+			pos := file.fset.Position(node.Pos())
+			impact.Sites = append(impact.Sites, ImpactSite{File: path, Line: pos.Line, Column: pos.Column, Package: change.Package, Symbol: change.Symbol, Change: change.Change, Match: match})
+			affected[path] = true
+		}
+
+		// The module's packages the file imports, by local name
+		imported := map[string]string{}
+		packages := map[string]bool{}
+		localNames := map[string]bool{}
+		for _, spec := range file.file.Imports {
+			importPath := strings.Trim(spec.Path.Value, `"`)
+			info := importInfo{path: importPath}
+			if spec.Name != nil {
+				info.name = spec.Name.Name
+			}
+			localNames[info.localName()] = true
+			if importPath != impact.Module && !strings.HasPrefix(importPath, impact.Module+"/") {
+				continue
+			}
+			rel := strings.TrimPrefix(strings.TrimPrefix(importPath, impact.Module), "/")
+			switch change, ok := byPackage[rel][""]; {
+			case ok:
+				site(spec, change, "import")
+			case impact.NewModule != "":
+				site(spec, APIChange{Package: rel, Change: "moved"}, "import")
+			}
+			imported[info.localName()] = rel
+			packages[rel] = true
+		}
+		if len(imported) == 0 {
+			continue
+		}
+
+		ast.Inspect(file.file, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil && localNames[x.Name] {
+				if rel, ok := imported[x.Name]; ok {
+					if change, ok := byPackage[rel][sel.Sel.Name]; ok {
+						site(sel, change, "qualified")
+					}
+				}
+				return true
+			}
+			// A method is matched by name in any package the file imports
+			for _, rel := range sortedKeys(packages) {
+				for _, change := range methods[rel][sel.Sel.Name] {
+					site(sel.Sel, change, "name")
+				}
+			}
+			return true
+		})
+	}
+
+	sort.SliceStable(impact.Sites, func(i, j int) bool {
+		a, b := impact.Sites[i], impact.Sites[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	impact.Summary.Sites = len(impact.Sites)
+	impact.Summary.Files = len(affected)
+}
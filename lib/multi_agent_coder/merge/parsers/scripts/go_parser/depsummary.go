@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/build"
+	"go/doc"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DependencySummary is the exported API of a third-party module
+type DependencySummary struct {
+	Module   string       `json:"module"`
+	Version  string       `json:"version"`
+	Dir      string       `json:"dir"`
+	Packages []PackageAPI `json:"packages"`
+}
+
+// PackageAPI is the exported API of one importable package. Docs are the
+// first sentence of each comment unless full docs were requested.
+type PackageAPI struct {
+	Path      string      `json:"path"`
+	Name      string      `json:"name"`
+	Doc       string      `json:"doc,omitempty"`
+	Constants []APIValue  `json:"constants"`
+	Variables []APIValue  `json:"variables"`
+	Functions []APISymbol `json:"functions"`
+	Types     []APIType   `json:"types"`
+}
+
+// APISymbol is an exported function or method and its signature
+type APISymbol struct {
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+}
+
+// APIValue is an exported const or var declaration, which may name several
+// values
+type APIValue struct {
+	Names     []string `json:"names"`
+	Signature string   `json:"signature"`
+	Doc       string   `json:"doc,omitempty"`
+}
+
+// APIType is an exported type with its constructors and methods. Struct and
+// interface signatures only show exported members.
+type APIType struct {
+	Name         string      `json:"name"`
+	Signature    string      `json:"signature"`
+	Doc          string      `json:"doc,omitempty"`
+	Constructors []APISymbol `json:"constructors"`
+	Methods      []APISymbol `json:"methods"`
+}
+
+func runDepSummary(args []string) int {
+	var module string
+	var packages stringList
+	fullDocs := false
+
+	flags := flag.NewFlagSet("depsummary", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&module, "module", "", "module to summarize as path@version (the newest cached version without @)")
+	flags.Var(&packages, "package", "only these import paths (repeatable, comma-separated)")
+	flags.BoolVar(&fullDocs, "full-docs", false, "include whole doc comments instead of their first sentence")
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if module == "" {
+		return fail("No module provided (--module path@version)")
+	}
+
+	dir, version, err := findCachedModule(module)
+	if err != nil {
+		return fail("%v", err)
+	}
+	modulePath := strings.SplitN(module, "@", 2)[0]
+
+	summary, err := summarizeModule(modulePath, version, dir, packages, fullDocs)
+	if err != nil {
+		return fail("Failed to summarize module: %v", err)
+	}
+	return printJSON(summary)
+}
+
+// summarizeModule walks the module's directories, skipping internal
+// packages, nested modules, main packages and directories the go tool
+// ignores
+func summarizeModule(modulePath, version, dir string, only []string, fullDocs bool) (*DependencySummary, error) {
+	summary := &DependencySummary{Module: modulePath, Version: version, Dir: dir, Packages: []PackageAPI{}}
+
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != dir {
+			if skipDir(entry.Name()) || entry.Name() == "internal" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		importPath := modulePath
+		if rel != "." {
+			importPath += "/" + filepath.ToSlash(rel)
+		}
+		if len(only) > 0 && !contains(only, importPath) {
+			return nil
+		}
+
+		api, err := summarizePackage(path, importPath, fullDocs)
+		if err != nil {
+			return err
+		}
+		if api != nil {
+			summary.Packages = append(summary.Packages, *api)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// summarizePackage reads the exported API of the package in dir, or returns
+// nil when the directory holds no importable package. Files excluded by
+// build constraints for the current platform are left out.
+func summarizePackage(dir, importPath string, fullDocs bool) (*PackageAPI, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if match, err := build.Default.MatchFile(dir, name); err != nil || !match {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	pkg, err := doc.NewFromFiles(fset, files, importPath)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.Name == "main" {
+		return nil, nil
+	}
+
+	docText := func(text string) string {
+		if fullDocs {
+			return strings.TrimSpace(text)
+		}
+		return pkg.Synopsis(text)
+	}
+	funcs := func(fns []*doc.Func) []APISymbol {
+		symbols := []APISymbol{}
+		for _, fn := range fns {
+			symbols = append(symbols, APISymbol{Name: fn.Name, Signature: declSignature(fset, fn.Decl), Doc: docText(fn.Doc)})
+		}
+		return symbols
+	}
+	values := func(vals []*doc.Value) []APIValue {
+		result := []APIValue{}
+		for _, val := range vals {
+			result = append(result, APIValue{Names: val.Names, Signature: declSignature(fset, val.Decl), Doc: docText(val.Doc)})
+		}
+		return result
+	}
+
+	api := &PackageAPI{
+		Path:      importPath,
+		Name:      pkg.Name,
+		Doc:       docText(pkg.Doc),
+		Constants: values(pkg.Consts),
+		Variables: values(pkg.Vars),
+		Functions: funcs(pkg.Funcs),
+		Types:     []APIType{},
+	}
+	for _, t := range pkg.Types {
+		// Typed constants and variables are grouped under their type by
+		// go/doc; keep them with the package's own
+		api.Constants = append(api.Constants, values(t.Consts)...)
+		api.Variables = append(api.Variables, values(t.Vars)...)
+		api.Types = append(api.Types, APIType{
+			Name:         t.Name,
+			Signature:    declSignature(fset, t.Decl),
+			Doc:          docText(t.Doc),
+			Constructors: funcs(t.Funcs),
+			Methods:      funcs(t.Methods),
+		})
+	}
+	sort.SliceStable(api.Constants, func(i, j int) bool { return api.Constants[i].Names[0] < api.Constants[j].Names[0] })
+	sort.SliceStable(api.Variables, func(i, j int) bool { return api.Variables[i].Names[0] < api.Variables[j].Names[0] })
+	return api, nil
+}
+
+// declSignature formats a declaration without its doc comment or body
+func declSignature(fset *token.FileSet, decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		copied := *d
+		copied.Doc, copied.Body = nil, nil
+		decl = &copied
+	case *ast.GenDecl:
+		copied := *d
+		copied.Doc = nil
+		copied.Specs = append([]ast.Spec{}, d.Specs...)
+		for i, spec := range copied.Specs {
+			if ts, ok := spec.(*ast.TypeSpec); ok {
+				typeSpec := *ts
+				typeSpec.Doc = nil
+				copied.Specs[i] = &typeSpec
+			}
+		}
+		decl = &copied
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, decl); err != nil {
+		return ""
+	}
+	return buf.String()
+}
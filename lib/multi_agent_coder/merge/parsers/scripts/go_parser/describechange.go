@@ -0,0 +1,480 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChangeDescription summarizes the difference between two trees of Go
+// source for a commit message or CHANGELOG entry: the files and top-level
+// symbols added, changed and removed, and notes on behavior worth calling
+// out, such as a function that starts writing files. Summary is a one-line
+// subject; Changelog drafts entries for the exported symbols only, since
+// unexported ones are not part of what users of the package see.
+type ChangeDescription struct {
+	Summary   string         `json:"summary"`
+	Files     []FileChange   `json:"files"`
+	Symbols   []SymbolChange `json:"symbols"`
+	Notes     []BehaviorNote `json:"notes"`
+	Changelog ChangelogDraft `json:"changelog"`
+	Errors    []FileError    `json:"errors"`
+}
+
+// FileChange is a file that differs, relative to the compared roots. Status
+// is added, removed or modified.
+type FileChange struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+// SymbolChange is a top-level declaration that was added, removed or
+// changed. Aspects says what changed: signature and body for functions,
+// definition for types and values, and doc for any of them. ID is the
+// declaration's persistent ID on the new side, the old one's for a removed
+// symbol, and PreviousID the old one's when the code changed, so a rename is
+// a symbol removed and one added with the same ID.
+type SymbolChange struct {
+	File       string   `json:"file"`
+	Name       string   `json:"name"`
+	ID         string   `json:"id,omitempty"`
+	PreviousID string   `json:"previous_id,omitempty"`
+	Kind       string   `json:"kind"`
+	Change     string   `json:"change"`
+	Exported   bool     `json:"exported"`
+	Aspects    []string `json:"aspects,omitempty"`
+}
+
+// BehaviorNote is a change of effect: a function that gained or lost a side
+// effect (Effect is an I/O call such as os.Remove, go, panic or os.Exit) or
+// a file that gained or lost an import. Kind is effect_added,
+// effect_removed, import_added or import_removed.
+type BehaviorNote struct {
+	File   string `json:"file"`
+	Symbol string `json:"symbol,omitempty"`
+	Kind   string `json:"kind"`
+	Effect string `json:"effect"`
+	Note   string `json:"note"`
+}
+
+// ChangelogDraft groups changelog lines the way Keep a Changelog does
+type ChangelogDraft struct {
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+}
+
+func runDescribeChange(args []string) int {
+	diff := false
+	strict := false
+
+	flags := flag.NewFlagSet("describe-change", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.BoolVar(&diff, "diff", false, "describe the difference between the old and new trees given as arguments")
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(positional) != 2 || (!diff && (isDirectory(positional[0]) || isDirectory(positional[1]))) {
+		return fail("Usage: describe-change --diff old/ new/, or describe-change old.go new.go")
+	}
+
+	description, err := describeChange(positional[0], positional[1])
+	if err != nil {
+		return fail("Describe failed: %v", err)
+	}
+	if err := strictFailure(description.Errors, strict); err != nil {
+		return fail("Describe failed: %v", err)
+	}
+	return printJSON(description)
+}
+
+// describeChange compares two files, or the Go files of two directories
+// paired by their path below the directory
+func describeChange(oldRoot, newRoot string) (*ChangeDescription, error) {
+	description := &ChangeDescription{
+		Files:     []FileChange{},
+		Symbols:   []SymbolChange{},
+		Notes:     []BehaviorNote{},
+		Changelog: ChangelogDraft{Added: []string{}, Changed: []string{}, Removed: []string{}},
+		Errors:    []FileError{},
+	}
+
+	oldFiles, err := changeTreeFiles(oldRoot)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := changeTreeFiles(newRoot)
+	if err != nil {
+		return nil, err
+	}
+	// Two files are one file's change, whatever their names
+	if !isDirectory(oldRoot) && !isDirectory(newRoot) {
+		oldFiles = map[string]string{filepath.Base(newRoot): oldRoot}
+	}
+
+	paths := []string{}
+	for path := range oldFiles {
+		paths = append(paths, path)
+	}
+	for path := range newFiles {
+		if _, ok := oldFiles[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		oldPath, inOld := oldFiles[path]
+		newPath, inNew := newFiles[path]
+
+		var oldFile, newFile *editFile
+		if inOld {
+			if oldFile, err = loadEditFile(oldPath); err != nil {
+				description.Errors = append(description.Errors, FileError{Path: oldPath, Error: err.Error()})
+				continue
+			}
+		}
+		if inNew {
+			if newFile, err = loadEditFile(newPath); err != nil {
+				description.Errors = append(description.Errors, FileError{Path: newPath, Error: err.Error()})
+				continue
+			}
+		}
+		if oldFile != nil && newFile != nil && oldFile.source == newFile.source {
+			continue
+		}
+
+		status := "modified"
+		switch {
+		case !inOld:
+			status = "added"
+		case !inNew:
+			status = "removed"
+		}
+		description.Files = append(description.Files, FileChange{Path: path, Status: status})
+		describeFileChange(description, path, oldFile, newFile)
+	}
+
+	description.Changelog = draftChangelog(description)
+	description.Summary = changeSummary(description)
+	return description, nil
+}
+
+// isDirectory reports whether path names an existing directory
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// changeTreeFiles maps the Go files of root to their path relative to it,
+// or a single file to its base name
+func changeTreeFiles(root string) (map[string]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return map[string]string{filepath.Base(root): root}, nil
+	}
+	paths, err := collectGoFiles([]string{filepath.Join(root, "...")}, true)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	for _, path := range paths {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.ToSlash(rel)] = path
+	}
+	return files, nil
+}
+
+// describeFileChange adds the symbol changes and behavior notes of one file;
+// a nil side stands for a file that does not exist there
+func describeFileChange(description *ChangeDescription, path string, oldFile, newFile *editFile) {
+	oldSymbols, oldOrder := changeSymbols(oldFile)
+	newSymbols, newOrder := changeSymbols(newFile)
+	oldIDs, newIDs := map[string]string{}, map[string]string{}
+	if oldFile != nil {
+		oldIDs = symbolIDsByName(oldFile.fset, oldFile.file)
+	}
+	if newFile != nil {
+		newIDs = symbolIDsByName(newFile.fset, newFile.file)
+	}
+
+	for _, name := range newOrder {
+		if _, ok := oldSymbols[name]; !ok {
+			decl := newSymbols[name]
+			description.Symbols = append(description.Symbols, SymbolChange{File: path, Name: name, ID: newIDs[name], Kind: decl.kind, Change: "added", Exported: symbolExported(name)})
+		}
+	}
+	for _, name := range oldOrder {
+		decl := oldSymbols[name]
+		next, ok := newSymbols[name]
+		if !ok {
+			description.Symbols = append(description.Symbols, SymbolChange{File: path, Name: name, ID: oldIDs[name], Kind: decl.kind, Change: "removed", Exported: symbolExported(name)})
+			continue
+		}
+		if aspects := changedAspects(oldFile, newFile, decl, next); len(aspects) > 0 {
+			change := SymbolChange{File: path, Name: name, ID: newIDs[name], Kind: next.kind, Change: "changed", Exported: symbolExported(name), Aspects: aspects}
+			if oldIDs[name] != change.ID {
+				change.PreviousID = oldIDs[name]
+			}
+			description.Symbols = append(description.Symbols, change)
+		}
+	}
+
+	// Effects are compared for the functions on both sides only; an added or
+	// removed function is a change of its own
+	for _, name := range newOrder {
+		decl, ok := oldSymbols[name]
+		next := newSymbols[name]
+		if !ok || decl.fn == nil || next.fn == nil {
+			continue
+		}
+		before, after := functionEffects(decl.fn), functionEffects(next.fn)
+		for _, effect := range sortedSetDifference(after, before) {
+			description.Notes = append(description.Notes, BehaviorNote{File: path, Symbol: name, Kind: "effect_added", Effect: effect, Note: fmt.Sprintf("%s now %s", name, effectPhrase(effect))})
+		}
+		for _, effect := range sortedSetDifference(before, after) {
+			description.Notes = append(description.Notes, BehaviorNote{File: path, Symbol: name, Kind: "effect_removed", Effect: effect, Note: fmt.Sprintf("%s no longer %s", name, effectPhrase(effect))})
+		}
+	}
+
+	before, after := fileImports(oldFile), fileImports(newFile)
+	for _, imp := range sortedSetDifference(after, before) {
+		description.Notes = append(description.Notes, BehaviorNote{File: path, Kind: "import_added", Effect: imp, Note: fmt.Sprintf("%s imports %s", path, imp)})
+	}
+	for _, imp := range sortedSetDifference(before, after) {
+		description.Notes = append(description.Notes, BehaviorNote{File: path, Kind: "import_removed", Effect: imp, Note: fmt.Sprintf("%s no longer imports %s", path, imp)})
+	}
+}
+
+// changeSymbols indexes a file's top-level symbols by name, keeping the last
+// of several init functions, and returns the names in source order
+func changeSymbols(file *editFile) (map[string]symbolDecl, []string) {
+	symbols := map[string]symbolDecl{}
+	order := []string{}
+	if file == nil {
+		return symbols, order
+	}
+	for _, decl := range topLevelSymbols(file.file) {
+		if decl.name == "_" {
+			continue
+		}
+		if _, ok := symbols[decl.name]; !ok {
+			order = append(order, decl.name)
+		}
+		symbols[decl.name] = decl
+	}
+	return symbols, order
+}
+
+// changedAspects compares the formatted source of a declaration on both
+// sides, so that reformatting alone is not a change
+func changedAspects(oldFile, newFile *editFile, old, new symbolDecl) []string {
+	aspects := []string{}
+	if old.fn != nil && new.fn != nil {
+		if funcSignature(old.fn) != funcSignature(new.fn) {
+			aspects = append(aspects, "signature")
+		}
+		if formatNode(oldFile.fset, bodyOrEmpty(old.fn)) != formatNode(newFile.fset, bodyOrEmpty(new.fn)) {
+			aspects = append(aspects, "body")
+		}
+	} else if formatNode(oldFile.fset, withoutDocs(old.node)) != formatNode(newFile.fset, withoutDocs(new.node)) {
+		aspects = append(aspects, "definition")
+	}
+	if old.doc.Text() != new.doc.Text() {
+		aspects = append(aspects, "doc")
+	}
+	return aspects
+}
+
+func bodyOrEmpty(fn *ast.FuncDecl) ast.Node {
+	if fn.Body == nil {
+		return &ast.BlockStmt{}
+	}
+	return fn.Body
+}
+
+// withoutDocs copies a declaration or spec with its doc and line comments
+// removed
+func withoutDocs(node ast.Node) ast.Node {
+	stripSpec := func(spec ast.Spec) ast.Spec {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			copied := *s
+			copied.Doc, copied.Comment = nil, nil
+			return &copied
+		case *ast.ValueSpec:
+			copied := *s
+			copied.Doc, copied.Comment = nil, nil
+			return &copied
+		}
+		return spec
+	}
+	switch n := node.(type) {
+	case *ast.GenDecl:
+		copied := *n
+		copied.Doc = nil
+		copied.Specs = make([]ast.Spec, len(n.Specs))
+		for i, spec := range n.Specs {
+			copied.Specs[i] = stripSpec(spec)
+		}
+		return &copied
+	case ast.Spec:
+		return stripSpec(n)
+	}
+	return node
+}
+
+// functionEffects lists the effects of a function's body: the calls the
+// side effect taxonomy classifies, goroutines, panics and exits
+func functionEffects(fn *ast.FuncDecl) map[string]bool {
+	effects := map[string]bool{}
+	if fn.Body == nil {
+		return effects
+	}
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.GoStmt:
+			effects["go"] = true
+		case *ast.CallExpr:
+			name := getFuncName(node.Fun)
+			switch {
+			case name == "panic" || name == "os.Exit" || name == "log.Fatal" || name == "log.Fatalf":
+				effects[name] = true
+			case sideEffectCategory(name) != "":
+				effects[name] = true
+			}
+		}
+		return true
+	})
+	return effects
+}
+
+// effectPhrase words an effect for a note, after "now" or "no longer"
+func effectPhrase(effect string) string {
+	switch effect {
+	case "go":
+		return "starts a goroutine"
+	case "panic":
+		return "panics"
+	case "os.Exit", "log.Fatal", "log.Fatalf":
+		return "can exit the process through " + effect
+	}
+	return "calls " + effect
+}
+
+func fileImports(file *editFile) map[string]bool {
+	imports := map[string]bool{}
+	if file == nil {
+		return imports
+	}
+	for _, imp := range file.file.Imports {
+		imports[strings.Trim(imp.Path.Value, "\"`")] = true
+	}
+	return imports
+}
+
+// sortedSetDifference returns the members of a that b lacks, sorted
+func sortedSetDifference(a, b map[string]bool) []string {
+	members := []string{}
+	for member := range a {
+		if !b[member] {
+			members = append(members, member)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// symbolExported reports whether a symbol is visible outside its package; a
+// method is when both its type and its name are
+func symbolExported(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if !isExported(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// draftChangelog words the exported symbol changes and the notes on them as
+// changelog lines
+func draftChangelog(description *ChangeDescription) ChangelogDraft {
+	draft := ChangelogDraft{Added: []string{}, Changed: []string{}, Removed: []string{}}
+	for _, symbol := range description.Symbols {
+		if !symbol.Exported {
+			continue
+		}
+		switch symbol.Change {
+		case "added":
+			draft.Added = append(draft.Added, fmt.Sprintf("%s `%s`", symbol.Kind, symbol.Name))
+		case "removed":
+			draft.Removed = append(draft.Removed, fmt.Sprintf("%s `%s`", symbol.Kind, symbol.Name))
+		case "changed":
+			if contains(symbol.Aspects, "signature") || contains(symbol.Aspects, "definition") {
+				draft.Changed = append(draft.Changed, fmt.Sprintf("%s `%s` has a new %s", symbol.Kind, symbol.Name, aspectNoun(symbol.Kind)))
+			}
+		}
+	}
+	for _, note := range description.Notes {
+		if note.Symbol != "" && symbolExported(note.Symbol) {
+			draft.Changed = append(draft.Changed, note.Note)
+		}
+	}
+	return draft
+}
+
+func aspectNoun(kind string) string {
+	if kind == "func" || kind == "method" {
+		return "signature"
+	}
+	return "definition"
+}
+
+// changeSummary is a commit subject naming up to three symbols per change,
+// exported ones first
+func changeSummary(description *ChangeDescription) string {
+	byChange := map[string][]string{}
+	for _, exported := range []bool{true, false} {
+		for _, symbol := range description.Symbols {
+			if symbol.Exported == exported {
+				byChange[symbol.Change] = append(byChange[symbol.Change], symbol.Name)
+			}
+		}
+	}
+
+	parts := []string{}
+	for _, change := range []struct{ key, verb string }{{"added", "add"}, {"changed", "update"}, {"removed", "remove"}} {
+		names := byChange[change.key]
+		if len(names) == 0 {
+			continue
+		}
+		listed := strings.Join(names[:min(3, len(names))], ", ")
+		if len(names) > 3 {
+			listed += fmt.Sprintf(" and %d more", len(names)-3)
+		}
+		parts = append(parts, change.verb+" "+listed)
+	}
+	switch {
+	case len(parts) > 0:
+		summary := strings.Join(parts, "; ")
+		return strings.ToUpper(summary[:1]) + summary[1:]
+	case len(description.Files) == 1:
+		return "Update " + description.Files[0].Path
+	case len(description.Files) > 1:
+		return fmt.Sprintf("Update %d files", len(description.Files))
+	}
+	return "No changes"
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDescribeChangeTwoFiles(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, newPath := filepath.Join(dir, "base.go"), filepath.Join(dir, "ours.go")
+	if err := os.WriteFile(oldPath, []byte("package p\n\nfunc A() int { return 1 }\n\nfunc B() {}\n\nfunc C() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, []byte("package p\n\nfunc A() int { return 2 }\n\nfunc B() {}\n\nfunc D() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	description, err := describeChange(oldPath, newPath)
+	if err != nil {
+		t.Fatalf("describeChange: %v", err)
+	}
+	if len(description.Files) != 1 || description.Files[0].Path != "ours.go" || description.Files[0].Status != "modified" {
+		t.Errorf("files = %+v, want ours.go modified", description.Files)
+	}
+	changes := map[string]string{}
+	for _, symbol := range description.Symbols {
+		changes[symbol.Name] = symbol.Change
+	}
+	want := map[string]string{"A": "changed", "C": "removed", "D": "added"}
+	if len(changes) != len(want) {
+		t.Errorf("symbols = %v, want %v", changes, want)
+	}
+	for name, change := range want {
+		if changes[name] != change {
+			t.Errorf("%s: change = %q, want %q", name, changes[name], change)
+		}
+	}
+}
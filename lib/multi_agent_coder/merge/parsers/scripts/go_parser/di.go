@@ -0,0 +1,194 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// DIGraph describes how the file wires its collaborators: the constructors
+// it declares, the dependencies each takes, and the places that build a type
+// directly even though it has a constructor
+type DIGraph struct {
+	Constructors   []Constructor         `json:"constructors"`
+	Edges          []DIEdge              `json:"edges"`
+	Instantiations []DirectInstantiation `json:"direct_instantiations"`
+}
+
+// Constructor is a NewX function and the type it builds
+type Constructor struct {
+	Name         string         `json:"name"`
+	Type         string         `json:"type"`
+	Dependencies []DIDependency `json:"dependencies"`
+	ReturnsError bool           `json:"returns_error"`
+}
+
+// DIDependency is a constructor parameter
+type DIDependency struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+}
+
+// DIEdge links a constructed type to a type it depends on
+type DIEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DirectInstantiation is a composite literal or new() call for a type that
+// has a constructor, outside that constructor
+type DirectInstantiation struct {
+	Type        string `json:"type"`
+	Constructor string `json:"constructor"`
+	In          string `json:"in,omitempty"`
+	Line        int    `json:"line"`
+}
+
+// buildDIGraph finds constructors by the NewX naming convention: an
+// unreceived function named New or New... (or new...) returning a named type
+func buildDIGraph(fset *token.FileSet, file *ast.File) *DIGraph {
+	graph := &DIGraph{
+		Constructors:   []Constructor{},
+		Edges:          []DIEdge{},
+		Instantiations: []DirectInstantiation{},
+	}
+
+	constructors := map[string][]string{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		typeName := constructorType(fn)
+		if typeName == "" {
+			continue
+		}
+		constructors[typeName] = append(constructors[typeName], fn.Name.Name)
+
+		ctor := Constructor{Name: fn.Name.Name, Type: typeName, Dependencies: []DIDependency{}}
+		for _, field := range fn.Type.Params.List {
+			typeString := types.ExprString(field.Type)
+			if len(field.Names) == 0 {
+				ctor.Dependencies = append(ctor.Dependencies, DIDependency{Type: typeString})
+			}
+			for _, name := range field.Names {
+				ctor.Dependencies = append(ctor.Dependencies, DIDependency{Name: name.Name, Type: typeString})
+			}
+			if to := dependencyType(field.Type); to != "" && !containsEdge(graph.Edges, typeName, to) {
+				graph.Edges = append(graph.Edges, DIEdge{From: typeName, To: to})
+			}
+		}
+		for _, field := range fn.Type.Results.List {
+			if ident, ok := field.Type.(*ast.Ident); ok && ident.Name == "error" {
+				ctor.ReturnsError = true
+			}
+		}
+		graph.Constructors = append(graph.Constructors, ctor)
+	}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		builds := constructorType(fn)
+		in := symbolName(fn)
+
+		record := func(expr ast.Expr, pos token.Pos) {
+			ident, ok := expr.(*ast.Ident)
+			if !ok || ident.Name == builds {
+				return
+			}
+			if names := constructors[ident.Name]; len(names) > 0 {
+				graph.Instantiations = append(graph.Instantiations, DirectInstantiation{
+					Type:        ident.Name,
+					Constructor: names[0],
+					In:          in,
+					Line:        fset.Position(pos).Line,
+				})
+			}
+		}
+
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.CompositeLit:
+				record(node.Type, node.Pos())
+			case *ast.CallExpr:
+				if ident, ok := node.Fun.(*ast.Ident); ok && ident.Name == "new" && len(node.Args) == 1 {
+					record(node.Args[0], node.Pos())
+				}
+			}
+			return true
+		})
+	}
+
+	return graph
+}
+
+// constructorType returns the type fn constructs, or "" if it is not a
+// constructor. The name is New or new, alone or followed by an upper-case
+// word, so Newline and newer are not constructors.
+func constructorType(fn *ast.FuncDecl) string {
+	if fn.Recv != nil || fn.Type.Results == nil || len(fn.Type.Results.List) == 0 {
+		return ""
+	}
+	name := fn.Name.Name
+	if !strings.HasPrefix(name, "New") && !strings.HasPrefix(name, "new") {
+		return ""
+	}
+	if rest := name[len("New"):]; rest != "" && !token.IsExported(rest) {
+		return ""
+	}
+
+	result := fn.Type.Results.List[0].Type
+	if star, ok := result.(*ast.StarExpr); ok {
+		result = star.X
+	}
+	switch t := result.(type) {
+	case *ast.Ident:
+		if types.Universe.Lookup(t.Name) != nil {
+			return ""
+		}
+		return t.Name
+	case *ast.SelectorExpr:
+		return types.ExprString(t)
+	}
+	return ""
+}
+
+// dependencyType reduces a parameter type to the named type it depends on,
+// looking through pointers, slices, variadics and maps' values. Builtin
+// types are not dependencies.
+func dependencyType(expr ast.Expr) string {
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.ArrayType:
+			expr = t.Elt
+		case *ast.Ellipsis:
+			expr = t.Elt
+		case *ast.MapType:
+			expr = t.Value
+		case *ast.Ident:
+			if types.Universe.Lookup(t.Name) != nil {
+				return ""
+			}
+			return t.Name
+		case *ast.SelectorExpr:
+			return types.ExprString(t)
+		default:
+			return ""
+		}
+	}
+}
+
+func containsEdge(edges []DIEdge, from, to string) bool {
+	for _, edge := range edges {
+		if edge.From == from && edge.To == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestConstructorType(t *testing.T) {
+	tests := []struct {
+		decl string
+		want string
+	}{
+		{"func NewServer() *Server", "Server"},
+		{"func newServer() *Server", "Server"},
+		{"func New() Client", "Client"},
+		{"func Newline() *Writer", ""},
+		{"func newer() *Version", ""},
+		{"func New_server() *Server", ""},
+		{"func NewCount() int", ""},
+		{"func MakeServer() *Server", ""},
+		{"func NewServer()", ""},
+		{"func NewStore() *sql.DB", "sql.DB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.decl, func(t *testing.T) {
+			file, err := parser.ParseFile(token.NewFileSet(), "di.go", "package p\n\n"+tt.decl+" { panic(0) }\n", 0)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got := constructorType(file.Decls[0].(*ast.FuncDecl)); got != tt.want {
+				t.Errorf("constructorType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DiffTestReport is the outcome of running two candidates' implementations
+// of a function on the same generated inputs. Passed is false when they
+// disagreed on any of them.
+type DiffTestReport struct {
+	Function    string           `json:"function"`
+	Signature   string           `json:"signature"`
+	A           string           `json:"a"`
+	B           string           `json:"b"`
+	Seed        int64            `json:"seed"`
+	Runs        int              `json:"runs"`
+	Passed      bool             `json:"passed"`
+	Divergences []DiffDivergence `json:"divergences"`
+}
+
+// DiffDivergence is an input the candidates disagreed on, with the
+// arguments formatted as Go values and what each candidate did with them.
+// An input is reported once, however often the generator draws it.
+type DiffDivergence struct {
+	Inputs []string    `json:"inputs"`
+	A      DiffOutcome `json:"a"`
+	B      DiffOutcome `json:"b"`
+}
+
+// DiffOutcome is what a call did: returned Results, strings and byte slices
+// quoted and other values as %+v prints them, panicked with Panic, or did
+// not return within the timeout. Two calls agree when they return the same
+// results or both panic.
+type DiffOutcome struct {
+	Results []string `json:"results,omitempty"`
+	Panic   string   `json:"panic,omitempty"`
+	Timeout bool     `json:"timeout,omitempty"`
+}
+
+// difftestEntry is the exported wrapper added to each candidate, so the
+// harness reaches unexported functions too
+const difftestEntry = "DifftestCall"
+
+func runDiffTest(args []string) int {
+	var function string
+	runs, maxDivergences := 500, 10
+	seed := int64(1)
+	timeout := time.Second
+	keep := false
+
+	flags := flag.NewFlagSet("difftest", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&function, "fn", "", "top-level function both candidates implement")
+	flags.IntVar(&runs, "runs", runs, "number of inputs to try, the first two the zero and small fuzz seeds")
+	flags.Int64Var(&seed, "seed", seed, "seed of the input generator, so a run can be repeated")
+	flags.DurationVar(&timeout, "timeout", timeout, "time a call may take before it counts as hanging")
+	flags.IntVar(&maxDivergences, "max-divergences", maxDivergences, "stop after this many distinct inputs the candidates disagree on")
+	flags.BoolVar(&keep, "keep", false, "leave the generated harness in place and print its path on stderr")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if function == "" || len(positional) != 2 {
+		return fail("Usage: difftest --fn Name [--runs 500] [--seed 1] [--timeout 1s] a.go b.go")
+	}
+
+	candidates := make([]*editFile, 2)
+	decls := make([]*ast.FuncDecl, 2)
+	for i, path := range positional {
+		candidates[i], err = loadSnippet(path)
+		if err != nil {
+			return fail("Failed to parse %s: %v", path, err)
+		}
+		if decls[i] = findFunction(candidates[i].file, function); decls[i] == nil {
+			return fail("%s does not declare function %s", path, function)
+		}
+	}
+
+	params := fieldParams(decls[0].Type.Params)
+	results := fieldParams(decls[0].Type.Results)
+	signature := canonicalSignature(params, results)
+	if other := canonicalSignature(fieldParams(decls[1].Type.Params), fieldParams(decls[1].Type.Results)); other != signature {
+		return fail("Signatures differ: %s in %s, %s in %s", signature, positional[0], other, positional[1])
+	}
+	if decls[0].Type.TypeParams != nil || decls[1].Type.TypeParams != nil {
+		return fail("%s is generic; only functions of concrete types can be tested", function)
+	}
+	if len(params) == 0 {
+		return fail("%s has no parameters to generate", function)
+	}
+	for _, param := range params {
+		if _, ok := fuzzSeeds[param.Type]; !ok {
+			return fail("Parameter type %s cannot be generated", param.Type)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "go_parser-difftest-")
+	if err != nil {
+		return fail("Failed to create harness: %v", err)
+	}
+	if keep {
+		fmt.Fprintln(os.Stderr, dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+
+	files := map[string]string{
+		"go.mod":  "module difftest\n\ngo 1.21\n",
+		"main.go": difftestHarness(params, results, runs, maxDivergences, seed, timeout),
+	}
+	for i, pkg := range []string{"a", "b"} {
+		files[filepath.Join(pkg, "candidate.go")] = difftestCandidate(candidates[i], decls[i], pkg)
+	}
+	for path, content := range files {
+		target := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fail("Failed to write harness: %v", err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0o644); err != nil {
+			return fail("Failed to write harness: %v", err)
+		}
+	}
+
+	if output, err := runHarnessCommand(dir, "go", "build", "-o", "harness", "."); err != nil {
+		return fail("Failed to build the harness: %v\n%s", err, output)
+	}
+	reportPath := filepath.Join(dir, "report.json")
+	output, err := runHarnessCommand(dir, filepath.Join(dir, "harness"), reportPath)
+	data, readErr := os.ReadFile(reportPath)
+	if readErr != nil {
+		return fail("Harness exited without a report: %v\n%s", err, output)
+	}
+
+	report := &DiffTestReport{Function: function, Signature: signature, A: positional[0], B: positional[1], Seed: seed}
+	if err := json.Unmarshal(data, report); err != nil {
+		return fail("Invalid harness report: %v", err)
+	}
+	report.Passed = len(report.Divergences) == 0
+
+	code := printJSON(report)
+	if code == 0 && !report.Passed {
+		return exitViolations
+	}
+	return code
+}
+
+// findFunction returns the top-level function of file called name, not a
+// method
+func findFunction(file *ast.File, name string) *ast.FuncDecl {
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// runHarnessCommand runs a command in the harness directory, outside any
+// workspace the caller is in, and returns the tail of its output
+func runHarnessCommand(dir, name string, args ...string) (string, error) {
+	var output bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err := cmd.Run()
+
+	text := output.String()
+	if len(text) > maxStageOutput {
+		text = "..." + text[len(text)-maxStageOutput:]
+	}
+	return text, err
+}
+
+// difftestCandidate returns a candidate's source as package pkg, with an
+// exported wrapper calling fn. The wrapper's types are written as in the
+// candidate, so they resolve through its imports.
+func difftestCandidate(candidate *editFile, fn *ast.FuncDecl, pkg string) string {
+	candidate.file.Name.Name = pkg
+	source := formatNode(candidate.fset, candidate.file)
+
+	params, results := fieldParams(fn.Type.Params), fieldParams(fn.Type.Results)
+	declared := make([]string, len(params))
+	args := make([]string, len(params))
+	for i, param := range params {
+		args[i] = fmt.Sprintf("p%d", i)
+		declared[i] = args[i] + " " + param.Type
+	}
+	resultTypes := make([]string, len(results))
+	for i, result := range results {
+		resultTypes[i] = result.Type
+	}
+
+	call := fmt.Sprintf("%s(%s)", fn.Name.Name, strings.Join(args, ", "))
+	returns := ""
+	if len(results) > 0 {
+		call = "return " + call
+		returns = " (" + strings.Join(resultTypes, ", ") + ")"
+	}
+	return fmt.Sprintf("%s\nfunc %s(%s)%s {\n\t%s\n}\n", source, difftestEntry, strings.Join(declared, ", "), returns, call)
+}
+
+// difftestGenerators are the expressions the harness draws a random value
+// of each generatable type with
+var difftestGenerators = map[string]string{
+	"string":  "randString(r)",
+	"[]byte":  "[]byte(randString(r))",
+	"bool":    "r.Intn(2) == 1",
+	"float32": "float32(randFloat(r))",
+	"float64": "randFloat(r)",
+}
+
+// difftestHarness writes the main package that calls both candidates on the
+// seeds and then on random inputs, and writes the divergences as JSON to the
+// path it is given
+func difftestHarness(params, results []ParamInfo, runs, maxDivergences int, seed int64, timeout time.Duration) string {
+	names := make([]string, len(params))
+	zero := make([]string, len(params))
+	small := make([]string, len(params))
+	random := make([]string, len(params))
+	shown := make([]string, len(params))
+	for i, param := range params {
+		names[i] = fmt.Sprintf("p%d", i)
+		zero[i] = fuzzSeeds[param.Type][0]
+		small[i] = fuzzSeeds[param.Type][1]
+		random[i] = difftestGenerators[param.Type]
+		if random[i] == "" {
+			random[i] = param.Type + "(randInt(r))"
+		}
+		shown[i] = fmt.Sprintf("show(%q, %s)", param.Type, names[i])
+	}
+
+	var b strings.Builder
+	b.WriteString(difftestPrelude)
+	fmt.Fprintf(&b, "\nfunc main() {\n\tr := rand.New(rand.NewSource(%d))\n", seed)
+	b.WriteString("\trep := report{Divergences: []divergence{}}\n")
+	b.WriteString("\t// Inputs already reported, by their JSON encoding, so that a repeated\n\t// input does not use up the divergences allowed\n")
+	b.WriteString("\tseen := map[string]bool{}\n")
+	fmt.Fprintf(&b, "\tfor run := 0; run < %d && len(rep.Divergences) < %d; run++ {\n", runs, maxDivergences)
+	for i, param := range params {
+		fmt.Fprintf(&b, "\t\tvar %s %s\n", names[i], param.Type)
+	}
+	list := strings.Join(names, ", ")
+	b.WriteString("\t\tswitch run {\n")
+	fmt.Fprintf(&b, "\t\tcase 0:\n\t\t\t%s = %s\n", list, strings.Join(zero, ", "))
+	fmt.Fprintf(&b, "\t\tcase 1:\n\t\t\t%s = %s\n", list, strings.Join(small, ", "))
+	fmt.Fprintf(&b, "\t\tdefault:\n\t\t\t%s = %s\n\t\t}\n", list, strings.Join(random, ", "))
+	fmt.Fprintf(&b, "\t\tinputs := []string{%s}\n", strings.Join(shown, ", "))
+	for _, pkg := range []string{"a", "b"} {
+		fmt.Fprintf(&b, "\t\t%s := call(%d, func() []string {\n", pkg+"Out", int64(timeout))
+		b.WriteString(difftestCall(pkg, params, results))
+		b.WriteString("\t\t})\n")
+	}
+	b.WriteString("\t\trep.Runs++\n")
+	b.WriteString("\t\tif key, _ := json.Marshal(inputs); !agree(aOut, bOut) && !seen[string(key)] {\n")
+	b.WriteString("\t\t\tseen[string(key)] = true\n")
+	b.WriteString("\t\t\trep.Divergences = append(rep.Divergences, divergence{Inputs: inputs, A: aOut, B: bOut})\n\t\t}\n")
+	b.WriteString("\t\t// A hanging call keeps running, so later timings would be off\n")
+	b.WriteString("\t\tif aOut.Timeout || bOut.Timeout {\n\t\t\tbreak\n\t\t}\n\t}\n")
+	b.WriteString("\tdata, _ := json.Marshal(rep)\n\tif err := os.WriteFile(os.Args[1], data, 0o644); err != nil {\n\t\tpanic(err)\n\t}\n}\n")
+	return b.String()
+}
+
+// difftestCall writes the body of the closure calling pkg's wrapper. Byte
+// slices are copied for each candidate, which may modify them.
+func difftestCall(pkg string, params, results []ParamInfo) string {
+	args := make([]string, len(params))
+	for i, param := range params {
+		args[i] = fmt.Sprintf("p%d", i)
+		if param.Type == "[]byte" {
+			args[i] = fmt.Sprintf("cloneBytes(p%d)", i)
+		}
+	}
+	call := fmt.Sprintf("%s.%s(%s)", pkg, difftestEntry, strings.Join(args, ", "))
+	if len(results) == 0 {
+		return fmt.Sprintf("\t\t\t%s\n\t\t\treturn nil\n", call)
+	}
+
+	vars := make([]string, len(results))
+	shown := make([]string, len(results))
+	for i, result := range results {
+		vars[i] = fmt.Sprintf("r%d", i)
+		shown[i] = fmt.Sprintf("show(%q, %s)", result.Type, vars[i])
+	}
+	return fmt.Sprintf("\t\t\t%s := %s\n\t\t\treturn []string{%s}\n", strings.Join(vars, ", "), call, strings.Join(shown, ", "))
+}
+
+// difftestPrelude is the fixed part of the harness: the report written, the
+// guarded call and the random value generators, which favour the edge
+// values implementations tend to disagree on
+const difftestPrelude = `// Code generated by go_parser difftest. DO NOT EDIT.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+
+	"difftest/a"
+	"difftest/b"
+)
+
+type outcome struct {
+	Results []string ` + "`json:\"results,omitempty\"`" + `
+	Panic   string   ` + "`json:\"panic,omitempty\"`" + `
+	Timeout bool     ` + "`json:\"timeout,omitempty\"`" + `
+}
+
+type divergence struct {
+	Inputs []string ` + "`json:\"inputs\"`" + `
+	A      outcome  ` + "`json:\"a\"`" + `
+	B      outcome  ` + "`json:\"b\"`" + `
+}
+
+type report struct {
+	Runs        int          ` + "`json:\"runs\"`" + `
+	Divergences []divergence ` + "`json:\"divergences\"`" + `
+}
+
+func call(timeout time.Duration, f func() []string) outcome {
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{Panic: fmt.Sprint(r)}
+			}
+		}()
+		done <- outcome{Results: f()}
+	}()
+	select {
+	case o := <-done:
+		return o
+	case <-time.After(timeout):
+		return outcome{Timeout: true}
+	}
+}
+
+func agree(x, y outcome) bool {
+	if x.Timeout || y.Timeout {
+		return x.Timeout == y.Timeout
+	}
+	if x.Panic != "" || y.Panic != "" {
+		return x.Panic != "" && y.Panic != ""
+	}
+	if len(x.Results) != len(y.Results) {
+		return false
+	}
+	for i := range x.Results {
+		if x.Results[i] != y.Results[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func show(typ string, v interface{}) string {
+	if typ == "string" || typ == "[]byte" {
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprintf("%+v", v)
+}
+
+func cloneBytes(p []byte) []byte {
+	if p == nil {
+		return nil
+	}
+	return append([]byte{}, p...)
+}
+
+var stringAlphabets = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"0123456789",
+	"0123456789+-.eE_xob",
+	" \t\n\r\"'\\/:;,.!?()[]{}<>=*&%$#@",
+	"éüßñ日本語😀\u0000\u200b\ufffd",
+}
+
+func randString(r *rand.Rand) string {
+	n := r.Intn(17)
+	runes := make([]rune, n)
+	for i := range runes {
+		alphabet := []rune(stringAlphabets[r.Intn(len(stringAlphabets))])
+		runes[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(runes)
+}
+
+var intEdges = []int64{0, 1, -1, 2, 7, 8, 10, -10, 100, 255, 256, 65535, math.MaxInt32, math.MinInt32, math.MaxInt64, math.MinInt64}
+
+func randInt(r *rand.Rand) int64 {
+	if r.Intn(4) == 0 {
+		return intEdges[r.Intn(len(intEdges))]
+	}
+	return r.Int63n(2001) - 1000
+}
+
+var floatEdges = []float64{0, math.Copysign(0, -1), 1, -1, 0.5, 0.1, 1e-9, 1e9, math.MaxFloat64, math.SmallestNonzeroFloat64, math.Inf(1), math.Inf(-1), math.NaN()}
+
+func randFloat(r *rand.Rand) float64 {
+	if r.Intn(4) == 0 {
+		return floatEdges[r.Intn(len(floatEdges))]
+	}
+	return r.NormFloat64() * 1000
+}
+`
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffTestDeduplicatesInputs(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the harness needs the go command")
+	}
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	if err := os.WriteFile(a, []byte("package p\n\nfunc Flip(v bool) bool { return v }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("package p\n\nfunc Flip(v bool) bool { return false }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only true tells the candidates apart, and most of the runs draw it
+	code, output := captureStdout(t, func() int {
+		return runDiffTest([]string{"--fn", "Flip", "--runs", "50", "--max-divergences", "5", a, b})
+	})
+	if code != exitViolations {
+		t.Fatalf("exit code = %d, want %d: %s", code, exitViolations, output)
+	}
+	var report DiffTestReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		t.Fatalf("output %q: %v", output, err)
+	}
+	if report.Runs != 50 {
+		t.Errorf("runs = %d, want all 50", report.Runs)
+	}
+	if len(report.Divergences) != 1 || len(report.Divergences[0].Inputs) != 1 || report.Divergences[0].Inputs[0] != "true" {
+		t.Errorf("divergences = %+v, want the input true once", report.Divergences)
+	}
+}
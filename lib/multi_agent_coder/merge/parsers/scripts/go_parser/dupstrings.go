@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// defaultMinDuplicates is how many uses of a string literal make it worth a
+// named constant
+const defaultMinDuplicates = 3
+
+// DuplicateString is a string literal repeated across the file. Constant is
+// an existing untyped or string constant with the same value, otherwise
+// SuggestedName is a name for a new one.
+type DuplicateString struct {
+	Value         string `json:"value"`
+	Count         int    `json:"count"`
+	Lines         []int  `json:"lines"`
+	Constant      string `json:"constant,omitempty"`
+	SuggestedName string `json:"suggested_name,omitempty"`
+
+	uses []*ast.BasicLit
+}
+
+// findDuplicateStrings groups the string literals of file by value and
+// returns those used at least minCount times. Import paths, struct tags and
+// the literal defining a string constant are not uses.
+func findDuplicateStrings(fset *token.FileSet, file *ast.File, minCount int) []DuplicateString {
+	duplicates := []DuplicateString{}
+	if minCount < 2 {
+		return duplicates
+	}
+
+	constants := map[string]string{}
+	definitions := map[*ast.BasicLit]bool{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, value := range vs.Values {
+				lit, ok := value.(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING || i >= len(vs.Names) {
+					continue
+				}
+				definitions[lit] = true
+				// A constant of a named string type cannot stand in for a
+				// plain string
+				if vs.Type != nil && !isIdent(vs.Type, "string") {
+					continue
+				}
+				if s, err := strconv.Unquote(lit.Value); err == nil {
+					if _, taken := constants[s]; !taken {
+						constants[s] = vs.Names[i].Name
+					}
+				}
+			}
+		}
+	}
+
+	uses := map[string][]*ast.BasicLit{}
+	order := []string{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.Field:
+			// Skip the tag, but not literals in the field type
+			if node.Type != nil {
+				ast.Inspect(node.Type, func(n ast.Node) bool {
+					if lit, ok := n.(*ast.BasicLit); ok {
+						recordStringUse(lit, definitions, uses, &order)
+					}
+					return true
+				})
+			}
+			return false
+		case *ast.BasicLit:
+			recordStringUse(node, definitions, uses, &order)
+		}
+		return true
+	})
+
+	names := fileIdentifiers(file)
+	for _, value := range order {
+		lits := uses[value]
+		if len(lits) < minCount {
+			continue
+		}
+
+		dup := DuplicateString{Value: value, Count: len(lits), Lines: []int{}, uses: lits}
+		for _, lit := range lits {
+			dup.Lines = append(dup.Lines, fset.Position(lit.Pos()).Line)
+		}
+		if name, ok := constants[value]; ok {
+			dup.Constant = name
+		} else {
+			dup.SuggestedName = constantName(value, names)
+			names[dup.SuggestedName] = true
+		}
+		duplicates = append(duplicates, dup)
+	}
+
+	sort.SliceStable(duplicates, func(i, j int) bool { return duplicates[i].Count > duplicates[j].Count })
+	return duplicates
+}
+
+func recordStringUse(lit *ast.BasicLit, definitions map[*ast.BasicLit]bool, uses map[string][]*ast.BasicLit, order *[]string) {
+	if lit.Kind != token.STRING || definitions[lit] {
+		return
+	}
+	value, err := strconv.Unquote(lit.Value)
+	// Very short strings such as separators read better inline
+	if err != nil || len(strings.TrimSpace(value)) < 2 {
+		return
+	}
+	if uses[value] == nil {
+		*order = append(*order, value)
+	}
+	uses[value] = append(uses[value], lit)
+}
+
+// fileIdentifiers collects every identifier in file, so generated names
+// cannot shadow or collide with anything
+func fileIdentifiers(file *ast.File) map[string]bool {
+	names := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			names[ident.Name] = true
+		}
+		return true
+	})
+	return names
+}
+
+// commonInitialisms are written in capitals inside generated names
+var commonInitialisms = map[string]bool{
+	"api": true, "id": true, "json": true, "url": true, "http": true,
+	"https": true, "sql": true, "xml": true, "html": true, "uuid": true,
+	"tcp": true, "udp": true, "ip": true, "uri": true, "utf8": true,
+}
+
+// constantName derives an unexported camelCase name from up to four words
+// of value, such as "application/json" -> "applicationJSON"
+func constantName(value string, taken map[string]bool) string {
+	words := strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 4 {
+		words = words[:4]
+	}
+
+	var b strings.Builder
+	for i, word := range words {
+		switch {
+		case i > 0 && commonInitialisms[word]:
+			b.WriteString(strings.ToUpper(word))
+		case i > 0:
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		default:
+			b.WriteString(word)
+		}
+	}
+
+	base := b.String()
+	if base == "" || !unicode.IsLetter([]rune(base)[0]) || token.IsKeyword(base) {
+		base = "str" + strings.ToUpper(base[:min(1, len(base))]) + base[min(1, len(base)):]
+	}
+
+	name := base
+	for i := 2; taken[name]; i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	return name
+}
+
+// extractStrings replaces repeated string literals with constants, reusing
+// an existing constant of the same value or declaring a new one after the
+// imports
+func extractStrings(file *editFile, opts transformOptions) (string, []string, error) {
+	duplicates := findDuplicateStrings(file.fset, file.file, opts.minDuplicates)
+	changes := []string{}
+	if len(duplicates) == 0 {
+		return file.source, changes, nil
+	}
+
+	type replacement struct {
+		start, end int
+		name       string
+	}
+	replacements := []replacement{}
+	specs := []string{}
+
+	for _, dup := range duplicates {
+		name := dup.Constant
+		if name == "" {
+			name = dup.SuggestedName
+			specs = append(specs, fmt.Sprintf("%s = %s", name, strconv.Quote(dup.Value)))
+			changes = append(changes, fmt.Sprintf("declared const %s for %q, replacing %d uses", name, dup.Value, dup.Count))
+		} else {
+			changes = append(changes, fmt.Sprintf("replaced %d uses of %q with const %s", dup.Count, dup.Value, name))
+		}
+		for _, lit := range dup.uses {
+			replacements = append(replacements, replacement{file.offset(lit.Pos()), file.offset(lit.End()), name})
+		}
+	}
+
+	sort.Slice(replacements, func(i, j int) bool { return replacements[i].start > replacements[j].start })
+	source := file.source
+	for _, r := range replacements {
+		source = source[:r.start] + r.name + source[r.end:]
+	}
+
+	if len(specs) > 0 {
+		at := file.offset(file.file.Name.End())
+		if decl := lastImportDecl(file.file); decl != nil {
+			at = file.offset(decl.End())
+		}
+		block := "const " + specs[0]
+		if len(specs) > 1 {
+			block = "const (\n\t" + strings.Join(specs, "\n\t") + "\n)"
+			// Let gofmt align the group
+			if formatted, err := format.Source([]byte(block)); err == nil {
+				block = strings.TrimSpace(string(formatted))
+			}
+		}
+		// Replacements all sit after the insertion point, so at is unchanged
+		source = source[:at] + "\n\n" + block + source[at:]
+	}
+
+	return source, changes, nil
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+// EditResult reports the outcome of a subcommand that rewrites a Go file
+type EditResult struct {
+	Target         string            `json:"target"`
+	Output         string            `json:"output,omitempty"`
+	Written        bool              `json:"written"`
+	Symbol         string            `json:"symbol,omitempty"`
+	Transform      string            `json:"transform,omitempty"`
+	Changes        []string          `json:"changes,omitempty"`
+	Inserted       []InsertedSymbol  `json:"inserted,omitempty"`
+	AddedImports   []string          `json:"added_imports"`
+	RemovedImports []string          `json:"removed_imports,omitempty"`
+	References     []SymbolReference `json:"references,omitempty"`
+	Missing        []string          `json:"missing,omitempty"`
+	ParseError     string            `json:"parse_error,omitempty"`
+	Source         string            `json:"source,omitempty"`
+	blockedByError bool
+}
+
+// editFile is a parsed Go file kept together with its source, so edits can
+// be made as byte splices that leave untouched code exactly as written
+type editFile struct {
+	path   string
+	source string
+	fset   *token.FileSet
+	file   *ast.File
+}
+
+// loadEditFile reads and parses path for editing
+func loadEditFile(path string) (*editFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseEditSource(path, string(content))
+}
+
+func parseEditSource(path, source string) (*editFile, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, source, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	return &editFile{path: path, source: source, fset: fset, file: file}, nil
+}
+
+// loadSnippet parses a file of declarations that may omit its package
+// clause, as providers often return a bare function
+func loadSnippet(path string) (*editFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	source := string(content)
+	if snippet, err := parseEditSource(path, source); err == nil {
+		return snippet, nil
+	}
+
+	snippet, err := parseEditSource(path, "package snippet\n\n"+source)
+	if err != nil {
+		return nil, err
+	}
+	return snippet, nil
+}
+
+func (f *editFile) offset(pos token.Pos) int {
+	return f.fset.Position(pos).Offset
+}
+
+func (f *editFile) text(node ast.Node) string {
+	return f.source[f.offset(node.Pos()):f.offset(node.End())]
+}
+
+// symbolName returns the name a declaration is addressed by on the command
+// line: "Name" for functions, types and values, "Type.Method" for methods
+func symbolName(fn *ast.FuncDecl) string {
+	if receiver := receiverTypeName(fn); receiver != "" {
+		return receiver + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// normalizeSymbolName accepts "(*T).M" and "*T.M" as spellings of "T.M"
+func normalizeSymbolName(name string) string {
+	name = strings.NewReplacer("(", "", ")", "", "*", "").Replace(name)
+	return strings.TrimSpace(name)
+}
+
+// symbolDecl is a located top-level declaration. node is the whole
+// declaration, or a single spec when it shares a parenthesized group with
+// others; doc is its doc comment, if any.
+type symbolDecl struct {
+	name string
+	kind string
+	node ast.Node
+	doc  *ast.CommentGroup
+	fn   *ast.FuncDecl
+}
+
+// findSymbol locates a top-level declaration by name
+func findSymbol(file *ast.File, name string) *symbolDecl {
+	name = normalizeSymbolName(name)
+	for _, decl := range topLevelSymbols(file) {
+		if decl.name == name {
+			return &decl
+		}
+	}
+	return nil
+}
+
+// topLevelSymbols lists every named top-level declaration in source order
+func topLevelSymbols(file *ast.File) []symbolDecl {
+	symbols := []symbolDecl{}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			kind := "func"
+			if d.Recv != nil {
+				kind = "method"
+			}
+			symbols = append(symbols, symbolDecl{name: symbolName(d), kind: kind, node: d, doc: d.Doc, fn: d})
+
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			kind := strings.ToLower(d.Tok.String())
+			for _, spec := range d.Specs {
+				var node ast.Node = spec
+				doc := specDoc(spec)
+				if len(d.Specs) == 1 && !d.Lparen.IsValid() {
+					node = d
+					if doc == nil {
+						doc = d.Doc
+					}
+				}
+				for _, name := range specNames(spec) {
+					symbols = append(symbols, symbolDecl{name: name, kind: kind, node: node, doc: doc})
+				}
+			}
+		}
+	}
+
+	return symbols
+}
+
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Doc
+	case *ast.ValueSpec:
+		return s.Doc
+	}
+	return nil
+}
+
+// declRange returns the byte range of a declaration, including its doc
+// comment when withDoc is set
+func (f *editFile) declRange(decl *symbolDecl, withDoc bool) (int, int) {
+	start := f.offset(decl.node.Pos())
+	if withDoc && decl.doc != nil {
+		start = f.offset(decl.doc.Pos())
+	}
+	return start, f.offset(decl.node.End())
+}
+
+// importInfo is an import spec as written, with its local name
+type importInfo struct {
+	name string
+	path string
+}
+
+func (i importInfo) spec() string {
+	if i.name != "" {
+		return i.name + ` "` + i.path + `"`
+	}
+	return `"` + i.path + `"`
+}
+
+func (i importInfo) localName() string {
+	if i.name != "" {
+		return i.name
+	}
+	return i.path[strings.LastIndex(i.path, "/")+1:]
+}
+
+// requiredImports returns the imports of snippet that node refers to
+func requiredImports(snippet *ast.File, node ast.Node) []importInfo {
+	used := map[string]bool{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+
+	required := []importInfo{}
+	for _, imp := range snippet.Imports {
+		info := importInfo{path: strings.Trim(imp.Path.Value, `"`)}
+		if imp.Name != nil {
+			info.name = imp.Name.Name
+		}
+		if used[info.localName()] {
+			required = append(required, info)
+		}
+	}
+	return required
+}
+
+// ensureImports adds any of imports missing from source to its import
+// declaration, keeping the standard library and other imports in their
+// usual groups, and returns the new source and the specs added
+func ensureImports(source string, imports []importInfo) (string, []string, error) {
+	target, err := parseEditSource("", source)
+	if err != nil {
+		return "", nil, err
+	}
+
+	existing := map[string]bool{}
+	for _, imp := range target.file.Imports {
+		existing[strings.Trim(imp.Path.Value, `"`)] = true
+	}
+
+	missing := []importInfo{}
+	for _, imp := range imports {
+		if !existing[imp.path] {
+			existing[imp.path] = true
+			missing = append(missing, imp)
+		}
+	}
+	if len(missing) == 0 {
+		return source, []string{}, nil
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].path < missing[j].path })
+
+	added := []string{}
+	for _, imp := range missing {
+		added = append(added, imp.spec())
+	}
+
+	importDecl := lastImportDecl(target.file)
+
+	// No imports yet: add a declaration after the package clause
+	if importDecl == nil {
+		at := target.offset(target.file.Name.End())
+		block := "\n\nimport " + added[0]
+		if len(added) > 1 {
+			block = "\n\n" + importGroup(groupImportSpecs(added))
+		}
+		return source[:at] + block + source[at:], added, nil
+	}
+
+	// A single unparenthesized import becomes a group
+	if !importDecl.Lparen.IsValid() {
+		start, end := target.offset(importDecl.Pos()), target.offset(importDecl.End())
+		specs := []string{target.text(importDecl.Specs[0])}
+		specs = append(specs, added...)
+		group := importGroup(groupImportSpecs(specs))
+		return source[:start] + group + source[end:], added, nil
+	}
+
+	// Insert each import before the first spec of its class that sorts after
+	// it, or after the last spec of its class
+	result := source
+	for i := len(missing) - 1; i >= 0; i-- {
+		imp := missing[i]
+		target, err = parseEditSource("", result)
+		if err != nil {
+			return "", nil, err
+		}
+		decl := lastImportDecl(target.file)
+
+		at := -1
+		lastOfClass := -1
+		for _, spec := range decl.Specs {
+			specPath := strings.Trim(spec.(*ast.ImportSpec).Path.Value, `"`)
+			if isStdlibPath(specPath) != isStdlibPath(imp.path) {
+				continue
+			}
+			lastOfClass = target.offset(spec.End())
+			if specPath > imp.path {
+				at = target.offset(spec.Pos())
+				if doc := spec.(*ast.ImportSpec).Doc; doc != nil {
+					at = target.offset(doc.Pos())
+				}
+				break
+			}
+		}
+
+		switch {
+		case at >= 0:
+			result = result[:at] + imp.spec() + "\n\t" + result[at:]
+		case lastOfClass >= 0:
+			result = result[:lastOfClass] + "\n\t" + imp.spec() + result[lastOfClass:]
+		default:
+			// First import of its class gets its own group
+			rparen := target.offset(decl.Rparen)
+			result = result[:rparen] + "\n\t" + imp.spec() + "\n" + result[rparen:]
+		}
+	}
+
+	return result, added, nil
+}
+
+func lastImportDecl(file *ast.File) *ast.GenDecl {
+	var last *ast.GenDecl
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			last = gen
+		}
+	}
+	return last
+}
+
+// groupImportSpecs orders import specs with the standard library first and
+// a blank line before other imports, as goimports does
+func groupImportSpecs(specs []string) []string {
+	std, other := []string{}, []string{}
+	for _, spec := range specs {
+		if isStdlibPath(importSpecPath(spec)) {
+			std = append(std, spec)
+		} else {
+			other = append(other, spec)
+		}
+	}
+	byPath := func(list []string) func(i, j int) bool {
+		return func(i, j int) bool { return importSpecPath(list[i]) < importSpecPath(list[j]) }
+	}
+	sort.SliceStable(std, byPath(std))
+	sort.SliceStable(other, byPath(other))
+
+	if len(std) > 0 && len(other) > 0 {
+		std = append(std, "")
+	}
+	return append(std, other...)
+}
+
+// importGroup renders specs as a parenthesized import declaration; empty
+// specs become blank separator lines
+func importGroup(specs []string) string {
+	lines := make([]string, len(specs))
+	for i, spec := range specs {
+		if spec != "" {
+			lines[i] = "\t" + spec
+		}
+	}
+	return "import (\n" + strings.Join(lines, "\n") + "\n)"
+}
+
+func importSpecPath(spec string) string {
+	if i := strings.Index(spec, `"`); i >= 0 {
+		return strings.Trim(spec[i:], "\"` ")
+	}
+	return spec
+}
+
+// isStdlibPath reports whether an import path looks like a standard library
+// package, i.e. its first element has no dot
+func isStdlibPath(path string) bool {
+	first := strings.SplitN(path, "/", 2)[0]
+	return !strings.Contains(first, ".")
+}
+
+// finishEdit validates the edited source and writes it to outputPath unless
+// dryRun is set, in which case the source is returned in the result.
+// Output that does not parse is never written.
+func finishEdit(result *EditResult, source, outputPath string, dryRun bool) error {
+	if _, err := parser.ParseFile(token.NewFileSet(), result.Target, source, parser.ParseComments); err != nil {
+		result.ParseError = err.Error()
+		result.blockedByError = true
+	}
+
+	if dryRun {
+		result.Source = source
+		return nil
+	}
+	if result.ParseError != "" {
+		return nil
+	}
+
+	if err := os.WriteFile(outputPath, []byte(source), 0644); err != nil {
+		return fmt.Errorf("failed to write output: %v", err)
+	}
+	result.Output = outputPath
+	result.Written = true
+	return nil
+}
+
+// printEditResult prints result and fails the command when the edit was
+// rejected
+func printEditResult(result *EditResult) int {
+	code := printJSON(result)
+	if code == 0 && result.blockedByError {
+		return 1
+	}
+	return code
+}
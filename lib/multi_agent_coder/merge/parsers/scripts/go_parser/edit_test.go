@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const editTarget = `package p
+
+import "fmt"
+
+// Config holds the settings
+type Config struct {
+	Name string
+}
+
+// F prints the config
+func F(c Config) {
+	fmt.Println(c.Name)
+}
+
+func (c Config) String() string {
+	return c.Name
+}
+`
+
+// mustEditFile parses source as an edit target or snippet
+func mustEditFile(t *testing.T, path, source string) *editFile {
+	t.Helper()
+	file, err := parseEditSource(path, source)
+	if err != nil {
+		t.Fatalf("%s does not parse: %v\n%s", path, err, source)
+	}
+	return file
+}
+
+// assertEquivalent fails unless source is the same code as want, apart from
+// formatting, comments and how imports are grouped
+func assertEquivalent(t *testing.T, source, want string) {
+	t.Helper()
+	result := &Equivalence{A: "got", B: "want", Differences: []string{}}
+	compareFiles(result, mustEditFile(t, "got.go", source), mustEditFile(t, "want.go", want))
+	if !result.Equivalent {
+		t.Errorf("%s: %v\n%s", result.Reason, result.Differences, source)
+	}
+}
+
+func TestReplaceRoundTrip(t *testing.T) {
+	file := mustEditFile(t, "target.go", editTarget)
+	snippet := mustEditFile(t, "snippet.go", "package p\n\nimport \"strings\"\n\nfunc F(c Config) {\n\tprintln(strings.ToUpper(c.Name))\n}\n")
+	replaced, name, added, err := replaceSymbol(file, snippet, "F")
+	if err != nil {
+		t.Fatalf("replaceSymbol: %v", err)
+	}
+	if name != "F" || strings.Join(added, ",") != `"strings"` {
+		t.Errorf("replaced %s adding %v, want F adding strings", name, added)
+	}
+	edited := mustEditFile(t, "target.go", replaced)
+	if !strings.Contains(replaced, "// F prints the config\nfunc F(c Config) {\n\tprintln(strings.ToUpper(c.Name))") {
+		t.Errorf("replacement lost the doc comment or body:\n%s", replaced)
+	}
+
+	// Putting the original back restores it; only the added import stays
+	original := mustEditFile(t, "original.go", editTarget)
+	restored, _, _, err := replaceSymbol(edited, original, "F")
+	if err != nil {
+		t.Fatalf("replaceSymbol back: %v", err)
+	}
+	restoredFile := mustEditFile(t, "target.go", restored)
+	assertEquivalent(t, removeImports(restoredFile, []string{"strings"}), editTarget)
+}
+
+func TestReplaceSymbolErrors(t *testing.T) {
+	file := mustEditFile(t, "target.go", editTarget)
+	tests := []struct {
+		name    string
+		symbol  string
+		snippet string
+		err     string
+	}{
+		{"missing target", "Missing", "package p\n\nfunc Missing() {}\n", "function Missing not found"},
+		{"not a function", "Config", "package p\n\ntype Config struct{}\n", "function Config not found"},
+		{"no replacement", "F", "package p\n\nfunc A() {}\n\nfunc B() {}\n", "replacement for F not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := replaceSymbol(file, mustEditFile(t, "snippet.go", tt.snippet), tt.symbol)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+)
+
+// EnumInfo represents a package-level const group, such as an iota enumeration
+type EnumInfo struct {
+	Type    string       `json:"type,omitempty"`
+	Members []EnumMember `json:"members"`
+}
+
+// EnumMember represents a constant in a const group with its effective value
+type EnumMember struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+	Kind  string      `json:"kind"`
+}
+
+// extractEnums evaluates every package-level const declaration in order, so
+// later groups can refer to earlier constants, and reports the parenthesized
+// groups along with their effective values.
+func extractEnums(file *ast.File) []EnumInfo {
+	enums := []EnumInfo{}
+	env := map[string]constant.Value{}
+
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.CONST {
+			continue
+		}
+
+		enum := EnumInfo{Members: []EnumMember{}}
+		var prevType ast.Expr
+		var prevValues []ast.Expr
+
+		for iota, spec := range genDecl.Specs {
+			valueSpec, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+
+			// A spec without values repeats the previous type and expressions
+			if len(valueSpec.Values) > 0 {
+				prevType = valueSpec.Type
+				prevValues = valueSpec.Values
+			}
+
+			if enum.Type == "" && prevType != nil {
+				enum.Type = getTypeName(prevType)
+			}
+
+			for i, name := range valueSpec.Names {
+				value := constant.MakeUnknown()
+				if i < len(prevValues) {
+					value = evalConst(prevValues[i], iota, env)
+				}
+
+				if name.Name == "_" {
+					continue
+				}
+
+				env[name.Name] = value
+				enum.Members = append(enum.Members, EnumMember{
+					Name:  name.Name,
+					Value: constantToJSON(value),
+					Kind:  constantKind(value),
+				})
+			}
+		}
+
+		if genDecl.Lparen.IsValid() && len(enum.Members) > 0 {
+			enums = append(enums, enum)
+		}
+	}
+
+	return enums
+}
+
+// evalConst computes the value of a constant expression, returning an unknown
+// value for anything that cannot be resolved from the file alone.
+func evalConst(expr ast.Expr, iota int, env map[string]constant.Value) constant.Value {
+	unknown := constant.MakeUnknown()
+
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(e.Value, e.Kind, 0)
+
+	case *ast.Ident:
+		switch e.Name {
+		case "iota":
+			return constant.MakeInt64(int64(iota))
+		case "true":
+			return constant.MakeBool(true)
+		case "false":
+			return constant.MakeBool(false)
+		}
+		if value, ok := env[e.Name]; ok {
+			return value
+		}
+		return unknown
+
+	case *ast.ParenExpr:
+		return evalConst(e.X, iota, env)
+
+	case *ast.UnaryExpr:
+		x := evalConst(e.X, iota, env)
+		if x.Kind() == constant.Unknown {
+			return unknown
+		}
+		return evalUnary(e.Op, x)
+
+	case *ast.BinaryExpr:
+		x := evalConst(e.X, iota, env)
+		y := evalConst(e.Y, iota, env)
+		if x.Kind() == constant.Unknown || y.Kind() == constant.Unknown {
+			return unknown
+		}
+		return evalBinary(e.Op, x, y)
+
+	case *ast.CallExpr:
+		// Conversions such as Weekday(1) or time.Duration(5) keep the value
+		if len(e.Args) == 1 {
+			switch e.Fun.(type) {
+			case *ast.Ident, *ast.SelectorExpr:
+				return evalConst(e.Args[0], iota, env)
+			}
+		}
+		return unknown
+	}
+
+	return unknown
+}
+
+// evalUnary applies op to x, returning an unknown value when op is not
+// defined on x's kind, as go/constant panics on such operands
+func evalUnary(op token.Token, x constant.Value) constant.Value {
+	switch {
+	case (op == token.ADD || op == token.SUB) && isNumeric(x),
+		op == token.XOR && x.Kind() == constant.Int,
+		op == token.NOT && x.Kind() == constant.Bool:
+		return constant.UnaryOp(op, x, 0)
+	}
+	return constant.MakeUnknown()
+}
+
+// evalBinary applies op to x and y, returning an unknown value when the
+// operands are ill-typed for it, such as true + 1 or 1 % 2.5
+func evalBinary(op token.Token, x, y constant.Value) constant.Value {
+	unknown := constant.MakeUnknown()
+	switch op {
+	case token.SHL, token.SHR:
+		if x.Kind() != constant.Int || !isNumeric(y) {
+			return unknown
+		}
+		shift, ok := constant.Uint64Val(constant.ToInt(y))
+		if !ok || shift > 1024 {
+			return unknown
+		}
+		return constant.Shift(x, op, uint(shift))
+
+	case token.LAND, token.LOR:
+		if x.Kind() != constant.Bool || y.Kind() != constant.Bool {
+			return unknown
+		}
+		return constant.BinaryOp(x, op, y)
+	}
+
+	// Other operators need operands of the same class
+	numeric := isNumeric(x) && isNumeric(y)
+	if !numeric && x.Kind() != y.Kind() {
+		return unknown
+	}
+
+	switch op {
+	case token.EQL, token.NEQ:
+		return constant.MakeBool(constant.Compare(x, op, y))
+
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if x.Kind() == constant.Bool || x.Kind() == constant.Complex || y.Kind() == constant.Complex {
+			return unknown
+		}
+		return constant.MakeBool(constant.Compare(x, op, y))
+
+	case token.ADD:
+		if !numeric && x.Kind() != constant.String {
+			return unknown
+		}
+
+	case token.SUB, token.MUL:
+		if !numeric {
+			return unknown
+		}
+
+	case token.QUO:
+		if !numeric || constant.Sign(y) == 0 {
+			return unknown
+		}
+		if x.Kind() == constant.Int && y.Kind() == constant.Int {
+			op = token.QUO_ASSIGN // integer division
+		}
+
+	case token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+		if x.Kind() != constant.Int || y.Kind() != constant.Int || op == token.REM && constant.Sign(y) == 0 {
+			return unknown
+		}
+
+	default:
+		return unknown
+	}
+
+	return constant.BinaryOp(x, op, y)
+}
+
+// isNumeric reports whether value is an integer, floating-point or complex
+// constant
+func isNumeric(value constant.Value) bool {
+	switch value.Kind() {
+	case constant.Int, constant.Float, constant.Complex:
+		return true
+	}
+	return false
+}
+
+func constantToJSON(value constant.Value) interface{} {
+	switch value.Kind() {
+	case constant.Int:
+		if v, exact := constant.Int64Val(value); exact {
+			return v
+		}
+		return value.ExactString()
+	case constant.Float:
+		v, _ := constant.Float64Val(value)
+		return v
+	case constant.String:
+		return constant.StringVal(value)
+	case constant.Bool:
+		return constant.BoolVal(value)
+	default:
+		return nil
+	}
+}
+
+func constantKind(value constant.Value) string {
+	switch value.Kind() {
+	case constant.Int:
+		return "int"
+	case constant.Float:
+		return "float"
+	case constant.String:
+		return "string"
+	case constant.Bool:
+		return "bool"
+	case constant.Complex:
+		return "complex"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"go/constant"
+	"go/parser"
+	"testing"
+)
+
+func TestEvalConst(t *testing.T) {
+	env := map[string]constant.Value{"KB": constant.MakeInt64(1024)}
+	tests := []struct {
+		expr string
+		iota int
+		want interface{}
+		kind string
+	}{
+		{"1 << iota", 3, int64(8), "int"},
+		{"KB * 4", 0, int64(4096), "int"},
+		{"7 / 2", 0, int64(3), "int"},
+		{"7 / 2.0", 0, 3.5, "float"},
+		{`"a" + "b"`, 0, "ab", "string"},
+		{"1 < 2 && true", 0, true, "bool"},
+		{"!false", 0, true, "bool"},
+		{"-(1 + 2)", 0, int64(-3), "int"},
+		{"^0", 0, int64(-1), "int"},
+		{"Weekday(2)", 0, int64(2), "int"},
+		{"Undeclared + 1", 0, nil, "unknown"},
+		{"1 / 0", 0, nil, "unknown"},
+		{"1 % 0", 0, nil, "unknown"},
+		{"1 << 2000", 0, nil, "unknown"},
+
+		// Ill-typed expressions are unknown, not a go/constant panic
+		{"true + 1", 0, nil, "unknown"},
+		{"-true", 0, nil, "unknown"},
+		{"^1.5", 0, nil, "unknown"},
+		{"1 % 2.5", 0, nil, "unknown"},
+		{"!1", 0, nil, "unknown"},
+		{"1 && 2", 0, nil, "unknown"},
+		{`"a" == true`, 0, nil, "unknown"},
+		{`"a" < 1`, 0, nil, "unknown"},
+		{`"a" - "b"`, 0, nil, "unknown"},
+		{`1 / "a"`, 0, nil, "unknown"},
+		{"true < false", 0, nil, "unknown"},
+		{"1.5 << 2", 0, nil, "unknown"},
+		{`1 << "a"`, 0, nil, "unknown"},
+		{"1 & 1.5", 0, nil, "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseExpr: %v", err)
+			}
+			value := evalConst(expr, tt.iota, env)
+			if got := constantKind(value); got != tt.kind {
+				t.Errorf("kind = %s, want %s", got, tt.kind)
+			}
+			if got := constantToJSON(value); got != tt.want {
+				t.Errorf("value = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractEnumsIllTyped(t *testing.T) {
+	result, err := parseGoCode("package p\n\nconst (\n\tA = true + 1\n\tB = 1 % 2.5\n\tC = iota\n)\n", SourceLimits{})
+	if err != nil {
+		t.Fatalf("parseGoCode: %v", err)
+	}
+	if len(result.Enums) != 1 || len(result.Enums[0].Members) != 3 {
+		t.Fatalf("enums = %+v, want one group of three", result.Enums)
+	}
+	if got := result.Enums[0].Members[2].Value; got != int64(2) {
+		t.Errorf("C = %v, want 2", got)
+	}
+}
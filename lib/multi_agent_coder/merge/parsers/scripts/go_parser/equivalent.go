@@ -0,0 +1,271 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// Equivalence answers whether two files, or a function or other symbol of
+// each, are the same code apart from formatting, comments and the order of
+// imports. Confidence is how far the answer can be trusted:
+//
+//   - high: the code is the same, declarations possibly in another order;
+//     or it differs in what is declared, imported or in a signature
+//   - medium: only package variables are initialized in another order,
+//     which may change what their initializers do, or only the bodies and
+//     values of the same declarations differ, which may be rewrites that
+//     behave the same
+//   - low: a file does not parse and the files were compared token by token
+//
+// Differences lists what differs, empty when Equivalent is set.
+type Equivalence struct {
+	A           string   `json:"a"`
+	B           string   `json:"b"`
+	Symbol      string   `json:"symbol,omitempty"`
+	Equivalent  bool     `json:"equivalent"`
+	Confidence  string   `json:"confidence"`
+	Reason      string   `json:"reason"`
+	Differences []string `json:"differences"`
+}
+
+// equivalenceDecl is a top-level declaration other than an import, with
+// the names it declares and its code as compared
+type equivalenceDecl struct {
+	names []string
+	kind  string
+	code  string
+	// A variable declaration initialized by code
+	initializes bool
+}
+
+func runEquivalent(args []string) int {
+	var name string
+
+	flags := flag.NewFlagSet("equivalent", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&name, "name", "", "compare only this symbol of each file, e.g. ParseConfig or Server.Start")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(positional) != 2 {
+		return fail("Usage: equivalent [--name Symbol] a.go b.go")
+	}
+
+	result := &Equivalence{A: positional[0], B: positional[1], Differences: []string{}}
+	sources := make([][]byte, 2)
+	files := make([]*editFile, 2)
+	for i, path := range positional {
+		if sources[i], err = os.ReadFile(path); err != nil {
+			return fail("Failed to read %s: %v", path, err)
+		}
+		// A file that does not parse is compared by its tokens
+		files[i], _ = parseEditSource(path, string(sources[i]))
+	}
+
+	switch {
+	case files[0] == nil || files[1] == nil:
+		if name != "" {
+			return fail("Both files must parse to compare --name")
+		}
+		compareTokens(result, sources[0], sources[1])
+	case name != "":
+		result.Symbol = normalizeSymbolName(name)
+		compareSymbol(result, files[0], files[1])
+	default:
+		compareFiles(result, files[0], files[1])
+	}
+
+	if code := printJSON(result); code != 0 {
+		return code
+	}
+	if !result.Equivalent {
+		return exitViolations
+	}
+	return 0
+}
+
+// compareFiles compares the package clause, the set of imports and the
+// declarations of two files, the declarations in any order
+func compareFiles(result *Equivalence, a, b *editFile) {
+	if a.file.Name.Name != b.file.Name.Name {
+		result.Differences = append(result.Differences, fmt.Sprintf("package %s is package %s", a.file.Name.Name, b.file.Name.Name))
+	}
+	importsA, importsB := fileImportSpecs(a.file), fileImportSpecs(b.file)
+	for _, path := range sortedKeys(setOfKeys(importsA)) {
+		name, ok := importsB[path]
+		switch {
+		case !ok:
+			result.Differences = append(result.Differences, fmt.Sprintf("import %q only in %s", path, result.A))
+		case name != importsA[path]:
+			result.Differences = append(result.Differences, fmt.Sprintf("import %q is named differently", path))
+		}
+	}
+	for _, path := range sortedKeys(setOfKeys(importsB)) {
+		if _, ok := importsA[path]; !ok {
+			result.Differences = append(result.Differences, fmt.Sprintf("import %q only in %s", path, result.B))
+		}
+	}
+	structural := len(result.Differences) > 0
+
+	declsA, declsB := equivalenceDecls(a), equivalenceDecls(b)
+	unmatched := map[string]int{}
+	for _, decl := range declsB {
+		unmatched[decl.code]++
+	}
+	onlyA := []equivalenceDecl{}
+	for _, decl := range declsA {
+		if unmatched[decl.code] > 0 {
+			unmatched[decl.code]--
+		} else {
+			onlyA = append(onlyA, decl)
+		}
+	}
+	onlyB := []equivalenceDecl{}
+	for _, decl := range declsB {
+		if unmatched[decl.code] > 0 {
+			unmatched[decl.code]--
+			onlyB = append(onlyB, decl)
+		}
+	}
+
+	// Declarations that differ are told apart by whether the other file
+	// declares the same names
+	namedB := map[string]equivalenceDecl{}
+	for _, decl := range onlyB {
+		namedB[decl.kind+" "+strings.Join(decl.names, ", ")] = decl
+	}
+	for _, decl := range onlyA {
+		label := decl.kind + " " + strings.Join(decl.names, ", ")
+		if _, ok := namedB[label]; ok {
+			delete(namedB, label)
+			result.Differences = append(result.Differences, label+" differs")
+			continue
+		}
+		structural = true
+		result.Differences = append(result.Differences, label+" only in "+result.A)
+	}
+	for _, decl := range onlyB {
+		label := decl.kind + " " + strings.Join(decl.names, ", ")
+		if _, ok := namedB[label]; ok {
+			structural = true
+			result.Differences = append(result.Differences, label+" only in "+result.B)
+		}
+	}
+
+	if len(result.Differences) > 0 {
+		result.Confidence, result.Reason = "medium", "only the bodies or values of the same declarations differ"
+		if structural || signaturesDiffer(a, b) {
+			result.Confidence, result.Reason = "high", "the files declare, import or sign their code differently"
+		}
+		return
+	}
+
+	result.Equivalent = true
+	result.Confidence, result.Reason = "high", "the same code apart from formatting, comments and import order"
+	if !sameOrder(declsA, declsB, func(equivalenceDecl) bool { return true }) {
+		result.Reason = "the same declarations in another order"
+		if !sameOrder(declsA, declsB, func(d equivalenceDecl) bool { return d.initializes || d.kind == "func init" }) {
+			result.Confidence, result.Reason = "medium", "the same declarations, with package variables or init functions in another order"
+		}
+	}
+}
+
+// compareSymbol compares one symbol of each file
+func compareSymbol(result *Equivalence, a, b *editFile) {
+	symbolsA, _ := changeSymbols(a)
+	symbolsB, _ := changeSymbols(b)
+	declA, inA := symbolsA[result.Symbol]
+	declB, inB := symbolsB[result.Symbol]
+	switch {
+	case !inA && !inB:
+		result.Differences = append(result.Differences, result.Symbol+" is in neither file")
+	case !inA:
+		result.Differences = append(result.Differences, result.Symbol+" only in "+result.B)
+	case !inB:
+		result.Differences = append(result.Differences, result.Symbol+" only in "+result.A)
+	case symbolSignature(declA) != symbolSignature(declB):
+		result.Differences = append(result.Differences, result.Symbol+" has another signature")
+	case normalizedCode(a.fset, declA.node) != normalizedCode(b.fset, declB.node):
+		result.Differences = append(result.Differences, result.Symbol+" differs")
+		result.Confidence, result.Reason = "medium", "only the body or value differs"
+		return
+	default:
+		result.Equivalent = true
+		result.Confidence, result.Reason = "high", "the same code apart from formatting and comments"
+		return
+	}
+	result.Confidence, result.Reason = "high", "the symbol is declared or signed differently"
+}
+
+// compareTokens compares files that do not parse by their tokens, names
+// included, without comments or semicolons
+func compareTokens(result *Equivalence, a, b []byte) {
+	result.Confidence = "low"
+	if strings.Join(structuralTokens(a, true), " ") == strings.Join(structuralTokens(b, true), " ") {
+		result.Equivalent = true
+		result.Reason = "a file does not parse; the same tokens apart from formatting and comments"
+		return
+	}
+	result.Reason = "a file does not parse; the tokens differ"
+	result.Differences = append(result.Differences, "tokens differ")
+}
+
+func equivalenceDecls(file *editFile) []equivalenceDecl {
+	decls := []equivalenceDecl{}
+	for _, decl := range file.file.Decls {
+		unit := equivalenceDecl{kind: declKind(decl), code: normalizedCode(file.fset, decl)}
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			unit.names = []string{symbolName(d)}
+			if d.Recv == nil && d.Name.Name == "init" {
+				unit.kind = "func init"
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				unit.names = append(unit.names, specNames(spec)...)
+				if value, ok := spec.(*ast.ValueSpec); ok && d.Tok == token.VAR && len(value.Values) > 0 {
+					unit.initializes = true
+				}
+			}
+		}
+		decls = append(decls, unit)
+	}
+	return decls
+}
+
+// sameOrder reports whether the declarations kept by keep come in the same
+// order in both lists
+func sameOrder(a, b []equivalenceDecl, keep func(equivalenceDecl) bool) bool {
+	codes := func(decls []equivalenceDecl) string {
+		kept := []string{}
+		for _, decl := range decls {
+			if keep(decl) {
+				kept = append(kept, decl.code)
+			}
+		}
+		return strings.Join(kept, "\n")
+	}
+	return codes(a) == codes(b)
+}
+
+// signaturesDiffer reports whether a symbol both files declare has a
+// different signature in each
+func signaturesDiffer(a, b *editFile) bool {
+	symbolsA, _ := changeSymbols(a)
+	symbolsB, _ := changeSymbols(b)
+	for name, declA := range symbolsA {
+		if declB, ok := symbolsB[name]; ok && (declA.kind != declB.kind || symbolSignature(declA) != symbolSignature(declB)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// errorPattern recognizes one form of a compiler or go/types error message.
+// The pattern's groups are the symbols it involves, in order.
+type errorPattern struct {
+	category string
+	pattern  *regexp.Regexp
+}
+
+// errorPatterns are tried in order, so the more specific forms come first.
+// They cover the messages of go/types and of gc, which words most of them
+// the same way.
+var errorPatterns = []errorPattern{
+	{"syntax", regexp.MustCompile(`^syntax error: (?:.*?(?:unexpected|non-declaration statement outside function body) ([^\s,]+))?`)},
+	{"missing_import", regexp.MustCompile(`^(?:could not import|no required module provides package|cannot find package) "?([^\s";(]+)"?`)},
+	{"missing_import", regexp.MustCompile(`^package (\S+) is not in std`)},
+	{"unused", regexp.MustCompile(`^"([^"]+)" imported(?: as \S+)? and not used`)},
+	{"unused", regexp.MustCompile(`^declared and not used: (\S+)`)},
+	{"unused", regexp.MustCompile(`^(\S+) declared and not used`)},
+	{"undefined", regexp.MustCompile(`^\S+ undefined \(type (\S+) has no (?:field or )?method (\w+)`)},
+	{"undefined", regexp.MustCompile(`^undefined: (\S+)`)},
+	{"duplicate_declaration", regexp.MustCompile(`^(\S+) redeclared(?: in this block)?`)},
+	{"duplicate_declaration", regexp.MustCompile(`^(?:method|field) (\S+) already declared`)},
+	{"duplicate_declaration", regexp.MustCompile(`^field and method with the same name (\S+)`)},
+	{"duplicate_declaration", regexp.MustCompile(`^duplicate (?:case|key|method|field) (\S+)`)},
+	// go/types follows a duplicate with where the other one is
+	{"duplicate_declaration", regexp.MustCompile(`^other declaration of (\S+)`)},
+	{"duplicate_declaration", regexp.MustCompile(`^previous case`)},
+	{"type_mismatch", regexp.MustCompile(`(\S+) does not implement (\S+) \((?:missing method|wrong type for method) (\w+)\)`)},
+	{"type_mismatch", regexp.MustCompile(`^cannot use (.+?) \((.*?)\) as (\S+) value`)},
+	{"type_mismatch", regexp.MustCompile(`^cannot convert (.+?) \((.*?)\) to type (\S+)`)},
+	{"type_mismatch", regexp.MustCompile(`\(mismatched types (.+?) and (.+?)\)$`)},
+	{"arity_mismatch", regexp.MustCompile(`^(?:not enough|too many) arguments in call to (\S+)`)},
+	{"arity_mismatch", regexp.MustCompile(`^(?:not enough|too many) return values`)},
+	{"arity_mismatch", regexp.MustCompile(`^assignment mismatch: \d+ variables? but (\w[\w.]*)`)},
+	{"missing_return", regexp.MustCompile(`^missing return`)},
+}
+
+// stdPackageNames are the standard packages a file most often forgets to
+// import, by the name their identifiers are qualified with
+var stdPackageNames = map[string]string{
+	"bufio": "bufio", "bytes": "bytes", "context": "context", "errors": "errors",
+	"fmt": "fmt", "io": "io", "json": "encoding/json", "log": "log", "math": "math",
+	"filepath": "path/filepath", "path": "path", "http": "net/http", "net": "net",
+	"os": "os", "exec": "os/exec", "reflect": "reflect", "regexp": "regexp",
+	"slices": "slices", "maps": "maps", "sort": "sort", "strconv": "strconv",
+	"strings": "strings", "sync": "sync", "atomic": "sync/atomic", "time": "time",
+	"unicode": "unicode", "utf8": "unicode/utf8", "rand": "math/rand", "url": "net/url",
+	"base64": "encoding/base64", "hex": "encoding/hex", "sha256": "crypto/sha256",
+	"ioutil": "io/ioutil", "testing": "testing", "flag": "flag", "runtime": "runtime",
+	"slog": "log/slog", "template": "text/template", "xml": "encoding/xml",
+	"csv": "encoding/csv", "gzip": "compress/gzip", "tls": "crypto/tls", "sql": "database/sql",
+}
+
+// classifyError sorts a type checker or compiler error message into a
+// category for repair strategies to dispatch on, with the symbols it
+// involves: syntax, missing_import, unused, undefined, duplicate_declaration,
+// type_mismatch, arity_mismatch, missing_return or other. "undefined: fmt"
+// for a standard package counts as a missing import, with the package's
+// name and import path as its symbols.
+func classifyError(msg string) (string, []string) {
+	// gc continues a message on indented lines
+	msg = strings.TrimSpace(strings.SplitN(msg, "\n", 2)[0])
+	for _, p := range errorPatterns {
+		match := p.pattern.FindStringSubmatch(msg)
+		if match == nil {
+			continue
+		}
+		symbols := []string{}
+		for _, group := range match[1:] {
+			if group != "" {
+				symbols = append(symbols, group)
+			}
+		}
+		// "cannot use x (variable of type int)" describes the value's type
+		if strings.HasPrefix(msg, "cannot ") && p.category == "type_mismatch" && len(symbols) == 3 {
+			symbols[1] = describedType(symbols[1])
+		}
+		if p.category == "undefined" && len(symbols) == 1 {
+			if path := stdPackageNames[symbols[0]]; path != "" {
+				return "missing_import", []string{symbols[0], path}
+			}
+		}
+		return p.category, symbols
+	}
+	return "other", []string{}
+}
+
+// describedType returns the type of a value as go/types describes it:
+// "int" for "variable of type int" or "constant 3 of type int", "T" for
+// "value of struct type T", "untyped int" for "untyped int constant"
+func describedType(description string) string {
+	if i := strings.LastIndex(description, "type "); i >= 0 {
+		return description[i+len("type "):]
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(description, " constant"), " value")
+}
+
+// diagnostic returns a type checker or compiler error with its category
+func diagnostic(line, column int, msg string) Diagnostic {
+	category, symbols := classifyError(msg)
+	return Diagnostic{Line: line, Column: column, Message: msg, Category: category, Symbols: symbols}
+}
+
+// syntaxDiagnostic returns a parser error, which go/parser words without
+// saying it is one
+func syntaxDiagnostic(line, column int, msg string) Diagnostic {
+	return Diagnostic{Line: line, Column: column, Message: msg, Category: "syntax", Symbols: []string{}}
+}
+
+// verifyDiagnostic returns an error in a file of the worktree with its
+// category
+func verifyDiagnostic(file string, line, column int, msg string) VerifyDiagnostic {
+	category, symbols := classifyError(msg)
+	return VerifyDiagnostic{File: file, Line: line, Column: column, Message: msg, Category: category, Symbols: symbols}
+}
@@ -0,0 +1,173 @@
+package main
+
+import "go/ast"
+
+// FeatureVectors are numeric features of each function for a learning-based
+// ranker of merge candidates. Names gives the meaning of each position of the
+// vectors; positions are only ever appended to, so a model trained on an
+// older parser keeps reading the features it knows.
+type FeatureVectors struct {
+	Names     []string           `json:"names"`
+	Functions []FunctionFeatures `json:"functions"`
+}
+
+// FunctionFeatures is the vector of one function, identified the way
+// FunctionInfo is
+type FunctionFeatures struct {
+	Name     string    `json:"name"`
+	ID       string    `json:"id,omitempty"`
+	Receiver *string   `json:"receiver,omitempty"`
+	Vector   []float64 `json:"vector"`
+}
+
+// featureNames are the vector positions: size and complexity, the share of
+// each kind of token in the function's source, and its place in the file's
+// call graph
+var featureNames = []string{
+	"lines",
+	"statements",
+	"cyclomatic_complexity",
+	"cognitive_complexity",
+	"max_nesting",
+	"params",
+	"results",
+	"returns_error",
+	"tokens",
+	"keyword_share",
+	"ident_share",
+	"literal_share",
+	"operator_share",
+	"comment_share",
+	"fan_in",
+	"fan_out",
+	"calls",
+	"package_calls",
+	"recursive",
+	"go_statements",
+	"defer_statements",
+}
+
+// computeFeatureVectors builds the vectors of result's functions from its
+// parsed file and content, the source the file was parsed from
+func computeFeatureVectors(result *Result, content []byte) *FeatureVectors {
+	vectors := &FeatureVectors{Names: featureNames, Functions: []FunctionFeatures{}}
+
+	fanIn, fanOut := map[[2]string]int{}, map[[2]string]int{}
+	if result.Coupling != nil {
+		for _, fc := range result.Coupling.Functions {
+			key := [2]string{fc.Name, ""}
+			if fc.Receiver != nil {
+				key[1] = *fc.Receiver
+			}
+			fanIn[key], fanOut[key] = fc.FanIn, fc.FanOut
+		}
+	}
+	imports := importNames(result.file)
+	tokens := tokenizeSource(content).Tokens
+	ids := symbolIDs(result.fset, result.file)
+
+	for _, decl := range result.file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		key := [2]string{fn.Name.Name, receiverExpr(fn)}
+		info := extractFunction(fn)
+		span := sourceSpan(result.fset, fn)
+		start, end := result.fset.Position(fn.Pos()).Offset, result.fset.Position(fn.End()).Offset
+
+		counts := map[string]int{}
+		total := 0
+		for _, tok := range tokens {
+			if tok.Offset >= start && tok.End <= end {
+				counts[tok.Kind]++
+				total++
+			}
+		}
+		share := func(kind string) float64 {
+			if total == 0 {
+				return 0
+			}
+			return float64(counts[kind]) / float64(total)
+		}
+
+		statements, calls, packageCalls, goStatements, defers := 0, 0, 0, 0, 0
+		recursive := false
+		if fn.Body != nil {
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				switch node := n.(type) {
+				case *ast.BlockStmt:
+				case ast.Stmt:
+					statements++
+					switch node.(type) {
+					case *ast.GoStmt:
+						goStatements++
+					case *ast.DeferStmt:
+						defers++
+					}
+				case *ast.CallExpr:
+					calls++
+					switch fun := node.Fun.(type) {
+					case *ast.Ident:
+						recursive = recursive || (fn.Recv == nil && fun.Name == fn.Name.Name)
+					case *ast.SelectorExpr:
+						if x, ok := fun.X.(*ast.Ident); ok && imports[x.Name] {
+							packageCalls++
+						} else if ok && x.Name == receiverVarName(fn) && fun.Sel.Name == fn.Name.Name {
+							recursive = true
+						}
+					}
+				}
+				return true
+			})
+		}
+
+		returnsError := 0.0
+		if info.ErrorResult != nil {
+			returnsError = 1
+		}
+		isRecursive := 0.0
+		if recursive {
+			isRecursive = 1
+		}
+
+		vectors.Functions = append(vectors.Functions, FunctionFeatures{
+			Name:     info.Name,
+			ID:       ids[fn.Name],
+			Receiver: info.Receiver,
+			Vector: []float64{
+				float64(span.EndLine - span.Line + 1),
+				float64(statements),
+				float64(functionComplexity(fn)),
+				float64(cognitiveComplexity(fn)),
+				float64(bodyNesting(fn)),
+				float64(len(info.Params)),
+				float64(len(info.Returns)),
+				returnsError,
+				float64(total),
+				share("keyword"),
+				share("ident"),
+				share("literal"),
+				share("operator"),
+				share("comment"),
+				float64(fanIn[key]),
+				float64(fanOut[key]),
+				float64(calls),
+				float64(packageCalls),
+				isRecursive,
+				float64(goStatements),
+				float64(defers),
+			},
+		})
+	}
+	return vectors
+}
+
+// bodyNesting is the nesting depth of fn's body, 0 for a declaration without
+// one
+func bodyNesting(fn *ast.FuncDecl) int {
+	if fn.Body == nil {
+		return 0
+	}
+	return nestingDepth(fn.Body)
+}
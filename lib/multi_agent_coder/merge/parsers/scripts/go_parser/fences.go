@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FenceExtraction describes the Go analyzed out of raw model output: the
+// fenced blocks taken from it, in the order they appear
+type FenceExtraction struct {
+	Mode   string       `json:"mode"`
+	Blocks []FenceBlock `json:"blocks"`
+}
+
+// FenceBlock is a fenced code block of the input. Line and EndLine are its
+// code's lines in the input, SourceLine where that code starts in the source
+// analyzed, whose positions the result's are. Unclosed is set for a block
+// the output ends in, as a truncated response does.
+type FenceBlock struct {
+	Index      int    `json:"index"`
+	Language   string `json:"language,omitempty"`
+	Line       int    `json:"line"`
+	EndLine    int    `json:"end_line"`
+	SourceLine int    `json:"source_line"`
+	Unclosed   bool   `json:"unclosed,omitempty"`
+}
+
+// fenceModes are the values of --extract-fences: concat analyzes the blocks
+// as one file, each as a file per block
+var fenceModes = []string{"concat", "each"}
+
+// fenceOpen matches the opening line of a fenced block, with its info string
+var fenceOpen = regexp.MustCompile("^([ \t]*)(```+|~~~+)[ \t]*([^ \t`]*)")
+
+// fencedBlock is the code of a fenced block of the input
+type fencedBlock struct {
+	FenceBlock
+	lines []string
+}
+
+// extractFences returns the Go blocks of markdown text: those tagged go or
+// golang or, when there are none, the untagged ones. Code is unindented by
+// the indentation of its fence, as for a block in a list item.
+func extractFences(text string) []fencedBlock {
+	lines := strings.Split(text, "\n")
+	tagged, untagged := []fencedBlock{}, []fencedBlock{}
+	for i := 0; i < len(lines); i++ {
+		match := fenceOpen.FindStringSubmatch(lines[i])
+		if match == nil {
+			continue
+		}
+		indent, fence, language := match[1], match[2], strings.ToLower(match[3])
+		block := fencedBlock{FenceBlock: FenceBlock{Language: language, Line: i + 2}, lines: []string{}}
+		closed := false
+		for i++; i < len(lines); i++ {
+			trimmed := strings.TrimSpace(lines[i])
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				closed = true
+				break
+			}
+			block.lines = append(block.lines, strings.TrimPrefix(lines[i], indent))
+		}
+		block.EndLine, block.Unclosed = block.Line+len(block.lines)-1, !closed
+		switch language {
+		case "go", "golang":
+			tagged = append(tagged, block)
+		case "":
+			untagged = append(untagged, block)
+		}
+	}
+
+	blocks := tagged
+	if len(blocks) == 0 {
+		blocks = untagged
+	}
+	for i := range blocks {
+		blocks[i].Index = i + 1
+	}
+	return blocks
+}
+
+// concatFences joins the blocks into one file: the first package clause, the
+// imports of all blocks, without repeats, and then the rest of each block in
+// order. A response often splits a file into blocks, or shows only the
+// changed functions.
+func concatFences(blocks []fencedBlock) (string, []FenceBlock) {
+	pkg := ""
+	imports := []string{}
+	seen := map[string]bool{}
+	bodies := make([][]string, len(blocks))
+	for i, block := range blocks {
+		body := []string{}
+		for j := 0; j < len(block.lines); j++ {
+			line := block.lines[j]
+			switch {
+			case strings.HasPrefix(line, "package "):
+				if pkg == "" {
+					pkg = strings.TrimSpace(line)
+				}
+			case strings.HasPrefix(line, "import ("):
+				for j++; j < len(block.lines) && strings.TrimSpace(block.lines[j]) != ")"; j++ {
+					spec := strings.TrimSpace(block.lines[j])
+					if spec != "" && !seen[spec] {
+						seen[spec] = true
+						imports = append(imports, spec)
+					}
+				}
+			case strings.HasPrefix(line, "import "):
+				spec := strings.TrimSpace(strings.TrimPrefix(line, "import "))
+				if !seen[spec] {
+					seen[spec] = true
+					imports = append(imports, spec)
+				}
+			default:
+				body = append(body, line)
+			}
+		}
+		bodies[i] = body
+	}
+	if pkg == "" {
+		pkg = "package main"
+	}
+
+	out := []string{pkg, ""}
+	if len(imports) > 0 {
+		out = append(out, "import (")
+		for _, spec := range imports {
+			out = append(out, "\t"+spec)
+		}
+		out = append(out, ")", "")
+	}
+	placed := []FenceBlock{}
+	for i, block := range blocks {
+		block.SourceLine = len(out) + 1
+		placed = append(placed, block.FenceBlock)
+		out = append(out, bodies[i]...)
+		out = append(out, "")
+	}
+	return strings.Join(out, "\n"), placed
+}
+
+// extractedSources returns the files to analyze for raw model output in the
+// given mode, named after path, with the blocks each was taken from. Output
+// without fences is taken to be the code itself; output with fences of
+// other languages only has no Go to analyze.
+func extractedSources(path string, content []byte, mode string) ([]sourceFile, []*FenceExtraction, error) {
+	blocks := extractFences(string(content))
+	if len(blocks) == 0 {
+		for _, line := range strings.Split(string(content), "\n") {
+			if fenceOpen.MatchString(line) {
+				return nil, nil, fmt.Errorf("no Go code blocks found")
+			}
+		}
+		return []sourceFile{{Path: path, Content: string(content)}}, []*FenceExtraction{{Mode: mode, Blocks: []FenceBlock{}}}, nil
+	}
+
+	if mode == "concat" {
+		source, placed := concatFences(blocks)
+		return []sourceFile{{Path: path, Content: source}}, []*FenceExtraction{{Mode: mode, Blocks: placed}}, nil
+	}
+
+	files := []sourceFile{}
+	extractions := []*FenceExtraction{}
+	for _, block := range blocks {
+		// A block showing only some declarations is analyzed in package main
+		source := strings.Join(block.lines, "\n")
+		block.SourceLine = 1
+		if !hasPackageClause(block.lines) {
+			source, block.SourceLine = "package main\n"+source, 2
+		}
+		files = append(files, sourceFile{Path: fmt.Sprintf("%s#%d", path, block.Index), Content: source})
+		extractions = append(extractions, &FenceExtraction{Mode: mode, Blocks: []FenceBlock{block.FenceBlock}})
+	}
+	return files, extractions, nil
+}
+
+func hasPackageClause(lines []string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(line, "package ") {
+			return true
+		}
+	}
+	return false
+}
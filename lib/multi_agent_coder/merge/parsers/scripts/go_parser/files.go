@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stringList is a flag value accepting repeated and comma-separated values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// collectGoFiles expands command-line patterns into a sorted list of Go
+// files. A pattern may be a file, a directory (its own files only) or a
+// directory followed by "/..." to include every subdirectory. Hidden,
+// underscore-prefixed, vendor and testdata directories are skipped when
+// walking, matching the go tool.
+func collectGoFiles(patterns []string, includeTests bool) ([]string, error) {
+	seen := map[string]bool{}
+	files := []string{}
+
+	add := func(path string) {
+		if !strings.HasSuffix(path, ".go") {
+			return
+		}
+		if !includeTests && strings.HasSuffix(path, "_test.go") {
+			return
+		}
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		recursive := false
+		if pattern == "..." || strings.HasSuffix(pattern, "/...") {
+			recursive = true
+			pattern = strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+			if pattern == "" {
+				pattern = "."
+			}
+		}
+
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			add(filepath.Clean(pattern))
+			continue
+		}
+
+		if !recursive {
+			entries, err := os.ReadDir(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					add(filepath.Join(pattern, entry.Name()))
+				}
+			}
+			continue
+		}
+
+		err = filepath.WalkDir(pattern, func(path string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if path != pattern && skipDir(entry.Name()) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			add(path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func skipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") ||
+		name == "vendor" || name == "testdata"
+}
+
+// findModule walks up from dir looking for go.mod and returns the module
+// root directory and module path. Both are empty when there is no go.mod.
+func findModule(dir string) (string, string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	for {
+		modFile := filepath.Join(abs, "go.mod")
+		if _, err := os.Stat(modFile); err == nil {
+			modulePath, err := readModulePath(modFile)
+			return abs, modulePath, err
+		}
+
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", "", nil
+		}
+		abs = parent
+	}
+}
+
+func readModulePath(modFile string) (string, error) {
+	f, err := os.Open(modFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module ")), `"`), nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no module directive in %s", modFile)
+}
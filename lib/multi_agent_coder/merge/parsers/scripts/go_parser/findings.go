@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Finding is a lint, security or risk result of the analysis sections in
+// one shape, so a consumer can apply thresholds without knowing each
+// section. Rule is the ID an //agentlint:ignore directive names and Section
+// the result field the finding comes from, which keeps its details.
+// Severity is error, warning or info; Confidence is how sure the analysis
+// is that the finding is real:
+//
+//   - high: the code is what the rule describes
+//   - medium: a heuristic, right for the common case
+//   - low: worth a look, often intended
+//
+// The span leaves out its columns when the section only records lines, as
+// for merge conflicts and file-level findings, and a position is a span
+// ending where it starts. Fix is a suggested change,
+// when the section has one.
+type Finding struct {
+	Rule       string     `json:"rule"`
+	Section    string     `json:"section"`
+	Severity   string     `json:"severity"`
+	Confidence string     `json:"confidence"`
+	Message    string     `json:"message"`
+	Symbol     string     `json:"symbol,omitempty"`
+	Span       SourceSpan `json:"span"`
+	Fix        string     `json:"fix,omitempty"`
+}
+
+// collectFindings gathers the findings of the sections result has, leaving
+// out the ones a directive suppresses. Budget violations were filtered when
+// checked and are not counted again. enforce makes them errors.
+func collectFindings(result *Result, enforce bool) []Finding {
+	findings := []Finding{}
+	add := func(finding Finding) {
+		if finding.Span.EndLine == 0 {
+			finding.Span.EndLine, finding.Span.EndColumn = finding.Span.Line, finding.Span.Column
+		}
+		// File-level findings are reported against the package clause
+		if finding.Span.Line == 0 {
+			finding.Span.Line, finding.Span.EndLine = result.suppressions.packageLine, result.suppressions.packageLine
+		}
+		if finding.Section != "budget_violations" && result.suppressions.suppress(finding.Rule, finding.Span.Line) {
+			return
+		}
+		findings = append(findings, finding)
+	}
+	lines := func(start, end int) SourceSpan {
+		return SourceSpan{Line: start, EndLine: end}
+	}
+	// at prefers the span of the node a section recorded, which has its columns
+	at := func(span SourceSpan, start, end int) SourceSpan {
+		if span.Line != 0 {
+			return span
+		}
+		return lines(start, end)
+	}
+
+	for _, diagnostic := range result.ParseErrors {
+		add(Finding{Rule: "syntax_error", Section: "parse_errors", Severity: "error", Confidence: "high", Message: diagnostic.Message, Span: SourceSpan{Line: diagnostic.Line, Column: diagnostic.Column}})
+	}
+	for _, region := range result.MergeConflicts {
+		add(Finding{Rule: "merge_conflict", Section: "merge_conflicts", Severity: "error", Confidence: "high",
+			Message: fmt.Sprintf("unresolved merge conflict between %s and %s", region.OursLabel, region.TheirsLabel),
+			Span:    lines(region.StartLine, region.EndLine),
+			Fix:     "resolve the conflict; the file was analyzed as its ours side"})
+	}
+	if result.TypeCheck != nil {
+		// Errors may come from imports the checker could not resolve
+		confidence := "high"
+		if len(result.TypeCheck.UnresolvedImports) > 0 {
+			confidence = "medium"
+		}
+		for _, diagnostic := range result.TypeCheck.Errors {
+			add(Finding{Rule: "type_error", Section: "type_check", Severity: "error", Confidence: confidence, Message: diagnostic.Message, Span: SourceSpan{Line: diagnostic.Line, Column: diagnostic.Column}})
+		}
+	}
+	if report := result.Sanitization; report != nil {
+		addSanitizeFindings(report, add)
+	}
+
+	for _, violation := range result.BudgetViolations {
+		severity := "warning"
+		if enforce {
+			severity = "error"
+		}
+		add(Finding{Rule: violation.Rule, Section: "budget_violations", Severity: severity, Confidence: "high", Message: violation.Message, Symbol: violation.Symbol, Span: at(violation.span, violation.Line, violation.EndLine)})
+	}
+	for _, risk := range result.ReliabilityRisks {
+		add(Finding{Rule: risk.Kind, Section: "reliability_risks", Severity: "warning", Confidence: "medium", Message: risk.Message, Symbol: risk.Function, Span: at(risk.span, risk.Line, risk.Line)})
+	}
+	for _, long := range result.LongFunctions {
+		name := long.Name
+		if long.Receiver != nil {
+			name = *long.Receiver + "." + long.Name
+		}
+		finding := Finding{Rule: "long_function", Section: "long_functions", Severity: "warning", Confidence: "high",
+			Message: name + ": " + strings.Join(long.Reasons, "; "), Symbol: name, Span: at(long.span, long.StartLine, long.EndLine)}
+		if len(long.Suggestions) > 0 {
+			suggestion := long.Suggestions[0]
+			finding.Fix = fmt.Sprintf("extract lines %d-%d: %s", suggestion.StartLine, suggestion.EndLine, suggestion.Description)
+		}
+		add(finding)
+	}
+	for _, duplicate := range result.DuplicateStrings {
+		finding := Finding{Rule: "duplicate_string", Section: "duplicate_strings", Severity: "info", Confidence: "high",
+			Message: fmt.Sprintf("string %q is repeated %d times", duplicate.Value, duplicate.Count),
+			Span:    lines(duplicate.Lines[0], duplicate.Lines[0])}
+		if len(duplicate.uses) > 0 && result.fset != nil {
+			finding.Span = sourceSpan(result.fset, duplicate.uses[0])
+		}
+		switch {
+		case duplicate.Constant != "":
+			finding.Fix = "use the constant " + duplicate.Constant
+		case duplicate.SuggestedName != "":
+			finding.Fix = "declare it as a constant named " + duplicate.SuggestedName
+		}
+		add(finding)
+	}
+	for _, singleton := range result.Singletons {
+		add(Finding{Rule: "singleton", Section: "singletons", Severity: "info", Confidence: "medium",
+			Message: fmt.Sprintf("package-level singleton %s (%s)", singleton.Name, singleton.Kind),
+			Symbol:  singleton.Name, Span: at(singleton.span, singleton.Line, singleton.Line),
+			Fix: "pass the instance to the code that uses it instead"})
+	}
+	if result.Assertions != nil && result.Assertions.Convention != nil && !result.Assertions.Convention.Consistent {
+		add(Finding{Rule: "assertion_convention", Section: "assertions", Severity: "info", Confidence: "high", Message: result.Assertions.Convention.Message,
+			Fix: "use " + result.Assertions.Convention.Dominant + " as the other test files do"})
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Span.Line != findings[j].Span.Line {
+			return findings[i].Span.Line < findings[j].Span.Line
+		}
+		return findings[i].Span.Column < findings[j].Span.Column
+	})
+	return findings
+}
+
+// addSanitizeFindings words the encoding problems of a sanitization report.
+// In fix mode the ones outside literals were already replaced in the
+// analyzed source and are only info.
+func addSanitizeFindings(report *SanitizeReport, add func(Finding)) {
+	fixed := func(issue SanitizeIssue) bool {
+		return report.Mode == "fix" && !issue.InLiteral
+	}
+	for _, issue := range report.InvalidUTF8 {
+		add(Finding{Rule: "invalid_utf8", Section: "sanitization", Severity: "error", Confidence: "high",
+			Message: "invalid UTF-8 byte " + issue.Char, Span: SourceSpan{Line: issue.Line, Column: issue.Column}})
+	}
+	for _, issue := range report.Invisible {
+		finding := Finding{Rule: "invisible_character", Section: "sanitization", Severity: "warning", Confidence: "high",
+			Message: fmt.Sprintf("invisible character %s (%s)", issue.Char, issue.Name), Span: SourceSpan{Line: issue.Line, Column: issue.Column}}
+		switch {
+		case fixed(issue):
+			finding.Severity = "info"
+		case issue.InLiteral:
+			// Literals may hold them on purpose
+			finding.Confidence = "low"
+			finding.Fix = "write it as an escape sequence"
+		default:
+			finding.Fix = "remove it"
+			if issue.Replacement != "" {
+				finding.Fix = fmt.Sprintf("replace it with %q", issue.Replacement)
+			}
+		}
+		add(finding)
+	}
+	for _, issue := range report.Homoglyphs {
+		finding := Finding{Rule: "homoglyph", Section: "sanitization", Severity: "warning", Confidence: "medium",
+			Message: fmt.Sprintf("%s (%s) looks like %q", issue.Name, issue.Char, issue.Replacement), Span: SourceSpan{Line: issue.Line, Column: issue.Column},
+			Fix: fmt.Sprintf("replace it with %q", issue.Replacement)}
+		if fixed(issue) {
+			finding.Severity, finding.Fix = "info", ""
+		}
+		add(finding)
+	}
+}
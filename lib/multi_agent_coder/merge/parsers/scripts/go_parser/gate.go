@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+)
+
+// GateReport is the outcome of checking every function against the
+// complexity thresholds. Passed is false when any function exceeds one.
+type GateReport struct {
+	Passed        bool            `json:"passed"`
+	MaxComplexity int             `json:"max_complexity"`
+	MaxCognitive  int             `json:"max_cognitive"`
+	Files         int             `json:"files"`
+	Functions     int             `json:"functions"`
+	Violations    []GateViolation `json:"violations"`
+	Suppressions  []Suppression   `json:"suppressions"`
+	Errors        []FileError     `json:"errors"`
+}
+
+// GateViolation is a function over a threshold. Metric is cyclomatic or
+// cognitive.
+type GateViolation struct {
+	File      string  `json:"file"`
+	Name      string  `json:"name"`
+	Receiver  *string `json:"receiver,omitempty"`
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Metric    string  `json:"metric"`
+	Value     int     `json:"value"`
+	Limit     int     `json:"limit"`
+}
+
+// gateRules are the SARIF rules of the gate, keyed by metric
+var gateRules = map[string]SARIFRule{
+	"cyclomatic": {ID: "cyclomatic_complexity", ShortDescription: SARIFMessage{Text: "Function exceeds the cyclomatic complexity threshold"}},
+	"cognitive":  {ID: "cognitive_complexity", ShortDescription: SARIFMessage{Text: "Function exceeds the cognitive complexity threshold"}},
+}
+
+func runGate(args []string) int {
+	maxComplexity := defaultMaxFunctionComplexity
+	maxCognitive := 20
+	format := "json"
+	strict := false
+
+	flags := flag.NewFlagSet("gate", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.IntVar(&maxComplexity, "max-complexity", maxComplexity, "highest cyclomatic complexity allowed (0 disables)")
+	flags.IntVar(&maxCognitive, "max-cognitive", maxCognitive, "highest cognitive complexity allowed (0 disables)")
+	flags.StringVar(&format, "format", format, "output format: json or sarif")
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if format != "json" && format != "sarif" {
+		return fail("Invalid format: %s", format)
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	files, err := collectGoFiles(patterns, false)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+
+	report := checkGate(files, maxComplexity, maxCognitive)
+	if err := strictFailure(report.Errors, strict); err != nil {
+		return fail("Gate failed: %v", err)
+	}
+
+	var code int
+	if format == "sarif" {
+		code = printJSON(gateSARIF(report))
+	} else {
+		code = printJSON(report)
+	}
+	if code == 0 && !report.Passed {
+		return exitViolations
+	}
+	return code
+}
+
+// checkGate measures every function of files; unparsable files are listed
+// under Errors. A violation an //agentlint:ignore directive covers, by the
+// ID of its SARIF rule, is left out.
+func checkGate(files []string, maxComplexity, maxCognitive int) *GateReport {
+	report := &GateReport{
+		MaxComplexity: maxComplexity,
+		MaxCognitive:  maxCognitive,
+		Violations:    []GateViolation{},
+		Suppressions:  []Suppression{},
+		Errors:        []FileError{},
+	}
+
+	for _, path := range files {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			report.Errors = append(report.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, source, parser.ParseComments)
+		if err != nil {
+			report.Errors = append(report.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+		report.Files++
+		suppressions := findSuppressions(fset, file, source)
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			report.Functions++
+
+			span := sourceSpan(fset, fn)
+			check := func(metric string, value, limit int) {
+				if limit <= 0 || value <= limit || suppressions.suppress(gateRules[metric].ID, span.Line) {
+					return
+				}
+				violation := GateViolation{
+					File:      path,
+					Name:      fn.Name.Name,
+					StartLine: span.Line,
+					EndLine:   span.EndLine,
+					Metric:    metric,
+					Value:     value,
+					Limit:     limit,
+				}
+				if receiver := receiverExpr(fn); receiver != "" {
+					violation.Receiver = &receiver
+				}
+				report.Violations = append(report.Violations, violation)
+			}
+			check("cyclomatic", functionComplexity(fn), maxComplexity)
+			check("cognitive", cognitiveComplexity(fn), maxCognitive)
+		}
+		report.Suppressions = append(report.Suppressions, suppressions.inFile(path)...)
+	}
+
+	report.Passed = len(report.Violations) == 0
+	return report
+}
+
+// gateSARIF reports the violations as SARIF errors
+func gateSARIF(report *GateReport) *SARIF {
+	log := newSARIF([]SARIFRule{gateRules["cyclomatic"], gateRules["cognitive"]})
+	for _, v := range report.Violations {
+		name := v.Name
+		if v.Receiver != nil {
+			name = *v.Receiver + "." + name
+		}
+		message := fmt.Sprintf("%s has %s complexity %d, over the limit of %d", name, v.Metric, v.Value, v.Limit)
+		log.addResult(gateRules[v.Metric].ID, "error", message, v.File, v.StartLine, v.EndLine)
+	}
+	for _, suppression := range report.Suppressions {
+		if suppression.Suppressed > 0 {
+			log.addSuppressed(suppression.Rule, "error", suppression)
+		}
+	}
+	return log
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// GenerateResult is the outcome of a generator: the file written, the
+// targets generated into it and the functions left out with the reason
+type GenerateResult struct {
+	Target     string              `json:"target"`
+	Generator  string              `json:"generator"`
+	Output     string              `json:"output,omitempty"`
+	Written    bool                `json:"written"`
+	Generated  []GeneratedTarget   `json:"generated"`
+	Skipped    []SkippedGeneration `json:"skipped"`
+	ParseError string              `json:"parse_error,omitempty"`
+	Source     string              `json:"source,omitempty"`
+
+	outputPath string
+}
+
+// GeneratedTarget is a generated test function and the function it covers
+type GeneratedTarget struct {
+	Name     string `json:"name"`
+	Function string `json:"function"`
+}
+
+// SkippedGeneration is a function no target was generated for
+type SkippedGeneration struct {
+	Function string `json:"function"`
+	Reason   string `json:"reason"`
+}
+
+// generators maps a generator name to its implementation, which returns the
+// generated file's source, or "" when there is nothing to generate
+var generators = map[string]func(file *editFile, result *GenerateResult) (string, error){
+	"fuzz":           generateFuzz,
+	"snapshot-tests": generateSnapshotTests,
+}
+
+// fuzzSeeds are the types go test can fuzz, with two seed values each: the
+// zero value and a small other one, written so that f.Add gets the exact type
+var fuzzSeeds = map[string][2]string{
+	"string":  {`""`, `"a"`},
+	"[]byte":  {`[]byte("")`, `[]byte("a")`},
+	"bool":    {"false", "true"},
+	"int":     {"0", "1"},
+	"int8":    {"int8(0)", "int8(1)"},
+	"int16":   {"int16(0)", "int16(1)"},
+	"int32":   {"int32(0)", "int32(1)"},
+	"rune":    {"rune(0)", "'a'"},
+	"int64":   {"int64(0)", "int64(1)"},
+	"uint":    {"uint(0)", "uint(1)"},
+	"uint8":   {"uint8(0)", "uint8(1)"},
+	"byte":    {"byte(0)", "byte('a')"},
+	"uint16":  {"uint16(0)", "uint16(1)"},
+	"uint32":  {"uint32(0)", "uint32(1)"},
+	"uint64":  {"uint64(0)", "uint64(1)"},
+	"float32": {"float32(0)", "float32(1.5)"},
+	"float64": {"0.0", "1.5"},
+}
+
+func runGenerate(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fail("Usage: generate <%s> target.go [-o out_test.go] [--dry-run]", strings.Join(generatorNames(), "|"))
+	}
+	name := args[0]
+	generator, ok := generators[name]
+	if !ok {
+		return fail("Unknown generator: %s", name)
+	}
+
+	var outputPath string
+	dryRun := false
+
+	suffix := strings.ReplaceAll(name, "-", "_")
+	flags := flag.NewFlagSet("generate "+name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&outputPath, "o", "", "write the generated file here instead of next to the target as <name>_"+suffix+"_test.go")
+	flags.BoolVar(&dryRun, "dry-run", false, "do not write; the generated source is returned in the output")
+
+	positional, err := parseFlags(flags, args[1:])
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(positional) != 1 {
+		return fail("Usage: generate %s target.go [-o out_test.go] [--dry-run]", name)
+	}
+
+	target := positional[0]
+	if strings.HasSuffix(target, "_test.go") {
+		return fail("Target is a test file: %s", target)
+	}
+	if outputPath == "" {
+		outputPath = strings.TrimSuffix(target, ".go") + "_" + suffix + "_test.go"
+	}
+
+	file, err := loadEditFile(target)
+	if err != nil {
+		return fail("Failed to load target: %v", err)
+	}
+
+	result := &GenerateResult{Target: target, Generator: name, Generated: []GeneratedTarget{}, Skipped: []SkippedGeneration{}, outputPath: outputPath}
+	source, err := generator(file, result)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if source == "" {
+		return printJSON(result)
+	}
+
+	formatted, err := format.Source([]byte(source))
+	if err != nil {
+		result.ParseError = err.Error()
+		result.Source = source
+		printJSON(result)
+		return 1
+	}
+	if dryRun {
+		result.Source = string(formatted)
+		return printJSON(result)
+	}
+	if err := os.WriteFile(outputPath, formatted, 0644); err != nil {
+		return fail("Failed to write output: %v", err)
+	}
+	result.Output = outputPath
+	result.Written = true
+	return printJSON(result)
+}
+
+func generatorNames() []string {
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generateFuzz writes a FuzzXxx target for each pure function of the file
+// whose parameters go test can fuzz. Each target seeds the corpus with zero
+// and small values and calls the function, so the fuzzer finds the inputs
+// that panic or hang it. The targets are in the target's package, so they
+// reach unexported functions too.
+func generateFuzz(file *editFile, result *GenerateResult) (string, error) {
+	used := map[string]bool{}
+	var targets strings.Builder
+	for _, fn := range generatableFunctions(file, result, nil) {
+		name := fn.Name.Name
+		targetName := generatedName(file, used, "Fuzz", name)
+		writeFuzzTarget(&targets, targetName, name, fieldParams(fn.Type.Params), len(fieldParams(fn.Type.Results)))
+		result.Generated = append(result.Generated, GeneratedTarget{Name: targetName, Function: name})
+	}
+
+	if len(result.Generated) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("// Code generated by go_parser generate fuzz. DO NOT EDIT.\n\npackage %s\n\nimport \"testing\"\n%s", file.file.Name.Name, targets.String()), nil
+}
+
+// generatableFunctions returns the top-level functions of the file a test
+// can be generated for: pure, not generic, with results, and with
+// parameters of the types in fuzzSeeds. resultProblem, when given, rejects
+// results the generator cannot handle. The others are added to the result's
+// skipped list.
+func generatableFunctions(file *editFile, result *GenerateResult, resultProblem func(results []ParamInfo) string) []*ast.FuncDecl {
+	reasons := impurityReasons(file.file)
+
+	functions := []*ast.FuncDecl{}
+	for _, decl := range file.file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Name.Name == "_" {
+			continue
+		}
+		name := fn.Name.Name
+		if name == "init" || name == "main" {
+			continue
+		}
+
+		skip := func(reason string) {
+			result.Skipped = append(result.Skipped, SkippedGeneration{Function: name, Reason: reason})
+		}
+		if reasons[name] != "" {
+			skip("not pure: " + reasons[name])
+			continue
+		}
+		if fn.Type.TypeParams != nil {
+			skip("is generic")
+			continue
+		}
+		results := fieldParams(fn.Type.Results)
+		if len(results) == 0 {
+			skip("has no results to compute")
+			continue
+		}
+		params := fieldParams(fn.Type.Params)
+		if len(params) == 0 {
+			skip("has no parameters to vary")
+			continue
+		}
+		unfuzzable := ""
+		for _, param := range params {
+			if _, ok := fuzzSeeds[param.Type]; !ok {
+				unfuzzable = param.Type
+				break
+			}
+		}
+		if unfuzzable != "" {
+			skip("has a parameter of type " + unfuzzable + ", which has no seed values")
+			continue
+		}
+		if resultProblem != nil {
+			if problem := resultProblem(results); problem != "" {
+				skip(problem)
+				continue
+			}
+		}
+		functions = append(functions, fn)
+	}
+	return functions
+}
+
+// generatedName returns prefix followed by the function's name, or by an
+// underscore and the name when that is taken, and marks it used
+func generatedName(file *editFile, used map[string]bool, prefix, function string) string {
+	name := prefix + upperFirst(function)
+	if used[name] || file.file.Scope.Lookup(name) != nil {
+		name = prefix + "_" + function
+	}
+	used[name] = true
+	return name
+}
+
+func writeFuzzTarget(b *strings.Builder, targetName, function string, params []ParamInfo, results int) {
+	args := make([]string, len(params))
+	declared := make([]string, len(params))
+	zero := make([]string, len(params))
+	small := make([]string, len(params))
+	for i, param := range params {
+		// The function's parameter names, unless they clash with the
+		// target's f and t
+		args[i] = param.Name
+		if args[i] == "" || args[i] == "_" || args[i] == "f" || args[i] == "t" {
+			args[i] = fmt.Sprintf("p%d", i)
+		}
+		declared[i] = args[i] + " " + param.Type
+		zero[i] = fuzzSeeds[param.Type][0]
+		small[i] = fuzzSeeds[param.Type][1]
+	}
+	blanks := strings.TrimSuffix(strings.Repeat("_, ", results), ", ")
+
+	fmt.Fprintf(b, "\nfunc %s(f *testing.F) {\n", targetName)
+	fmt.Fprintf(b, "\tf.Add(%s)\n", strings.Join(zero, ", "))
+	fmt.Fprintf(b, "\tf.Add(%s)\n", strings.Join(small, ", "))
+	fmt.Fprintf(b, "\tf.Fuzz(func(t *testing.T, %s) {\n", strings.Join(declared, ", "))
+	fmt.Fprintf(b, "\t\t%s = %s(%s)\n", blanks, function, strings.Join(args, ", "))
+	b.WriteString("\t})\n}\n")
+}
+
+func upperFirst(name string) string {
+	for i, r := range name {
+		return string(unicode.ToUpper(r)) + name[i+len(string(r)):]
+	}
+	return name
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"time"
+)
+
+// HotspotReport ranks the files and functions where complexity and recent
+// change frequency coincide
+type HotspotReport struct {
+	Window    string      `json:"window"`
+	Since     string      `json:"since"`
+	Files     []Hotspot   `json:"files"`
+	Functions []Hotspot   `json:"functions"`
+	Errors    []FileError `json:"errors"`
+}
+
+// Hotspot is a single ranked entry. Score is complexity multiplied by the
+// number of commits within the window.
+type Hotspot struct {
+	File       string  `json:"file"`
+	Name       string  `json:"name,omitempty"`
+	Receiver   *string `json:"receiver,omitempty"`
+	Complexity int     `json:"complexity"`
+	Commits    int     `json:"commits"`
+	Score      int     `json:"score"`
+	Reason     string  `json:"reason"`
+}
+
+func runHotspots(args []string) int {
+	top := 10
+	window := "90d"
+	strict := false
+
+	flags := flag.NewFlagSet("hotspots", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.IntVar(&top, "top", 10, "number of files and functions to report")
+	flags.StringVar(&window, "window", "90d", "history window such as 90d or 12w")
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	duration, err := parseWindow(window)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	files, err := collectGoFiles(patterns, false)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+
+	report, err := computeHotspots(files, window, time.Now().Add(-duration), top)
+	if err != nil {
+		return fail("Failed to compute hotspots: %v", err)
+	}
+	if err := strictFailure(report.Errors, strict); err != nil {
+		return fail("Failed to compute hotspots: %v", err)
+	}
+
+	return printJSON(report)
+}
+
+func computeHotspots(files []string, window string, since time.Time, top int) (*HotspotReport, error) {
+	report := &HotspotReport{
+		Window:    window,
+		Since:     since.UTC().Format(time.RFC3339),
+		Files:     []Hotspot{},
+		Functions: []Hotspot{},
+		Errors:    []FileError{},
+	}
+
+	for _, path := range files {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			report.Errors = append(report.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+
+		churn, err := computeFileChurn(path, since)
+		if err != nil {
+			return nil, err
+		}
+
+		fileComplexity := 1
+		ast.Inspect(file, func(n ast.Node) bool {
+			fileComplexity += complexityIncrement(n)
+			return true
+		})
+
+		report.Files = append(report.Files, Hotspot{
+			File:       path,
+			Complexity: fileComplexity,
+			Commits:    churn.Commits,
+			Score:      fileComplexity * churn.Commits,
+		})
+
+		// Functions in files untouched during the window cannot be hot
+		if churn.Commits == 0 {
+			continue
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+
+			commits, err := computeLineRangeChurn(path, sourceSpan(fset, fn), since)
+			if err != nil {
+				return nil, err
+			}
+
+			complexity := functionComplexity(fn)
+			hotspot := Hotspot{
+				File:       path,
+				Name:       fn.Name.Name,
+				Complexity: complexity,
+				Commits:    commits,
+				Score:      complexity * commits,
+			}
+			if receiver := receiverExpr(fn); receiver != "" {
+				hotspot.Receiver = &receiver
+			}
+			report.Functions = append(report.Functions, hotspot)
+		}
+	}
+
+	report.Files = rankHotspots(report.Files, window, top)
+	report.Functions = rankHotspots(report.Functions, window, top)
+	return report, nil
+}
+
+// rankHotspots drops entries with a zero score, sorts the rest and explains
+// each of the top entries relative to the medians of the whole set
+func rankHotspots(hotspots []Hotspot, window string, top int) []Hotspot {
+	complexities := make([]int, len(hotspots))
+	commits := make([]int, len(hotspots))
+	for i, h := range hotspots {
+		complexities[i] = h.Complexity
+		commits[i] = h.Commits
+	}
+	medianComplexity := median(complexities)
+	medianCommits := median(commits)
+
+	ranked := []Hotspot{}
+	for _, h := range hotspots {
+		if h.Score > 0 {
+			ranked = append(ranked, h)
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Complexity > ranked[j].Complexity
+	})
+
+	if top > 0 && len(ranked) > top {
+		ranked = ranked[:top]
+	}
+
+	for i := range ranked {
+		h := &ranked[i]
+		h.Reason = fmt.Sprintf("complexity %d changed in %d commits within %s", h.Complexity, h.Commits, window)
+		switch {
+		case h.Complexity > medianComplexity && h.Commits > medianCommits:
+			h.Reason += "; both above the median, a prime refactoring target"
+		case h.Complexity > medianComplexity:
+			h.Reason += "; complexity above the median"
+		case h.Commits > medianCommits:
+			h.Reason += "; changes more often than the median"
+		}
+	}
+
+	return ranked
+}
+
+func median(values []int) int {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+	"unicode"
+)
+
+// TestHygiene summarizes how a test file's tests use the testing package.
+// Score is the file's test_quality dimension.
+type TestHygiene struct {
+	Tests []TestHygieneInfo `json:"tests"`
+	Score float64           `json:"score"`
+}
+
+// TestHygieneInfo reports the testing facilities a single test uses
+type TestHygieneInfo struct {
+	Name             string  `json:"name"`
+	Parallel         bool    `json:"parallel"`
+	Subtests         int     `json:"subtests"`
+	ParallelSubtests int     `json:"parallel_subtests"`
+	Cleanups         int     `json:"cleanups"`
+	Defers           int     `json:"defers"`
+	TempDirs         int     `json:"temp_dirs"`
+	ManualTempFiles  int     `json:"manual_temp_files"`
+	Score            float64 `json:"score"`
+}
+
+// manualTempCalls create temporary files that the test must remove itself,
+// where t.TempDir cleans up automatically
+var manualTempCalls = []string{"os.MkdirTemp", "os.CreateTemp", "ioutil.TempDir", "ioutil.TempFile"}
+
+// analyzeTestHygiene inspects the Test functions of file, returning nil when
+// it has none
+func analyzeTestHygiene(file *ast.File) *TestHygiene {
+	hygiene := &TestHygiene{Tests: []TestHygieneInfo{}}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil || fn.Recv != nil || !isTestFunc(fn) {
+			continue
+		}
+
+		info := TestHygieneInfo{Name: fn.Name.Name}
+		topIdent := fn.Type.Params.List[0].Names[0]
+		top := topIdent.Name
+
+		// Names bound to a *testing.T: the test's own and its subtests'
+		testVars := map[string]bool{top: true}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if lit, ok := n.(*ast.FuncLit); ok {
+				for _, field := range lit.Type.Params.List {
+					if types.ExprString(field.Type) == "*testing.T" {
+						for _, name := range field.Names {
+							testVars[name.Name] = true
+						}
+					}
+				}
+			}
+			return true
+		})
+
+		hasLoop := false
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.RangeStmt, *ast.ForStmt:
+				hasLoop = true
+			case *ast.DeferStmt:
+				info.Defers++
+			case *ast.CallExpr:
+				name := getFuncName(node.Fun)
+				if contains(manualTempCalls, name) {
+					info.ManualTempFiles++
+					return true
+				}
+				sel, ok := node.Fun.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				x, ok := sel.X.(*ast.Ident)
+				if !ok || !testVars[x.Name] {
+					return true
+				}
+				switch sel.Sel.Name {
+				case "Parallel":
+					// Subtests usually shadow the test's own t
+					if x.Obj == topIdent.Obj {
+						info.Parallel = true
+					} else {
+						info.ParallelSubtests++
+					}
+				case "Run":
+					info.Subtests++
+				case "Cleanup":
+					info.Cleanups++
+				case "TempDir":
+					info.TempDirs++
+				}
+			}
+			return true
+		})
+
+		info.Score = testHygieneScore(info, hasLoop)
+		hygiene.Tests = append(hygiene.Tests, info)
+	}
+
+	if len(hygiene.Tests) == 0 {
+		return nil
+	}
+
+	total := 0.0
+	for _, info := range hygiene.Tests {
+		total += info.Score
+	}
+	hygiene.Score = roundTo(total/float64(len(hygiene.Tests)), 3)
+	return hygiene
+}
+
+// testHygieneScore averages the checks that apply to a test: it runs in
+// parallel; it cleans up with t.Cleanup rather than only defer; it uses
+// t.TempDir rather than managing temp files; and a test that loops over
+// cases runs them as subtests
+func testHygieneScore(info TestHygieneInfo, hasLoop bool) float64 {
+	checks := []bool{info.Parallel}
+	if info.Defers > 0 || info.Cleanups > 0 {
+		checks = append(checks, info.Cleanups > 0)
+	}
+	if info.TempDirs > 0 || info.ManualTempFiles > 0 {
+		checks = append(checks, info.ManualTempFiles == 0)
+	}
+	if hasLoop {
+		checks = append(checks, info.Subtests > 0)
+	}
+
+	passed := 0
+	for _, ok := range checks {
+		if ok {
+			passed++
+		}
+	}
+	return roundTo(float64(passed)/float64(len(checks)), 3)
+}
+
+// isTestFunc reports whether fn is a TestXxx(t *testing.T) function
+func isTestFunc(fn *ast.FuncDecl) bool {
+	name := fn.Name.Name
+	if !strings.HasPrefix(name, "Test") || name == "TestMain" {
+		return false
+	}
+	if rest := name[len("Test"):]; rest != "" && unicode.IsLower([]rune(rest)[0]) {
+		return false
+	}
+	params := fn.Type.Params.List
+	return len(params) == 1 && len(params[0].Names) == 1 && types.ExprString(params[0].Type) == "*testing.T"
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// InterfaceGap compares a type's methods with an interface. Implements is
+// whether *T satisfies the interface and ValueImplements whether T does.
+type InterfaceGap struct {
+	Interface       string      `json:"interface"`
+	Type            string      `json:"type"`
+	Implements      bool        `json:"implements"`
+	ValueImplements bool        `json:"value_implements"`
+	Methods         []MethodGap `json:"methods"`
+	Missing         []string    `json:"missing"`
+	Mismatched      []string    `json:"mismatched"`
+	TypeErrors      []string    `json:"type_errors"`
+}
+
+// MethodGap is one interface method. Status is ok, missing or mismatch;
+// Want is the method to write, with the type's receiver, and Have the
+// declaration found instead.
+type MethodGap struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Want   string `json:"want"`
+	Have   string `json:"have,omitempty"`
+	Line   int    `json:"line,omitempty"`
+}
+
+func runIfaceGap(args []string) int {
+	ifaceName, typeName := "", ""
+
+	flags := flag.NewFlagSet("iface-gap", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&ifaceName, "interface", "", "interface declared in the files, or qualified as io.Writer or example.com/pkg.Store")
+	flags.StringVar(&typeName, "type", "", "type declared in the files")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if ifaceName == "" || typeName == "" {
+		return fail("--interface and --type are required")
+	}
+	typeName = strings.TrimPrefix(typeName, "*")
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	files, err := collectGoFiles(patterns, false)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+
+	gap, err := interfaceGap(files, ifaceName, typeName)
+	if err != nil {
+		return fail("Interface gap failed: %v", err)
+	}
+	return printJSON(gap)
+}
+
+// interfaceGap type-checks files as one package, tolerating errors such as
+// the ones missing methods cause, and matches typeName against ifaceName
+func interfaceGap(paths []string, ifaceName, typeName string) (*InterfaceGap, error) {
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+	for _, path := range paths {
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go files given")
+	}
+
+	gap := &InterfaceGap{Interface: ifaceName, Type: typeName, Methods: []MethodGap{}, Missing: []string{}, Mismatched: []string{}, TypeErrors: []string{}}
+	imp := newFallbackImporter(fset)
+	config := types.Config{
+		Importer: imp,
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok && !imp.refersToMissing(typeErr.Msg) {
+				gap.TypeErrors = append(gap.TypeErrors, fmt.Sprintf("%s: %s", fset.Position(typeErr.Pos), typeErr.Msg))
+			}
+		},
+	}
+	pkg, _ := config.Check(files[0].Name.Name, fset, files, nil)
+
+	named, ok := lookupTypeName(pkg, typeName)
+	if !ok {
+		return nil, fmt.Errorf("type %s is not declared in the given files", typeName)
+	}
+	iface, err := lookupInterface(pkg, imp, ifaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	pointer := types.NewPointer(named)
+	gap.Implements = types.Implements(pointer, iface)
+	gap.ValueImplements = types.Implements(named, iface)
+
+	qualifier := types.RelativeTo(pkg)
+	receiver := stubReceiverName(files, typeName)
+	for i := 0; i < iface.NumMethods(); i++ {
+		method := iface.Method(i)
+		want := method.Type().(*types.Signature)
+		entry := MethodGap{
+			Name:   method.Name(),
+			Status: "ok",
+			Want:   fmt.Sprintf("func (%s *%s) %s%s", receiver, typeName, method.Name(), strings.TrimPrefix(types.TypeString(want, qualifier), "func")),
+		}
+
+		obj, _, _ := types.LookupFieldOrMethod(pointer, true, method.Pkg(), method.Name())
+		switch found := obj.(type) {
+		case nil:
+			entry.Status = "missing"
+			gap.Missing = append(gap.Missing, method.Name())
+		case *types.Func:
+			entry.Line = fset.Position(found.Pos()).Line
+			if !types.Identical(found.Type(), want) {
+				entry.Status = "mismatch"
+				entry.Have = types.ObjectString(found, qualifier)
+				gap.Mismatched = append(gap.Mismatched, method.Name())
+			}
+		default:
+			entry.Status = "mismatch"
+			entry.Have = types.ObjectString(found, qualifier)
+			entry.Line = fset.Position(found.Pos()).Line
+			gap.Mismatched = append(gap.Mismatched, method.Name())
+		}
+		gap.Methods = append(gap.Methods, entry)
+	}
+	return gap, nil
+}
+
+func lookupTypeName(pkg *types.Package, name string) (*types.Named, bool) {
+	obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return nil, false
+	}
+	named, ok := obj.Type().(*types.Named)
+	return named, ok
+}
+
+// lookupInterface resolves an interface declared in pkg or, when qualified,
+// in an imported package
+func lookupInterface(pkg *types.Package, imp types.Importer, name string) (*types.Interface, error) {
+	scope := pkg.Scope()
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		path := name[:i]
+		for _, imported := range pkg.Imports() {
+			if imported.Name() == path {
+				path = imported.Path()
+			}
+		}
+		other, err := imp.Import(path)
+		if err != nil {
+			return nil, err
+		}
+		scope, name = other.Scope(), name[i+1:]
+	}
+
+	obj, ok := scope.Lookup(name).(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("interface %s not found", name)
+	}
+	iface, ok := obj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an interface", name)
+	}
+	return iface, nil
+}
+
+// stubReceiverName returns the receiver name used by the type's existing
+// methods, or its lower-cased initial
+func stubReceiverName(files []*ast.File, typeName string) string {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && receiverTypeName(fn) == typeName {
+				if name := receiverVarName(fn); name != "" && name != "_" {
+					return name
+				}
+			}
+		}
+	}
+	return string(unicode.ToLower([]rune(typeName)[0]))
+}
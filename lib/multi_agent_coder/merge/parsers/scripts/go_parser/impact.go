@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ImpactReport lists the packages of a repository a change can affect. Build
+// is every package whose compiled code depends on a changed file and Test
+// every package with tests that must be rerun, both as import paths that can
+// be passed to go build and go test.
+type ImpactReport struct {
+	Module   string            `json:"module"`
+	Changed  []string          `json:"changed"`
+	Packages []ImpactedPackage `json:"packages"`
+	Build    []string          `json:"build"`
+	Test     []string          `json:"test"`
+	Errors   []FileError       `json:"errors"`
+}
+
+// ImpactedPackage is one affected package. Reason is changed when a file of
+// the package changed, imports when it depends on a changed package (Via is
+// the import that leads there and Depth the number of imports away), tests
+// when only its test files import one, and module when go.mod or go.sum
+// changed.
+type ImpactedPackage struct {
+	Path     string `json:"path"`
+	Dir      string `json:"dir"`
+	Reason   string `json:"reason"`
+	Via      string `json:"via,omitempty"`
+	Depth    int    `json:"depth"`
+	Rebuild  bool   `json:"rebuild"`
+	HasTests bool   `json:"has_tests"`
+}
+
+func runImpact(args []string) int {
+	var changed stringList
+	strict := false
+
+	flags := flag.NewFlagSet("impact", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.Var(&changed, "changed", "files touched by the proposed change (repeatable, comma-separated)")
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(changed) == 0 {
+		return fail("--changed is required")
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	goFiles := []string{}
+	for _, path := range changed {
+		if strings.HasSuffix(path, ".go") {
+			goFiles = append(goFiles, path)
+		}
+	}
+	graph, err := buildPackageGraph(patterns, goFiles)
+	if err != nil {
+		return fail("Failed to build package graph: %v", err)
+	}
+	if err := strictFailure(graph.Errors, strict); err != nil {
+		return fail("Failed to build package graph: %v", err)
+	}
+
+	return printJSON(changeImpact(graph, changed))
+}
+
+// changeImpact walks the package graph backwards from the changed files.
+// Production imports carry a change on to every importer; test-only imports
+// and changed _test.go files only require rerunning that package's tests.
+func changeImpact(graph *PackageGraph, changed []string) *ImpactReport {
+	report := &ImpactReport{
+		Module:   graph.Module,
+		Changed:  []string{},
+		Packages: []ImpactedPackage{},
+		Build:    []string{},
+		Test:     []string{},
+		Errors:   graph.Errors,
+	}
+
+	nodes := map[string]PackageNode{}
+	for _, node := range graph.Packages {
+		nodes[node.Path] = node
+	}
+	importers := map[string][]PackageEdge{}
+	for _, edge := range graph.Edges {
+		importers[edge.To] = append(importers[edge.To], edge)
+	}
+
+	impacted := map[string]*ImpactedPackage{}
+	add := func(path, reason, via string, depth int, rebuild bool) bool {
+		if entry := impacted[path]; entry != nil {
+			if !rebuild || entry.Rebuild {
+				return false
+			}
+			entry.Reason, entry.Via, entry.Depth, entry.Rebuild = reason, via, depth, true
+			return true
+		}
+		impacted[path] = &ImpactedPackage{Path: path, Dir: nodes[path].Dir, Reason: reason, Via: via, Depth: depth, Rebuild: rebuild}
+		return true
+	}
+
+	root := ""
+	if len(changed) > 0 && graph.Module != "" {
+		root, _, _ = findModule(filepath.Dir(changed[0]))
+	}
+
+	queue := []string{}
+	moduleChanged := false
+	for _, path := range changed {
+		path = filepath.Clean(path)
+		report.Changed = append(report.Changed, path)
+
+		switch base := filepath.Base(path); {
+		case base == "go.mod" || base == "go.sum":
+			moduleChanged = true
+		case strings.HasSuffix(base, ".go"):
+			importPath := packageImportPath(root, graph.Module, filepath.Dir(path))
+			rebuild := !strings.HasSuffix(base, "_test.go")
+			if add(importPath, "changed", "", 0, rebuild) && rebuild {
+				queue = append(queue, importPath)
+			}
+		}
+	}
+
+	if moduleChanged {
+		for _, node := range graph.Packages {
+			if entry := impacted[node.Path]; entry == nil || !entry.Rebuild {
+				impacted[node.Path] = &ImpactedPackage{Path: node.Path, Dir: node.Dir, Reason: "module", Rebuild: true}
+			}
+		}
+		queue = nil
+	}
+
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		depth := impacted[path].Depth + 1
+		for _, edge := range importers[path] {
+			if edge.Test {
+				add(edge.From, "tests", path, depth, false)
+			} else if add(edge.From, "imports", path, depth, true) {
+				queue = append(queue, edge.From)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(impacted))
+	for path := range impacted {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		entry := impacted[path]
+		tests, _ := filepath.Glob(filepath.Join(entry.Dir, "*_test.go"))
+		entry.HasTests = len(tests) > 0
+
+		report.Packages = append(report.Packages, *entry)
+		if entry.Rebuild {
+			report.Build = append(report.Build, path)
+		}
+		if entry.HasTests {
+			report.Test = append(report.Test, path)
+		}
+	}
+
+	sort.SliceStable(report.Packages, func(i, j int) bool {
+		return report.Packages[i].Depth < report.Packages[j].Depth
+	})
+	return report
+}
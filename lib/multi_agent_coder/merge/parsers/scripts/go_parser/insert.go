@@ -0,0 +1,338 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"os"
+	"sort"
+	"strings"
+)
+
+// InsertedSymbol records where insert-symbol placed a declaration. After is
+// the declaration it follows, empty when it was appended to the file or put
+// ahead of the first declaration of its kind.
+type InsertedSymbol struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	After string `json:"after,omitempty"`
+}
+
+// insertion is a declaration from the snippet and the target offset it goes
+// to; before is set when it is spliced in ahead of the declaration at that
+// offset rather than after the one ending there
+type insertion struct {
+	at     int
+	before bool
+	order  int
+	text   string
+	symbol InsertedSymbol
+}
+
+var insertPolicies = []string{"related", "alphabetical", "end"}
+
+func runInsertSymbol(args []string) int {
+	var fromPath, after, outputPath string
+	policy := "related"
+	dryRun := false
+
+	flags := flag.NewFlagSet("insert-symbol", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&fromPath, "from", "", "file containing the declarations to insert")
+	flags.StringVar(&after, "after", "", "insert everything after this declaration, e.g. TypeDecl:Config or Server.Start")
+	flags.StringVar(&policy, "policy", "related", "placement without --after: related, alphabetical or end")
+	flags.StringVar(&outputPath, "o", "", "write the result here instead of over the target")
+	flags.BoolVar(&dryRun, "dry-run", false, "do not write; the result source is returned in the output")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	if fromPath == "" || len(positional) != 1 {
+		return fail("Usage: insert-symbol target.go --from snippet.go [--after Kind:Name | --policy related|alphabetical|end] [-o out.go] [--dry-run]")
+	}
+	if !contains(insertPolicies, policy) {
+		return fail("Invalid policy: %s", policy)
+	}
+
+	target := positional[0]
+	if outputPath == "" {
+		outputPath = target
+	}
+
+	file, err := loadEditFile(target)
+	if err != nil {
+		return fail("Failed to load target: %v", err)
+	}
+
+	snippet, err := loadSnippet(fromPath)
+	if err != nil {
+		return fail("Failed to load snippet: %v", err)
+	}
+
+	source, inserted, added, err := insertSymbols(file, snippet, after, policy)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	result := &EditResult{Target: target, AddedImports: added, Inserted: inserted}
+	if err := finishEdit(result, source, outputPath, dryRun); err != nil {
+		return fail("%v", err)
+	}
+	return printEditResult(result)
+}
+
+// insertSymbols adds every non-import declaration of snippet to file, either
+// after the anchor declaration or where policy places each one, and merges
+// the imports they need
+func insertSymbols(file, snippet *editFile, after, policy string) (string, []InsertedSymbol, []string, error) {
+	return insertDecls(file, snippet, topLevelSymbols(snippet.file), after, policy)
+}
+
+// insertDecls adds the given declarations of snippet to file as
+// insertSymbols does
+func insertDecls(file, snippet *editFile, decls []symbolDecl, after, policy string) (string, []InsertedSymbol, []string, error) {
+	existing := topLevelSymbols(file.file)
+	names := map[string]bool{}
+	for _, decl := range existing {
+		names[decl.name] = true
+	}
+
+	var anchor *symbolDecl
+	if after != "" {
+		var err error
+		if anchor, err = findAnchor(file.file, after); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	insertions := []insertion{}
+	required := []importInfo{}
+	seen := map[ast.Node]bool{}
+	// Methods on a type the snippet itself adds travel with that type
+	newTypes := map[string]insertion{}
+
+	for _, decl := range decls {
+		if names[decl.name] {
+			return "", nil, nil, fmt.Errorf("%s %s already exists in %s; use replace-symbol to change it", decl.kind, decl.name, file.path)
+		}
+		// A grouped declaration is inserted once, however many names it has
+		if seen[decl.node] {
+			continue
+		}
+		seen[decl.node] = true
+
+		start, end := snippet.declRange(&decl, true)
+		item := insertion{
+			order:  len(insertions),
+			text:   snippet.source[start:end],
+			symbol: InsertedSymbol{Name: decl.name, Kind: decl.kind},
+		}
+
+		place, before := anchor, (*symbolDecl)(nil)
+		if place == nil {
+			place, before = placeSymbol(existing, decl, policy)
+		}
+		place, before = wholeDecl(file.file, place), wholeDecl(file.file, before)
+		owner, ownedBySnippet := newTypes[receiverName(decl)]
+
+		switch {
+		case anchor == nil && ownedBySnippet:
+			item.at, item.before = owner.at, owner.before
+			item.symbol.After = "type " + owner.symbol.Name
+		case place != nil:
+			_, item.at = file.declRange(place, false)
+			item.symbol.After = place.kind + " " + place.name
+		case before != nil:
+			item.at, _ = file.declRange(before, true)
+			item.before = true
+		default:
+			item.at = len(strings.TrimRight(file.source, "\n"))
+		}
+		if decl.kind == "type" {
+			newTypes[decl.name] = item
+		}
+
+		// Lone specs of a grouped snippet declaration need their keyword
+		if _, isSpec := decl.node.(ast.Spec); isSpec {
+			item.text = decl.kind + " " + item.text
+		}
+
+		insertions = append(insertions, item)
+		required = append(required, requiredImports(snippet.file, decl.node)...)
+	}
+
+	if len(insertions) == 0 {
+		return "", nil, nil, fmt.Errorf("no declarations found in %s", snippet.path)
+	}
+
+	// Splice from the end of the file backwards so earlier offsets stay valid,
+	// keeping snippet order among declarations sharing an offset
+	sort.SliceStable(insertions, func(i, j int) bool {
+		if insertions[i].at != insertions[j].at {
+			return insertions[i].at > insertions[j].at
+		}
+		return insertions[i].order > insertions[j].order
+	})
+
+	source := file.source
+	for _, item := range insertions {
+		if item.before {
+			source = source[:item.at] + item.text + "\n\n" + source[item.at:]
+		} else {
+			source = source[:item.at] + "\n\n" + item.text + source[item.at:]
+		}
+	}
+	if !strings.HasSuffix(source, "\n") {
+		source += "\n"
+	}
+
+	source, added, err := ensureImports(source, required)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("inserted declarations do not parse in %s: %v", file.path, err)
+	}
+
+	inserted := []InsertedSymbol{}
+	sort.SliceStable(insertions, func(i, j int) bool { return insertions[i].order < insertions[j].order })
+	for _, item := range insertions {
+		inserted = append(inserted, item.symbol)
+	}
+
+	return source, inserted, added, nil
+}
+
+// wholeDecl widens a spec of a parenthesized group to the declaration
+// holding it, so that what is placed next to it goes outside the group
+func wholeDecl(file *ast.File, decl *symbolDecl) *symbolDecl {
+	if decl == nil {
+		return nil
+	}
+	if _, isSpec := decl.node.(ast.Spec); !isSpec {
+		return decl
+	}
+	for _, d := range file.Decls {
+		if gen, ok := d.(*ast.GenDecl); ok && gen.Pos() <= decl.node.Pos() && decl.node.End() <= gen.End() {
+			widened := *decl
+			widened.node, widened.doc = gen, gen.Doc
+			return &widened
+		}
+	}
+	return decl
+}
+
+func receiverName(decl symbolDecl) string {
+	if decl.fn == nil {
+		return ""
+	}
+	return receiverTypeName(decl.fn)
+}
+
+// anchorKinds maps the kind prefixes accepted by --after to declaration kinds
+var anchorKinds = map[string][]string{
+	"typedecl": {"type"},
+	"type":     {"type"},
+	"funcdecl": {"func", "method"},
+	"func":     {"func", "method"},
+	"method":   {"method"},
+	"var":      {"var"},
+	"const":    {"const"},
+}
+
+// findAnchor resolves an --after value of the form "Kind:Name" or "Name"
+func findAnchor(file *ast.File, after string) (*symbolDecl, error) {
+	name, kinds := after, []string(nil)
+	if i := strings.Index(after, ":"); i >= 0 {
+		prefix := strings.ToLower(after[:i])
+		if kinds = anchorKinds[prefix]; kinds == nil {
+			return nil, fmt.Errorf("unknown declaration kind in --after: %s", after[:i])
+		}
+		name = after[i+1:]
+	}
+
+	decl := findSymbol(file, name)
+	if decl == nil || (kinds != nil && !contains(kinds, decl.kind)) {
+		return nil, fmt.Errorf("anchor %s not found", after)
+	}
+	return decl, nil
+}
+
+// placeSymbol picks where a new declaration goes: after one existing
+// declaration, before one, or (both nil) at the end of the file
+func placeSymbol(existing []symbolDecl, decl symbolDecl, policy string) (after, before *symbolDecl) {
+	switch policy {
+	case "related":
+		return placeRelated(existing, decl), nil
+	case "alphabetical":
+		return placeAlphabetical(existing, decl)
+	}
+	return nil, nil
+}
+
+// placeRelated puts methods after the last method of their receiver (or the
+// type itself), constructors after the type they return, and anything else
+// after the last declaration of the same kind
+func placeRelated(existing []symbolDecl, decl symbolDecl) *symbolDecl {
+	for _, typeName := range relatedTypes(decl) {
+		var place *symbolDecl
+		for i := range existing {
+			other := &existing[i]
+			switch {
+			case other.kind == "type" && other.name == typeName:
+				place = other
+			case decl.kind == "method" && other.fn != nil && receiverTypeName(other.fn) == typeName:
+				place = other
+			}
+		}
+		if place != nil {
+			return place
+		}
+	}
+
+	var place *symbolDecl
+	for i := range existing {
+		if existing[i].kind == decl.kind {
+			place = &existing[i]
+		}
+	}
+	return place
+}
+
+// relatedTypes returns the types a declaration belongs with: a method's
+// receiver, or the result types of a function such as NewConfig
+func relatedTypes(decl symbolDecl) []string {
+	if decl.fn == nil {
+		return nil
+	}
+	if decl.kind == "method" {
+		return []string{receiverTypeName(decl.fn)}
+	}
+
+	types := []string{}
+	if decl.fn.Type.Results != nil {
+		for _, field := range decl.fn.Type.Results.List {
+			types = append(types, strings.TrimPrefix(getTypeName(field.Type), "*"))
+		}
+	}
+	return types
+}
+
+// placeAlphabetical keeps declarations of a kind sorted by name: the new one
+// follows the last existing declaration of its kind that sorts before it, or
+// goes right before the first one when it sorts first
+func placeAlphabetical(existing []symbolDecl, decl symbolDecl) (after, before *symbolDecl) {
+	for i := range existing {
+		other := &existing[i]
+		if other.kind != decl.kind {
+			continue
+		}
+		if other.name > decl.name {
+			if after == nil {
+				before = other
+			}
+			break
+		}
+		after = other
+	}
+	return after, before
+}
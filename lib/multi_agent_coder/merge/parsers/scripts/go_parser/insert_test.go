@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInsertSymbolsGrouped(t *testing.T) {
+	target := `package p
+
+// Limits
+const (
+	A = 1
+	C = 3
+)
+
+var (
+	x = 1
+	z = 3
+)
+
+func F() {}
+`
+	tests := []struct {
+		name    string
+		snippet string
+		after   string
+		policy  string
+		want    string
+	}{
+		{
+			name:    "const after a const group",
+			snippet: "package p\n\nconst D = 4\n",
+			policy:  "related",
+			want:    "\tC = 3\n)\n\nconst D = 4\n\nvar (",
+		},
+		{
+			name:    "const before a later const group",
+			snippet: "package p\n\nconst B0 = 0\n",
+			policy:  "alphabetical",
+			want:    "const (\n\tA = 1\n\tC = 3\n)\n\nconst B0 = 0\n\nvar (",
+		},
+		{
+			name:    "var ahead of the first var group",
+			snippet: "package p\n\nvar a = 0\n",
+			policy:  "alphabetical",
+			want:    ")\n\nvar a = 0\n\nvar (\n\tx = 1",
+		},
+		{
+			name:    "after a spec of a group",
+			snippet: "package p\n\nvar (\n\ty = 2\n)\n",
+			after:   "var:x",
+			policy:  "related",
+			want:    "\tz = 3\n)\n\nvar y = 2\n\nfunc F",
+		},
+		{
+			name:    "specs of a grouped snippet",
+			snippet: "package p\n\nconst (\n\tE = 5\n\tG = 7\n)\n",
+			after:   "A",
+			policy:  "related",
+			want:    "\tC = 3\n)\n\nconst E = 5\n\nconst G = 7\n\nvar (",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parseEditSource("target.go", target)
+			if err != nil {
+				t.Fatalf("target: %v", err)
+			}
+			snippet, err := parseEditSource("snippet.go", tt.snippet)
+			if err != nil {
+				t.Fatalf("snippet: %v", err)
+			}
+			source, _, _, err := insertSymbols(file, snippet, tt.after, tt.policy)
+			if err != nil {
+				t.Fatalf("insertSymbols: %v", err)
+			}
+			if _, err := parseEditSource("out.go", source); err != nil {
+				t.Fatalf("result does not parse: %v\n%s", err, source)
+			}
+			if !strings.Contains(source, tt.want) {
+				t.Errorf("result lacks %q:\n%s", tt.want, source)
+			}
+		})
+	}
+}
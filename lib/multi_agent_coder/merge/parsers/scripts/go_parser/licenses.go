@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LicensePolicy lists SPDX license identifiers that dependencies may or may
+// not use. With an empty allow list any license that is not denied passes.
+type LicensePolicy struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// LicenseReport is the license verdict for each module checked. Passed is
+// false when any module was denied.
+type LicenseReport struct {
+	Passed  bool            `json:"passed"`
+	Policy  *LicensePolicy  `json:"policy,omitempty"`
+	Modules []ModuleLicense `json:"modules"`
+}
+
+// ModuleLicense is the license found in a module's cached source. Verdict is
+// allow, deny or review; review covers licenses that could not be
+// identified and ones outside a non-empty allow list.
+type ModuleLicense struct {
+	Module   string   `json:"module"`
+	Version  string   `json:"version"`
+	New      bool     `json:"new"`
+	Licenses []string `json:"licenses"`
+	Files    []string `json:"files"`
+	Verdict  string   `json:"verdict"`
+	Reason   string   `json:"reason"`
+}
+
+// licenseFilePattern matches the files a module's license is looked for in
+var licenseFilePattern = regexp.MustCompile(`(?i)^(licen[cs]e|copying|unlicense)([-._].*)?$`)
+
+// licenseSignatures identify licenses by phrases of their text, checked in
+// order so that the more specific variants come first
+var licenseSignatures = []struct {
+	id      string
+	phrases []string
+}{
+	{"AGPL-3.0", []string{"gnu affero general public license", "version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+	{"CC0-1.0", []string{"cc0 1.0 universal"}},
+	{"EPL-2.0", []string{"eclipse public license", "2.0"}},
+}
+
+func runLicenses(args []string) int {
+	baseline := ""
+	configPath := ""
+
+	flags := flag.NewFlagSet("licenses", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&baseline, "baseline", "", "go.mod before the change; only the modules it does not require are checked")
+	flags.StringVar(&configPath, "config", "", "JSON configuration file with a licenses policy")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	var policy *LicensePolicy
+	if configPath != "" {
+		config, err := loadConfig(configPath)
+		if err != nil {
+			return fail("Invalid config: %v", err)
+		}
+		policy = config.Licenses
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	files, err := collectGoFiles(patterns, true)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+	if len(files) == 0 {
+		return fail("No Go files in %s", strings.Join(patterns, " "))
+	}
+
+	root, modulePath, err := findModule(filepath.Dir(files[0]))
+	if err != nil || root == "" {
+		return fail("No go.mod found for %s", files[0])
+	}
+
+	var baselineRequires map[string]string
+	if baseline != "" {
+		if baselineRequires, err = readModuleRequires(baseline); err != nil {
+			return fail("Failed to read baseline: %v", err)
+		}
+	}
+
+	modules, _, err := collectSBOMModules(files, root, modulePath, baselineRequires)
+	if err != nil {
+		return fail("Failed to collect dependencies: %v", err)
+	}
+
+	report := &LicenseReport{Passed: true, Policy: policy, Modules: []ModuleLicense{}}
+	for _, module := range modules {
+		if baselineRequires != nil && !module.New {
+			continue
+		}
+		license := checkModuleLicense(module, policy)
+		if license.Verdict == "deny" {
+			report.Passed = false
+		}
+		report.Modules = append(report.Modules, license)
+	}
+
+	code := printJSON(report)
+	if code == 0 && !report.Passed {
+		return exitViolations
+	}
+	return code
+}
+
+// checkModuleLicense identifies the license of a module from its copy in the
+// module cache and applies policy to it
+func checkModuleLicense(module sbomModule, policy *LicensePolicy) ModuleLicense {
+	license := ModuleLicense{Module: module.Path, Version: module.Version, New: module.New, Licenses: []string{}, Files: []string{}}
+
+	spec := module.Path
+	if module.Version != "" {
+		spec += "@" + module.Version
+	}
+	dir, version, err := findCachedModule(spec)
+	if err != nil {
+		license.Verdict, license.Reason = "review", err.Error()
+		return license
+	}
+	license.Version = version
+
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() || !licenseFilePattern.MatchString(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		license.Files = append(license.Files, entry.Name())
+		if id := identifyLicense(string(data)); id != "" && !contains(license.Licenses, id) {
+			license.Licenses = append(license.Licenses, id)
+		}
+	}
+	sort.Strings(license.Licenses)
+
+	license.Verdict, license.Reason = licenseVerdict(license, policy)
+	return license
+}
+
+// identifyLicense returns the SPDX identifier of a license text, or ""
+func identifyLicense(text string) string {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	for _, signature := range licenseSignatures {
+		matched := true
+		for _, phrase := range signature.phrases {
+			if !strings.Contains(text, phrase) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return signature.id
+		}
+	}
+	return ""
+}
+
+// licenseVerdict denies a module when any of its licenses is denied, and
+// otherwise allows it when all of them pass the allow list
+func licenseVerdict(license ModuleLicense, policy *LicensePolicy) (string, string) {
+	if len(license.Files) == 0 {
+		return "review", "no license file found"
+	}
+	if len(license.Licenses) == 0 {
+		return "review", "license text not recognized: " + strings.Join(license.Files, ", ")
+	}
+	if policy == nil {
+		return "allow", "no license policy configured"
+	}
+
+	listed := func(list []string, id string) bool {
+		for _, item := range list {
+			if strings.EqualFold(item, id) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, id := range license.Licenses {
+		if listed(policy.Deny, id) {
+			return "deny", id + " is on the deny list"
+		}
+	}
+	if len(policy.Allow) > 0 {
+		for _, id := range license.Licenses {
+			if !listed(policy.Allow, id) {
+				return "review", id + " is not on the allow list"
+			}
+		}
+		return "allow", strings.Join(license.Licenses, ", ") + " allowed"
+	}
+	return "allow", strings.Join(license.Licenses, ", ") + " not denied"
+}
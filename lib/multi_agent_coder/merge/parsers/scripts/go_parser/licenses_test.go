@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	mitText     = "MIT License\n\nPermission is hereby granted, free of charge, to any person obtaining a copy\nof this software..."
+	apacheText  = "                                 Apache License\n                           Version 2.0, January 2004\n"
+	gplText     = "GNU GENERAL PUBLIC LICENSE\n   Version 3, 29 June 2007\n"
+	bsd2Text    = "Redistribution and use in source and binary forms, with or without\nmodification, are permitted provided that...\n"
+	bsd3Text    = bsd2Text + "3. Neither the name of the copyright holder nor the names of its contributors...\n"
+	lgpl21Text  = "GNU LESSER GENERAL PUBLIC LICENSE\nVersion 2.1, February 1999\n"
+	agplText    = "GNU AFFERO GENERAL PUBLIC LICENSE\nVersion 3, 19 November 2007\n"
+	privateText = "Copyright 2026 Example Corp. All rights reserved.\n"
+)
+
+func TestIdentifyLicense(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"mit", mitText, "MIT"},
+		{"apache", apacheText, "Apache-2.0"},
+		{"gpl", gplText, "GPL-3.0"},
+		{"bsd-2-clause", bsd2Text, "BSD-2-Clause"},
+		{"bsd-3-clause before bsd-2-clause", bsd3Text, "BSD-3-Clause"},
+		{"lgpl before gpl", lgpl21Text, "LGPL-2.1"},
+		{"agpl before gpl", agplText, "AGPL-3.0"},
+		{"wrapped and in capitals", "PERMISSION IS HEREBY\n    GRANTED, FREE OF CHARGE", "MIT"},
+		{"unrecognized", privateText, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := identifyLicense(tt.text); got != tt.want {
+				t.Errorf("identifyLicense = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckModuleLicense(t *testing.T) {
+	fixtureModuleCache(t, map[string]map[string]string{
+		"example.com/mit@v1.0.0":  {"LICENSE": mitText, "mit.go": "package mit\n"},
+		"example.com/gpl@v2.0.0":  {"COPYING": gplText},
+		"example.com/dual@v1.1.0": {"LICENSE-APACHE": apacheText, "LICENSE-MIT": mitText, "licensing/README": mitText},
+		"example.com/bare@v0.1.0": {"README.md": "# bare\n"},
+		"example.com/odd@v0.2.0":  {"LICENSE.txt": privateText},
+		"example.com/tip@v0.3.0":  {"UNLICENSE": "This is free and unencumbered software released into the public domain.\n"},
+		"example.com/tip@v0.3.2":  {"UNLICENSE": "This is free and unencumbered software released into the public domain.\n"},
+	})
+	policy := &LicensePolicy{Allow: []string{"MIT", "unlicense"}, Deny: []string{"GPL-3.0"}}
+
+	tests := []struct {
+		module   sbomModule
+		policy   *LicensePolicy
+		version  string
+		licenses string
+		files    string
+		verdict  string
+		reason   string
+	}{
+		{sbomModule{Path: "example.com/mit", Version: "v1.0.0"}, policy, "v1.0.0", "MIT", "LICENSE", "allow", "MIT allowed"},
+		{sbomModule{Path: "example.com/gpl", Version: "v2.0.0"}, policy, "v2.0.0", "GPL-3.0", "COPYING", "deny", "GPL-3.0 is on the deny list"},
+		{sbomModule{Path: "example.com/dual", Version: "v1.1.0"}, policy, "v1.1.0", "Apache-2.0 MIT", "LICENSE-APACHE LICENSE-MIT", "review", "Apache-2.0 is not on the allow list"},
+		{sbomModule{Path: "example.com/dual", Version: "v1.1.0"}, &LicensePolicy{Deny: []string{"GPL-3.0"}}, "v1.1.0", "Apache-2.0 MIT", "LICENSE-APACHE LICENSE-MIT", "allow", "Apache-2.0, MIT not denied"},
+		{sbomModule{Path: "example.com/dual", Version: "v1.1.0"}, nil, "v1.1.0", "Apache-2.0 MIT", "LICENSE-APACHE LICENSE-MIT", "allow", "no license policy configured"},
+		{sbomModule{Path: "example.com/bare", Version: "v0.1.0"}, policy, "v0.1.0", "", "", "review", "no license file found"},
+		{sbomModule{Path: "example.com/odd", Version: "v0.2.0"}, policy, "v0.2.0", "", "LICENSE.txt", "review", "license text not recognized: LICENSE.txt"},
+		// A module go.mod lacks is checked at the newest version cached
+		{sbomModule{Path: "example.com/tip", New: true, Missing: true}, policy, "v0.3.2", "Unlicense", "UNLICENSE", "allow", "Unlicense allowed"},
+		{sbomModule{Path: "example.com/gone", Version: "v1.0.0"}, policy, "v1.0.0", "", "", "review", "example.com/gone@v1.0.0 is not in the module cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.module.Path+"@"+tt.module.Version, func(t *testing.T) {
+			license := checkModuleLicense(tt.module, tt.policy)
+			if license.Module != tt.module.Path || license.Version != tt.version || license.New != tt.module.New {
+				t.Errorf("module = %s@%s new=%v, want %s@%s", license.Module, license.Version, license.New, tt.module.Path, tt.version)
+			}
+			if got := strings.Join(license.Licenses, " "); got != tt.licenses {
+				t.Errorf("licenses = %q, want %q", got, tt.licenses)
+			}
+			if got := strings.Join(license.Files, " "); got != tt.files {
+				t.Errorf("files = %q, want %q", got, tt.files)
+			}
+			if license.Verdict != tt.verdict || !strings.HasPrefix(license.Reason, tt.reason) {
+				t.Errorf("verdict = %s (%s), want %s (%s)", license.Verdict, license.Reason, tt.verdict, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+)
+
+// SourceLimits bound the input the analysis accepts, so that pathological
+// generated files cannot exhaust the stack or memory of a long-running
+// parser. Zero disables a limit.
+type SourceLimits struct {
+	// Open parentheses, brackets and braces at any point of the source
+	MaxNesting int
+	// Depth of the syntax tree, which long operator chains also deepen
+	MaxASTDepth int
+	// Nodes in the syntax tree
+	MaxNodes int
+	// Bytes in an identifier
+	MaxIdentLength int
+}
+
+const (
+	defaultMaxNesting     = 1000
+	defaultMaxASTDepth    = 5000
+	defaultMaxNodes       = 2000000
+	defaultMaxIdentLength = 1024
+)
+
+// LimitExceeded is the structured part of an error for input over a limit:
+// which limit, its maximum, the value reached when the check stopped and
+// where. Limit is max_nesting, max_ast_depth, max_nodes or max_ident_length.
+type LimitExceeded struct {
+	Limit  string `json:"limit"`
+	Max    int    `json:"max"`
+	Value  int    `json:"value"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+// limitError is returned by analyzeSource for input over a limit
+type limitError struct {
+	exceeded LimitExceeded
+}
+
+func (e *limitError) Error() string {
+	return fmt.Sprintf("input exceeds %s of %d at %d:%d", e.exceeded.Limit, e.exceeded.Max, e.exceeded.Line, e.exceeded.Column)
+}
+
+// checkTokenLimits scans source for nesting and identifier length before it
+// is parsed. Scanning is iterative, so it is safe on any input; syntax
+// errors are left for the parser to report.
+func checkTokenLimits(source []byte, limits SourceLimits) error {
+	if limits.MaxNesting <= 0 && limits.MaxIdentLength <= 0 {
+		return nil
+	}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(source))
+	var s scanner.Scanner
+	s.Init(file, source, nil, 0)
+
+	depth := 0
+	for {
+		pos, tok, lit := s.Scan()
+		exceeded := func(limit string, max, value int) error {
+			position := file.Position(pos)
+			return &limitError{LimitExceeded{Limit: limit, Max: max, Value: value, Line: position.Line, Column: position.Column}}
+		}
+		switch tok {
+		case token.EOF:
+			return nil
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+			if limits.MaxNesting > 0 && depth > limits.MaxNesting {
+				return exceeded("max_nesting", limits.MaxNesting, depth)
+			}
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth = max(depth-1, 0)
+		case token.IDENT:
+			if limits.MaxIdentLength > 0 && len(lit) > limits.MaxIdentLength {
+				return exceeded("max_ident_length", limits.MaxIdentLength, len(lit))
+			}
+		}
+	}
+}
+
+// checkTreeLimits measures the depth and size of a parsed file, descending
+// no deeper than the depth limit
+func checkTreeLimits(fset *token.FileSet, file *ast.File, limits SourceLimits) error {
+	if limits.MaxASTDepth <= 0 && limits.MaxNodes <= 0 {
+		return nil
+	}
+	var err error
+	depth, nodes := 0, 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		if err != nil {
+			return false
+		}
+		depth++
+		nodes++
+		exceeded := func(limit string, max, value int) {
+			position := fset.Position(n.Pos())
+			err = &limitError{LimitExceeded{Limit: limit, Max: max, Value: value, Line: position.Line, Column: position.Column}}
+		}
+		switch {
+		case limits.MaxASTDepth > 0 && depth > limits.MaxASTDepth:
+			exceeded("max_ast_depth", limits.MaxASTDepth, depth)
+		case limits.MaxNodes > 0 && nodes > limits.MaxNodes:
+			exceeded("max_nodes", limits.MaxNodes, nodes)
+		}
+		// Inspect calls back with nil after the children of each node it
+		// descends into, which undoes the increment
+		return err == nil
+	})
+	return err
+}
+
+// parseFallback is what goes with an analysis error: the structure recovered
+// from the source, or, for input over a limit, the limit instead, since
+// recovering it would cost as much as the analysis that was refused
+func parseFallback(content []byte, err error) (*RecoveredOutline, *LimitExceeded) {
+	if limit, ok := err.(*limitError); ok {
+		return nil, &limit.exceeded
+	}
+	return recoverOutline(content), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSourceLimits(t *testing.T) {
+	var decls strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&decls, "var v%d = 1\n", i)
+	}
+	tests := []struct {
+		name   string
+		source string
+		limits SourceLimits
+		limit  string
+		line   int
+	}{
+		{"nesting", "package p\n\nvar x = " + strings.Repeat("(", 20) + "1" + strings.Repeat(")", 20) + "\n", SourceLimits{MaxNesting: 10}, "max_nesting", 3},
+		{"identifier", "package p\n\nvar " + strings.Repeat("a", 40) + " = 1\n", SourceLimits{MaxIdentLength: 32}, "max_ident_length", 3},
+		{"depth", "package p\n\nvar x = 1" + strings.Repeat(" + 1", 30) + "\n", SourceLimits{MaxASTDepth: 20}, "max_ast_depth", 3},
+		{"nodes", "package p\n\n" + decls.String(), SourceLimits{MaxNodes: 20}, "max_nodes", 0},
+	}
+	formats := []struct {
+		name  string
+		parse func(source []byte, limits SourceLimits) error
+	}{
+		{"json", func(source []byte, limits SourceLimits) error {
+			_, err := parseGoCode(string(source), limits)
+			return err
+		}},
+		{"outline", func(source []byte, limits SourceLimits) error {
+			_, err := buildOutline(source, limits)
+			return err
+		}},
+		{"ast", func(source []byte, limits SourceLimits) error {
+			_, err := buildASTExport(source, 3, limits)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		for _, format := range formats {
+			t.Run(tt.name+"/"+format.name, func(t *testing.T) {
+				if err := format.parse([]byte(tt.source), SourceLimits{}); err != nil {
+					t.Fatalf("without limits: %v", err)
+				}
+				err := format.parse([]byte(tt.source), tt.limits)
+				fallback, exceeded := parseFallback([]byte(tt.source), err)
+				if exceeded == nil {
+					t.Fatalf("error = %v, want %s exceeded", err, tt.limit)
+				}
+				if fallback != nil {
+					t.Error("a limit error carries a fallback")
+				}
+				if exceeded.Limit != tt.limit || exceeded.Value <= exceeded.Max {
+					t.Errorf("limit = %+v, want %s over its maximum", exceeded, tt.limit)
+				}
+				if tt.line != 0 && exceeded.Line != tt.line {
+					t.Errorf("limit line = %d, want %d", exceeded.Line, tt.line)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Default thresholds above which a function is reported as too long
+const (
+	defaultMaxFunctionLines      = 60
+	defaultMaxFunctionComplexity = 15
+)
+
+// LongFunction is a function over the line or complexity threshold, with the
+// blocks that could be extracted from it
+type LongFunction struct {
+	Name        string            `json:"name"`
+	Receiver    *string           `json:"receiver,omitempty"`
+	StartLine   int               `json:"start_line"`
+	EndLine     int               `json:"end_line"`
+	Lines       int               `json:"lines"`
+	Complexity  int               `json:"complexity"`
+	Reasons     []string          `json:"reasons"`
+	Suggestions []SplitSuggestion `json:"suggestions"`
+
+	span SourceSpan
+}
+
+// SplitSuggestion is a run of statements that could become its own
+// function. Inputs are the locals it reads from the enclosing function and
+// Outputs the ones it sets that are used afterwards; fewer crossings make a
+// cleaner extraction.
+type SplitSuggestion struct {
+	StartLine   int      `json:"start_line"`
+	EndLine     int      `json:"end_line"`
+	Lines       int      `json:"lines"`
+	Kind        string   `json:"kind"`
+	Inputs      []string `json:"inputs"`
+	Outputs     []string `json:"outputs"`
+	Returns     bool     `json:"returns"`
+	Description string   `json:"description"`
+}
+
+// maxSplitSuggestions caps the suggestions made for a single function
+const maxSplitSuggestions = 3
+
+// findLongFunctions reports the functions of file exceeding maxLines or
+// maxComplexity
+func findLongFunctions(fset *token.FileSet, file *ast.File, maxLines, maxComplexity int) []LongFunction {
+	long := []LongFunction{}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+
+		span := sourceSpan(fset, fn)
+		lines := span.EndLine - span.Line + 1
+		complexity := functionComplexity(fn)
+
+		reasons := []string{}
+		if maxLines > 0 && lines > maxLines {
+			reasons = append(reasons, fmt.Sprintf("%d lines exceeds the limit of %d", lines, maxLines))
+		}
+		if maxComplexity > 0 && complexity > maxComplexity {
+			reasons = append(reasons, fmt.Sprintf("complexity %d exceeds the limit of %d", complexity, maxComplexity))
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+
+		info := LongFunction{
+			Name:        fn.Name.Name,
+			StartLine:   span.Line,
+			EndLine:     span.EndLine,
+			Lines:       lines,
+			Complexity:  complexity,
+			Reasons:     reasons,
+			Suggestions: suggestSplits(fset, fn),
+			span:        sourceSpan(fset, fn),
+		}
+		if receiver := receiverExpr(fn); receiver != "" {
+			info.Receiver = &receiver
+		}
+		long = append(long, info)
+	}
+
+	return long
+}
+
+// splitCandidate is a contiguous run of statements within one block
+type splitCandidate struct {
+	stmts []ast.Stmt
+	score float64
+	SplitSuggestion
+}
+
+// Caps on the split search, so generated functions of thousands of
+// statements stay fast: the statements in a run and the runs scored
+const (
+	maxSplitStatements = 100
+	maxSplitCandidates = 2000
+)
+
+// stmtFacts is what the split search needs of one statement: the locals it
+// mentions, by object, the ones it assigns, and whether it returns or
+// branches out of the run
+type stmtFacts struct {
+	locals   map[*ast.Object]string
+	assigned map[*ast.Object]bool
+	escapes  bool
+	returns  bool
+}
+
+// suggestSplits looks for extractable statement runs in the function body
+// and in the bodies of its top-level compound statements, preferring long
+// runs that share few variables with the rest of the function
+func suggestSplits(fset *token.FileSet, fn *ast.FuncDecl) []SplitSuggestion {
+	fnSpan := sourceSpan(fset, fn.Body)
+	fnLines := fnSpan.EndLine - fnSpan.Line + 1
+	minLines := max(5, fnLines*15/100)
+	maxLines := fnLines * 80 / 100
+
+	declaredAt := localDeclarations(fn)
+	lastUse := lastUses(fn, declaredAt)
+
+	blocks := [][]ast.Stmt{fn.Body.List}
+	for _, stmt := range fn.Body.List {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if block, ok := n.(*ast.BlockStmt); ok && block != fn.Body {
+				blocks = append(blocks, block.List)
+				return false
+			}
+			return true
+		})
+	}
+
+	candidates := []splitCandidate{}
+	for _, stmts := range blocks {
+		facts := make([]stmtFacts, len(stmts))
+		for k, stmt := range stmts {
+			facts[k] = statementFacts(stmt, declaredAt)
+		}
+
+		for i := 0; i < len(stmts) && len(candidates) < maxSplitCandidates; i++ {
+			// The run's facts grow with it, one statement at a time
+			locals, assigned, returns := map[*ast.Object]string{}, map[*ast.Object]bool{}, false
+			for j := i; j < len(stmts) && j-i < maxSplitStatements && len(candidates) < maxSplitCandidates; j++ {
+				// Every longer run holds the branch too
+				if facts[j].escapes {
+					break
+				}
+				for obj, name := range facts[j].locals {
+					locals[obj] = name
+				}
+				for obj := range facts[j].assigned {
+					assigned[obj] = true
+				}
+				returns = returns || facts[j].returns
+
+				run := stmts[i : j+1]
+				start, end := fset.Position(run[0].Pos()).Line, fset.Position(run[len(run)-1].End()).Line
+				lines := end - start + 1
+				if lines > maxLines {
+					break
+				}
+				if lines < minLines {
+					continue
+				}
+
+				candidate := splitCandidate{stmts: run}
+				candidate.StartLine, candidate.EndLine, candidate.Lines = start, end, lines
+				candidate.Kind = runKind(run)
+				candidate.Inputs, candidate.Outputs = crossingVariables(run, locals, assigned, declaredAt, lastUse)
+				candidate.Returns = returns
+
+				candidate.score = float64(lines) / float64(1+len(candidate.Inputs)+2*len(candidate.Outputs))
+				if candidate.Returns {
+					candidate.score /= 2
+				}
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].StartLine < candidates[j].StartLine
+	})
+
+	suggestions := []SplitSuggestion{}
+	chosen := []SplitSuggestion{}
+	for _, candidate := range candidates {
+		if len(suggestions) == maxSplitSuggestions {
+			break
+		}
+		overlapping := false
+		for _, other := range chosen {
+			if candidate.StartLine <= other.EndLine && candidate.EndLine >= other.StartLine {
+				overlapping = true
+				break
+			}
+		}
+		if overlapping {
+			continue
+		}
+		chosen = append(chosen, candidate.SplitSuggestion)
+		candidate.Description = describeSplit(candidate.SplitSuggestion)
+		suggestions = append(suggestions, candidate.SplitSuggestion)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool { return suggestions[i].StartLine < suggestions[j].StartLine })
+	return suggestions
+}
+
+// localDeclarations maps each object local to fn (receiver, parameters,
+// results and variables) to the position of its declaring identifier
+func localDeclarations(fn *ast.FuncDecl) map[*ast.Object]token.Pos {
+	declaredAt := map[*ast.Object]token.Pos{}
+	ast.Inspect(fn, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || ident.Obj == nil || ident.Obj.Kind != ast.Var {
+			return true
+		}
+		decl, ok := ident.Obj.Decl.(ast.Node)
+		if !ok || decl.Pos() < fn.Pos() || decl.Pos() >= fn.End() {
+			return true
+		}
+		if _, seen := declaredAt[ident.Obj]; !seen {
+			declaredAt[ident.Obj] = ident.Pos()
+		}
+		return true
+	})
+	return declaredAt
+}
+
+// lastUses maps each local of fn to the position of its last identifier in
+// the body
+func lastUses(fn *ast.FuncDecl, declaredAt map[*ast.Object]token.Pos) map[*ast.Object]token.Pos {
+	last := map[*ast.Object]token.Pos{}
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			if _, local := declaredAt[ident.Obj]; local && ident.Pos() > last[ident.Obj] {
+				last[ident.Obj] = ident.Pos()
+			}
+		}
+		return true
+	})
+	return last
+}
+
+// statementFacts walks a statement once for the split search
+func statementFacts(stmt ast.Stmt, declaredAt map[*ast.Object]token.Pos) stmtFacts {
+	facts := stmtFacts{locals: map[*ast.Object]string{}, assigned: map[*ast.Object]bool{}}
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.Ident:
+			if _, ok := declaredAt[node.Obj]; ok {
+				facts.locals[node.Obj] = node.Name
+			}
+		case *ast.AssignStmt:
+			for _, lhs := range node.Lhs {
+				if ident, ok := lhs.(*ast.Ident); ok && ident.Obj != nil {
+					facts.assigned[ident.Obj] = true
+				}
+			}
+		case *ast.IncDecStmt:
+			if ident, ok := node.X.(*ast.Ident); ok && ident.Obj != nil {
+				facts.assigned[ident.Obj] = true
+			}
+		}
+		return true
+	})
+	facts.escapes = hasEscapingBranch([]ast.Stmt{stmt})
+	facts.returns = containsReturn([]ast.Stmt{stmt})
+	return facts
+}
+
+// crossingVariables returns the locals declared before run and used in it
+// (inputs) and the locals declared or assigned in run and used after it
+// (outputs), from the locals and assignments of its statements
+func crossingVariables(run []ast.Stmt, locals map[*ast.Object]string, assigned map[*ast.Object]bool, declaredAt, lastUse map[*ast.Object]token.Pos) ([]string, []string) {
+	start, end := run[0].Pos(), run[len(run)-1].End()
+	inside := func(pos token.Pos) bool { return pos >= start && pos < end }
+
+	inputs, outputs := map[string]bool{}, map[string]bool{}
+	for obj, name := range locals {
+		at := declaredAt[obj]
+		if !inside(at) {
+			inputs[name] = true
+		}
+		if (inside(at) || assigned[obj]) && lastUse[obj] >= end {
+			outputs[name] = true
+		}
+	}
+	return sortedKeys(inputs), sortedKeys(outputs)
+}
+
+// hasEscapingBranch reports whether run contains a break, continue or goto
+// that would leave the extracted function
+func hasEscapingBranch(run []ast.Stmt) bool {
+	escaping := false
+	for _, stmt := range run {
+		var visit func(n ast.Node, inLoop, inSwitch bool)
+		visit = func(n ast.Node, inLoop, inSwitch bool) {
+			ast.Inspect(n, func(child ast.Node) bool {
+				if escaping || child == nil || child == n {
+					return !escaping
+				}
+				switch node := child.(type) {
+				case *ast.ForStmt, *ast.RangeStmt:
+					visit(node, true, inSwitch)
+					return false
+				case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+					visit(node, inLoop, true)
+					return false
+				case *ast.FuncLit:
+					return false
+				case *ast.BranchStmt:
+					switch {
+					case node.Label != nil, node.Tok == token.GOTO:
+						escaping = true
+					case node.Tok == token.CONTINUE && !inLoop:
+						escaping = true
+					case node.Tok == token.BREAK && !inLoop && !inSwitch:
+						escaping = true
+					}
+				}
+				return true
+			})
+		}
+		visit(&ast.BlockStmt{List: []ast.Stmt{stmt}}, false, false)
+	}
+	return escaping
+}
+
+func containsReturn(run []ast.Stmt) bool {
+	found := false
+	for _, stmt := range run {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.ReturnStmt:
+				found = true
+			case *ast.FuncLit:
+				return false
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// runKind names a run by its statement when it is a single compound one
+func runKind(run []ast.Stmt) string {
+	if len(run) > 1 {
+		return "statements"
+	}
+	switch run[0].(type) {
+	case *ast.ForStmt, *ast.RangeStmt:
+		return "loop"
+	case *ast.IfStmt:
+		return "if"
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+		return "switch"
+	case *ast.SelectStmt:
+		return "select"
+	case *ast.BlockStmt:
+		return "block"
+	}
+	return "statements"
+}
+
+// describeSplit phrases a suggestion as an instruction for a provider prompt
+func describeSplit(s SplitSuggestion) string {
+	description := fmt.Sprintf("extract the %s on lines %d-%d into a function taking (%s)", s.Kind, s.StartLine, s.EndLine, strings.Join(s.Inputs, ", "))
+	if len(s.Outputs) > 0 {
+		description += fmt.Sprintf(" and returning (%s)", strings.Join(s.Outputs, ", "))
+	}
+	if s.Returns {
+		description += "; it contains return statements, so the caller must check whether to return early"
+	}
+	return description
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
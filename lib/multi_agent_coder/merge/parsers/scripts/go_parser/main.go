@@ -0,0 +1,507 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// options holds the command-line settings for a parse run
+type options struct {
+	sanitize string
+	blame    bool
+	churn    string
+	// Whether to look up the docs of the other packages' symbols used
+	referencedDocs bool
+	// Output format, one of outputFormats, and legacy shape to emit, if any
+	format string
+	compat string
+	// Levels of the tree --format ast renders, 0 for all
+	astDepth int
+	// Whether a failing file aborts a batch instead of being reported
+	strict bool
+	// Thresholds for reporting long functions; zero disables a check
+	maxFunctionLines      int
+	maxFunctionComplexity int
+	// Size limits from the --config file, and whether exceeding them fails
+	// the run
+	budgets *SizeBudgets
+	enforce bool
+	// Rules from the --codeowners file to annotate files and symbols with
+	codeowners *CodeOwners
+	// Bounds on the input, against pathological generated files
+	limits SourceLimits
+	// Tokenizer heuristic to count the file's and symbols' tokens with, if any
+	tokenizer string
+	// Whether to emit per-function feature vectors for candidate ranking
+	features bool
+	// Whether to run go/types over the file and report what it resolves
+	typecheck bool
+	// How to analyze the fenced Go blocks of raw model output, one of
+	// fenceModes, or "" to analyze the input as Go
+	extractFences string
+	// Whether a file with syntax errors fails instead of being analyzed as
+	// the declarations salvaged from it
+	noSalvage bool
+	// Uses of a string literal that warrant a named constant
+	minDuplicates int
+	// Test files to compare the assertion libraries of a test file with
+	testConvention stringList
+	// Whether to extract the expectations of the package's tests
+	contracts bool
+}
+
+// defaultOptions are the settings of a parse run given no flags, for the
+// commands that analyze files the way the default command does
+func defaultOptions() options {
+	return options{
+		sanitize:              "off",
+		format:                "json",
+		maxFunctionLines:      defaultMaxFunctionLines,
+		maxFunctionComplexity: defaultMaxFunctionComplexity,
+		minDuplicates:         defaultMinDuplicates,
+		limits: SourceLimits{
+			MaxNesting:     defaultMaxNesting,
+			MaxASTDepth:    defaultMaxASTDepth,
+			MaxNodes:       defaultMaxNodes,
+			MaxIdentLength: defaultMaxIdentLength,
+		},
+	}
+}
+
+// stdinPath is the file argument that stands for the source on stdin
+const stdinPath = "-"
+
+// outputFormats are the documents runParse can print for a single file: the
+// Result, the file's classified tokens, its outline or its syntax tree
+var outputFormats = []string{"json", "tokens", "outline", "ast"}
+
+// singleFileOutput reports whether opts select output that only exists for a
+// single file
+func (opts options) singleFileOutput() bool {
+	return opts.format != "json" || opts.compat != ""
+}
+
+// subcommands maps a leading command-line argument to its handler. Any other
+// first argument is treated as the file to parse. --serve is serve, spelled
+// as the daemon mode's flag.
+var subcommands = map[string]func(args []string) int{
+	"agreement":       runAgreement,
+	"apply":           runApply,
+	"benchcorpus":     runBenchCorpus,
+	"context":         runContext,
+	"change-coupling": runChangeCoupling,
+	"checklist":       runChecklist,
+	"compose":         runCompose,
+	"delete-symbol":   runDeleteSymbol,
+	"describe-change": runDescribeChange,
+	"diff":            runDiff,
+	"difftest":        runDiffTest,
+	"depsummary":      runDepSummary,
+	"depimpact":       runDepImpact,
+	"equivalent":      runEquivalent,
+	"gate":            runGate,
+	"generate":        runGenerate,
+	"hotspots":        runHotspots,
+	"iface-gap":       runIfaceGap,
+	"impact":          runImpact,
+	"insert-symbol":   runInsertSymbol,
+	"licenses":        runLicenses,
+	"merge":           runMerge,
+	"merge-body":      runMergeBody,
+	"packages":        runPackages,
+	"perf-hints":      runPerfHints,
+	"pkg-graph":       runPkgGraph,
+	"policy":          runPolicy,
+	"provenance":      runProvenance,
+	"replace-symbol":  runReplaceSymbol,
+	"result-diff":     runResultDiff,
+	"sbom":            runSBOM,
+	"schema":          runSchema,
+	"serve":           runServe,
+	"--serve":         runServe,
+	"similarity":      runSimilarity,
+	"splice":          runSplice,
+	"test-map":        runTestMap,
+	"transform":       runTransform,
+	"triage":          runTriage,
+	"verify-merge":    runVerifyMerge,
+	"vulncheck":       runVulncheck,
+	"vocabulary":      runVocabulary,
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
+	os.Exit(runParse(os.Args[1:]))
+}
+
+// runParse analyzes a single file and prints its Result, or a BatchResult
+// when given several files or directories, or files on stdin
+func runParse(args []string) int {
+	opts := options{}
+	stdinFiles, stdin := false, false
+	configPath := ""
+	codeownersPath := ""
+
+	flags := flag.NewFlagSet("go_parser", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&opts.sanitize, "sanitize", "off", "encoding sanitization: off, report or fix")
+	flags.BoolVar(&opts.blame, "blame", false, "annotate symbols with their last git commit")
+	flags.StringVar(&opts.churn, "churn-window", "", "report git churn over a window such as 90d or 12w")
+	flags.IntVar(&opts.maxFunctionLines, "max-function-lines", defaultMaxFunctionLines, "report functions longer than this many lines (0 disables)")
+	flags.IntVar(&opts.maxFunctionComplexity, "max-function-complexity", defaultMaxFunctionComplexity, "report functions above this cyclomatic complexity (0 disables)")
+	flags.Var(&opts.testConvention, "test-convention", "compare a test file's assertion libraries with these test files (patterns such as ./...)")
+	flags.BoolVar(&opts.contracts, "contracts", false, "extract the inputs, outputs and invariants the package's tests expect of each function")
+	flags.BoolVar(&opts.referencedDocs, "referenced-docs", false, "add the doc comments of symbols used from other packages")
+	flags.StringVar(&opts.format, "format", "json", "output format: json, tokens, outline or ast")
+	flags.IntVar(&opts.astDepth, "ast-depth", 0, "with --format ast, levels of the tree to render (0 renders all)")
+	flags.StringVar(&opts.compat, "compat", "", "emit a legacy output shape: v1")
+	flags.BoolVar(&opts.strict, "strict", false, "with several files, fail on the first file that cannot be parsed")
+	flags.IntVar(&opts.minDuplicates, "min-duplicates", defaultMinDuplicates, "report string literals used at least this many times (0 disables)")
+	flags.StringVar(&configPath, "config", "", "JSON configuration file with size budgets")
+	flags.BoolVar(&opts.enforce, "enforce", false, "exit with status 2 when a size budget is exceeded")
+	flags.IntVar(&opts.limits.MaxNesting, "max-nesting", defaultMaxNesting, "reject input with more open parentheses, brackets and braces (0 disables)")
+	flags.IntVar(&opts.limits.MaxASTDepth, "max-ast-depth", defaultMaxASTDepth, "reject input with a deeper syntax tree (0 disables)")
+	flags.IntVar(&opts.limits.MaxNodes, "max-nodes", defaultMaxNodes, "reject input with more syntax tree nodes (0 disables)")
+	flags.IntVar(&opts.limits.MaxIdentLength, "max-ident-length", defaultMaxIdentLength, "reject input with a longer identifier (0 disables)")
+	flags.StringVar(&opts.tokenizer, "tokenizer", "", "count tokens per file and symbol with a heuristic: "+strings.Join(tokenizerNames(), ", "))
+	flags.BoolVar(&opts.features, "features", false, "emit a numeric feature vector per function for candidate ranking")
+	flags.BoolVar(&opts.typecheck, "typecheck", false, "type check the file with go/types and report resolved types and type errors")
+	flags.StringVar(&opts.extractFences, "extract-fences", "", "analyze the go-fenced blocks of raw model output: concat (as one file) or each (a file per block)")
+	flags.BoolVar(&opts.noSalvage, "no-salvage", false, "fail on syntax errors instead of analyzing the declarations that parse")
+	flags.StringVar(&codeownersPath, "codeowners", "", "CODEOWNERS file to annotate files and symbols with their owners")
+	flags.BoolVar(&stdinFiles, "stdin-files", false, "read a JSON list of {path, content} files from stdin")
+	flags.BoolVar(&stdin, "stdin", false, "read a single file's source from stdin, as the path - does")
+
+	paths, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	if !isValidSanitizeMode(opts.sanitize) {
+		return fail("Invalid sanitize mode: %s", opts.sanitize)
+	}
+
+	if opts.compat != "" && compatOutputs[opts.compat] == nil {
+		return fail("Invalid compat mode: %s", opts.compat)
+	}
+
+	if !contains(outputFormats, opts.format) {
+		return fail("Invalid format: %s", opts.format)
+	}
+
+	if opts.extractFences != "" && !contains(fenceModes, opts.extractFences) {
+		return fail("Invalid fence extraction mode: %s", opts.extractFences)
+	}
+
+	if _, ok := tokenizers[opts.tokenizer]; opts.tokenizer != "" && !ok {
+		return fail("Invalid tokenizer: %s", opts.tokenizer)
+	}
+
+	if configPath != "" {
+		config, err := loadConfig(configPath)
+		if err != nil {
+			return fail("Invalid config: %v", err)
+		}
+		opts.budgets = config.Budgets
+	}
+	if opts.enforce && opts.budgets == nil {
+		return fail("--enforce needs a --config file with budgets")
+	}
+	if codeownersPath != "" {
+		if opts.codeowners, err = loadCodeOwners(codeownersPath); err != nil {
+			return fail("Invalid CODEOWNERS: %v", err)
+		}
+	}
+
+	if stdinFiles {
+		if len(paths) > 0 || opts.singleFileOutput() || opts.extractFences != "" {
+			return fail("--stdin-files takes no paths and only produces batch output")
+		}
+		files, err := readSourceFiles(os.Stdin)
+		if err != nil {
+			return fail("Invalid stdin payload: %v", err)
+		}
+		batch, err := analyzeSourceFiles(files, opts)
+		if err != nil {
+			return fail("Batch failed: %v", err)
+		}
+		return enforced(printJSON(batch), opts, batch.budgetViolations())
+	}
+
+	if stdin {
+		if len(paths) > 0 {
+			return fail("--stdin takes no paths")
+		}
+		paths = []string{stdinPath}
+	}
+
+	if len(paths) < 1 {
+		return fail("No file path provided")
+	}
+
+	if isBatch(paths) {
+		if opts.singleFileOutput() {
+			return fail("--compat and --format only apply to single-file output")
+		}
+		if opts.extractFences != "" {
+			return fail("--extract-fences takes a single file of model output")
+		}
+		batch, err := analyzeBatch(paths, opts)
+		if err != nil {
+			return fail("Batch failed: %v", err)
+		}
+		return enforced(printJSON(batch), opts, batch.budgetViolations())
+	}
+
+	filePath := paths[0]
+
+	var content []byte
+	if filePath == stdinPath {
+		if opts.blame || opts.churn != "" {
+			return fail("--blame and --churn-window need the file on disk")
+		}
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(filePath)
+	}
+	if err != nil {
+		return fail("Failed to read file: %v", err)
+	}
+
+	var fences *FenceExtraction
+	if opts.extractFences != "" {
+		if opts.blame || opts.churn != "" {
+			return fail("--blame and --churn-window need the file on disk")
+		}
+		files, extractions, err := extractedSources(filePath, content, opts.extractFences)
+		if err != nil {
+			return fail("Failed to extract code blocks: %v", err)
+		}
+		if opts.extractFences == "each" {
+			if opts.singleFileOutput() {
+				return fail("--compat and --format only apply to single-file output")
+			}
+			batch, err := analyzeSourceFiles(files, opts)
+			if err != nil {
+				return fail("Batch failed: %v", err)
+			}
+			for i, entry := range batch.Results {
+				if entry.Result != nil {
+					entry.Result.Fences = extractions[i]
+				}
+			}
+			return enforced(printJSON(batch), opts, batch.budgetViolations())
+		}
+		content, fences = []byte(files[0].Content), extractions[0]
+	}
+
+	// Tokens are for highlighting, including of files that do not parse
+	if opts.format == "tokens" {
+		return printJSON(tokenizeSource(content))
+	}
+	if opts.format == "outline" {
+		outline, err := buildOutline(content, opts.limits)
+		if err != nil {
+			return failParse(content, err)
+		}
+		return printJSON(outline)
+	}
+	if opts.format == "ast" {
+		export, err := buildASTExport(content, opts.astDepth, opts.limits)
+		if err != nil {
+			return failParse(content, err)
+		}
+		return printJSON(export)
+	}
+
+	result, err := analyzeSource(filePath, content, opts)
+	if err != nil {
+		return failParse(content, err)
+	}
+	result.Fences = fences
+
+	return enforced(printJSON(compatOutput(result, opts.compat)), opts, len(result.BudgetViolations))
+}
+
+// enforced turns a successful exit code into exitViolations when --enforce
+// is set and budgets were exceeded
+func enforced(code int, opts options, violations int) int {
+	if code == 0 && opts.enforce && violations > 0 {
+		return exitViolations
+	}
+	return code
+}
+
+// analyzeSource runs the optional pre-processing steps selected in opts,
+// parses the resulting source and applies the requested annotations. path is
+// only used by annotations that need the file on disk.
+func analyzeSource(path string, content []byte, opts options) (*Result, error) {
+	var report *SanitizeReport
+	if opts.sanitize != "off" {
+		report = sanitizeSource(content, opts.sanitize == "fix")
+		if report.Source != "" {
+			content = []byte(report.Source)
+		}
+	}
+
+	// Files with merge conflict markers are analyzed as their "ours" side,
+	// with both sides broken down per region
+	var conflicts []ConflictRegion
+	if hasConflictMarkers(string(content)) {
+		var resolved string
+		resolved, conflicts = resolveConflicts(string(content))
+		content = []byte(resolved)
+	}
+
+	result, err := parseGoCode(string(content), opts.limits)
+	if err != nil && !opts.noSalvage {
+		if salvaged := salvageGoCode(string(content), err, opts.limits); salvaged != nil {
+			result, err = salvaged, nil
+		}
+	}
+	if err != nil {
+		if report != nil && report.Mode == "report" && report.issueCount() > 0 {
+			return nil, fmt.Errorf("%v (input has %d encoding issues, retry with --sanitize=fix)", err, report.issueCount())
+		}
+		return nil, err
+	}
+
+	result.Sanitization = report
+	result.MergeConflicts = conflicts
+	result.LongFunctions = findLongFunctions(result.fset, result.file, opts.maxFunctionLines, opts.maxFunctionComplexity)
+	result.DuplicateStrings = findDuplicateStrings(result.fset, result.file, opts.minDuplicates)
+	result.suppressions = findSuppressions(result.fset, result.file, content)
+	if opts.budgets != nil {
+		result.BudgetViolations = []BudgetViolation{}
+		for _, violation := range checkBudgets(result.fset, result.file, opts.budgets) {
+			if violation.Symbol == "" && result.suppressions.suppressFile(violation.Rule) || violation.Symbol != "" && result.suppressions.suppress(violation.Rule, violation.Line) {
+				continue
+			}
+			result.BudgetViolations = append(result.BudgetViolations, violation)
+		}
+	}
+	if len(result.suppressions.list) > 0 {
+		result.Suppressions = result.suppressions.list
+	}
+
+	if len(opts.testConvention) > 0 && result.Assertions != nil {
+		convention, err := compareAssertionConvention(result.Assertions, path, opts.testConvention)
+		if err != nil {
+			return nil, fmt.Errorf("test convention failed: %v", err)
+		}
+		result.Assertions.Convention = convention
+	}
+
+	if opts.contracts {
+		result.Contracts = extractContracts(result.file, path)
+	}
+
+	if opts.blame {
+		if err := annotateBlame(result, path); err != nil {
+			return nil, fmt.Errorf("blame failed: %v", err)
+		}
+	}
+
+	if opts.referencedDocs {
+		result.ReferencedDocs = findReferencedDocs(result.file, path)
+	}
+
+	if opts.codeowners != nil {
+		annotateOwnership(result, path, opts.codeowners)
+	}
+
+	if opts.tokenizer != "" {
+		annotateTokens(result, string(content), opts.tokenizer)
+	}
+
+	if opts.features {
+		result.FeatureVectors = computeFeatureVectors(result, content)
+	}
+
+	if opts.typecheck {
+		result.TypeCheck = typeCheckSource(result.fset, result.file, path)
+	}
+
+	if opts.churn != "" {
+		if err := annotateChurn(result, path, opts.churn); err != nil {
+			return nil, fmt.Errorf("churn failed: %v", err)
+		}
+	}
+
+	result.Findings = collectFindings(result, opts.enforce)
+	return result, nil
+}
+
+// parseFlags parses args allowing flags and positional arguments to be mixed,
+// as in "replace-symbol target.go --name Foo". Everything after a "--" is
+// positional. It returns the positional arguments in order.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var tail []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, tail = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	return append(positional, tail...), nil
+}
+
+// printJSON writes v to stdout as a single line of JSON and returns the exit
+// code for the command
+func printJSON(v interface{}) int {
+	output, err := json.Marshal(v)
+	if err != nil {
+		return fail("Failed to encode JSON: %v", err)
+	}
+
+	fmt.Println(string(output))
+	return 0
+}
+
+// exitViolations is the exit code of a run that succeeded but found code
+// over the enforced limits or gate thresholds, distinct from the failure
+// code of fail
+const exitViolations = 2
+
+// fail prints a formatted error and returns the generic failure exit code
+func fail(format string, args ...interface{}) int {
+	printError(fmt.Sprintf(format, args...))
+	return 1
+}
+
+// failParse reports a file that could not be analyzed along with the
+// structure recovered from it, when it is the parse that failed
+func failParse(content []byte, err error) int {
+	fallback, limit := parseFallback(content, err)
+	output, _ := json.Marshal(ErrorResult{Error: fmt.Sprintf("Parse error: %v", err), Fallback: fallback, Limit: limit})
+	fmt.Println(string(output))
+	return 1
+}
+
+func printError(msg string) {
+	output, _ := json.Marshal(ErrorResult{Error: msg})
+	fmt.Println(string(output))
+}
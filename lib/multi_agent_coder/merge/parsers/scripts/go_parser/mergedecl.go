@@ -0,0 +1,474 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// DeclMerge is the declaration-level three-way merge of two candidates
+// against their base. Source is the merged file, with diff3-style markers
+// around each conflict when Merged is false. The files are merged as gofmt
+// formats them; FormattingOnly counts the declarations a side changed only
+// in formatting, or also only in comments with --ignore-comments, which
+// would otherwise have been changes to merge.
+type DeclMerge struct {
+	Base           string              `json:"base"`
+	Ours           string              `json:"ours"`
+	Theirs         string              `json:"theirs"`
+	Merged         bool                `json:"merged"`
+	FormattingOnly int                 `json:"formatting_only"`
+	Declarations   []MergedDeclaration `json:"declarations"`
+	Conflicts      []DeclConflict      `json:"conflicts"`
+	Imports        []string            `json:"imports"`
+	Output         string              `json:"output,omitempty"`
+	Written        bool                `json:"written"`
+	Source         string              `json:"source,omitempty"`
+}
+
+// MergedDeclaration is a declaration of the merged file and how it was
+// resolved: unchanged, ours or theirs for the side that changed it, both
+// when the sides made the same change, merged when their function bodies
+// were merged statement by statement, or conflict. Lines are those of the
+// merged file, doc comment and markers included.
+type MergedDeclaration struct {
+	Symbols    []string `json:"symbols"`
+	Kind       string   `json:"kind"`
+	Resolution string   `json:"resolution"`
+	StartLine  int      `json:"start_line"`
+	EndLine    int      `json:"end_line"`
+}
+
+// DeclConflict is a declaration the sides changed differently. Type is
+// modify/modify, modify/delete when theirs deleted what ours changed,
+// delete/modify the other way round, or add/add when both added it. Texts
+// are each side's declaration, empty where it is missing. Body lists the
+// statement conflicts of a function whose bodies were merged, with lines of
+// the ours file.
+type DeclConflict struct {
+	Symbols   []string       `json:"symbols"`
+	Kind      string         `json:"kind"`
+	Type      string         `json:"type"`
+	StartLine int            `json:"start_line"`
+	EndLine   int            `json:"end_line"`
+	Base      string         `json:"base"`
+	Ours      string         `json:"ours"`
+	Theirs    string         `json:"theirs"`
+	Body      []BodyConflict `json:"body,omitempty"`
+}
+
+// mergeDecl is a top-level declaration of one side, with its text as
+// written before formatting and the form it is compared by
+type mergeDecl struct {
+	file       *editFile
+	decl       ast.Decl
+	names      []string
+	written    string
+	normalized string
+}
+
+// mergeSlot is a declaration as each side has it, nil where it is missing
+type mergeSlot struct {
+	base, ours, theirs *mergeDecl
+}
+
+func runMerge(args []string) int {
+	var outputPath string
+	dryRun, ignoreComments := false, false
+
+	flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&outputPath, "o", "", "write the merged file here when there are no conflicts")
+	flags.BoolVar(&dryRun, "dry-run", false, "print the merged source instead of writing it")
+	flags.BoolVar(&ignoreComments, "ignore-comments", false, "treat declarations that differ only in comments as unchanged")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(positional) != 3 {
+		return fail("Usage: merge [-o out.go] [--dry-run] [--ignore-comments] base.go ours.go theirs.go")
+	}
+
+	sides := make([][]*mergeDecl, 3)
+	files := make([]*editFile, 3)
+	for i, path := range positional {
+		written, err := loadEditFile(path)
+		if err != nil {
+			return fail("Failed to load %s: %v", path, err)
+		}
+		files[i] = formatEditFile(written)
+		sides[i] = mergeDecls(files[i], written, ignoreComments)
+	}
+
+	result := mergeDeclarations(files, sides, ignoreComments)
+	result.Base, result.Ours, result.Theirs = positional[0], positional[1], positional[2]
+	if result.Merged {
+		if _, err := parser.ParseFile(token.NewFileSet(), "", result.Source, parser.ParseComments); err != nil {
+			return fail("Merged source does not parse: %v", err)
+		}
+	}
+
+	if outputPath != "" && result.Merged && !dryRun {
+		if err := os.WriteFile(outputPath, []byte(result.Source), 0644); err != nil {
+			return fail("Failed to write %s: %v", outputPath, err)
+		}
+		result.Output, result.Written = outputPath, true
+		result.Source = ""
+	}
+	if code := printJSON(result); code != 0 {
+		return code
+	}
+	if !result.Merged {
+		return exitViolations
+	}
+	return 0
+}
+
+// mergeDeclarations pairs the top-level declarations of the three files by
+// the names they declare and takes, for each, the side that changed it. A
+// function both sides changed without changing its signature differently
+// has its body merged; anything else both changed is a conflict. The merged
+// file keeps the ours order, with declarations only theirs or base has
+// after the one they follow there. files are base, ours and theirs, and
+// sides their declarations.
+func mergeDeclarations(files []*editFile, sides [][]*mergeDecl, ignoreComments bool) *DeclMerge {
+	ours := files[1]
+	byName := map[string][]*mergeSlot{}
+	match := func(decls []*mergeDecl, side func(*mergeSlot) **mergeDecl) []*mergeSlot {
+		order := []*mergeSlot{}
+		for _, decl := range decls {
+			var slot *mergeSlot
+			for _, name := range decl.names {
+				for _, candidate := range byName[name] {
+					if *side(candidate) == nil {
+						slot = candidate
+						break
+					}
+				}
+				if slot != nil {
+					break
+				}
+			}
+			if slot == nil {
+				slot = &mergeSlot{}
+			}
+			*side(slot) = decl
+			for _, name := range decl.names {
+				byName[name] = append(byName[name], slot)
+			}
+			order = append(order, slot)
+		}
+		return order
+	}
+	baseOrder := match(sides[0], func(s *mergeSlot) **mergeDecl { return &s.base })
+	oursOrder := match(sides[1], func(s *mergeSlot) **mergeDecl { return &s.ours })
+	theirsOrder := match(sides[2], func(s *mergeSlot) **mergeDecl { return &s.theirs })
+
+	placed := map[*mergeSlot]bool{}
+	sequence := []*mergeSlot{}
+	for _, slot := range oursOrder {
+		placed[slot] = true
+		sequence = append(sequence, slot)
+	}
+	for _, order := range [][]*mergeSlot{theirsOrder, baseOrder} {
+		for i, slot := range order {
+			if placed[slot] {
+				continue
+			}
+			at := 0
+			for j := i - 1; j >= 0; j-- {
+				if k := slotIndex(sequence, order[j]); k >= 0 {
+					at = k + 1
+					break
+				}
+			}
+			sequence = append(sequence[:at], append([]*mergeSlot{slot}, sequence[at:]...)...)
+			placed[slot] = true
+		}
+	}
+
+	result := &DeclMerge{Declarations: []MergedDeclaration{}, Conflicts: []DeclConflict{}}
+	imports := map[string]bool{}
+	require := func(sides ...*mergeDecl) {
+		for _, side := range sides {
+			if side != nil {
+				for _, imp := range requiredImports(side.file.file, side.decl) {
+					imports[imp.spec()] = true
+				}
+			}
+		}
+	}
+
+	texts := []string{}
+	resolved := []MergedDeclaration{}
+	conflicts := map[int]*DeclConflict{}
+	for _, slot := range sequence {
+		result.FormattingOnly += slot.formattingOnly()
+		b, o, t := slot.base.key(), slot.ours.key(), slot.theirs.key()
+		taken, resolution := slot.ours, "ours"
+		switch {
+		case o == t:
+			resolution = "both"
+			if o == b {
+				resolution = "unchanged"
+			}
+		case o == b:
+			taken, resolution = slot.theirs, "theirs"
+		case t == b:
+		default:
+			text, conflict := mergeSlotConflict(slot, ignoreComments)
+			if conflict == nil {
+				// Only the imports the merged body still uses
+				if merged, err := parseEditSource("", "package p\n"+text); err == nil && len(merged.file.Decls) == 1 {
+					for _, side := range []*mergeDecl{slot.ours, slot.theirs} {
+						for _, imp := range requiredImports(side.file.file, merged.file.Decls[0]) {
+							imports[imp.spec()] = true
+						}
+					}
+				}
+				resolved = append(resolved, MergedDeclaration{Symbols: slot.names(), Kind: slot.kind(), Resolution: "merged"})
+				texts = append(texts, text)
+				continue
+			}
+			require(slot.ours, slot.theirs)
+			conflicts[len(texts)] = conflict
+			resolved = append(resolved, MergedDeclaration{Symbols: conflict.Symbols, Kind: conflict.Kind, Resolution: "conflict"})
+			texts = append(texts, text)
+			continue
+		}
+		if taken == nil {
+			continue
+		}
+		require(taken)
+		resolved = append(resolved, MergedDeclaration{Symbols: taken.names, Kind: declKind(taken.decl), Resolution: resolution})
+		texts = append(texts, taken.text())
+	}
+
+	for _, file := range files[1:] {
+		for _, imp := range file.file.Imports {
+			if imp.Name != nil && imp.Name.Name == "_" {
+				imports[importInfo{name: "_", path: strings.Trim(imp.Path.Value, `"`)}.spec()] = true
+			}
+		}
+	}
+	result.Imports = sortedKeys(imports)
+
+	var out strings.Builder
+	out.WriteString(ours.source[:ours.offset(ours.file.Package)])
+	out.WriteString("package " + ours.file.Name.Name + "\n")
+	if len(result.Imports) > 0 {
+		out.WriteString("\n" + importGroup(groupImportSpecs(result.Imports)) + "\n")
+	}
+	for i, text := range texts {
+		out.WriteString("\n")
+		start := strings.Count(out.String(), "\n") + 1
+		out.WriteString(text + "\n")
+		resolved[i].StartLine, resolved[i].EndLine = start, start+strings.Count(text, "\n")
+		if conflict := conflicts[i]; conflict != nil {
+			conflict.StartLine, conflict.EndLine = resolved[i].StartLine, resolved[i].EndLine
+			result.Conflicts = append(result.Conflicts, *conflict)
+		}
+	}
+	result.Declarations = resolved
+	result.Source = out.String()
+	result.Merged = len(result.Conflicts) == 0
+	return result
+}
+
+// mergeSlotConflict resolves a declaration both sides changed differently:
+// a function on both sides with the same signature and its doc comment
+// changed on at most one side has its body merged, and conflicts are
+// recorded otherwise. It returns the text for the merged file and the
+// conflict, or nil when the bodies merged cleanly.
+func mergeSlotConflict(slot *mergeSlot, ignoreComments bool) (string, *DeclConflict) {
+	conflict := &DeclConflict{Symbols: slot.names(), Kind: slot.kind(), Type: "modify/modify"}
+	switch {
+	case slot.base == nil:
+		conflict.Type = "add/add"
+	case slot.ours == nil:
+		conflict.Type = "delete/modify"
+	case slot.theirs == nil:
+		conflict.Type = "modify/delete"
+	}
+	conflict.Base, conflict.Ours, conflict.Theirs = slot.base.text(), slot.ours.text(), slot.theirs.text()
+
+	if slot.ours != nil && slot.theirs != nil {
+		oursFn, _ := slot.ours.decl.(*ast.FuncDecl)
+		theirsFn, _ := slot.theirs.decl.(*ast.FuncDecl)
+		if oursFn != nil && theirsFn != nil && oursFn.Body != nil && theirsFn.Body != nil {
+			ours, theirs := &bodySide{file: slot.ours.file, fn: oursFn}, &bodySide{file: slot.theirs.file, fn: theirsFn}
+			doc, docMerged := mergeDocs(slot, ignoreComments)
+			if ours.signature() == theirs.signature() && docMerged {
+				base := &bodySide{}
+				if slot.base != nil {
+					base.file = slot.base.file
+					base.fn, _ = slot.base.decl.(*ast.FuncDecl)
+				}
+				body := mergeFunctionBodies(base, ours, theirs)
+				if body.Merged {
+					return doc + body.Source, nil
+				}
+				conflict.Body = body.Conflicts
+				return doc + body.Source, conflict
+			}
+		}
+	}
+	side := func(text string) string {
+		if text == "" {
+			return ""
+		}
+		return text + "\n"
+	}
+	return "<<<<<<< ours\n" + side(conflict.Ours) + "||||||| base\n" + side(conflict.Base) + "=======\n" + side(conflict.Theirs) + ">>>>>>> theirs", conflict
+}
+
+// mergeDocs takes the doc comment of a function from the side that changed
+// it, and reports false when both changed it differently. Ignoring comments,
+// the ours doc comment is kept.
+func mergeDocs(slot *mergeSlot, ignoreComments bool) (string, bool) {
+	doc := func(side *mergeDecl) string {
+		if side == nil {
+			return ""
+		}
+		fn, ok := side.decl.(*ast.FuncDecl)
+		if !ok || fn.Doc == nil {
+			return ""
+		}
+		return side.file.source[side.file.offset(fn.Doc.Pos()):side.file.offset(fn.Pos())]
+	}
+	b, o, t := doc(slot.base), doc(slot.ours), doc(slot.theirs)
+	switch {
+	case ignoreComments, normalizeWhitespace(o) == normalizeWhitespace(t), normalizeWhitespace(t) == normalizeWhitespace(b):
+		return o, true
+	case normalizeWhitespace(o) == normalizeWhitespace(b):
+		return t, true
+	}
+	return "", false
+}
+
+// mergeDecls lists the top-level declarations of a file other than imports,
+// each with its text in written, the file before formatting. Formatting
+// keeps the declarations and their order, so they pair up by position.
+// Ignoring comments, declarations are compared by their code alone.
+func mergeDecls(file, written *editFile, ignoreComments bool) []*mergeDecl {
+	before := []ast.Decl{}
+	for _, decl := range written.file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); !ok || gen.Tok != token.IMPORT {
+			before = append(before, decl)
+		}
+	}
+	decls := []*mergeDecl{}
+	for _, decl := range file.file.Decls {
+		unit := &mergeDecl{file: file, decl: decl}
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			unit.names = []string{symbolName(d)}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				unit.names = append(unit.names, specNames(spec)...)
+			}
+		}
+		unit.written = unit.text()
+		if len(decls) < len(before) {
+			unit.written = declText(written, before[len(decls)])
+		}
+		unit.normalized = normalizeWhitespace(unit.text())
+		if ignoreComments {
+			unit.normalized = normalizedCode(file.fset, decl)
+		}
+		decls = append(decls, unit)
+	}
+	return decls
+}
+
+// text is the declaration as formatted, with its doc comment, or empty for
+// a missing side
+func (d *mergeDecl) text() string {
+	if d == nil {
+		return ""
+	}
+	return declText(d.file, d.decl)
+}
+
+func declText(file *editFile, decl ast.Decl) string {
+	start := file.offset(decl.Pos())
+	if doc := declDoc(decl); doc != nil {
+		start = file.offset(doc.Pos())
+	}
+	return file.source[start:file.offset(decl.End())]
+}
+
+// key compares declarations by their formatted text with whitespace
+// normalized, so comments count as changes and reformatting does not
+func (d *mergeDecl) key() string {
+	if d == nil {
+		return ""
+	}
+	return d.normalized
+}
+
+// formattingOnly counts the sides whose declaration was written differently
+// from the base, or from ours when only the two sides add it, and compares
+// the same
+func (s *mergeSlot) formattingOnly() int {
+	count := 0
+	against := s.base
+	if against == nil {
+		against = s.ours
+	}
+	for _, side := range []*mergeDecl{s.ours, s.theirs} {
+		if side != nil && against != nil && side != against && side.written != against.written && side.key() == against.key() {
+			count++
+		}
+	}
+	return count
+}
+
+// formatEditFile is the file as gofmt formats it, or as it is when it cannot
+// be formatted
+func formatEditFile(file *editFile) *editFile {
+	formatted, err := format.Source([]byte(file.source))
+	if err != nil || string(formatted) == file.source {
+		return file
+	}
+	if reformatted, err := parseEditSource(file.path, string(formatted)); err == nil {
+		return reformatted
+	}
+	return file
+}
+
+// names are those of the first side that has the declaration, ours first
+func (s *mergeSlot) names() []string {
+	return s.first().names
+}
+
+func (s *mergeSlot) kind() string {
+	return declKind(s.first().decl)
+}
+
+func (s *mergeSlot) first() *mergeDecl {
+	switch {
+	case s.ours != nil:
+		return s.ours
+	case s.theirs != nil:
+		return s.theirs
+	}
+	return s.base
+}
+
+func slotIndex(sequence []*mergeSlot, slot *mergeSlot) int {
+	for i, candidate := range sequence {
+		if candidate == slot {
+			return i
+		}
+	}
+	return -1
+}
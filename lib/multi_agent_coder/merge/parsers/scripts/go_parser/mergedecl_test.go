@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// mergeSources runs the declaration merge over three sources, as the merge
+// subcommand does over three files
+func mergeSources(t *testing.T, base, ours, theirs string) *DeclMerge {
+	t.Helper()
+	files := make([]*editFile, 3)
+	sides := make([][]*mergeDecl, 3)
+	for i, source := range []string{base, ours, theirs} {
+		written := mustEditFile(t, []string{"base.go", "ours.go", "theirs.go"}[i], source)
+		files[i] = formatEditFile(written)
+		sides[i] = mergeDecls(files[i], written, false)
+	}
+	return mergeDeclarations(files, sides, false)
+}
+
+func TestMergeDeclarations(t *testing.T) {
+	const base = "package p\n\nfunc A() int { return 1 }\n\nfunc B() {\n\tprintln(1)\n}\n"
+	tests := []struct {
+		name         string
+		ours, theirs string
+		conflict     string
+		contains     []string
+	}{
+		{
+			name:     "clean three-way merge",
+			ours:     base + "\nfunc C() {}\n",
+			theirs:   strings.Replace(base, "println(1)", "println(2)", 1),
+			contains: []string{"func A() int { return 1 }", "println(2)", "func C() {}"},
+		},
+		{
+			name:     "conflicting one-line body",
+			ours:     strings.Replace(base, "return 1", "return 2", 1),
+			theirs:   strings.Replace(base, "return 1", "return 3", 1),
+			conflict: "modify/modify",
+			contains: []string{"func A() int {\n<<<<<<< ours\nreturn 2\n||||||| base\nreturn 1\n=======\nreturn 3\n>>>>>>> theirs\n}"},
+		},
+		{
+			name:     "deleted by ours, changed by theirs",
+			ours:     "package p\n\nfunc A() int { return 1 }\n",
+			theirs:   strings.Replace(base, "println(1)", "println(2)", 1),
+			conflict: "delete/modify",
+			contains: []string{"<<<<<<< ours\n||||||| base\nfunc B() {\n\tprintln(1)\n}\n=======\nfunc B() {\n\tprintln(2)\n}\n>>>>>>> theirs"},
+		},
+		{
+			name:     "changed by ours, deleted by theirs",
+			ours:     strings.Replace(base, "println(1)", "println(2)", 1),
+			theirs:   "package p\n\nfunc A() int { return 1 }\n",
+			conflict: "modify/delete",
+		},
+		{
+			name:     "added by both with different signatures",
+			ours:     base + "\nfunc C() int { return 2 }\n",
+			theirs:   base + "\nfunc C() string { return \"3\" }\n",
+			conflict: "add/add",
+			contains: []string{"<<<<<<< ours\nfunc C() int { return 2 }\n||||||| base\n=======\nfunc C() string { return \"3\" }\n>>>>>>> theirs"},
+		},
+		{
+			name:     "added by both",
+			ours:     base + "\nfunc C() int { return 2 }\n",
+			theirs:   base + "\nfunc C() int { return 3 }\n",
+			conflict: "add/add",
+			contains: []string{"func C() int {\n<<<<<<< ours\nreturn 2\n||||||| base\n=======\nreturn 3\n>>>>>>> theirs\n}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := mergeSources(t, base, tt.ours, tt.theirs)
+			if tt.conflict == "" {
+				if !result.Merged || len(result.Conflicts) != 0 {
+					t.Fatalf("conflicts = %+v, want a clean merge", result.Conflicts)
+				}
+				mustEditFile(t, "merged.go", result.Source)
+			} else if len(result.Conflicts) != 1 || result.Conflicts[0].Type != tt.conflict {
+				t.Fatalf("conflicts = %+v, want one %s", result.Conflicts, tt.conflict)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(result.Source, want) {
+					t.Errorf("source lacks %q:\n%s", want, result.Source)
+				}
+			}
+			assertMarkerLines(t, result.Source)
+		})
+	}
+}
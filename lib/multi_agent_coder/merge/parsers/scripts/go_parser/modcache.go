@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// goEnvValues caches the go env settings already looked up
+var goEnvValues = map[string]string{}
+
+// goEnv returns a go env setting, or "" when the go command is unavailable
+func goEnv(name string) string {
+	if value, ok := goEnvValues[name]; ok {
+		return value
+	}
+	value := ""
+	if output, err := exec.Command("go", "env", name).Output(); err == nil {
+		value = strings.TrimSpace(string(output))
+	}
+	goEnvValues[name] = value
+	return value
+}
+
+func goRoot() string {
+	if root := goEnv("GOROOT"); root != "" {
+		return root
+	}
+	return runtime.GOROOT()
+}
+
+// moduleCacheDir locates the module cache the way the go command does
+func moduleCacheDir() (string, error) {
+	if dir := goEnv("GOMODCACHE"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir, nil
+	}
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate the module cache: %v", err)
+	}
+	return filepath.Join(home, "go", "pkg", "mod"), nil
+}
+
+// escapeModulePath applies the module cache's case encoding, in which each
+// upper-case letter is written as "!" and its lower-case form
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// findCachedModule returns the directory and version of module@version in
+// the module cache. Without a version the newest cached one is used, and a
+// partial version such as v2 or v1.8 picks the newest cached one it
+// prefixes. Nothing is downloaded.
+func findCachedModule(spec string) (string, string, error) {
+	modulePath, version := spec, ""
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		modulePath, version = spec[:i], spec[i+1:]
+	}
+	if modulePath == "" {
+		return "", "", fmt.Errorf("no module path in %q", spec)
+	}
+
+	cache, err := moduleCacheDir()
+	if err != nil {
+		return "", "", err
+	}
+	escaped := filepath.Join(cache, filepath.FromSlash(escapeModulePath(modulePath)))
+
+	if partial := version; strings.Count(version, ".") < 2 {
+		version = ""
+		entries, _ := os.ReadDir(filepath.Dir(escaped))
+		prefix := filepath.Base(escaped) + "@"
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() || !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			candidate := strings.TrimPrefix(name, prefix)
+			if partial != "" && candidate != partial && !strings.HasPrefix(candidate, partial+".") {
+				continue
+			}
+			if version == "" || compareVersions(candidate, version) > 0 {
+				version = candidate
+			}
+		}
+		if version == "" {
+			if partial != "" {
+				return "", "", fmt.Errorf("no %s@%s version is in the module cache (%s); run go mod download %s@%s", modulePath, partial, cache, modulePath, partial)
+			}
+			return "", "", fmt.Errorf("%s is not in the module cache (%s); run go mod download %s", modulePath, cache, modulePath)
+		}
+	}
+
+	dir := escaped + "@" + escapeModulePath(version)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", "", fmt.Errorf("%s@%s is not in the module cache (%s); run go mod download %s@%s", modulePath, version, cache, modulePath, version)
+	}
+	return dir, version, nil
+}
+
+// readModuleRequires returns the required module versions listed in a go.mod
+// file, from both single-line and block require directives
+func readModuleRequires(modFile string) (map[string]string, error) {
+	data, err := os.ReadFile(modFile)
+	if err != nil {
+		return nil, err
+	}
+
+	requires := map[string]string{}
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.SplitN(line, "//", 2)[0])
+		switch {
+		case line == "require (":
+			inBlock = true
+			continue
+		case inBlock && line == ")":
+			inBlock = false
+			continue
+		case strings.HasPrefix(line, "require "):
+			line = strings.TrimSpace(strings.TrimPrefix(line, "require "))
+		case !inBlock:
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			requires[strings.Trim(fields[0], `"`)] = fields[1]
+		}
+	}
+	return requires, nil
+}
+
+// compareVersions orders semantic versions such as v1.8.1 and
+// v2.0.0-rc.1, treating a pre-release as older than its release
+func compareVersions(a, b string) int {
+	splitVersion := func(v string) ([]string, string) {
+		v = strings.TrimPrefix(strings.SplitN(v, "+", 2)[0], "v")
+		release, pre := v, ""
+		if i := strings.Index(v, "-"); i >= 0 {
+			release, pre = v[:i], v[i+1:]
+		}
+		return strings.Split(release, "."), pre
+	}
+
+	aParts, aPre := splitVersion(a)
+	bParts, bPre := splitVersion(b)
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		x, y := 0, 0
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return strings.Compare(aPre, bPre)
+}
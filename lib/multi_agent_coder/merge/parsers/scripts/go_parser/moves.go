@@ -0,0 +1,276 @@
+package main
+
+import (
+	"go/ast"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SymbolMove is a top-level function, type, constant or variable removed
+// from one package and added to another with the same code, by import path,
+// and the files it left and went to below the roots. Methods move with
+// their type and are not listed.
+type SymbolMove struct {
+	Symbol  string `json:"symbol"`
+	Kind    string `json:"kind"`
+	Hash    string `json:"hash"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	OldFile string `json:"old_file"`
+	NewFile string `json:"new_file"`
+}
+
+// ImportRewrite is the follow-up change a file of the new tree needs for
+// the moves: the references to rewrite, the import to add for the packages
+// the symbols went to and the imports left unused
+type ImportRewrite struct {
+	File          string          `json:"file"`
+	AddImports    []string        `json:"add_imports"`
+	RemoveImports []string        `json:"remove_imports"`
+	Edits         []ReferenceEdit `json:"edits"`
+}
+
+// ReferenceEdit replaces a reference to a moved symbol at a position
+type ReferenceEdit struct {
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// movedDecl is a declaration only one tree has, in a package directory
+type movedDecl struct {
+	dir  string
+	rel  string
+	name string
+	kind string
+}
+
+// movePackage is where a package's symbols went: the import path and name
+// of the destination of each moved symbol
+type movePackage struct {
+	importPath string
+	moves      map[string]SymbolMove
+}
+
+// detectMoves pairs the declarations the tree diff found removed from one
+// package directory and added to another by their hash, and plans the
+// rewrites of the references the rest of the new tree still makes through
+// the old package
+func detectMoves(tree *TreeDiff, oldFiles, newFiles map[string]string) {
+	removed, added := map[string][]movedDecl{}, map[string][]movedDecl{}
+	loaded := map[string]*editFile{}
+	load := func(filePath string) *editFile {
+		if file, ok := loaded[filePath]; ok {
+			return file
+		}
+		file, _ := loadEditFile(filePath)
+		loaded[filePath] = file
+		return file
+	}
+	record := func(into map[string][]movedDecl, filePath, dir, rel string, decls []DeclSummary) {
+		file := load(filePath)
+		if file == nil {
+			return
+		}
+		symbols, _ := changeSymbols(file)
+		for _, decl := range decls {
+			symbol, ok := symbols[decl.Name]
+			if !ok || decl.Kind == "method" {
+				continue
+			}
+			hash := declHash(file, symbol.node)
+			into[hash] = append(into[hash], movedDecl{dir: dir, rel: rel, name: decl.Name, kind: decl.Kind})
+		}
+	}
+	for _, pkg := range tree.Packages {
+		for _, item := range pkg.Files {
+			if isTestFile(item.Path) {
+				continue
+			}
+			for _, decls := range []DeclDiff{item.Diff.Functions, item.Diff.Types, item.Diff.Values} {
+				if oldPath, ok := oldFiles[item.Path]; ok {
+					record(removed, oldPath, pkg.Dir, item.Path, decls.Removed)
+				}
+				if newPath, ok := newFiles[item.Path]; ok {
+					record(added, newPath, pkg.Dir, item.Path, decls.Added)
+				}
+			}
+		}
+	}
+
+	importPath := treeImportPaths(tree.New, tree.Old)
+	byDir := map[string]*movePackage{}
+	hashes := []string{}
+	for hash := range removed {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	for _, hash := range hashes {
+		for _, from := range removed[hash] {
+			targets := added[hash]
+			for i, to := range targets {
+				if to.name != from.name || to.dir == from.dir {
+					continue
+				}
+				added[hash] = append(targets[:i:i], targets[i+1:]...)
+				move := SymbolMove{Symbol: from.name, Kind: from.kind, Hash: hash, From: importPath(from.dir), To: importPath(to.dir), OldFile: from.rel, NewFile: to.rel}
+				tree.Moves = append(tree.Moves, move)
+				if byDir[from.dir] == nil {
+					byDir[from.dir] = &movePackage{importPath: move.From, moves: map[string]SymbolMove{}}
+				}
+				byDir[from.dir].moves[move.Symbol] = move
+				break
+			}
+		}
+	}
+	sort.Slice(tree.Moves, func(i, j int) bool {
+		if tree.Moves[i].From != tree.Moves[j].From {
+			return tree.Moves[i].From < tree.Moves[j].From
+		}
+		return tree.Moves[i].Symbol < tree.Moves[j].Symbol
+	})
+	if len(tree.Moves) == 0 {
+		return
+	}
+
+	// The package name each destination is imported by
+	packageNames := map[string]string{}
+	for _, move := range tree.Moves {
+		packageNames[move.To] = ""
+	}
+	for _, rel := range sortedKeys(setOfKeys(newFiles)) {
+		dir := importPath(path.Dir(rel))
+		if name, ok := packageNames[dir]; ok && name == "" && !isTestFile(rel) {
+			if file := load(newFiles[rel]); file != nil {
+				packageNames[dir] = file.file.Name.Name
+			}
+		}
+	}
+
+	fromPaths := map[string]*movePackage{}
+	for _, pkg := range byDir {
+		fromPaths[pkg.importPath] = pkg
+	}
+	for _, rel := range sortedKeys(setOfKeys(newFiles)) {
+		file := load(newFiles[rel])
+		if file == nil {
+			continue
+		}
+		if rewrite := planImportRewrite(file, rel, importPath(path.Dir(rel)), byDir[path.Dir(rel)], fromPaths, packageNames); rewrite != nil {
+			tree.Rewrites = append(tree.Rewrites, *rewrite)
+		}
+	}
+}
+
+// planImportRewrite finds a file's references to moved symbols, through an
+// import of their old package or, in that package itself, by their bare
+// name, and words the rewrite for each. own is the file's import path and
+// local the moves out of its own package, if any.
+func planImportRewrite(file *editFile, rel, own string, local *movePackage, fromPaths map[string]*movePackage, packageNames map[string]string) *ImportRewrite {
+	rewrite := &ImportRewrite{File: rel, AddImports: []string{}, RemoveImports: []string{}, Edits: []ReferenceEdit{}}
+	// Imported packages by local name, and how many references to each stay
+	imported := map[string]*movePackage{}
+	remaining := map[string]int{}
+	for _, imp := range file.file.Imports {
+		info := importInfo{path: strings.Trim(imp.Path.Value, `"`)}
+		if imp.Name != nil {
+			info.name = imp.Name.Name
+		}
+		if pkg, ok := fromPaths[info.path]; ok {
+			imported[info.localName()] = pkg
+		}
+	}
+	if len(imported) == 0 && local == nil {
+		return nil
+	}
+
+	added := map[string]bool{}
+	target := func(move SymbolMove) string {
+		if move.To == own {
+			return move.Symbol
+		}
+		name := packageNames[move.To]
+		if name == "" {
+			name = path.Base(move.To)
+		}
+		spec := strconv.Quote(move.To)
+		if name != path.Base(move.To) {
+			spec = name + " " + spec
+		}
+		added[spec] = true
+		return name + "." + move.Symbol
+	}
+	edit := func(node ast.Node, old, replacement string) {
+		pos := file.fset.Position(node.Pos())
+		rewrite.Edits = append(rewrite.Edits, ReferenceEdit{Line: pos.Line, Column: pos.Column, Old: old, New: replacement})
+	}
+
+	selected := map[*ast.Ident]bool{}
+	ast.Inspect(file.file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.SelectorExpr:
+			selected[node.Sel] = true
+			x, ok := node.X.(*ast.Ident)
+			if !ok || x.Obj != nil {
+				return true
+			}
+			pkg, ok := imported[x.Name]
+			if !ok {
+				return true
+			}
+			if move, ok := pkg.moves[node.Sel.Name]; ok {
+				edit(node, x.Name+"."+node.Sel.Name, target(move))
+				return false
+			}
+			remaining[x.Name]++
+		case *ast.Ident:
+			// In the package the symbol left, unresolved bare uses of it
+			if local == nil || node.Obj != nil || selected[node] {
+				return true
+			}
+			if move, ok := local.moves[node.Name]; ok {
+				edit(node, node.Name, target(move))
+			}
+		}
+		return true
+	})
+	if len(rewrite.Edits) == 0 {
+		return nil
+	}
+
+	for name, pkg := range imported {
+		if remaining[name] == 0 {
+			rewrite.RemoveImports = append(rewrite.RemoveImports, pkg.importPath)
+		}
+	}
+	sort.Strings(rewrite.RemoveImports)
+	existing := fileImportSpecs(file.file)
+	for _, spec := range sortedKeys(added) {
+		if _, ok := existing[importSpecPath(spec)]; !ok {
+			rewrite.AddImports = append(rewrite.AddImports, spec)
+		}
+	}
+	return rewrite
+}
+
+// treeImportPaths maps the package directories below the roots, relative
+// and slash-separated, to import paths, from the module the first root with
+// one belongs to; without a module, a directory is its own import path
+func treeImportPaths(roots ...string) func(dir string) string {
+	for _, root := range roots {
+		moduleRoot, modulePath, err := findModule(root)
+		if err != nil || moduleRoot == "" {
+			continue
+		}
+		return func(dir string) string {
+			return packageImportPath(moduleRoot, modulePath, filepath.Join(root, filepath.FromSlash(dir)))
+		}
+	}
+	return func(dir string) string { return dir }
+}
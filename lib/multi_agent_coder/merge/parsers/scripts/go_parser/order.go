@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Declaration layout categories, in output order
+const (
+	layoutConst = iota
+	layoutVar
+	layoutInit
+	layoutType
+	layoutForeignMethods
+	layoutExportedFunc
+	layoutHelper
+)
+
+// declChunk is a top-level declaration with the comments leading up to it
+type declChunk struct {
+	text  string
+	label string
+	index int
+	key   [3]int
+}
+
+// orderDecls lays out a file as consts, vars, init functions, then each type
+// followed by its constructors and methods, then methods on types declared
+// elsewhere, exported functions and finally unexported helpers. Declarations
+// keep their source order within a slot, so the layout is stable and running
+// it again changes nothing.
+func orderDecls(file *editFile, _ transformOptions) (string, []string, error) {
+	bodyStart := file.offset(file.file.Name.End())
+	if decl := lastImportDecl(file.file); decl != nil {
+		bodyStart = file.offset(decl.End())
+	}
+
+	types := map[string]int{}
+	for i, decl := range file.file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+			for _, spec := range gen.Specs {
+				types[spec.(*ast.TypeSpec).Name.Name] = i
+			}
+		}
+	}
+	foreign := map[string]int{}
+
+	chunks := []declChunk{}
+	prevEnd := bodyStart
+	for i, decl := range file.file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			continue
+		}
+
+		// A comment trailing the declaration on its last line moves with it
+		end := file.offset(decl.End())
+		if nl := strings.Index(file.source[end:], "\n"); nl >= 0 {
+			end += nl
+		} else {
+			end = len(file.source)
+		}
+
+		chunk := declChunk{
+			text:  strings.TrimLeft(file.source[prevEnd:end], "\r\n"),
+			label: declLabel(decl),
+			index: i,
+		}
+		prevEnd = end
+
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			switch d.Tok {
+			case token.CONST:
+				chunk.key = [3]int{layoutConst}
+			case token.VAR:
+				chunk.key = [3]int{layoutVar}
+			default:
+				chunk.key = [3]int{layoutType, i}
+			}
+
+		case *ast.FuncDecl:
+			receiver := receiverTypeName(d)
+			switch {
+			case receiver != "":
+				if at, ok := types[receiver]; ok {
+					chunk.key = [3]int{layoutType, at, 2}
+				} else {
+					if _, seen := foreign[receiver]; !seen {
+						foreign[receiver] = i
+					}
+					chunk.key = [3]int{layoutForeignMethods, foreign[receiver]}
+				}
+			case d.Name.Name == "init":
+				chunk.key = [3]int{layoutInit}
+			case constructedType(d, types) != "":
+				chunk.key = [3]int{layoutType, types[constructedType(d, types)], 1}
+			case d.Name.IsExported():
+				chunk.key = [3]int{layoutExportedFunc}
+			default:
+				chunk.key = [3]int{layoutHelper}
+			}
+		}
+
+		chunks = append(chunks, chunk)
+	}
+
+	ordered := make([]declChunk, len(chunks))
+	copy(ordered, chunks)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i].key, ordered[j].key
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+
+	changes := []string{}
+	for i, chunk := range ordered {
+		if chunk.index == chunks[i].index {
+			continue
+		}
+		if i == 0 {
+			changes = append(changes, fmt.Sprintf("moved %s to the top", chunk.label))
+		} else {
+			changes = append(changes, fmt.Sprintf("moved %s after %s", chunk.label, ordered[i-1].label))
+		}
+	}
+	if len(changes) == 0 {
+		return file.source, changes, nil
+	}
+
+	texts := make([]string, len(ordered))
+	for i, chunk := range ordered {
+		texts[i] = chunk.text
+	}
+
+	var b strings.Builder
+	b.WriteString(file.source[:bodyStart])
+	b.WriteString("\n\n")
+	b.WriteString(strings.Join(texts, "\n\n"))
+	if tail := strings.TrimSpace(file.source[prevEnd:]); tail != "" {
+		b.WriteString("\n\n" + tail)
+	}
+	b.WriteString("\n")
+
+	return b.String(), changes, nil
+}
+
+// constructedType returns the type a constructor builds, if that type is
+// declared in the file
+func constructedType(fn *ast.FuncDecl, types map[string]int) string {
+	name := constructorType(fn)
+	if _, ok := types[name]; ok {
+		return name
+	}
+	return ""
+}
+
+// declLabel describes a declaration as "kind name"
+func declLabel(decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil {
+			return "method " + symbolName(d)
+		}
+		return "func " + d.Name.Name
+	case *ast.GenDecl:
+		return strings.ToLower(d.Tok.String()) + " " + declName(d)
+	}
+	return ""
+}
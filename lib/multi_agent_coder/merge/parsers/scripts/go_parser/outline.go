@@ -0,0 +1,213 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// maxOutlineValue is the longest constant or variable value shown in an
+// outline signature before it is elided
+const maxOutlineValue = 40
+
+// Outline is a compact view of a file for browsing: its declarations in
+// source order, with constructors and methods nested under the types the
+// file declares
+type Outline struct {
+	Package string         `json:"package"`
+	Entries []OutlineEntry `json:"entries"`
+}
+
+// OutlineEntry is one declaration with a single-line signature. Kind is
+// const, var, type, func, method or constructor.
+type OutlineEntry struct {
+	Name      string         `json:"name"`
+	ID        string         `json:"id,omitempty"`
+	Kind      string         `json:"kind"`
+	Signature string         `json:"signature"`
+	Line      int            `json:"line"`
+	EndLine   int            `json:"end_line"`
+	Children  []OutlineEntry `json:"children,omitempty"`
+}
+
+// buildOutline parses source within the same limits as the analysis and
+// lists its declarations
+func buildOutline(source []byte, limits SourceLimits) (*Outline, error) {
+	if err := checkTokenLimits(source, limits); err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", source, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTreeLimits(fset, file, limits); err != nil {
+		return nil, err
+	}
+
+	outline := &Outline{Package: file.Name.Name, Entries: []OutlineEntry{}}
+	ids := symbolIDs(fset, file)
+	entry := func(ident *ast.Ident, name, kind, signature string, node ast.Node) OutlineEntry {
+		span := sourceSpan(fset, node)
+		return OutlineEntry{Name: name, ID: ids[ident], Kind: kind, Signature: signature, Line: span.Line, EndLine: span.EndLine}
+	}
+
+	declared := map[string]bool{}
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+			for _, spec := range gen.Specs {
+				declared[spec.(*ast.TypeSpec).Name.Name] = true
+			}
+		}
+	}
+
+	// Functions of the file's own types, attached after the loop since a
+	// type may be declared after its methods
+	typeIndex := map[string]int{}
+	members := map[string][]OutlineEntry{}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			kind := strings.ToLower(d.Tok.String())
+			for _, spec := range d.Specs {
+				var node ast.Node = spec
+				if len(d.Specs) == 1 {
+					node = d
+				}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					typeIndex[s.Name.Name] = len(outline.Entries)
+					outline.Entries = append(outline.Entries, entry(s.Name, s.Name.Name, "type", typeSignature(s), node))
+				case *ast.ValueSpec:
+					for i, name := range s.Names {
+						if name.Name != "_" {
+							outline.Entries = append(outline.Entries, entry(name, name.Name, kind, valueSignature(kind, s, i), node))
+						}
+					}
+				}
+			}
+
+		case *ast.FuncDecl:
+			owner, kind := outlineReceiver(d), "method"
+			name := owner + "." + d.Name.Name
+			if owner == "" {
+				owner, kind, name = constructorType(d), "constructor", d.Name.Name
+			}
+
+			switch {
+			case declared[owner]:
+				members[owner] = append(members[owner], entry(d.Name, name, kind, funcSignature(d), d))
+			case kind == "constructor":
+				outline.Entries = append(outline.Entries, entry(d.Name, name, "func", funcSignature(d), d))
+			default:
+				outline.Entries = append(outline.Entries, entry(d.Name, name, kind, funcSignature(d), d))
+			}
+		}
+	}
+
+	for name, i := range typeIndex {
+		outline.Entries[i].Children = members[name]
+	}
+	return outline, nil
+}
+
+// outlineReceiver returns the base type name of a method's receiver,
+// including generic receivers such as *List[T]
+func outlineReceiver(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	expr := fn.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		expr = t.X
+	case *ast.IndexListExpr:
+		expr = t.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return receiverTypeName(fn)
+}
+
+// funcSignature renders a function's header on one line
+func funcSignature(fn *ast.FuncDecl) string {
+	var b strings.Builder
+	b.WriteString("func ")
+	if fn.Recv != nil && len(fn.Recv.List) > 0 {
+		recv := fn.Recv.List[0]
+		b.WriteString("(")
+		if len(recv.Names) > 0 {
+			b.WriteString(recv.Names[0].Name + " ")
+		}
+		b.WriteString(types.ExprString(recv.Type) + ") ")
+	}
+	b.WriteString(fn.Name.Name)
+	if fn.Type.TypeParams != nil {
+		b.WriteString("[" + fieldListString(fn.Type.TypeParams) + "]")
+	}
+	b.WriteString(strings.TrimPrefix(types.ExprString(fn.Type), "func"))
+	return b.String()
+}
+
+// typeSignature renders a type declaration on one line, abbreviating struct
+// and interface bodies
+func typeSignature(spec *ast.TypeSpec) string {
+	signature := "type " + spec.Name.Name
+	if spec.TypeParams != nil {
+		signature += "[" + fieldListString(spec.TypeParams) + "]"
+	}
+	if spec.Assign.IsValid() {
+		signature += " ="
+	}
+
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		return signature + " struct{…}"
+	case *ast.InterfaceType:
+		if len(t.Methods.List) == 0 {
+			return signature + " interface{}"
+		}
+		return signature + " interface{…}"
+	}
+	return signature + " " + types.ExprString(spec.Type)
+}
+
+// fieldListString renders a type parameter list without its brackets
+func fieldListString(list *ast.FieldList) string {
+	params := []string{}
+	for _, field := range list.List {
+		names := []string{}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		params = append(params, strings.Join(names, ", ")+" "+types.ExprString(field.Type))
+	}
+	return strings.Join(params, ", ")
+}
+
+// valueSignature renders the i'th name of a const or var spec with its type
+// and value, eliding long values
+func valueSignature(kind string, spec *ast.ValueSpec, i int) string {
+	signature := kind + " " + spec.Names[i].Name
+	if spec.Type != nil {
+		signature += " " + types.ExprString(spec.Type)
+	}
+	if i < len(spec.Values) {
+		value := []rune(types.ExprString(spec.Values[i]))
+		if len(value) > maxOutlineValue {
+			value = append(value[:maxOutlineValue], '…')
+		}
+		signature += " = " + string(value)
+	}
+	return signature
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Result represents the parsing result
+type Result struct {
+	Functions    []FunctionInfo   `json:"functions"`
+	Structs      []TypeInfo       `json:"structs"`
+	Interfaces   []TypeInfo       `json:"interfaces"`
+	Imports      []string         `json:"imports"`
+	Dependencies []DependencyInfo `json:"dependencies"`
+	// Functions and methods to the ones of the file they call
+	CallGraph        map[string][]string `json:"call_graph"`
+	SideEffects      []string            `json:"side_effects"`
+	SideEffectCalls  []SideEffectCall    `json:"side_effect_calls"`
+	Complexity       int                 `json:"complexity"`
+	Enums            []EnumInfo          `json:"enums"`
+	Constants        []ValueInfo         `json:"constants"`
+	Variables        []ValueInfo         `json:"variables"`
+	Coupling         *CouplingInfo       `json:"coupling"`
+	Quality          *QualityScore       `json:"quality"`
+	DIGraph          *DIGraph            `json:"di_graph"`
+	Singletons       []Singleton         `json:"singletons"`
+	ReliabilityRisks []ReliabilityRisk   `json:"reliability_risks"`
+	Assertions       *AssertionUsage     `json:"assertions,omitempty"`
+	TestHygiene      *TestHygiene        `json:"test_hygiene,omitempty"`
+	Contracts        []FunctionContract  `json:"contracts,omitempty"`
+	Sanitization     *SanitizeReport     `json:"sanitization,omitempty"`
+	Churn            *ChurnInfo          `json:"churn,omitempty"`
+	Ownership        *Ownership          `json:"ownership,omitempty"`
+	TokenCount       *TokenCount         `json:"token_count,omitempty"`
+	FeatureVectors   *FeatureVectors     `json:"feature_vectors,omitempty"`
+	TypeCheck        *TypeCheckReport    `json:"type_check,omitempty"`
+	Fences           *FenceExtraction    `json:"fences,omitempty"`
+	ParseErrors      []Diagnostic        `json:"parse_errors,omitempty"`
+	Salvaged         []SalvagedSpan      `json:"salvaged,omitempty"`
+	ReferencedDocs   []ReferencedDoc     `json:"referenced_docs,omitempty"`
+	MergeConflicts   []ConflictRegion    `json:"merge_conflicts,omitempty"`
+	LongFunctions    []LongFunction      `json:"long_functions"`
+	DuplicateStrings []DuplicateString   `json:"duplicate_strings"`
+	BudgetViolations []BudgetViolation   `json:"budget_violations,omitempty"`
+	Suppressions     []Suppression       `json:"suppressions,omitempty"`
+	Findings         []Finding           `json:"findings"`
+
+	// The parsed file, for analyses that run after parseGoCode
+	fset         *token.FileSet
+	file         *ast.File
+	suppressions *suppressionSet
+}
+
+// FunctionInfo represents a function declaration
+type FunctionInfo struct {
+	Name string `json:"name"`
+	// Persistent ID of the declaration, from symbolIDs
+	ID     string      `json:"id,omitempty"`
+	Arity  int         `json:"arity"`
+	Params []ParamInfo `json:"params"`
+	// Type parameters of a generic function, in order
+	TypeParams []TypeParamInfo `json:"type_params,omitempty"`
+	Exported   bool            `json:"exported"`
+	Receiver   *string         `json:"receiver,omitempty"`
+	Returns    []ParamInfo     `json:"returns"`
+	// Index in Returns of the last error result, if there is one
+	ErrorResult *int `json:"error_result,omitempty"`
+	// Parameter and result types without names, from canonicalSignature
+	Signature string `json:"signature"`
+	// Hash of the body's tokens, the same for bodies differing only in
+	// formatting and comments; empty for a function declared without one
+	BodyHash string `json:"body_hash,omitempty"`
+	// Cyclomatic complexity of the function alone; the file's is Result.Complexity
+	Complexity int `json:"complexity"`
+	// SonarSource-style cognitive complexity, which weighs nesting
+	CognitiveComplexity int        `json:"cognitive_complexity"`
+	Doc                 string     `json:"doc,omitempty"`
+	Summary             string     `json:"summary,omitempty"`
+	Blame               *BlameInfo `json:"blame,omitempty"`
+	Owners              []string   `json:"owners,omitempty"`
+	Tokens              int        `json:"tokens,omitempty"`
+	// Goroutines, channels and locks, when the function uses any
+	Concurrency *ConcurrencyInfo `json:"concurrency,omitempty"`
+	SourceSpan
+}
+
+// ParamInfo is one parameter or result of a function: its type as written
+// and its name, when it has one. A grouped "(x, y int)" gives one entry per
+// name.
+type ParamInfo struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+}
+
+// FieldInfo is one field of a struct: its name, its type as written and its
+// tag without the quotes, such as json:"id,omitempty". An embedded field is
+// named after its type, as the language names it. A grouped "x, y int" gives
+// one entry per name.
+type FieldInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Tag      string `json:"tag,omitempty"`
+	Embedded bool   `json:"embedded,omitempty"`
+}
+
+// TypeParamInfo is a type parameter of a generic function or type and its
+// constraint as written, such as any, comparable or ~int | ~float64
+type TypeParamInfo struct {
+	Name       string `json:"name"`
+	Constraint string `json:"constraint"`
+}
+
+// TypeInfo represents a struct or interface
+type TypeInfo struct {
+	Name       string          `json:"name"`
+	ID         string          `json:"id,omitempty"`
+	Exported   bool            `json:"exported"`
+	Kind       string          `json:"kind"`
+	TypeParams []TypeParamInfo `json:"type_params,omitempty"`
+	Fields     []FieldInfo     `json:"fields,omitempty"`
+	Methods    []string        `json:"methods,omitempty"`
+	// Types embedded in a struct or interface, as written
+	Embedded []string   `json:"embedded,omitempty"`
+	Doc      string     `json:"doc,omitempty"`
+	Summary  string     `json:"summary,omitempty"`
+	Blame    *BlameInfo `json:"blame,omitempty"`
+	Owners   []string   `json:"owners,omitempty"`
+	Tokens   int        `json:"tokens,omitempty"`
+	SourceSpan
+}
+
+// SourceSpan is where a symbol lies in its file, as the 1-based line and
+// byte column of its first character and of the character after it. The
+// columns are left out when only the lines are known.
+type SourceSpan struct {
+	Line      int `json:"line"`
+	Column    int `json:"column,omitempty"`
+	EndLine   int `json:"end_line"`
+	EndColumn int `json:"end_column,omitempty"`
+}
+
+func sourceSpan(fset *token.FileSet, node ast.Node) SourceSpan {
+	start, end := fset.Position(node.Pos()), fset.Position(node.End())
+	return SourceSpan{Line: start.Line, Column: start.Column, EndLine: end.Line, EndColumn: end.Column}
+}
+
+// DependencyInfo represents a function call
+type DependencyInfo struct {
+	Function string  `json:"function"`
+	Package  *string `json:"package,omitempty"`
+	SourceSpan
+}
+
+func parseGoCode(source string, limits SourceLimits) (*Result, error) {
+	if err := checkTokenLimits([]byte(source), limits); err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", source, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTreeLimits(fset, file, limits); err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Functions:    []FunctionInfo{},
+		Structs:      []TypeInfo{},
+		Interfaces:   []TypeInfo{},
+		Imports:      []string{},
+		Dependencies: []DependencyInfo{},
+		Complexity:   1,
+		Enums:        extractEnums(file),
+		Findings:     []Finding{},
+		fset:         fset,
+		file:         file,
+	}
+
+	ids := symbolIDs(fset, file)
+	result.Constants, result.Variables = extractValues(fset, file, ids)
+	result.SideEffects, result.SideEffectCalls = findSideEffects(fset, file)
+	syncNames := syncImportNames(file)
+
+	// Extract imports
+	for _, imp := range file.Imports {
+		path := strings.Trim(imp.Path.Value, `"`)
+		result.Imports = append(result.Imports, path)
+	}
+
+	// Walk the AST
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.FuncDecl:
+			funcInfo := extractFunction(node)
+			funcInfo.ID = ids[node.Name]
+			funcInfo.SourceSpan = sourceSpan(fset, node)
+			funcInfo.BodyHash = bodyHash(fset, node.Body)
+			funcInfo.Doc, funcInfo.Summary = docComment(node.Doc)
+			funcInfo.Concurrency = functionConcurrency(node, syncNames)
+			result.Functions = append(result.Functions, funcInfo)
+
+		case *ast.GenDecl:
+			if node.Tok == token.TYPE {
+				for _, spec := range node.Specs {
+					if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+						typeInfo := extractType(typeSpec)
+						typeInfo.ID = ids[typeSpec.Name]
+						typeInfo.SourceSpan = sourceSpan(fset, typeSpec)
+						doc := typeSpec.Doc
+						// An ungrouped declaration's comment is on the GenDecl
+						if doc == nil && !node.Lparen.IsValid() {
+							doc = node.Doc
+						}
+						typeInfo.Doc, typeInfo.Summary = docComment(doc)
+						if typeInfo.Kind == "struct" {
+							result.Structs = append(result.Structs, typeInfo)
+						} else if typeInfo.Kind == "interface" {
+							result.Interfaces = append(result.Interfaces, typeInfo)
+						}
+					}
+				}
+			}
+
+		case *ast.CallExpr:
+			dep := extractDependency(node)
+			dep.SourceSpan = sourceSpan(fset, node)
+			result.Dependencies = append(result.Dependencies, dep)
+		}
+
+		result.Complexity += complexityIncrement(n)
+		return true
+	})
+
+	result.Coupling = computeCoupling([]*ast.File{file})
+	result.TestHygiene = analyzeTestHygiene(file)
+	result.Quality = computeQuality(result)
+	result.DIGraph = buildDIGraph(fset, file)
+	result.CallGraph = buildCallGraph(file)
+	result.Singletons = findSingletons(fset, file)
+	result.ReliabilityRisks = findReliabilityRisks(fset, file)
+	result.Assertions = detectAssertions(file)
+
+	return result, nil
+}
+
+func extractFunction(node *ast.FuncDecl) FunctionInfo {
+	info := FunctionInfo{
+		Name:       node.Name.Name,
+		Exported:   isExported(node.Name.Name),
+		Params:     fieldParams(node.Type.Params),
+		TypeParams: typeParams(node.Type.TypeParams),
+		Returns:    fieldParams(node.Type.Results),
+	}
+
+	// Extract receiver if it's a method
+	if node.Recv != nil && len(node.Recv.List) > 0 {
+		receiverType := getTypeName(node.Recv.List[0].Type)
+		info.Receiver = &receiverType
+	}
+
+	info.Arity = len(info.Params)
+	info.Complexity = functionComplexity(node)
+	info.CognitiveComplexity = cognitiveComplexity(node)
+	for i := len(info.Returns) - 1; i >= 0; i-- {
+		if info.Returns[i].Type == "error" {
+			info.ErrorResult = &i
+			break
+		}
+	}
+	info.Signature = canonicalSignature(info.Params, info.Returns)
+	if len(info.TypeParams) > 0 {
+		info.Signature = "func[" + typeParamList(info.TypeParams) + "]" + strings.TrimPrefix(info.Signature, "func")
+	}
+
+	return info
+}
+
+// fieldParams lists a parameter or result list one entry per name, or per
+// type for unnamed entries
+func fieldParams(fields *ast.FieldList) []ParamInfo {
+	params := []ParamInfo{}
+	if fields == nil {
+		return params
+	}
+	for _, field := range fields.List {
+		fieldType := types.ExprString(field.Type)
+		if len(field.Names) == 0 {
+			params = append(params, ParamInfo{Type: fieldType})
+		}
+		for _, name := range field.Names {
+			params = append(params, ParamInfo{Name: name.Name, Type: fieldType})
+		}
+	}
+	return params
+}
+
+// typeParams lists the type parameters of a function or type, one entry per
+// name
+func typeParams(fields *ast.FieldList) []TypeParamInfo {
+	params := []TypeParamInfo{}
+	if fields == nil {
+		return params
+	}
+	for _, field := range fields.List {
+		constraint := types.ExprString(field.Type)
+		for _, name := range field.Names {
+			params = append(params, TypeParamInfo{Name: name.Name, Constraint: constraint})
+		}
+	}
+	return params
+}
+
+// typeParamList writes type parameters as in a declaration, T any, U any
+func typeParamList(params []TypeParamInfo) string {
+	parts := make([]string, len(params))
+	for i, param := range params {
+		parts[i] = param.Name + " " + param.Constraint
+	}
+	return strings.Join(parts, ", ")
+}
+
+// bodyHash hashes a function body by its tokens as gofmt prints it, so
+// neither layout nor comments change it: semicolons and the commas ending
+// a list split over lines are left out, literals are kept as written
+func bodyHash(fset *token.FileSet, body *ast.BlockStmt) string {
+	if body == nil {
+		return ""
+	}
+	source := []byte(formatNode(fset, body))
+	file := token.NewFileSet().AddFile("", -1, len(source))
+	var s scanner.Scanner
+	s.Init(file, source, nil, 0)
+
+	tokens := []string{}
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch {
+		case tok == token.SEMICOLON:
+			continue
+		case tok == token.RPAREN || tok == token.RBRACE || tok == token.RBRACK:
+			if n := len(tokens); n > 0 && tokens[n-1] == "," {
+				tokens = tokens[:n-1]
+			}
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		tokens = append(tokens, lit)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(tokens, " ")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// canonicalSignature writes a function's type without parameter names, as
+// func(int, ...string) (bool, error), so that candidates differing only
+// in naming have the same signature
+func canonicalSignature(params, returns []ParamInfo) string {
+	typeList := func(list []ParamInfo) string {
+		parts := make([]string, len(list))
+		for i, p := range list {
+			parts[i] = p.Type
+		}
+		return strings.Join(parts, ", ")
+	}
+	signature := "func(" + typeList(params) + ")"
+	switch len(returns) {
+	case 0:
+	case 1:
+		signature += " " + returns[0].Type
+	default:
+		signature += " (" + typeList(returns) + ")"
+	}
+	return signature
+}
+
+func extractType(spec *ast.TypeSpec) TypeInfo {
+	info := TypeInfo{
+		Name:       spec.Name.Name,
+		Exported:   isExported(spec.Name.Name),
+		TypeParams: typeParams(spec.TypeParams),
+		Fields:     []FieldInfo{},
+		Methods:    []string{},
+		Embedded:   []string{},
+	}
+
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		info.Kind = "struct"
+		if t.Fields != nil {
+			for _, field := range t.Fields.List {
+				info.Fields = append(info.Fields, structFields(field)...)
+				if len(field.Names) == 0 {
+					info.Embedded = append(info.Embedded, types.ExprString(field.Type))
+				}
+			}
+		}
+
+	case *ast.InterfaceType:
+		info.Kind = "interface"
+		if t.Methods != nil {
+			for _, method := range t.Methods.List {
+				if len(method.Names) == 0 {
+					info.Embedded = append(info.Embedded, types.ExprString(method.Type))
+				}
+				for _, name := range method.Names {
+					info.Methods = append(info.Methods, name.Name)
+				}
+			}
+		}
+
+	default:
+		info.Kind = "other"
+	}
+
+	return info
+}
+
+// structFields describes the fields one line of a struct declares
+func structFields(field *ast.Field) []FieldInfo {
+	fieldType := types.ExprString(field.Type)
+	tag := ""
+	if field.Tag != nil {
+		if value, err := strconv.Unquote(field.Tag.Value); err == nil {
+			tag = value
+		}
+	}
+	if len(field.Names) == 0 {
+		return []FieldInfo{{Name: embeddedFieldName(field.Type), Type: fieldType, Tag: tag, Embedded: true}}
+	}
+	fields := []FieldInfo{}
+	for _, name := range field.Names {
+		fields = append(fields, FieldInfo{Name: name.Name, Type: fieldType, Tag: tag})
+	}
+	return fields
+}
+
+// embeddedFieldName is the name of an embedded field: its type's name
+// without a pointer, package or type arguments
+func embeddedFieldName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedFieldName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedFieldName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedFieldName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return types.ExprString(expr)
+}
+
+// docComment returns the text of a doc comment without its comment markers,
+// and its first sentence as go doc shows it in package listings
+func docComment(group *ast.CommentGroup) (string, string) {
+	if group == nil {
+		return "", ""
+	}
+	text := strings.TrimSpace(group.Text())
+	return text, new(doc.Package).Synopsis(text)
+}
+
+func extractDependency(node *ast.CallExpr) DependencyInfo {
+	funcName := getFuncName(node.Fun)
+	dep := DependencyInfo{
+		Function: funcName,
+	}
+
+	// Try to extract package name
+	if sel, ok := node.Fun.(*ast.SelectorExpr); ok {
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			dep.Package = &ident.Name
+		}
+	}
+
+	return dep
+}
+
+func getFuncName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return fmt.Sprintf("%s.%s", getFuncName(e.X), e.Sel.Name)
+	default:
+		return "unknown"
+	}
+}
+
+func getTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return "*" + getTypeName(t.X)
+	case *ast.SelectorExpr:
+		return fmt.Sprintf("%s.%s", getTypeName(t.X), t.Sel.Name)
+	case *ast.ArrayType:
+		return "[]" + getTypeName(t.Elt)
+	case *ast.IndexExpr:
+		// Type arguments are left out, so a generic receiver such as
+		// *List[T] goes by its type's name
+		return getTypeName(t.X)
+	case *ast.IndexListExpr:
+		return getTypeName(t.X)
+	default:
+		return "unknown"
+	}
+}
+
+func isExported(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	return unicode.IsUpper(rune(name[0]))
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
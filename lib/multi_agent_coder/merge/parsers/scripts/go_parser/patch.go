@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// filePatch is the set of hunks a unified diff applies to one file
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []hunk
+}
+
+// hunk is a single @@ section of a unified diff
+type hunk struct {
+	oldStart int
+	oldLines []string
+	newLines []string
+	// leading and trailing count the unchanged context lines at either end,
+	// which are the only lines fuzzing may ignore
+	leading  int
+	trailing int
+	// remaining line counts from the header, so that body lines that look
+	// like file headers are still read as part of the hunk
+	oldLeft int
+	newLeft int
+}
+
+func (h *hunk) complete() bool {
+	return h.oldLeft <= 0 && h.newLeft <= 0
+}
+
+// HunkResult reports where and how a hunk was applied
+type HunkResult struct {
+	Index   int    `json:"index"`
+	Applied bool   `json:"applied"`
+	Line    int    `json:"line,omitempty"`
+	Offset  int    `json:"offset"`
+	Fuzz    int    `json:"fuzz"`
+	Loose   bool   `json:"whitespace_insensitive,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// maxHunkFuzz is the number of context lines that may be ignored at either
+// end of a hunk when it does not match exactly, as with patch(1)
+const maxHunkFuzz = 2
+
+// parseUnifiedDiff splits a unified diff into per-file patches
+func parseUnifiedDiff(diff string) ([]filePatch, error) {
+	patches := []filePatch{}
+	var current *filePatch
+	var h *hunk
+
+	flushHunk := func() {
+		if h != nil && current != nil {
+			h.leading, h.trailing = contextBounds(h)
+			current.hunks = append(current.hunks, *h)
+		}
+		h = nil
+	}
+
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		inHunk := h != nil && !h.complete()
+
+		switch {
+		case inHunk && strings.HasPrefix(line, " "):
+			h.oldLines = append(h.oldLines, line[1:])
+			h.newLines = append(h.newLines, line[1:])
+			h.oldLeft--
+			h.newLeft--
+
+		case inHunk && strings.HasPrefix(line, "-"):
+			h.oldLines = append(h.oldLines, line[1:])
+			h.oldLeft--
+
+		case inHunk && strings.HasPrefix(line, "+"):
+			h.newLines = append(h.newLines, line[1:])
+			h.newLeft--
+
+		case inHunk && line == "":
+			// Some tools strip the space from empty context lines
+			h.oldLines = append(h.oldLines, "")
+			h.newLines = append(h.newLines, "")
+			h.oldLeft--
+			h.newLeft--
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			flushHunk()
+			patches = append(patches, filePatch{oldPath: diffPath(line[4:])})
+			current = &patches[len(patches)-1]
+
+		case strings.HasPrefix(line, "+++ ") && current != nil && h == nil:
+			current.newPath = diffPath(line[4:])
+
+		case strings.HasPrefix(line, "@@"):
+			flushHunk()
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("malformed hunk header on line %d: %s", i+1, line)
+			}
+			if current == nil {
+				patches = append(patches, filePatch{})
+				current = &patches[len(patches)-1]
+			}
+			start, _ := strconv.Atoi(m[1])
+			h = &hunk{oldStart: start, oldLeft: headerCount(m[2]), newLeft: headerCount(m[4])}
+		}
+	}
+	flushHunk()
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no hunks found in diff")
+	}
+	return patches, nil
+}
+
+// headerCount reads an optional hunk header line count, which defaults to 1
+func headerCount(value string) int {
+	if value == "" {
+		return 1
+	}
+	count, _ := strconv.Atoi(value)
+	return count
+}
+
+func diffPath(header string) string {
+	path := strings.TrimSpace(strings.SplitN(header, "\t", 2)[0])
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		path = path[2:]
+	}
+	return path
+}
+
+// contextBounds counts the context lines shared at the start and end of a
+// hunk, which are the lines fuzzing is allowed to ignore
+func contextBounds(h *hunk) (int, int) {
+	leading := 0
+	for leading < len(h.oldLines) && leading < len(h.newLines) && h.oldLines[leading] == h.newLines[leading] {
+		leading++
+	}
+	trailing := 0
+	for trailing < len(h.oldLines)-leading && trailing < len(h.newLines)-leading &&
+		h.oldLines[len(h.oldLines)-1-trailing] == h.newLines[len(h.newLines)-1-trailing] {
+		trailing++
+	}
+	return leading, trailing
+}
+
+// selectPatch picks the file patch matching target, by path suffix, or the
+// only patch in a single-file diff
+func selectPatch(patches []filePatch, target string) (*filePatch, error) {
+	if len(patches) == 1 {
+		return &patches[0], nil
+	}
+
+	target = filepath.ToSlash(filepath.Clean(target))
+	for i := range patches {
+		for _, path := range []string{patches[i].newPath, patches[i].oldPath} {
+			if path != "" && (path == target || strings.HasSuffix(target, "/"+path) || strings.HasSuffix(path, "/"+target)) {
+				return &patches[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("diff has no changes for %s", target)
+}
+
+// applyHunks applies the hunks of patch to source, locating each hunk near
+// its stated line (adjusted by earlier hunks) and falling back to
+// whitespace-insensitive matching and reduced context
+func applyHunks(source string, patch *filePatch) (string, []HunkResult) {
+	trailingNewline := strings.HasSuffix(source, "\n")
+	lines := strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+	if source == "" {
+		lines = []string{}
+	}
+
+	results := []HunkResult{}
+	delta := 0
+	floor := 0
+
+	for i, h := range patch.hunks {
+		result := HunkResult{Index: i}
+		expected := h.oldStart - 1 + delta
+		if len(h.oldLines) == 0 {
+			// Pure insertion: the start line names the line to insert after
+			expected = h.oldStart + delta
+		}
+
+		pos, fuzz, loose, ok := locateHunk(lines, h, expected, floor)
+		if !ok {
+			result.Error = fmt.Sprintf("hunk does not match near line %d", h.oldStart)
+			results = append(results, result)
+			continue
+		}
+
+		oldLines := h.oldLines[fuzz.lead : len(h.oldLines)-fuzz.trail]
+		newLines := h.newLines[fuzz.lead : len(h.newLines)-fuzz.trail]
+
+		merged := make([]string, 0, len(lines)-len(oldLines)+len(newLines))
+		merged = append(merged, lines[:pos]...)
+		merged = append(merged, newLines...)
+		merged = append(merged, lines[pos+len(oldLines):]...)
+		lines = merged
+
+		result.Applied = true
+		result.Line = pos + 1
+		result.Offset = pos - fuzz.lead - expected
+		result.Fuzz = fuzz.lead + fuzz.trail
+		result.Loose = loose
+		results = append(results, result)
+
+		delta += len(newLines) - len(oldLines) + result.Offset
+		floor = pos + len(newLines)
+	}
+
+	out := strings.Join(lines, "\n")
+	if trailingNewline || source == "" {
+		out += "\n"
+	}
+	return out, results
+}
+
+type hunkFuzz struct {
+	lead  int
+	trail int
+}
+
+func locateHunk(lines []string, h hunk, expected, floor int) (int, hunkFuzz, bool, bool) {
+	for level := 0; level <= maxHunkFuzz; level++ {
+		fuzz := hunkFuzz{lead: min(level, h.leading), trail: min(level, h.trailing)}
+		if level > 0 && fuzz.lead+fuzz.trail == 0 {
+			break
+		}
+		old := h.oldLines[fuzz.lead : len(h.oldLines)-fuzz.trail]
+
+		for _, loose := range []bool{false, true} {
+			if pos, ok := searchLines(lines, old, expected+fuzz.lead, floor, loose); ok {
+				return pos, fuzz, loose, true
+			}
+		}
+	}
+	return 0, hunkFuzz{}, false, false
+}
+
+// searchLines finds old in lines, trying the expected index first and then
+// moving outward in both directions, never before floor
+func searchLines(lines, old []string, expected, floor int, loose bool) (int, bool) {
+	limit := len(lines) - len(old)
+	if expected > limit {
+		expected = limit
+	}
+	if expected < floor {
+		expected = floor
+	}
+
+	for distance := 0; distance <= len(lines); distance++ {
+		candidates := []int{expected - distance, expected + distance}
+		if distance == 0 {
+			candidates = candidates[:1]
+		}
+		for _, pos := range candidates {
+			if pos < floor || pos > limit {
+				continue
+			}
+			if matchLines(lines[pos:pos+len(old)], old, loose) {
+				return pos, true
+			}
+		}
+		if expected-distance < floor && expected+distance > limit {
+			break
+		}
+	}
+	return 0, false
+}
+
+func matchLines(actual, expected []string, loose bool) bool {
+	for i := range expected {
+		a, e := actual[i], expected[i]
+		if loose {
+			a, e = normalizeWhitespace(a), normalizeWhitespace(e)
+		}
+		if a != e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PerfHints lists optimization hints for the non-test functions of each
+// package: small leaf functions called inside loops, which are inlining
+// candidates, and large functions with many call sites, whose common path
+// may be worth splitting out
+type PerfHints struct {
+	MaxInlineCost int         `json:"max_inline_cost"`
+	MinCallSites  int         `json:"min_call_sites"`
+	GiantLines    int         `json:"giant_lines"`
+	Hints         []PerfHint  `json:"hints"`
+	Errors        []FileError `json:"errors"`
+}
+
+// PerfHint is one hint. Kind is inline or hot_giant. Cost approximates the
+// compiler's inlining cost as the number of syntax nodes in the body, and
+// Blockers lists constructs known to keep gc from inlining the function.
+type PerfHint struct {
+	Kind          string   `json:"kind"`
+	Name          string   `json:"name"`
+	File          string   `json:"file"`
+	Line          int      `json:"line"`
+	EndLine       int      `json:"end_line"`
+	Cost          int      `json:"cost"`
+	CallSites     int      `json:"call_sites"`
+	LoopCallSites int      `json:"loop_call_sites"`
+	Callers       []string `json:"callers"`
+	Blockers      []string `json:"blockers"`
+	Message       string   `json:"message"`
+}
+
+// perfBuiltins are the predeclared functions a leaf function may still call
+var perfBuiltins = map[string]bool{
+	"append": true, "cap": true, "clear": true, "complex": true, "copy": true, "delete": true,
+	"imag": true, "len": true, "make": true, "max": true, "min": true, "new": true,
+	"panic": true, "print": true, "println": true, "real": true, "recover": true,
+}
+
+func runPerfHints(args []string) int {
+	maxInlineCost := 80
+	minCallSites := 5
+	giantLines := 80
+	strict := false
+
+	flags := flag.NewFlagSet("perf-hints", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.IntVar(&maxInlineCost, "max-inline-cost", 80, "largest body, in syntax nodes, suggested for inlining")
+	flags.IntVar(&minCallSites, "min-call-sites", 5, "call sites that make a large function hot")
+	flags.IntVar(&giantLines, "giant-lines", 80, "lines that make a function large")
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	files, err := collectGoFiles(patterns, false)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+
+	hints := &PerfHints{MaxInlineCost: maxInlineCost, MinCallSites: minCallSites, GiantLines: giantLines, Hints: []PerfHint{}, Errors: []FileError{}}
+	byDir := map[string][]string{}
+	dirs := []string{}
+	for _, path := range files {
+		dir := filepath.Dir(path)
+		if byDir[dir] == nil {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], path)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		hints.addPackage(byDir[dir])
+	}
+	if err := strictFailure(hints.Errors, strict); err != nil {
+		return fail("Perf hints failed: %v", err)
+	}
+	return printJSON(hints)
+}
+
+// perfFunc is a function of the package with the calls made to it
+type perfFunc struct {
+	name      string
+	file      string
+	fset      *token.FileSet
+	fn        *ast.FuncDecl
+	callers   map[string]bool
+	sites     int
+	loopSites int
+}
+
+// addPackage resolves calls by name within one package, as test-map does,
+// and records where each function is called from and whether the call is
+// inside a loop
+func (h *PerfHints) addPackage(paths []string) {
+	fset := token.NewFileSet()
+	funcs := map[string]*perfFunc{}
+	order := []string{}
+	methodsByName := map[string][]string{}
+	parsed := []*ast.File{}
+
+	for _, path := range paths {
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			h.Errors = append(h.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+		parsed = append(parsed, file)
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || funcs[symbolName(fn)] != nil {
+				continue
+			}
+			name := symbolName(fn)
+			funcs[name] = &perfFunc{name: name, file: path, fset: fset, fn: fn, callers: map[string]bool{}}
+			order = append(order, name)
+			if fn.Recv != nil {
+				methodsByName[fn.Name.Name] = append(methodsByName[fn.Name.Name], name)
+			}
+		}
+	}
+
+	for _, file := range parsed {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			caller, receiver, recvVar := symbolName(fn), receiverTypeName(fn), receiverVarName(fn)
+			resolve := func(call *ast.CallExpr) *perfFunc {
+				switch fun := call.Fun.(type) {
+				case *ast.Ident:
+					if fun.Obj == nil || fun.Obj.Kind == ast.Fun {
+						return funcs[fun.Name]
+					}
+				case *ast.SelectorExpr:
+					if x, ok := fun.X.(*ast.Ident); ok && x.Name == recvVar && funcs[receiver+"."+fun.Sel.Name] != nil {
+						return funcs[receiver+"."+fun.Sel.Name]
+					}
+					// Other methods only when the name is unambiguous
+					if methods := methodsByName[fun.Sel.Name]; len(methods) == 1 {
+						return funcs[methods[0]]
+					}
+				}
+				return nil
+			}
+			walkCalls(fn.Body, false, func(call *ast.CallExpr, inLoop bool) {
+				if target := resolve(call); target != nil && target.name != caller {
+					target.callers[caller] = true
+					target.sites++
+					if inLoop {
+						target.loopSites++
+					}
+				}
+			})
+		}
+	}
+
+	for _, name := range order {
+		f := funcs[name]
+		span := sourceSpan(f.fset, f.fn)
+		hint := PerfHint{
+			Name:          name,
+			File:          f.file,
+			Line:          span.Line,
+			EndLine:       span.EndLine,
+			Cost:          inlineCost(f.fn.Body),
+			CallSites:     f.sites,
+			LoopCallSites: f.loopSites,
+			Callers:       sortedKeys(f.callers),
+			Blockers:      inlineBlockers(f.fn),
+		}
+		lines := span.EndLine - span.Line + 1
+
+		switch {
+		case f.loopSites > 0 && hint.Cost <= h.MaxInlineCost && isLeaf(f.fn.Body):
+			hint.Kind = "inline"
+			if len(hint.Blockers) == 0 {
+				hint.Message = fmt.Sprintf("small leaf function called in a loop at %d site(s); gc should inline it already, confirm with -gcflags=-m", f.loopSites)
+			} else {
+				hint.Message = fmt.Sprintf("small leaf function called in a loop at %d site(s) that gc will not inline because of %s; remove the blocker or inline it by hand", f.loopSites, strings.Join(hint.Blockers, ", "))
+			}
+		case lines >= h.GiantLines && f.sites >= h.MinCallSites:
+			hint.Kind = "hot_giant"
+			hint.Message = fmt.Sprintf("%d-line function called from %d site(s) in %d function(s); split the common path from the rare cases so callers can inline it", lines, f.sites, len(f.callers))
+		default:
+			continue
+		}
+		h.Hints = append(h.Hints, hint)
+	}
+}
+
+// walkCalls calls visit for each call in node, reporting whether it is
+// inside a for or range statement. Closures are walked too, since a closure
+// defined in a loop usually runs in it.
+func walkCalls(node ast.Node, inLoop bool, visit func(*ast.CallExpr, bool)) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			if !inLoop && n != node {
+				walkCalls(n, true, visit)
+				return false
+			}
+		case *ast.CallExpr:
+			visit(n, inLoop)
+		}
+		return true
+	})
+}
+
+// inlineCost counts the syntax nodes in body, the unit the compiler's
+// budget of 80 is roughly measured in
+func inlineCost(body *ast.BlockStmt) int {
+	cost := 0
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n != nil {
+			cost++
+		}
+		return true
+	})
+	return cost
+}
+
+// isLeaf reports whether body calls nothing but builtins, conversions to
+// predeclared types and its own closures
+func isLeaf(body *ast.BlockStmt) bool {
+	leaf := true
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !leaf {
+			return leaf
+		}
+		if _, ok := call.Fun.(*ast.FuncLit); ok {
+			return true
+		}
+		ident, ok := call.Fun.(*ast.Ident)
+		if !ok || ident.Obj != nil || (!perfBuiltins[ident.Name] && !isPredeclaredType(ident.Name)) {
+			leaf = false
+		}
+		return leaf
+	})
+	return leaf
+}
+
+func isPredeclaredType(name string) bool {
+	switch name {
+	case "bool", "byte", "complex64", "complex128", "float32", "float64", "int", "int8", "int16", "int32", "int64",
+		"rune", "string", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "any":
+		return true
+	}
+	return false
+}
+
+// inlineBlockers lists what keeps gc from inlining fn: a //go:noinline
+// directive, defer, recover, go statements and direct recursion
+func inlineBlockers(fn *ast.FuncDecl) []string {
+	blockers := []string{}
+	if fn.Doc != nil {
+		for _, comment := range fn.Doc.List {
+			if strings.HasPrefix(comment.Text, "//go:noinline") {
+				blockers = append(blockers, "//go:noinline")
+			}
+		}
+	}
+
+	found := map[string]bool{}
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeferStmt:
+			found["defer"] = true
+		case *ast.GoStmt:
+			found["go statement"] = true
+		case *ast.CallExpr:
+			if ident, ok := n.Fun.(*ast.Ident); ok {
+				if ident.Name == "recover" && ident.Obj == nil {
+					found["recover"] = true
+				}
+				if fn.Recv == nil && ident.Name == fn.Name.Name && ident.Obj != nil && ident.Obj.Kind == ast.Fun {
+					found["recursion"] = true
+				}
+			}
+		}
+		return true
+	})
+	return append(blockers, sortedKeys(found)...)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PackageGraph is the internal package dependency graph of a repository
+type PackageGraph struct {
+	Module   string        `json:"module"`
+	Packages []PackageNode `json:"packages"`
+	Edges    []PackageEdge `json:"edges"`
+	Touched  []string      `json:"touched"`
+	Errors   []FileError   `json:"errors"`
+}
+
+// PackageNode represents a single package directory
+type PackageNode struct {
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Dir     string `json:"dir"`
+	Files   int    `json:"files"`
+	Touched bool   `json:"touched"`
+}
+
+// PackageEdge represents an import between two internal packages. Test is
+// set when the import only comes from _test.go files.
+type PackageEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Test bool   `json:"test,omitempty"`
+}
+
+func runPkgGraph(args []string) int {
+	var changed stringList
+	format := "json"
+	strict := false
+
+	flags := flag.NewFlagSet("pkg-graph", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&format, "format", "json", "output format: json or dot")
+	flags.Var(&changed, "changed", "files touched by the proposed change (repeatable, comma-separated)")
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	if format != "json" && format != "dot" {
+		return fail("Invalid format: %s", format)
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	graph, err := buildPackageGraph(patterns, changed)
+	if err != nil {
+		return fail("Failed to build package graph: %v", err)
+	}
+	if err := strictFailure(graph.Errors, strict); err != nil {
+		return fail("Failed to build package graph: %v", err)
+	}
+
+	if format == "dot" {
+		fmt.Print(graph.dot())
+		return 0
+	}
+	return printJSON(graph)
+}
+
+// buildPackageGraph parses the imports of every file matched by patterns
+// (plus any changed files not already matched) and links the packages that
+// belong to the same module.
+func buildPackageGraph(patterns []string, changed []string) (*PackageGraph, error) {
+	files, err := collectGoFiles(patterns, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range changed {
+		if _, err := os.Stat(path); err == nil && strings.HasSuffix(path, ".go") {
+			files = append(files, filepath.Clean(path))
+		}
+	}
+
+	root, modulePath := "", ""
+	if len(files) > 0 {
+		root, modulePath, err = findModule(filepath.Dir(files[0]))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	graph := &PackageGraph{
+		Module:   modulePath,
+		Packages: []PackageNode{},
+		Edges:    []PackageEdge{},
+		Touched:  []string{},
+		Errors:   []FileError{},
+	}
+
+	nodes := map[string]*PackageNode{}
+	nodeFiles := map[string]map[string]bool{}
+	imports := map[string]map[string]bool{}
+	testOnly := map[[2]string]bool{}
+	fset := token.NewFileSet()
+
+	for _, path := range files {
+		dir := filepath.Dir(path)
+		importPath := packageImportPath(root, modulePath, dir)
+
+		node := nodes[importPath]
+		if node == nil {
+			node = &PackageNode{Path: importPath, Dir: dir}
+			nodes[importPath] = node
+			nodeFiles[importPath] = map[string]bool{}
+			imports[importPath] = map[string]bool{}
+		}
+		if nodeFiles[importPath][path] {
+			continue
+		}
+		nodeFiles[importPath][path] = true
+
+		file, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
+		if err != nil {
+			graph.Errors = append(graph.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+		node.Files++
+
+		isTest := strings.HasSuffix(path, "_test.go")
+		if node.Name == "" || (!isTest && strings.HasSuffix(node.Name, "_test")) {
+			node.Name = file.Name.Name
+		}
+
+		for _, imp := range file.Imports {
+			target := strings.Trim(imp.Path.Value, `"`)
+			key := [2]string{importPath, target}
+			if !imports[importPath][target] {
+				imports[importPath][target] = true
+				testOnly[key] = isTest
+			} else if !isTest {
+				testOnly[key] = false
+			}
+		}
+	}
+
+	for _, path := range changed {
+		dir := filepath.Dir(filepath.Clean(path))
+		importPath := packageImportPath(root, modulePath, dir)
+		if node := nodes[importPath]; node != nil {
+			node.Touched = true
+		} else {
+			nodes[importPath] = &PackageNode{Path: importPath, Dir: dir, Touched: true}
+		}
+	}
+
+	paths := make([]string, 0, len(nodes))
+	for path := range nodes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		node := nodes[path]
+		node.Name = strings.TrimSuffix(node.Name, "_test")
+		graph.Packages = append(graph.Packages, *node)
+		if node.Touched {
+			graph.Touched = append(graph.Touched, path)
+		}
+
+		targets := make([]string, 0, len(imports[path]))
+		for target := range imports[path] {
+			if _, internal := nodes[target]; internal && target != path {
+				targets = append(targets, target)
+			}
+		}
+		sort.Strings(targets)
+
+		for _, target := range targets {
+			graph.Edges = append(graph.Edges, PackageEdge{
+				From: path,
+				To:   target,
+				Test: testOnly[[2]string{path, target}],
+			})
+		}
+	}
+
+	return graph, nil
+}
+
+// packageImportPath derives the import path of the package in dir from the
+// module root, falling back to the slash-separated directory without a module
+func packageImportPath(root, modulePath, dir string) string {
+	if root == "" {
+		return filepath.ToSlash(filepath.Clean(dir))
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.ToSlash(dir)
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(dir)
+	}
+	if rel == "." {
+		return modulePath
+	}
+	return modulePath + "/" + filepath.ToSlash(rel)
+}
+
+// dot renders the graph in Graphviz format, highlighting touched packages
+// and drawing test-only imports dashed
+func (g *PackageGraph) dot() string {
+	var b strings.Builder
+	b.WriteString("digraph packages {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, fontname=\"Helvetica\"];\n")
+
+	for _, node := range g.Packages {
+		label := strings.TrimPrefix(strings.TrimPrefix(node.Path, g.Module), "/")
+		if label == "" {
+			label = node.Path
+		}
+		attrs := fmt.Sprintf("label=%q", label)
+		if node.Touched {
+			attrs += ", style=filled, fillcolor=\"#ffd27f\""
+		}
+		fmt.Fprintf(&b, "  %q [%s];\n", node.Path, attrs)
+	}
+
+	for _, edge := range g.Edges {
+		if edge.Test {
+			fmt.Fprintf(&b, "  %q -> %q [style=dashed];\n", edge.From, edge.To)
+		} else {
+			fmt.Fprintf(&b, "  %q -> %q;\n", edge.From, edge.To)
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PackageAnalysis is the cross-file view of the packages matched by the
+// patterns: each package's symbol table over all of its files, and the
+// import graph between them
+type PackageAnalysis struct {
+	Module   string           `json:"module"`
+	Packages []PackageSymbols `json:"packages"`
+	Edges    []PackageEdge    `json:"edges"`
+	Errors   []FileError      `json:"errors"`
+}
+
+// PackageSymbols is the symbol table of a package: the package-level
+// declarations of all its files that the build constraints select, those
+// declared in more than one file, and the identifiers no file declares.
+// External test packages are listed separately, under their own name.
+type PackageSymbols struct {
+	Path       string            `json:"path"`
+	Name       string            `json:"name"`
+	Dir        string            `json:"dir"`
+	Files      []string          `json:"files"`
+	Imports    []string          `json:"imports"`
+	Symbols    []PackageSymbol   `json:"symbols"`
+	Duplicates []DuplicateSymbol `json:"duplicates"`
+	Undefined  []string          `json:"undefined"`
+}
+
+// PackageSymbol is a package-level declaration. UsedIn lists the other files
+// of the package that refer to it.
+type PackageSymbol struct {
+	Name     string   `json:"name"`
+	ID       string   `json:"id,omitempty"`
+	Kind     string   `json:"kind"`
+	Exported bool     `json:"exported"`
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	UsedIn   []string `json:"used_in"`
+}
+
+// DuplicateSymbol is a name declared at package level by more than one file,
+// or more than once in a file, which the package does not compile with
+type DuplicateSymbol struct {
+	Name         string           `json:"name"`
+	Declarations []SymbolLocation `json:"declarations"`
+}
+
+// SymbolLocation is where a symbol is declared
+type SymbolLocation struct {
+	Kind string `json:"kind"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// packageUnit is a package being assembled from its files
+type packageUnit struct {
+	symbols    *PackageSymbols
+	files      []*ast.File
+	paths      []string
+	dotImports bool
+}
+
+func runPackages(args []string) int {
+	strict := false
+
+	flags := flag.NewFlagSet("packages", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	analysis, err := analyzePackages(patterns)
+	if err != nil {
+		return fail("Failed to load packages: %v", err)
+	}
+	if err := strictFailure(analysis.Errors, strict); err != nil {
+		return fail("Failed to load packages: %v", err)
+	}
+	return printJSON(analysis)
+}
+
+// analyzePackages parses every file matched by patterns, groups the files
+// into packages by directory and package clause, skipping those the build
+// constraints exclude, and builds each package's symbol table
+func analyzePackages(patterns []string) (*PackageAnalysis, error) {
+	graph, err := buildPackageGraph(patterns, nil)
+	if err != nil {
+		return nil, err
+	}
+	files, err := collectGoFiles(patterns, true)
+	if err != nil {
+		return nil, err
+	}
+
+	root := ""
+	if len(files) > 0 {
+		if root, _, err = findModule(filepath.Dir(files[0])); err != nil {
+			return nil, err
+		}
+	}
+
+	analysis := &PackageAnalysis{Module: graph.Module, Packages: []PackageSymbols{}, Edges: graph.Edges, Errors: graph.Errors}
+	failed := map[string]bool{}
+	for _, e := range graph.Errors {
+		failed[e.Path] = true
+	}
+	units := map[string]*packageUnit{}
+	keys := []string{}
+	fset := token.NewFileSet()
+	for _, path := range files {
+		dir := filepath.Dir(path)
+		if match, err := build.Default.MatchFile(dir, filepath.Base(path)); err != nil || !match {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			if !failed[path] {
+				analysis.Errors = append(analysis.Errors, FileError{Path: path, Error: err.Error()})
+			}
+			continue
+		}
+
+		importPath := packageImportPath(root, graph.Module, dir)
+		if strings.HasSuffix(file.Name.Name, "_test") && strings.HasSuffix(path, "_test.go") {
+			importPath += "_test"
+		}
+		key := importPath + " " + file.Name.Name
+		unit := units[key]
+		if unit == nil {
+			unit = &packageUnit{symbols: &PackageSymbols{Path: importPath, Name: file.Name.Name, Dir: dir, Files: []string{}}}
+			units[key] = unit
+			keys = append(keys, key)
+		}
+		unit.files = append(unit.files, file)
+		unit.paths = append(unit.paths, path)
+		unit.symbols.Files = append(unit.symbols.Files, path)
+		for _, imp := range file.Imports {
+			if imp.Name != nil && imp.Name.Name == "." {
+				unit.dotImports = true
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		analysis.Packages = append(analysis.Packages, *units[key].symbolTable(fset))
+	}
+	return analysis, nil
+}
+
+// symbolTable collects the package-level declarations of the unit's files
+// and the files that refer to each, through the identifiers go/parser could
+// not resolve within their own file
+func (u *packageUnit) symbolTable(fset *token.FileSet) *PackageSymbols {
+	table := u.symbols
+	table.Imports, table.Symbols, table.Duplicates, table.Undefined = []string{}, []PackageSymbol{}, []DuplicateSymbol{}, []string{}
+
+	imports := map[string]bool{}
+	locations := map[string][]SymbolLocation{}
+	ids := map[string]string{}
+	names := []string{}
+	for i, file := range u.files {
+		for name, id := range symbolIDsByName(fset, file) {
+			if _, ok := ids[name]; !ok {
+				ids[name] = id
+			}
+		}
+		for _, imp := range file.Imports {
+			imports[strings.Trim(imp.Path.Value, `"`)] = true
+		}
+		for _, decl := range topLevelSymbols(file) {
+			name := decl.name
+			// init and blank declarations may repeat
+			if name == "_" || (name == "init" && decl.kind == "func") {
+				continue
+			}
+			if locations[name] == nil {
+				names = append(names, name)
+			}
+			locations[name] = append(locations[name], SymbolLocation{Kind: decl.kind, File: u.paths[i], Line: fset.Position(decl.node.Pos()).Line})
+		}
+	}
+	table.Imports = sortedKeys(imports)
+
+	// Which files use each name they do not declare themselves
+	usedIn := map[string]map[string]bool{}
+	undefined := map[string]bool{}
+	for i, file := range u.files {
+		packages, unsure := fileImportNames(file)
+		qualifiers := map[*ast.Ident]bool{}
+		ast.Inspect(file, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if x, ok := sel.X.(*ast.Ident); ok {
+					qualifiers[x] = true
+				}
+			}
+			return true
+		})
+		for _, ident := range file.Unresolved {
+			name := ident.Name
+			if locations[name] == nil {
+				// A qualifier may be the package of an import whose name is
+				// not its path's last element
+				if types.Universe.Lookup(name) == nil && !packages[name] && !(unsure && qualifiers[ident]) && !u.dotImports {
+					undefined[name] = true
+				}
+				continue
+			}
+			if usedIn[name] == nil {
+				usedIn[name] = map[string]bool{}
+			}
+			usedIn[name][u.paths[i]] = true
+		}
+	}
+	table.Undefined = sortedKeys(undefined)
+
+	for _, name := range names {
+		declared := locations[name]
+		first := declared[0]
+		used := []string{}
+		for _, path := range sortedKeys(usedIn[name]) {
+			if path != first.File {
+				used = append(used, path)
+			}
+		}
+		table.Symbols = append(table.Symbols, PackageSymbol{Name: name, ID: ids[name], Kind: first.Kind, Exported: isExported(name[strings.LastIndex(name, ".")+1:]), File: first.File, Line: first.Line, UsedIn: used})
+		if len(declared) > 1 {
+			table.Duplicates = append(table.Duplicates, DuplicateSymbol{Name: name, Declarations: declared})
+		}
+	}
+	return table
+}
+
+// fileImportNames returns the names a file refers to its imports by, and
+// whether some of them are unsure, as for gopkg.in/yaml.v3 or .../v2, whose
+// package name is not the last element of the path
+func fileImportNames(file *ast.File) (map[string]bool, bool) {
+	names := map[string]bool{}
+	unsure := false
+	for _, imp := range file.Imports {
+		info := importInfo{path: strings.Trim(imp.Path.Value, `"`)}
+		if imp.Name != nil {
+			info.name = imp.Name.Name
+		}
+		local := info.localName()
+		if info.name == "" && (!token.IsIdentifier(local) || majorVersion.MatchString(local)) {
+			unsure = true
+		}
+		names[local] = true
+	}
+	return names, unsure
+}
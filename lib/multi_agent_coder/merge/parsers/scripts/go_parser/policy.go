@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PolicyFile is the --policy file, in YAML or JSON: rules that the analysis
+// of every matched file must satisfy. Each rule has a name and any of the
+// checks, which are all applied:
+//
+//   - deny_imports: import paths the code may not import
+//   - allow_imports: the only import paths it may import; with --baseline,
+//     imports the baseline tree already has are exempt, so only new ones are
+//     checked
+//   - deny_calls: functions it may not call, by import path and name such as
+//     os/exec.Command or os.Exit, or a builtin such as panic
+//   - require_context: exported (or all) functions and methods must take a
+//     context.Context first, except the exclude_symbols
+//
+// Patterns are path.Match globs, or a path ending in /... for the path and
+// everything below it. paths restricts a rule to the files matching one of
+// its patterns; test files are skipped unless include_tests is set. A rule
+// of severity warning is reported without failing the check.
+type PolicyFile struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule is one rule of a PolicyFile
+type PolicyRule struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description,omitempty"`
+	Severity       string   `json:"severity,omitempty"`
+	Paths          []string `json:"paths,omitempty"`
+	IncludeTests   bool     `json:"include_tests,omitempty"`
+	DenyImports    []string `json:"deny_imports,omitempty"`
+	AllowImports   []string `json:"allow_imports,omitempty"`
+	DenyCalls      []string `json:"deny_calls,omitempty"`
+	RequireContext string   `json:"require_context,omitempty"`
+	ExcludeSymbols []string `json:"exclude_symbols,omitempty"`
+}
+
+// PolicyReport is the outcome of the policy over the matched files. Passed
+// is false when a rule of severity error has a violation.
+type PolicyReport struct {
+	Passed     bool              `json:"passed"`
+	Files      int               `json:"files"`
+	Rules      []PolicyRuleCount `json:"rules"`
+	Violations []PolicyViolation `json:"violations"`
+	// The //agentlint:ignore directives of the files, by rule name
+	Suppressions []Suppression `json:"suppressions"`
+	Errors       []FileError   `json:"errors"`
+}
+
+// PolicyRuleCount is the number of violations of one rule
+type PolicyRuleCount struct {
+	Name       string `json:"name"`
+	Severity   string `json:"severity"`
+	Violations int    `json:"violations"`
+}
+
+// PolicyViolation is one breach of a rule, at the import, call or function
+// that breaks it
+type PolicyViolation struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Symbol   string `json:"symbol,omitempty"`
+	Message  string `json:"message"`
+}
+
+func runPolicy(args []string) int {
+	policyPath := ""
+	baseline := ""
+	strict := false
+
+	flags := flag.NewFlagSet("policy", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&policyPath, "policy", "", "YAML or JSON file with the rules")
+	flags.StringVar(&baseline, "baseline", "", "tree whose imports are exempt from allow_imports")
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if policyPath == "" {
+		return fail("--policy is required")
+	}
+	policy, err := loadPolicy(policyPath)
+	if err != nil {
+		return fail("Invalid policy: %v", err)
+	}
+
+	baselineImports := map[string]bool{}
+	if baseline != "" {
+		if baselineImports, err = treeImports(baseline); err != nil {
+			return fail("Failed to read baseline: %v", err)
+		}
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	paths, err := collectGoFiles(patterns, true)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+
+	report := evaluatePolicy(policy, paths, baselineImports)
+	if err := strictFailure(report.Errors, strict); err != nil {
+		return fail("Policy check failed: %v", err)
+	}
+	code := printJSON(report)
+	if code == 0 && !report.Passed {
+		return exitViolations
+	}
+	return code
+}
+
+// loadPolicy reads a policy file, rejecting unknown fields so that a
+// misspelled check does not pass silently
+func loadPolicy(policyPath string) (*PolicyFile, error) {
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", policyPath, err)
+	}
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", policyPath, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	policy := &PolicyFile{}
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("%s: %v", policyPath, err)
+	}
+
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("%s: rule %d has no name", policyPath, i+1)
+		}
+		if rule.Severity == "" {
+			rule.Severity = "error"
+		}
+		if rule.Severity != "error" && rule.Severity != "warning" {
+			return nil, fmt.Errorf("%s: rule %s: severity must be error or warning", policyPath, rule.Name)
+		}
+		if rule.RequireContext != "" && rule.RequireContext != "exported" && rule.RequireContext != "all" {
+			return nil, fmt.Errorf("%s: rule %s: require_context must be exported or all", policyPath, rule.Name)
+		}
+		if len(rule.DenyImports) == 0 && len(rule.AllowImports) == 0 && len(rule.DenyCalls) == 0 && rule.RequireContext == "" {
+			return nil, fmt.Errorf("%s: rule %s has no checks", policyPath, rule.Name)
+		}
+		for _, patterns := range [][]string{rule.Paths, rule.DenyImports, rule.AllowImports, rule.DenyCalls, rule.ExcludeSymbols} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(strings.TrimSuffix(pattern, "/..."), ""); err != nil {
+					return nil, fmt.Errorf("%s: rule %s: invalid pattern %q", policyPath, rule.Name, pattern)
+				}
+			}
+		}
+	}
+	return policy, nil
+}
+
+// treeImports collects the import paths of every Go file under root
+func treeImports(root string) (map[string]bool, error) {
+	paths, err := collectGoFiles([]string{filepath.Join(root, "...")}, true)
+	if err != nil {
+		return nil, err
+	}
+	imports := map[string]bool{}
+	for _, path := range paths {
+		file, err := loadEditFile(path)
+		if err != nil {
+			continue
+		}
+		for _, imp := range file.file.Imports {
+			imports[strings.Trim(imp.Path.Value, "\"`")] = true
+		}
+	}
+	return imports, nil
+}
+
+// evaluatePolicy applies every rule to the analysis of each file
+func evaluatePolicy(policy *PolicyFile, paths []string, baselineImports map[string]bool) *PolicyReport {
+	report := &PolicyReport{Rules: []PolicyRuleCount{}, Violations: []PolicyViolation{}, Suppressions: []Suppression{}, Errors: []FileError{}}
+	counts := map[string]int{}
+	opts := defaultOptions()
+
+	for _, filePath := range paths {
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			report.Errors = append(report.Errors, FileError{Path: filePath, Error: err.Error()})
+			continue
+		}
+		result, err := analyzeSource(filePath, content, opts)
+		if err != nil {
+			report.Errors = append(report.Errors, FileError{Path: filePath, Error: err.Error()})
+			continue
+		}
+		report.Files++
+
+		slashPath := filepath.ToSlash(filePath)
+		for _, rule := range policy.Rules {
+			if !rule.IncludeTests && strings.HasSuffix(filePath, "_test.go") {
+				continue
+			}
+			if len(rule.Paths) > 0 && !matchesAnyPattern(rule.Paths, slashPath) {
+				continue
+			}
+			for _, violation := range checkPolicyRule(rule, result, baselineImports) {
+				if result.suppressions.suppress(rule.Name, violation.Line) {
+					continue
+				}
+				violation.Rule, violation.Severity, violation.Path = rule.Name, rule.Severity, filePath
+				if rule.Description != "" {
+					violation.Message += " (" + rule.Description + ")"
+				}
+				report.Violations = append(report.Violations, violation)
+				counts[rule.Name]++
+			}
+		}
+		report.Suppressions = append(report.Suppressions, result.suppressions.inFile(filePath)...)
+	}
+
+	report.Passed = true
+	for _, rule := range policy.Rules {
+		report.Rules = append(report.Rules, PolicyRuleCount{Name: rule.Name, Severity: rule.Severity, Violations: counts[rule.Name]})
+		if rule.Severity == "error" && counts[rule.Name] > 0 {
+			report.Passed = false
+		}
+	}
+	sort.SliceStable(report.Violations, func(i, j int) bool {
+		a, b := report.Violations[i], report.Violations[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+	return report
+}
+
+// checkPolicyRule returns the violations of one rule in an analyzed file,
+// without the fields evaluatePolicy fills in
+func checkPolicyRule(rule PolicyRule, result *Result, baselineImports map[string]bool) []PolicyViolation {
+	violations := []PolicyViolation{}
+	at := func(node ast.Node, symbol, message string) {
+		position := result.fset.Position(node.Pos())
+		violations = append(violations, PolicyViolation{Line: position.Line, Column: position.Column, Symbol: symbol, Message: message})
+	}
+
+	// Local names of the imports, to qualify calls with the import path
+	importPaths := map[string]string{}
+	for _, imp := range result.file.Imports {
+		importPath := strings.Trim(imp.Path.Value, "\"`")
+		name := importPath[strings.LastIndex(importPath, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		importPaths[name] = importPath
+
+		switch {
+		case matchesAnyPattern(rule.DenyImports, importPath):
+			at(imp, "", fmt.Sprintf("imports %s, which the policy denies", importPath))
+		case len(rule.AllowImports) > 0 && !matchesAnyPattern(rule.AllowImports, importPath) && !baselineImports[importPath]:
+			at(imp, "", fmt.Sprintf("imports %s, which is not in the allowlist", importPath))
+		}
+	}
+
+	if len(rule.DenyCalls) > 0 {
+		var caller string
+		ast.Inspect(result.file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.FuncDecl:
+				caller = symbolName(node)
+			case *ast.CallExpr:
+				callee := getFuncName(node.Fun)
+				if sel, ok := node.Fun.(*ast.SelectorExpr); ok {
+					if x, ok := sel.X.(*ast.Ident); ok && importPaths[x.Name] != "" {
+						callee = importPaths[x.Name] + "." + sel.Sel.Name
+					}
+				}
+				if matchesAnyPattern(rule.DenyCalls, callee) {
+					at(node, caller, fmt.Sprintf("calls %s, which the policy denies", callee))
+				}
+			}
+			return true
+		})
+	}
+
+	if rule.RequireContext != "" {
+		contextNames := map[string]bool{}
+		for name, importPath := range importPaths {
+			if importPath == "context" {
+				contextNames[name] = true
+			}
+		}
+		for _, decl := range result.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			name := symbolName(fn)
+			if rule.RequireContext == "exported" && !symbolExported(name) {
+				continue
+			}
+			if name == "main" || name == "init" || matchesAnyPattern(rule.ExcludeSymbols, name) {
+				continue
+			}
+			if !takesContextFirst(fn, contextNames) {
+				at(fn.Name, name, fmt.Sprintf("%s does not take a context.Context as its first parameter", name))
+			}
+		}
+	}
+	return violations
+}
+
+// takesContextFirst reports whether fn's first parameter is a
+// context.Context, under any of the names the file imports context as
+func takesContextFirst(fn *ast.FuncDecl, contextNames map[string]bool) bool {
+	if fn.Type.Params == nil || len(fn.Type.Params.List) == 0 {
+		return false
+	}
+	parts := strings.SplitN(types.ExprString(fn.Type.Params.List[0].Type), ".", 2)
+	return len(parts) == 2 && contextNames[parts[0]] && parts[1] == "Context"
+}
+
+// matchesAnyPattern reports whether value matches one of patterns: a
+// path.Match glob, or a prefix ending in /... matching itself and everything
+// below it
+func matchesAnyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+			if value == prefix || strings.HasPrefix(value, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
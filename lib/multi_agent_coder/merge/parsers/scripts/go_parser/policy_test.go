@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const policySource = `package p
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"unsafe"
+)
+
+func Run(ctx context.Context) { exec.Command("ls") }
+
+func Build() { fmt.Println(unsafe.Sizeof(0)); panic("x") }
+
+func HelperA() {}
+
+func internal() {}
+`
+
+func TestEvaluatePolicy(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"internal/p.go":      policySource,
+		"internal/p_test.go": "package p\n\nimport \"unsafe\"\n\nvar _ = unsafe.Sizeof(0)\n",
+		"cmd/main.go":        "package main\n\nimport \"unsafe\"\n\nfunc main() { _ = unsafe.Sizeof(0) }\n",
+	}
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	tests := []struct {
+		name     string
+		rule     PolicyRule
+		baseline map[string]bool
+		// Symbols or import paths of the violations, in order
+		want   []string
+		passed bool
+	}{
+		{
+			name: "deny imports",
+			rule: PolicyRule{Name: "no-unsafe", DenyImports: []string{"unsafe"}},
+			want: []string{"unsafe", "unsafe"},
+		},
+		{
+			name: "deny imports in tests",
+			rule: PolicyRule{Name: "no-unsafe", DenyImports: []string{"unsafe"}, IncludeTests: true},
+			want: []string{"unsafe", "unsafe", "unsafe"},
+		},
+		{
+			name: "deny imports under paths",
+			rule: PolicyRule{Name: "no-unsafe", DenyImports: []string{"unsafe"}, Paths: []string{filepath.ToSlash(dir) + "/internal/..."}},
+			want: []string{"unsafe"},
+		},
+		{
+			name:   "warning",
+			rule:   PolicyRule{Name: "no-unsafe", Severity: "warning", DenyImports: []string{"unsafe"}},
+			want:   []string{"unsafe", "unsafe"},
+			passed: true,
+		},
+		{
+			name: "allow imports",
+			rule: PolicyRule{Name: "std", AllowImports: []string{"context", "fmt", "os/..."}},
+			want: []string{"unsafe", "unsafe"},
+		},
+		{
+			name:     "allow imports with a baseline",
+			rule:     PolicyRule{Name: "std", AllowImports: []string{"context", "fmt", "os/..."}},
+			baseline: map[string]bool{"unsafe": true},
+			passed:   true,
+		},
+		{
+			name: "deny calls",
+			rule: PolicyRule{Name: "no-exec", DenyCalls: []string{"os/exec.*", "panic"}},
+			want: []string{"Run", "Build"},
+		},
+		{
+			name: "require context",
+			rule: PolicyRule{Name: "ctx", RequireContext: "exported", ExcludeSymbols: []string{"Helper*"}},
+			want: []string{"Build"},
+		},
+		{
+			name: "require context everywhere",
+			rule: PolicyRule{Name: "ctx", RequireContext: "all"},
+			want: []string{"Build", "HelperA", "internal"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			if rule.Severity == "" {
+				rule.Severity = "error"
+			}
+			report := evaluatePolicy(&PolicyFile{Rules: []PolicyRule{rule}}, paths, tt.baseline)
+			if len(report.Errors) > 0 {
+				t.Fatalf("errors = %+v", report.Errors)
+			}
+			got := []string{}
+			for _, violation := range report.Violations {
+				name := violation.Symbol
+				if name == "" {
+					name = strings.TrimSuffix(strings.Fields(violation.Message)[1], ",")
+				}
+				got = append(got, name)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("violations = %v, want %v", got, tt.want)
+			}
+			if report.Passed != tt.passed {
+				t.Errorf("passed = %v, want %v", report.Passed, tt.passed)
+			}
+			if len(report.Rules) != 1 || report.Rules[0].Violations != len(tt.want) {
+				t.Errorf("rule counts = %+v", report.Rules)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		error  string
+	}{
+		{"yaml", "rules:\n  - name: no-exec\n    deny_calls: [os/exec.Command]\n  - name: ctx\n    severity: warning\n    require_context: exported\n", ""},
+		{"json", `{"rules": [{"name": "no-unsafe", "deny_imports": ["unsafe"]}]}`, ""},
+		{"unknown field", "rules:\n  - name: x\n    deny_import: [unsafe]\n", "unknown field"},
+		{"no name", "rules:\n  - deny_imports: [unsafe]\n", "rule 1 has no name"},
+		{"no checks", "rules:\n  - name: x\n", "rule x has no checks"},
+		{"severity", "rules:\n  - name: x\n    severity: fatal\n    deny_imports: [unsafe]\n", "severity must be error or warning"},
+		{"require context", "rules:\n  - name: x\n    require_context: some\n", "require_context must be exported or all"},
+		{"pattern", "rules:\n  - name: x\n    deny_imports: [\"[\"]\n", "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(path, []byte(tt.policy), 0644); err != nil {
+				t.Fatal(err)
+			}
+			policy, err := loadPolicy(path)
+			switch {
+			case tt.error == "" && err != nil:
+				t.Fatalf("loadPolicy: %v", err)
+			case tt.error != "" && (err == nil || !strings.Contains(err.Error(), tt.error)):
+				t.Fatalf("loadPolicy error = %v, want %q", err, tt.error)
+			case tt.error == "":
+				for _, rule := range policy.Rules {
+					if rule.Severity != "error" && rule.Severity != "warning" {
+						t.Errorf("rule %s has severity %q", rule.Name, rule.Severity)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProvenanceRecord is an entry of the provenance store: a declaration
+// composed into File, by the hash of its code, with the candidate that
+// contributed it and the task it was merged for
+type ProvenanceRecord struct {
+	Hash      string   `json:"hash"`
+	Symbols   []string `json:"symbols"`
+	IDs       []string `json:"ids,omitempty"`
+	Kind      string   `json:"kind"`
+	Provider  string   `json:"provider"`
+	Task      string   `json:"task,omitempty"`
+	File      string   `json:"file,omitempty"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// ProvenanceQueryResult lists the records matching a query, newest first.
+// With --file, Hash is the current hash of the symbol in the file, and
+// Modified is set when the store knows the symbol only by other code, so the
+// declaration changed since it was merged.
+type ProvenanceQueryResult struct {
+	Symbol   string             `json:"symbol,omitempty"`
+	Hash     string             `json:"hash,omitempty"`
+	Records  []ProvenanceRecord `json:"records"`
+	Modified bool               `json:"modified,omitempty"`
+}
+
+// recordProvenance appends the origins of a composed file to the store at
+// path, a file of JSON records, one per line, created if it does not exist
+func recordProvenance(path string, result *ComposeResult, task string) error {
+	store, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	encoder := json.NewEncoder(store)
+	for _, decl := range result.Declarations {
+		record := ProvenanceRecord{Hash: decl.Hash, Symbols: decl.Symbols, IDs: decl.IDs, Kind: decl.Kind, Provider: decl.Candidate, Task: task, File: result.Output, Timestamp: timestamp}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadProvenance reads the records of the store at path
+func loadProvenance(path string) ([]ProvenanceRecord, error) {
+	store, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	records := []ProvenanceRecord{}
+	scanner := bufio.NewScanner(store)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record ProvenanceRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func runProvenance(args []string) int {
+	if len(args) == 0 || args[0] != "query" {
+		return fail("Usage: provenance query --db provenance.jsonl [--file merged.go] [--symbol Name] [--hash h] [--id symbol-id] [--provider name] [--task id]")
+	}
+
+	var dbPath, filePath string
+	var filter ProvenanceRecord
+	symbol, id := "", ""
+	flags := flag.NewFlagSet("provenance query", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&dbPath, "db", "", "provenance store written by compose --provenance-db")
+	flags.StringVar(&filePath, "file", "", "look the symbol up by its current code in this file")
+	flags.StringVar(&symbol, "symbol", "", "symbol to look up, e.g. ParseConfig or Server.Start")
+	flags.StringVar(&filter.Hash, "hash", "", "declaration hash to look up")
+	flags.StringVar(&id, "id", "", "persistent symbol ID to look up, which renames keep")
+	flags.StringVar(&filter.Provider, "provider", "", "only records of this provider")
+	flags.StringVar(&filter.Task, "task", "", "only records of this task")
+
+	positional, err := parseFlags(flags, args[1:])
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if dbPath == "" || len(positional) > 0 {
+		return fail("Usage: provenance query --db provenance.jsonl [--file merged.go] [--symbol Name] [--hash h] [--id symbol-id] [--provider name] [--task id]")
+	}
+	if filePath != "" && symbol == "" {
+		return fail("--file needs a --symbol to look up")
+	}
+
+	records, err := loadProvenance(dbPath)
+	if err != nil {
+		return fail("Failed to read provenance store: %v", err)
+	}
+
+	result := &ProvenanceQueryResult{Symbol: normalizeSymbolName(symbol), Records: []ProvenanceRecord{}}
+	if filePath != "" {
+		file, err := loadEditFile(filePath)
+		if err != nil {
+			return fail("Failed to load %s: %v", filePath, err)
+		}
+		decl := findDeclaring(file.file, result.Symbol)
+		if decl == nil {
+			return fail("%s is not declared in %s", result.Symbol, filePath)
+		}
+		result.Hash = declHash(file, decl)
+		filter.Hash = result.Hash
+	}
+
+	known, current := false, false
+	// Later lines are newer, which the sort keeps for equal timestamps
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if symbol != "" && !contains(record.Symbols, result.Symbol) {
+			continue
+		}
+		known = true
+		current = current || record.Hash == result.Hash
+		if (filter.Hash == "" || record.Hash == filter.Hash) && (id == "" || contains(record.IDs, id)) && (filter.Provider == "" || record.Provider == filter.Provider) && (filter.Task == "" || record.Task == filter.Task) {
+			result.Records = append(result.Records, record)
+		}
+	}
+	result.Modified = filePath != "" && known && !current
+
+	// RFC 3339 timestamps in UTC sort as strings
+	sort.SliceStable(result.Records, func(i, j int) bool { return result.Records[i].Timestamp > result.Records[j].Timestamp })
+	return printJSON(result)
+}
+
+// findDeclaring returns the top-level declaration that declares name, the
+// whole group for a name in a parenthesized one, as compose hashes it
+func findDeclaring(file *ast.File, name string) ast.Decl {
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if symbolName(d) == name {
+				return d
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				if contains(specNames(spec), name) {
+					return d
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// purePackages are the standard packages whose functions only compute on
+// their arguments. fmt is limited to its formatting functions.
+var purePackages = map[string]bool{
+	"bytes": true, "errors": true, "maps": true, "math": true, "math/bits": true,
+	"path": true, "slices": true, "sort": true, "strconv": true, "strings": true,
+	"unicode": true, "unicode/utf16": true, "unicode/utf8": true,
+}
+
+// pureBuiltins are the builtin functions and the predeclared types, whose
+// conversions are calls too, that have no effect outside the function
+var pureBuiltins = map[string]bool{
+	"append": true, "cap": true, "clear": true, "complex": true, "copy": true, "delete": true,
+	"imag": true, "len": true, "make": true, "max": true, "min": true, "new": true,
+	"panic": true, "real": true, "recover": true,
+	"bool": true, "byte": true, "complex64": true, "complex128": true, "error": true,
+	"float32": true, "float64": true, "int": true, "int8": true, "int16": true, "int32": true,
+	"int64": true, "rune": true, "string": true, "uint": true, "uint8": true, "uint16": true,
+	"uint32": true, "uint64": true, "uintptr": true, "any": true,
+}
+
+var pureFmtFunctions = map[string]bool{"Sprint": true, "Sprintf": true, "Sprintln": true, "Errorf": true}
+
+// impurityReasons checks each top-level function of a file without a
+// receiver for purity, as far as the file alone can tell: a pure function
+// neither reads nor writes package variables, starts goroutines, uses
+// channels or calls anything but pure standard functions and other pure
+// functions of the file. Methods called on local values are trusted, since
+// their receivers were built by the function. The result maps every such
+// function to why it is impure, or to "" when it is pure.
+func impurityReasons(file *ast.File) map[string]string {
+	importPaths := map[string]string{}
+	for _, imp := range file.Imports {
+		importPath := strings.Trim(imp.Path.Value, "\"`")
+		name := importPath[strings.LastIndex(importPath, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		importPaths[name] = importPath
+	}
+
+	funcs := map[string]*ast.FuncDecl{}
+	order := []string{}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name != "_" {
+			if _, seen := funcs[fn.Name.Name]; !seen {
+				order = append(order, fn.Name.Name)
+			}
+			funcs[fn.Name.Name] = fn
+		}
+	}
+
+	// Direct reasons first, then impurity spreads to callers until nothing
+	// changes
+	reasons := map[string]string{}
+	callees := map[string][]string{}
+	for _, name := range order {
+		reasons[name], callees[name] = directImpurity(file, funcs[name], funcs, importPaths)
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, name := range order {
+			if reasons[name] != "" {
+				continue
+			}
+			for _, callee := range callees[name] {
+				if reasons[callee] != "" {
+					reasons[name] = "calls impure function " + callee
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return reasons
+}
+
+// directImpurity returns the first impure thing fn's body does itself, and
+// the functions of the file it calls
+func directImpurity(file *ast.File, fn *ast.FuncDecl, funcs map[string]*ast.FuncDecl, importPaths map[string]string) (string, []string) {
+	if fn.Body == nil {
+		return "has no body", nil
+	}
+	reason := ""
+	calls := []string{}
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if reason != "" {
+			return false
+		}
+		switch node := n.(type) {
+		case *ast.GoStmt:
+			reason = "starts a goroutine"
+		case *ast.SelectStmt:
+			reason = "selects on channels"
+		case *ast.SendStmt:
+			reason = "sends on a channel"
+		case *ast.UnaryExpr:
+			if node.Op == token.ARROW {
+				reason = "receives from a channel"
+			}
+		case *ast.ChanType:
+			reason = "uses channels"
+		case *ast.Ident:
+			if obj := file.Scope.Lookup(node.Name); obj != nil && obj == node.Obj && obj.Kind == ast.Var {
+				reason = "uses package variable " + node.Name
+			}
+		case *ast.CallExpr:
+			switch fun := node.Fun.(type) {
+			case *ast.Ident:
+				switch {
+				case fun.Obj != nil:
+					if _, ok := funcs[fun.Name]; ok && file.Scope.Lookup(fun.Name) == fun.Obj {
+						calls = append(calls, fun.Name)
+					}
+				case fun.Name == "print" || fun.Name == "println":
+					reason = "calls " + fun.Name
+				case !pureBuiltins[fun.Name]:
+					reason = "calls " + fun.Name + ", declared in another file"
+				}
+			case *ast.SelectorExpr:
+				x, ok := fun.X.(*ast.Ident)
+				if !ok || x.Obj != nil {
+					break
+				}
+				importPath, imported := importPaths[x.Name]
+				switch {
+				case !imported:
+					reason = "uses " + x.Name + ", declared in another file"
+				case !purePackages[importPath] && !(importPath == "fmt" && pureFmtFunctions[fun.Sel.Name]):
+					reason = fmt.Sprintf("calls %s.%s", importPath, fun.Sel.Name)
+				}
+			}
+		}
+		return true
+	})
+	return reason, calls
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// RecoveredOutline is the best-effort structure of a file go/parser
+// rejects, for targeting repairs: the declarations found by scanning the
+// tokens, the parser's errors and the spans it could not make sense of.
+//
+// A tree-sitter grammar would recover more, but needs cgo and third-party
+// code this parser does without; the token scan relies on top-level
+// declarations starting in column 1, as gofmt writes them, to resynchronize
+// after unbalanced braces.
+type RecoveredOutline struct {
+	Entries  []OutlineEntry `json:"entries"`
+	Errors   []Diagnostic   `json:"errors"`
+	BadNodes []BadNode      `json:"bad_nodes"`
+}
+
+// BadNode is a span the parser replaced with a placeholder. Kind is decl,
+// stmt or expr.
+type BadNode struct {
+	Kind    string `json:"kind"`
+	Line    int    `json:"line"`
+	EndLine int    `json:"end_line"`
+}
+
+// recoverOutline returns the recovered structure of source, or nil when
+// source parses
+func recoverOutline(source []byte) *RecoveredOutline {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", source, parser.AllErrors|parser.SkipObjectResolution)
+	if err == nil {
+		return nil
+	}
+
+	outline := &RecoveredOutline{Entries: scanDeclarations(source), Errors: []Diagnostic{}, BadNodes: []BadNode{}}
+	if list, ok := err.(scanner.ErrorList); ok {
+		for _, e := range list {
+			outline.Errors = append(outline.Errors, syntaxDiagnostic(e.Pos.Line, e.Pos.Column, e.Msg))
+		}
+	} else {
+		outline.Errors = append(outline.Errors, syntaxDiagnostic(0, 0, err.Error()))
+	}
+
+	if file != nil {
+		ast.Inspect(file, func(n ast.Node) bool {
+			kind := ""
+			switch n.(type) {
+			case *ast.BadDecl:
+				kind = "decl"
+			case *ast.BadStmt:
+				kind = "stmt"
+			case *ast.BadExpr:
+				kind = "expr"
+			default:
+				return true
+			}
+			span := sourceSpan(fset, n)
+			outline.BadNodes = append(outline.BadNodes, BadNode{Kind: kind, Line: span.Line, EndLine: span.EndLine})
+			return true
+		})
+	}
+	return outline
+}
+
+// scanDeclarations finds the top-level declarations of source from its
+// tokens alone. Each entry runs until the next declaration, and its
+// signature is the text of its first line up to the opening brace of a body.
+func scanDeclarations(source []byte) []OutlineEntry {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(source))
+	var s scanner.Scanner
+	s.Init(file, source, func(token.Position, string) {}, 0)
+
+	lines := strings.Split(string(source), "\n")
+	signature := func(line int) string {
+		return strings.TrimSpace(lines[line-1])
+	}
+
+	entries := []OutlineEntry{}
+	current := -1
+	braces, parens := 0, 0
+	// Set between a declaration keyword and the name it declares
+	pending, kind, receiver := false, "", ""
+	// Set inside a type, var or const group while at the start of a spec
+	group, specStart := "", false
+
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		position := file.Position(pos)
+
+		declKeyword := tok == token.FUNC || tok == token.TYPE || tok == token.VAR || tok == token.CONST || tok == token.IMPORT
+		if declKeyword && position.Column == 1 {
+			braces, parens, group = 0, 0, ""
+		}
+		topLevel := braces == 0 && parens == 0
+
+		startsDecl := (declKeyword && topLevel) || (group != "" && specStart && tok == token.IDENT)
+		if current >= 0 && tok != token.SEMICOLON && !startsDecl {
+			end := min(file.Offset(pos)+max(len(lit), len(tok.String())), len(source))
+			entries[current].EndLine = file.Position(file.Pos(end)).Line
+			if tok == token.LBRACE && topLevel && position.Line == entries[current].Line {
+				entries[current].Signature = strings.TrimSpace(lines[position.Line-1][:position.Column-1])
+			}
+		}
+
+		switch {
+		case declKeyword && topLevel:
+			pending, kind, receiver = tok != token.IMPORT, strings.ToLower(tok.String()), ""
+			current = -1
+
+		case pending && kind == "func" && tok == token.LPAREN && receiver == "" && parens == 0:
+			receiver = scanReceiver(&s)
+			continue
+
+		case pending && tok == token.LPAREN && kind != "func":
+			group, specStart, pending = kind, true, false
+			parens++
+			continue
+
+		case pending && tok == token.IDENT:
+			name, entryKind := lit, kind
+			if receiver != "" {
+				name, entryKind = receiver+"."+lit, "method"
+			}
+			entries = append(entries, OutlineEntry{Name: name, Kind: entryKind, Signature: signature(position.Line), Line: position.Line, EndLine: position.Line})
+			current = len(entries) - 1
+			pending = false
+
+		case group != "" && specStart && tok == token.IDENT && braces == 0 && parens == 1:
+			entries = append(entries, OutlineEntry{Name: lit, Kind: group, Signature: group + " " + signature(position.Line), Line: position.Line, EndLine: position.Line})
+			current = len(entries) - 1
+		}
+
+		specStart = group != "" && tok == token.SEMICOLON && parens == 1
+		switch tok {
+		case token.LBRACE:
+			braces++
+		case token.RBRACE:
+			braces = max(0, braces-1)
+		case token.LPAREN:
+			parens++
+		case token.RPAREN:
+			parens = max(0, parens-1)
+			if parens == 0 {
+				group = ""
+			}
+		}
+	}
+	return entries
+}
+
+// scanReceiver consumes a method receiver after its opening parenthesis and
+// returns the receiver's type name
+func scanReceiver(s *scanner.Scanner) string {
+	name, depth := "", 1
+	for depth > 0 {
+		_, tok, lit := s.Scan()
+		switch tok {
+		case token.EOF:
+			return name
+		case token.LPAREN:
+			depth++
+		case token.RPAREN:
+			depth--
+		case token.LBRACK:
+			// Type parameters of a generic receiver follow its name
+			depth++
+			for depth > 1 {
+				_, tok, _ := s.Scan()
+				switch tok {
+				case token.EOF:
+					return name
+				case token.LBRACK:
+					depth++
+				case token.RBRACK:
+					depth--
+				}
+			}
+		case token.IDENT:
+			name = lit
+		}
+	}
+	return name
+}
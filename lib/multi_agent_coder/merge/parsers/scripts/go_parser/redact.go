@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RedactionRules is the --rules file of the redact transform. Each rule's
+// pattern is a regular expression matched against the value of every string
+// literal; the parts it matches are replaced with a placeholder.
+type RedactionRules struct {
+	Rules []RedactionRule `json:"rules"`
+}
+
+// RedactionRule names a kind of sensitive value, such as connection_string
+// or customer_id; the name goes into the placeholders
+type RedactionRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// RedactionMapping is the --mapping file: every placeholder handed out and
+// the value it stands for, so a provider's response can be restored with
+// unredact. An existing mapping is extended, keeping its placeholders.
+type RedactionMapping struct {
+	Redactions []Redaction `json:"redactions"`
+}
+
+// Redaction is one redacted value and the files it was found in
+type Redaction struct {
+	Placeholder string   `json:"placeholder"`
+	Rule        string   `json:"rule"`
+	Value       string   `json:"value"`
+	Files       []string `json:"files"`
+}
+
+// placeholderName turns a rule name into the stem of its placeholders:
+// customer-id gives REDACTED_CUSTOMER_ID
+var placeholderName = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// loadRedactionRules reads a rules file, YAML or JSON, rejecting unknown
+// fields so that a misspelled key does not leave values unmasked
+func loadRedactionRules(path string) (*RedactionRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	rules := &RedactionRules{}
+	if err := decoder.Decode(rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		if rule.Name == "" || rule.Pattern == "" {
+			return nil, fmt.Errorf("%s: rule %d needs a name and a pattern", path, i+1)
+		}
+		if rule.re, err = regexp.Compile(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("%s: rule %s: %v", path, rule.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+// loadRedactionMapping reads the mapping at path, or starts an empty one when
+// the file does not exist yet
+func loadRedactionMapping(path string) (*RedactionMapping, error) {
+	mapping := &RedactionMapping{Redactions: []Redaction{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return mapping, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, mapping); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return mapping, nil
+}
+
+// redact replaces the parts of string literals and comments matched by the rules with
+// placeholders, the same value always getting the same placeholder, and
+// records them in the mapping file. The mapping is written even with
+// --dry-run, since the source in the output cannot be restored without it.
+func redact(file *editFile, opts transformOptions) (string, []string, error) {
+	if opts.rules == "" || opts.mapping == "" {
+		return "", nil, fmt.Errorf("redact needs --rules and --mapping")
+	}
+	rules, err := loadRedactionRules(opts.rules)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid rules: %v", err)
+	}
+	mapping, err := loadRedactionMapping(opts.mapping)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid mapping: %v", err)
+	}
+
+	byValue := map[[2]string]int{}
+	counts := map[string]int{}
+	for i, r := range mapping.Redactions {
+		byValue[[2]string{r.Rule, r.Value}] = i
+		counts[r.Rule]++
+	}
+	placeholder := func(rule, value string) string {
+		key := [2]string{rule, value}
+		i, ok := byValue[key]
+		if !ok {
+			counts[rule]++
+			stem := strings.ToUpper(strings.Trim(placeholderName.ReplaceAllString(rule, "_"), "_"))
+			i = len(mapping.Redactions)
+			byValue[key] = i
+			mapping.Redactions = append(mapping.Redactions, Redaction{Placeholder: fmt.Sprintf("REDACTED_%s_%d", stem, counts[rule]), Rule: rule, Value: value, Files: []string{}})
+		}
+		r := &mapping.Redactions[i]
+		if !contains(r.Files, file.path) {
+			r.Files = append(r.Files, file.path)
+		}
+		return r.Placeholder
+	}
+
+	changes := []string{}
+	mask := func(text string, line int) string {
+		for _, rule := range rules.Rules {
+			text = rule.re.ReplaceAllStringFunc(text, func(match string) string {
+				name := placeholder(rule.Name, match)
+				changes = append(changes, fmt.Sprintf("redacted %s value at line %d as %s", rule.Name, line, name))
+				return name
+			})
+		}
+		return text
+	}
+	source := rewriteStringLiterals(file, func(lit *ast.BasicLit, value string) string {
+		return mask(value, file.fset.Position(lit.Pos()).Line)
+	})
+	source = rewriteComments(file.path, source, func(comment *ast.Comment, line int) string {
+		return mask(comment.Text, line)
+	})
+
+	data, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.WriteFile(opts.mapping, append(data, '\n'), 0o600); err != nil {
+		return "", nil, fmt.Errorf("failed to write mapping: %v", err)
+	}
+	return source, changes, nil
+}
+
+// unredact puts back the values of the mapping's placeholders, quoted as
+// their literal needs, in string literals and comments
+func unredact(file *editFile, opts transformOptions) (string, []string, error) {
+	if opts.mapping == "" {
+		return "", nil, fmt.Errorf("unredact needs --mapping")
+	}
+	data, err := os.ReadFile(opts.mapping)
+	if err != nil {
+		return "", nil, err
+	}
+	mapping := &RedactionMapping{}
+	if err := json.Unmarshal(data, mapping); err != nil {
+		return "", nil, fmt.Errorf("invalid mapping: %v", err)
+	}
+
+	// Longest first, so REDACTED_X_1 does not match inside REDACTED_X_10
+	redactions := append([]Redaction{}, mapping.Redactions...)
+	sort.Slice(redactions, func(i, j int) bool {
+		return len(redactions[i].Placeholder) > len(redactions[j].Placeholder)
+	})
+	changes := []string{}
+	restore := func(text string, line int) string {
+		for _, r := range redactions {
+			if strings.Contains(text, r.Placeholder) {
+				text = strings.ReplaceAll(text, r.Placeholder, r.Value)
+				changes = append(changes, fmt.Sprintf("restored %s at line %d", r.Placeholder, line))
+			}
+		}
+		return text
+	}
+
+	source := rewriteStringLiterals(file, func(lit *ast.BasicLit, value string) string {
+		return restore(value, file.fset.Position(lit.Pos()).Line)
+	})
+	source = rewriteComments(file.path, source, func(comment *ast.Comment, line int) string {
+		return restore(comment.Text, line)
+	})
+	return source, changes, nil
+}
+
+// rewriteStringLiterals passes the value of every string literal of the file
+// to rewrite and requotes the literals whose value it changes, as raw strings
+// when they were raw and the new value allows it
+func rewriteStringLiterals(file *editFile, rewrite func(lit *ast.BasicLit, value string) string) string {
+	type splice struct {
+		start, end int
+		text       string
+	}
+	splices := []splice{}
+	ast.Inspect(file.file, func(n ast.Node) bool {
+		lit, ok := n.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		value, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		next := rewrite(lit, value)
+		if next == value {
+			return true
+		}
+		text := strconv.Quote(next)
+		if strings.HasPrefix(lit.Value, "`") && !strings.ContainsAny(next, "`\r") {
+			text = "`" + next + "`"
+		}
+		splices = append(splices, splice{file.offset(lit.Pos()), file.offset(lit.End()), text})
+		return true
+	})
+
+	source := file.source
+	for i := len(splices) - 1; i >= 0; i-- {
+		s := splices[i]
+		source = source[:s.start] + s.text + source[s.end:]
+	}
+	return source
+}
+
+// rewriteComments parses source and replaces the text of each comment with
+// what rewrite returns for it; source that does not parse is left as it is
+func rewriteComments(path, source string, rewrite func(comment *ast.Comment, line int) string) string {
+	file, err := parseEditSource(path, source)
+	if err != nil {
+		return source
+	}
+	type splice struct {
+		start, end int
+		text       string
+	}
+	splices := []splice{}
+	for _, group := range file.file.Comments {
+		for _, comment := range group.List {
+			if text := rewrite(comment, file.fset.Position(comment.Pos()).Line); text != comment.Text {
+				splices = append(splices, splice{file.offset(comment.Pos()), file.offset(comment.End()), text})
+			}
+		}
+	}
+	for i := len(splices) - 1; i >= 0; i-- {
+		s := splices[i]
+		source = source[:s.start] + s.text + source[s.end:]
+	}
+	return source
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"go/ast"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ReferencedDoc is the documentation of a package-level symbol of another
+// package that the file uses
+type ReferencedDoc struct {
+	Package   string `json:"package"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+}
+
+// findReferencedDocs resolves the pkg.Name selectors of file against the
+// standard library, the enclosing module and the module cache. Imports that
+// cannot be found locally are skipped; nothing is downloaded.
+func findReferencedDocs(file *ast.File, path string) []ReferencedDoc {
+	dir := filepath.Dir(path)
+	packages := map[string]*PackageAPI{}
+	for _, imp := range file.Imports {
+		importPath := strings.Trim(imp.Path.Value, `"`)
+		if importPath == "C" || (imp.Name != nil && (imp.Name.Name == "_" || imp.Name.Name == ".")) {
+			continue
+		}
+		source := packageSourceDir(importPath, dir)
+		if source == "" {
+			continue
+		}
+		api, err := summarizePackage(source, importPath, true)
+		if err != nil || api == nil {
+			continue
+		}
+		name := api.Name
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		packages[name] = api
+	}
+
+	seen := map[string]bool{}
+	docs := []ReferencedDoc{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		// A resolved object means a local shadows the package name
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || x.Obj != nil || packages[x.Name] == nil {
+			return true
+		}
+		api := packages[x.Name]
+		key := api.Path + "." + sel.Sel.Name
+		if seen[key] {
+			return true
+		}
+		seen[key] = true
+		if doc, ok := lookupAPI(api, sel.Sel.Name); ok {
+			docs = append(docs, doc)
+		}
+		return true
+	})
+
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Package != docs[j].Package {
+			return docs[i].Package < docs[j].Package
+		}
+		return docs[i].Name < docs[j].Name
+	})
+	return docs
+}
+
+// lookupAPI finds a package-level symbol in a package summary
+func lookupAPI(api *PackageAPI, name string) (ReferencedDoc, bool) {
+	doc := ReferencedDoc{Package: api.Path, Name: name}
+	symbol := func(kind string, s APISymbol) (ReferencedDoc, bool) {
+		doc.Kind, doc.Signature, doc.Doc = kind, s.Signature, s.Doc
+		return doc, true
+	}
+
+	for _, fn := range api.Functions {
+		if fn.Name == name {
+			return symbol("func", fn)
+		}
+	}
+	for _, t := range api.Types {
+		if t.Name == name {
+			return symbol("type", APISymbol{Signature: t.Signature, Doc: t.Doc})
+		}
+		for _, fn := range t.Constructors {
+			if fn.Name == name {
+				return symbol("func", fn)
+			}
+		}
+	}
+	for _, value := range api.Constants {
+		if contains(value.Names, name) {
+			return symbol("const", APISymbol{Signature: value.Signature, Doc: value.Doc})
+		}
+	}
+	for _, value := range api.Variables {
+		if contains(value.Names, name) {
+			return symbol("var", APISymbol{Signature: value.Signature, Doc: value.Doc})
+		}
+	}
+	return doc, false
+}
+
+// packageSourceDir finds the source directory of importPath as seen from
+// dir: in GOROOT for the standard library, in the enclosing module for its
+// own packages, and otherwise in the module cache at the version go.mod
+// requires (or the newest cached one). It returns "" when not found.
+func packageSourceDir(importPath, dir string) string {
+	if isStdlibPath(importPath) {
+		return filepath.Join(goRoot(), "src", filepath.FromSlash(importPath))
+	}
+
+	root, modulePath, _ := findModule(dir)
+	if modulePath != "" && (importPath == modulePath || strings.HasPrefix(importPath, modulePath+"/")) {
+		return filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(importPath, modulePath)))
+	}
+
+	var requires map[string]string
+	if root != "" {
+		requires, _ = readModuleRequires(filepath.Join(root, "go.mod"))
+	}
+
+	// The module is the longest prefix of the import path that resolves
+	for prefix := importPath; prefix != "." && prefix != "/"; prefix = filepath.ToSlash(filepath.Dir(prefix)) {
+		spec := prefix
+		if version := requires[prefix]; version != "" {
+			spec += "@" + version
+		}
+		if moduleDir, _, err := findCachedModule(spec); err == nil {
+			return filepath.Join(moduleDir, filepath.FromSlash(strings.TrimPrefix(importPath, prefix)))
+		}
+	}
+	return ""
+}
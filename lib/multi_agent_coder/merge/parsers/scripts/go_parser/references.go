@@ -0,0 +1,193 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// SymbolReference is a use of a declaration found in the analyzed file set.
+// In names the top-level declaration containing the use.
+type SymbolReference struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	In     string `json:"in,omitempty"`
+}
+
+// referenceTarget describes the declaration being looked up
+type referenceTarget struct {
+	name       string // identifier to match, the method name for methods
+	method     bool
+	pkgName    string
+	dir        string // absolute directory of the declaring package
+	importPath string
+	// file and range of the declaration itself, which is not a reference
+	file       string
+	start, end int
+}
+
+// newReferenceTarget builds the lookup for decl, declared in file
+func newReferenceTarget(file *editFile, decl *symbolDecl) (*referenceTarget, error) {
+	abs, err := filepath.Abs(file.path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(abs)
+
+	root, modulePath, err := findModule(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := file.declRange(decl, true)
+	target := &referenceTarget{
+		name:       decl.name,
+		pkgName:    file.file.Name.Name,
+		dir:        dir,
+		importPath: packageImportPath(root, modulePath, dir),
+		file:       abs,
+		start:      start,
+		end:        end,
+	}
+	if decl.kind == "method" {
+		target.name = decl.fn.Name.Name
+		target.method = true
+	}
+	return target, nil
+}
+
+// findReferences lists the uses of target in paths, failing on a file that
+// does not parse
+func findReferences(paths []string, target *referenceTarget) ([]SymbolReference, error) {
+	refs := []SymbolReference{}
+	fset := token.NewFileSet()
+
+	for _, path := range paths {
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, fileReferences(fset, path, file, target)...)
+	}
+	return refs, nil
+}
+
+// fileReferences lists the uses of target in file, parsed from path into
+// fset. Matching is by name, so it errs on the side of reporting: any
+// selector with a method's name counts as a use of that method, and
+// shadowing locals count as uses too.
+func fileReferences(fset *token.FileSet, path string, file *ast.File, target *referenceTarget) []SymbolReference {
+	refs := []SymbolReference{}
+	abs, _ := filepath.Abs(path)
+	samePackage := filepath.Dir(abs) == target.dir && file.Name.Name == target.pkgName
+	if !samePackage && !target.method && !isExported(target.name) {
+		return refs
+	}
+
+	// Local names this file imports the target's package under
+	qualifiers := map[string]bool{}
+	for _, imp := range file.Imports {
+		path := strings.Trim(imp.Path.Value, `"`)
+		if path != target.importPath {
+			continue
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		qualifiers[name] = true
+	}
+	if !samePackage && !target.method && len(qualifiers) == 0 {
+		return refs
+	}
+
+	record := func(node ast.Node, in string) {
+		pos := fset.Position(node.Pos())
+		if abs == target.file && pos.Offset >= target.start && pos.Offset < target.end {
+			return
+		}
+		refs = append(refs, SymbolReference{File: path, Line: pos.Line, Column: pos.Column, In: in})
+	}
+
+	for _, decl := range file.Decls {
+		in := declName(decl)
+
+		var visit func(n ast.Node) bool
+		visit = func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.SelectorExpr:
+				if node.Sel.Name == target.name {
+					x, isIdent := node.X.(*ast.Ident)
+					if target.method || (isIdent && qualifiers[x.Name]) {
+						record(node.Sel, in)
+					}
+				}
+				ast.Inspect(node.X, visit)
+				return false
+
+			case *ast.Field:
+				// Field and parameter names declare, they do not refer
+				if node.Type != nil {
+					ast.Inspect(node.Type, visit)
+				}
+				return false
+
+			case *ast.Ident:
+				if samePackage && !target.method && node.Name == target.name {
+					record(node, in)
+				}
+			}
+			return true
+		}
+
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			// The declared name itself is not a use
+			if d.Recv != nil {
+				ast.Inspect(d.Recv, visit)
+			}
+			ast.Inspect(d.Type, visit)
+			if d.Body != nil {
+				ast.Inspect(d.Body, visit)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.TypeParams != nil {
+						ast.Inspect(s.TypeParams, visit)
+					}
+					ast.Inspect(s.Type, visit)
+				case *ast.ValueSpec:
+					if s.Type != nil {
+						ast.Inspect(s.Type, visit)
+					}
+					for _, value := range s.Values {
+						ast.Inspect(value, visit)
+					}
+				}
+			}
+		}
+	}
+
+	return refs
+}
+
+// declName names a top-level declaration for reporting, as symbolName does
+// for functions; grouped declarations are named by their first spec
+func declName(decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return symbolName(d)
+	case *ast.GenDecl:
+		if len(d.Specs) > 0 {
+			if names := specNames(d.Specs[0]); len(names) > 0 && d.Tok != token.IMPORT {
+				return names[0]
+			}
+		}
+	}
+	return ""
+}
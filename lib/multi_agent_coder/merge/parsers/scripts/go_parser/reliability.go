@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// ReliabilityRisk is a construct likely to hang a request or leak a
+// goroutine. Kind is blocking_in_handler, for an operation that can block an
+// HTTP handler indefinitely, or goroutine_leak, for a goroutine looping
+// forever with no way to stop it.
+type ReliabilityRisk struct {
+	Kind     string `json:"kind"`
+	Function string `json:"function"`
+	Line     int    `json:"line"`
+	Call     string `json:"call"`
+	Message  string `json:"message"`
+
+	span SourceSpan
+}
+
+// defaultClientCalls use http.DefaultClient, which has no timeout
+var defaultClientCalls = []string{"Get", "Head", "Post", "PostForm"}
+
+// findReliabilityRisks inspects the HTTP handlers of the file, recognized by
+// their (http.ResponseWriter, *http.Request) parameters, and the goroutines
+// it starts
+func findReliabilityRisks(fset *token.FileSet, file *ast.File) []ReliabilityRisk {
+	risks := []ReliabilityRisk{}
+	httpName := ""
+	for _, imp := range file.Imports {
+		if strings.Trim(imp.Path.Value, `"`) == "net/http" {
+			info := importInfo{path: "net/http"}
+			if imp.Name != nil {
+				info.name = imp.Name.Name
+			}
+			httpName = info.localName()
+		}
+	}
+
+	funcs := map[string]*ast.FuncDecl{}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+			funcs[symbolName(fn)] = fn
+		}
+	}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		name := symbolName(fn)
+		add := func(kind string, node ast.Node, call, message string) {
+			risks = append(risks, ReliabilityRisk{Kind: kind, Function: name, Line: fset.Position(node.Pos()).Line, Call: call, Message: message, span: sourceSpan(fset, node)})
+		}
+
+		if httpName != "" && isHTTPHandler(fn.Type, httpName) {
+			findBlockingCalls(fn.Body, httpName, add)
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.FuncLit:
+				if httpName != "" && isHTTPHandler(node.Type, httpName) {
+					findBlockingCalls(node.Body, httpName, add)
+				}
+			case *ast.GoStmt:
+				var body *ast.BlockStmt
+				target := types.ExprString(node.Call.Fun)
+				switch fun := node.Call.Fun.(type) {
+				case *ast.FuncLit:
+					body, target = fun.Body, "func literal"
+				case *ast.Ident:
+					if decl := funcs[fun.Name]; decl != nil {
+						body = decl.Body
+					}
+				}
+				if body != nil {
+					if loop := endlessLoop(body); loop != nil {
+						add("goroutine_leak", node, "go "+target, fmt.Sprintf("goroutine loops forever from line %d with no return, break or exit; select on a context's Done channel or a quit channel so it can stop", fset.Position(loop.Pos()).Line))
+					}
+				}
+			}
+			return true
+		})
+	}
+	return risks
+}
+
+// isHTTPHandler reports whether a function takes an http.ResponseWriter and
+// an *http.Request
+func isHTTPHandler(fn *ast.FuncType, httpName string) bool {
+	writer, request := false, false
+	for _, field := range fn.Params.List {
+		switch types.ExprString(field.Type) {
+		case httpName + ".ResponseWriter":
+			writer = true
+		case "*" + httpName + ".Request":
+			request = true
+		}
+	}
+	return writer && request
+}
+
+// findBlockingCalls reports operations in a handler body that wait without a
+// bound: sleeps, channel operations outside a select that has a default,
+// timeout or cancellation case, Wait calls and requests through the
+// default client. Goroutines and closures started from the handler are not
+// on its path and are skipped.
+func findBlockingCalls(body *ast.BlockStmt, httpName string, add func(kind string, node ast.Node, call, message string)) {
+	blocking := func(node ast.Node, call, message string) {
+		add("blocking_in_handler", node, call, message)
+	}
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.FuncLit, *ast.GoStmt:
+			return false
+
+		case *ast.SelectStmt:
+			if !boundedSelect(node) {
+				blocking(node, "select", "select with no default, timeout or cancellation case can block the handler forever; add a case on r.Context().Done()")
+			}
+			// The cases' channel operations are bounded by the select itself
+			for _, clause := range node.Body.List {
+				for _, stmt := range clause.(*ast.CommClause).Body {
+					findBlockingCalls(&ast.BlockStmt{List: []ast.Stmt{stmt}}, httpName, add)
+				}
+			}
+			return false
+
+		case *ast.UnaryExpr:
+			if node.Op == token.ARROW && !isTimeoutChannel(node.X) {
+				blocking(node, "<-"+types.ExprString(node.X), "unbounded channel receive; select on it together with r.Context().Done() or a timer")
+			}
+
+		case *ast.SendStmt:
+			blocking(node, types.ExprString(node.Chan)+" <-", "unbounded channel send; select on it together with r.Context().Done() or a timer")
+
+		case *ast.CallExpr:
+			sel, ok := node.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			call := types.ExprString(node.Fun)
+			switch {
+			case call == "time.Sleep":
+				blocking(node, call, "time.Sleep holds the request goroutine; wait on a timer in a select with r.Context().Done() instead")
+			case sel.Sel.Name == "Wait" && len(node.Args) == 0:
+				blocking(node, call, "Wait has no timeout; bound the work with the request context")
+			case isIdent(sel.X, httpName) && contains(defaultClientCalls, sel.Sel.Name):
+				blocking(node, call, "the default HTTP client has no timeout; use a client with Timeout set or a request built with r.Context()")
+			}
+		}
+		return true
+	})
+}
+
+// boundedSelect reports whether a select has a default case or a case on a
+// Done channel, time.After or a timer
+func boundedSelect(sel *ast.SelectStmt) bool {
+	for _, clause := range sel.Body.List {
+		comm := clause.(*ast.CommClause).Comm
+		if comm == nil {
+			return true
+		}
+		bounded := false
+		ast.Inspect(comm, func(n ast.Node) bool {
+			if unary, ok := n.(*ast.UnaryExpr); ok && unary.Op == token.ARROW && isTimeoutChannel(unary.X) {
+				bounded = true
+			}
+			return !bounded
+		})
+		if bounded {
+			return true
+		}
+	}
+	return false
+}
+
+// isTimeoutChannel recognizes ctx.Done(), time.After(d), time.Tick(d) and
+// the C field of timers and tickers
+func isTimeoutChannel(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.CallExpr:
+		name := types.ExprString(e.Fun)
+		return strings.HasSuffix(name, ".Done") || name == "time.After" || name == "time.Tick"
+	case *ast.SelectorExpr:
+		return e.Sel.Name == "C"
+	}
+	return false
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+// endlessLoop returns the first condition-less for loop of body, outside
+// closures, that nothing leaves: no return, no break or goto out of it and
+// no call to panic, os.Exit, log.Fatal or runtime.Goexit
+func endlessLoop(body *ast.BlockStmt) *ast.ForStmt {
+	var found *ast.ForStmt
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found != nil {
+			return false
+		}
+		switch node := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ForStmt:
+			if node.Cond == nil && !loopExits(node) {
+				found = node
+				return false
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// loopExits reports whether anything in loop leaves it. Unlabeled breaks
+// count when they are not inside a nested for, switch or select.
+func loopExits(loop *ast.ForStmt) bool {
+	exits := false
+	var visit func(n ast.Node, nested bool)
+	visit = func(root ast.Node, nested bool) {
+		ast.Inspect(root, func(n ast.Node) bool {
+			if exits {
+				return false
+			}
+			switch node := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				exits = true
+			case *ast.BranchStmt:
+				switch {
+				case node.Tok == token.GOTO:
+					exits = true
+				case node.Tok == token.BREAK && (node.Label != nil || !nested):
+					exits = true
+				}
+			case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+				if n != root {
+					visit(n, true)
+					return false
+				}
+			case *ast.CallExpr:
+				switch types.ExprString(node.Fun) {
+				case "panic", "os.Exit", "log.Fatal", "log.Fatalf", "log.Fatalln", "log.Panic", "log.Panicf", "runtime.Goexit":
+					exits = true
+				}
+			}
+			return true
+		})
+	}
+	visit(loop.Body, false)
+	return exits
+}
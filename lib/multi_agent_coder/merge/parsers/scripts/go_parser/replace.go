@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"os"
+)
+
+func runReplaceSymbol(args []string) int {
+	var name, withPath, outputPath string
+	dryRun := false
+
+	flags := flag.NewFlagSet("replace-symbol", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&name, "name", "", "function or method to replace, e.g. ParseConfig or Server.Start")
+	flags.StringVar(&withPath, "with", "", "file containing the new declaration")
+	flags.StringVar(&outputPath, "o", "", "write the result here instead of over the target")
+	flags.BoolVar(&dryRun, "dry-run", false, "do not write; the result source is returned in the output")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	if name == "" || withPath == "" || len(positional) != 1 {
+		return fail("Usage: replace-symbol target.go --name Func --with new_impl.go [-o out.go] [--dry-run]")
+	}
+
+	target := positional[0]
+	if outputPath == "" {
+		outputPath = target
+	}
+
+	file, err := loadEditFile(target)
+	if err != nil {
+		return fail("Failed to load target: %v", err)
+	}
+
+	snippet, err := loadSnippet(withPath)
+	if err != nil {
+		return fail("Failed to load replacement: %v", err)
+	}
+
+	source, symbol, added, err := replaceSymbol(file, snippet, name)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	result := &EditResult{Target: target, Symbol: symbol, AddedImports: added}
+	if err := finishEdit(result, source, outputPath, dryRun); err != nil {
+		return fail("%v", err)
+	}
+	return printEditResult(result)
+}
+
+// replaceSymbol swaps the named function or method in file for its
+// counterpart in snippet. The target keeps its doc comment unless the
+// replacement brings its own, and imports the replacement needs are added.
+func replaceSymbol(file, snippet *editFile, name string) (string, string, []string, error) {
+	existing := findSymbol(file.file, name)
+	if existing == nil || existing.fn == nil {
+		return "", "", nil, fmt.Errorf("function %s not found in %s", name, file.path)
+	}
+
+	replacement := findSymbol(snippet.file, existing.name)
+	if replacement == nil {
+		// Accept a snippet holding a single function under a new name
+		funcs := []*ast.FuncDecl{}
+		for _, decl := range snippet.file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				funcs = append(funcs, fn)
+			}
+		}
+		if len(funcs) != 1 {
+			return "", "", nil, fmt.Errorf("replacement for %s not found in %s", existing.name, snippet.path)
+		}
+		replacement = &symbolDecl{name: symbolName(funcs[0]), kind: "func", node: funcs[0], doc: funcs[0].Doc, fn: funcs[0]}
+	}
+	if replacement.fn == nil {
+		return "", "", nil, fmt.Errorf("%s in %s is not a function", replacement.name, snippet.path)
+	}
+
+	withDoc := replacement.doc != nil
+	start, end := file.declRange(existing, withDoc)
+	newStart, newEnd := snippet.declRange(replacement, withDoc)
+
+	source := file.source[:start] + snippet.source[newStart:newEnd] + file.source[end:]
+
+	source, added, err := ensureImports(source, requiredImports(snippet.file, replacement.node))
+	if err != nil {
+		return "", "", nil, fmt.Errorf("replacement does not parse in %s: %v", file.path, err)
+	}
+
+	return source, existing.name, added, nil
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// majorVersion matches the last element of a major version import path
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// defaultReproAttempts bounds the rebuilds spent reducing a failure
+const defaultReproAttempts = 40
+
+// BuildReproducer is a reduced version of the failing package that still
+// fails with Message in File: the package's files with only the
+// declarations the failure needs, by path, as written to the worktree.
+// Minimal is false when the attempts ran out before no declaration could be
+// removed.
+type BuildReproducer struct {
+	Package  string            `json:"package"`
+	File     string            `json:"file"`
+	Message  string            `json:"message"`
+	Files    map[string]string `json:"files"`
+	Kept     int               `json:"kept"`
+	Removed  int               `json:"removed"`
+	Attempts int               `json:"attempts"`
+	Minimal  bool              `json:"minimal"`
+}
+
+// reproFile is a file of the package being reduced, split into its
+// top-level declarations
+type reproFile struct {
+	path     string
+	original string
+	header   string
+	imports  []reproImport
+	decls    []reproDecl
+	// cgo files are kept as they are, since their preamble goes with the import
+	verbatim bool
+}
+
+type reproImport struct {
+	spec string
+	path string
+	// name is the name the file refers to the package by, "" for blank and
+	// dot imports and those whose name is unsure, which are always kept
+	name string
+}
+
+type reproDecl struct {
+	text string
+	uses map[string]bool
+}
+
+// reproUnit is a declaration: an index into the files and into its decls
+type reproUnit struct {
+	file, decl int
+}
+
+// minimizeFailure reduces the package of the stage's first diagnostic by
+// delta debugging over its declarations: it removes ever smaller groups of
+// declarations while the stage's check still reports the same message in
+// the same file, then restores the package. check is the stage rerun on a
+// package directory. It returns nil when the failure is not in a Go file or
+// does not reproduce.
+func minimizeFailure(stage *VerifyStage, check func(dir string) []VerifyDiagnostic, maxAttempts int) *BuildReproducer {
+	var target *VerifyDiagnostic
+	for i := range stage.Diagnostics {
+		if strings.HasSuffix(stage.Diagnostics[i].File, ".go") {
+			target = &stage.Diagnostics[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil
+	}
+
+	dir := filepath.Dir(target.File)
+	files := loadReproFiles(dir, target.File)
+	if len(files) == 0 {
+		return nil
+	}
+	defer func() {
+		for _, f := range files {
+			os.WriteFile(f.path, []byte(f.original), 0o644)
+		}
+	}()
+
+	repro := &BuildReproducer{Package: filepath.ToSlash(dir), File: target.File, Message: target.Message}
+	fails := func(units []reproUnit) bool {
+		repro.Attempts++
+		writeReproFiles(files, units)
+		for _, d := range check(dir) {
+			if d.File == target.File && d.Message == target.Message {
+				return true
+			}
+		}
+		return false
+	}
+
+	units := []reproUnit{}
+	for i, f := range files {
+		for j := range f.decls {
+			units = append(units, reproUnit{i, j})
+		}
+	}
+	total := len(units)
+	if !fails(units) {
+		return nil
+	}
+
+	// Remove each of n chunks in turn, keeping the first removal that still
+	// fails, and split finer when none does
+	n := 2
+	repro.Minimal = true
+	for len(units) >= 2 {
+		reduced := false
+		for _, chunk := range splitUnits(units, n) {
+			if repro.Attempts >= maxAttempts {
+				repro.Minimal = false
+				break
+			}
+			complement := withoutUnits(units, chunk)
+			if fails(complement) {
+				units, reduced = complement, true
+				if n > 2 {
+					n--
+				}
+				break
+			}
+		}
+		if !repro.Minimal {
+			break
+		}
+		if !reduced {
+			if n >= len(units) {
+				break
+			}
+			n = min(n*2, len(units))
+		}
+	}
+
+	repro.Files = map[string]string{}
+	for i, content := range renderReproFiles(files, units) {
+		if files[i].verbatim || len(unitsOf(units, i)) > 0 || files[i].path == target.File {
+			repro.Files[filepath.ToSlash(files[i].path)] = content
+		}
+	}
+	repro.Kept, repro.Removed = len(units), total-len(units)
+	return repro
+}
+
+// loadReproFiles splits the non-test files of dir in the package of the
+// failing file into declarations
+func loadReproFiles(dir, failing string) []*reproFile {
+	fset := token.NewFileSet()
+	failingFile, err := parser.ParseFile(fset, failing, nil, parser.PackageClauseOnly)
+	if err != nil {
+		return nil
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	files := []*reproFile{}
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		source := string(content)
+		file, err := parser.ParseFile(fset, path, source, parser.ParseComments)
+		if err != nil || file.Name.Name != failingFile.Name.Name {
+			continue
+		}
+
+		offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+		f := &reproFile{path: path, original: source, header: source[:offset(file.Package)] + "package " + file.Name.Name + "\n"}
+		for _, imp := range file.Imports {
+			importPath, _ := strconv.Unquote(imp.Path.Value)
+			info := importInfo{path: importPath}
+			name := ""
+			if imp.Name != nil {
+				info.name = imp.Name.Name
+			}
+			// An unnamed import whose package name is not its last path
+			// element, as in gopkg.in/yaml.v3 or .../v2, is always kept too
+			if local := info.localName(); info.name != "_" && info.name != "." && token.IsIdentifier(local) && !majorVersion.MatchString(local) {
+				name = local
+			}
+			if importPath == "C" {
+				f.verbatim = true
+			}
+			f.imports = append(f.imports, reproImport{spec: info.spec(), path: importPath, name: name})
+		}
+
+		for _, decl := range file.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+				continue
+			}
+			start := decl.Pos()
+			if doc := declDoc(decl); doc != nil {
+				start = doc.Pos()
+			}
+			uses := map[string]bool{}
+			ast.Inspect(decl, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+						uses[x.Name] = true
+					}
+				}
+				return true
+			})
+			f.decls = append(f.decls, reproDecl{text: source[offset(start):offset(decl.End())], uses: uses})
+		}
+		if f.verbatim {
+			f.decls = nil
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Doc
+	case *ast.GenDecl:
+		return d.Doc
+	}
+	return nil
+}
+
+// renderReproFiles writes each file with only the given declarations.
+// Imports the kept declarations no longer use are left out, so the failure
+// is not drowned in unused import errors.
+func renderReproFiles(files []*reproFile, units []reproUnit) []string {
+	contents := make([]string, len(files))
+	for i, f := range files {
+		if f.verbatim {
+			contents[i] = f.original
+			continue
+		}
+		kept := unitsOf(units, i)
+		if len(kept) == 0 {
+			contents[i] = f.header
+			continue
+		}
+
+		uses := map[string]bool{}
+		for _, j := range kept {
+			for name := range f.decls[j].uses {
+				uses[name] = true
+			}
+		}
+		imports := []string{}
+		for _, imp := range f.imports {
+			if imp.name == "" || uses[imp.name] {
+				imports = append(imports, imp.spec)
+			}
+		}
+
+		var b strings.Builder
+		b.WriteString(f.header)
+		if len(imports) > 0 {
+			b.WriteString("\nimport (\n")
+			for _, spec := range imports {
+				b.WriteString("\t" + spec + "\n")
+			}
+			b.WriteString(")\n")
+		}
+		for _, j := range kept {
+			b.WriteString("\n" + f.decls[j].text + "\n")
+		}
+		contents[i] = b.String()
+	}
+	return contents
+}
+
+// buildDirDiagnostics builds the package in dir alone, discarding the
+// binary of a main package
+func buildDirDiagnostics(dir string) []VerifyDiagnostic {
+	stage := VerifyStage{}
+	goStage(&stage, "build", "-o", os.DevNull, "./"+filepath.ToSlash(dir))
+	return stage.Diagnostics
+}
+
+func writeReproFiles(files []*reproFile, units []reproUnit) {
+	for i, content := range renderReproFiles(files, units) {
+		os.WriteFile(files[i].path, []byte(content), 0o644)
+	}
+}
+
+// unitsOf returns the indexes of the declarations of file i among units,
+// in order
+func unitsOf(units []reproUnit, i int) []int {
+	decls := []int{}
+	for _, u := range units {
+		if u.file == i {
+			decls = append(decls, u.decl)
+		}
+	}
+	sort.Ints(decls)
+	return decls
+}
+
+// splitUnits splits units into n chunks of nearly equal size
+func splitUnits(units []reproUnit, n int) [][]reproUnit {
+	chunks := [][]reproUnit{}
+	for i := 0; i < n; i++ {
+		start, end := i*len(units)/n, (i+1)*len(units)/n
+		if start < end {
+			chunks = append(chunks, units[start:end])
+		}
+	}
+	return chunks
+}
+
+func withoutUnits(units, chunk []reproUnit) []reproUnit {
+	removed := map[reproUnit]bool{}
+	for _, u := range chunk {
+		removed[u] = true
+	}
+	rest := []reproUnit{}
+	for _, u := range units {
+		if !removed[u] {
+			rest = append(rest, u)
+		}
+	}
+	return rest
+}
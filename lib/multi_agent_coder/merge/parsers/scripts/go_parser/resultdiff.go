@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ResultDiff compares the output of two parser versions for the same input.
+// Lists are compared regardless of order and fields only the new output has
+// are ignored, unless --report-added is given, so upgrading the parser only
+// shows up when it loses or changes information.
+type ResultDiff struct {
+	Equal       bool               `json:"equal"`
+	Compared    []string           `json:"compared"`
+	Differences []ResultDifference `json:"differences"`
+}
+
+// ResultDifference is one change at Path, a field path such as
+// functions[Parse].params[1]: removed (a field or list item only the old
+// output has), added (a list item, or with --report-added a field, only the
+// new output has) or changed (a different value or type). File names the
+// compared document when diffing directories.
+type ResultDifference struct {
+	File string      `json:"file,omitempty"`
+	Path string      `json:"path"`
+	Kind string      `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// identityFields name the fields that identify an object in a list, so that
+// the functions or batch entries of the two outputs are paired by name or
+// path rather than by content
+var identityFields = []string{"path", "receiver", "name"}
+
+func runResultDiff(args []string) int {
+	reportAdded := false
+
+	flags := flag.NewFlagSet("result-diff", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.BoolVar(&reportAdded, "report-added", false, "also report fields only the new output has")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(positional) != 2 {
+		return fail("Usage: result-diff old.json new.json, or two directories of outputs")
+	}
+
+	diff, err := diffResultPaths(positional[0], positional[1], reportAdded)
+	if err != nil {
+		return fail("Diff failed: %v", err)
+	}
+	code := printJSON(diff)
+	if code == 0 && !diff.Equal {
+		return exitViolations
+	}
+	return code
+}
+
+// diffResultPaths compares two output files, or every .json file of the old
+// directory with the file of the same name in the new one
+func diffResultPaths(oldPath, newPath string, reportAdded bool) (*ResultDiff, error) {
+	diff := &ResultDiff{Compared: []string{}, Differences: []ResultDifference{}}
+
+	info, err := os.Stat(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	pairs := [][2]string{{oldPath, newPath}}
+	if info.IsDir() {
+		pairs = nil
+		paths, err := filepath.Glob(filepath.Join(oldPath, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			pairs = append(pairs, [2]string{path, filepath.Join(newPath, filepath.Base(path))})
+		}
+	}
+
+	for _, pair := range pairs {
+		name := ""
+		if info.IsDir() {
+			name = filepath.Base(pair[0])
+		}
+		oldDoc, err := readJSONDocument(pair[0])
+		if err != nil {
+			return nil, err
+		}
+		newDoc, err := readJSONDocument(pair[1])
+		if os.IsNotExist(err) && info.IsDir() {
+			diff.Differences = append(diff.Differences, ResultDifference{File: name, Path: "", Kind: "removed"})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		differ := &resultDiffer{file: name, reportAdded: reportAdded}
+		differ.compare("", oldDoc, newDoc)
+		diff.Differences = append(diff.Differences, differ.differences...)
+		diff.Compared = append(diff.Compared, pair[0])
+	}
+	diff.Equal = len(diff.Differences) == 0
+	return diff, nil
+}
+
+func readJSONDocument(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return doc, nil
+}
+
+// resultDiffer collects the differences of one pair of documents
+type resultDiffer struct {
+	file        string
+	reportAdded bool
+	differences []ResultDifference
+}
+
+func (d *resultDiffer) add(path, kind string, old, new interface{}) {
+	d.differences = append(d.differences, ResultDifference{File: d.file, Path: path, Kind: kind, Old: old, New: new})
+}
+
+func (d *resultDiffer) compare(path string, old, new interface{}) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			d.add(path, "changed", old, new)
+			return
+		}
+		for _, key := range sortedJSONKeys(o) {
+			value, ok := n[key]
+			if !ok {
+				d.add(joinJSONPath(path, key), "removed", o[key], nil)
+				continue
+			}
+			d.compare(joinJSONPath(path, key), o[key], value)
+		}
+		if d.reportAdded {
+			for _, key := range sortedJSONKeys(n) {
+				if _, ok := o[key]; !ok {
+					d.add(joinJSONPath(path, key), "added", nil, n[key])
+				}
+			}
+		}
+
+	case []interface{}:
+		// An empty list and a missing one are the same to consumers
+		if new == nil && len(o) == 0 {
+			return
+		}
+		n, ok := new.([]interface{})
+		if !ok {
+			d.add(path, "changed", old, new)
+			return
+		}
+		d.compareLists(path, o, n)
+
+	default:
+		if !jsonEqual(old, new) {
+			d.add(path, "changed", old, new)
+		}
+	}
+}
+
+// compareLists pairs the items of two lists, by identity when every object
+// of both has a distinct one and otherwise by finding for each old item a
+// new one with no differences
+func (d *resultDiffer) compareLists(path string, old, new []interface{}) {
+	oldKeys, oldOK := listIdentities(old)
+	newKeys, newOK := listIdentities(new)
+	if oldOK && newOK {
+		byKey := map[string]interface{}{}
+		for i, key := range newKeys {
+			byKey[key] = new[i]
+		}
+		seen := map[string]bool{}
+		for i, key := range oldKeys {
+			seen[key] = true
+			item, ok := byKey[key]
+			if !ok {
+				d.add(path+"["+key+"]", "removed", old[i], nil)
+				continue
+			}
+			d.compare(path+"["+key+"]", old[i], item)
+		}
+		for i, key := range newKeys {
+			if !seen[key] {
+				d.add(path+"["+key+"]", "added", nil, new[i])
+			}
+		}
+		return
+	}
+
+	used := make([]bool, len(new))
+	for i, item := range old {
+		match := -1
+		for j := range new {
+			if !used[j] && d.matches(item, new[j]) {
+				match = j
+				break
+			}
+		}
+		if match < 0 {
+			d.add(fmt.Sprintf("%s[%d]", path, i), "removed", item, nil)
+			continue
+		}
+		used[match] = true
+	}
+	for j, item := range new {
+		if !used[j] {
+			d.add(fmt.Sprintf("%s[%d]", path, j), "added", nil, item)
+		}
+	}
+}
+
+// matches reports whether new has everything old has
+func (d *resultDiffer) matches(old, new interface{}) bool {
+	probe := &resultDiffer{reportAdded: d.reportAdded}
+	probe.compare("", old, new)
+	return len(probe.differences) == 0
+}
+
+// listIdentities returns the identity of each item of a list of objects,
+// from the identityFields it has, or false when an item has none or two
+// items share one
+func listIdentities(items []interface{}) ([]string, bool) {
+	keys := make([]string, 0, len(items))
+	seen := map[string]bool{}
+	for _, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		parts := []string{}
+		for _, field := range identityFields {
+			if value, ok := object[field].(string); ok && value != "" {
+				parts = append(parts, value)
+			}
+		}
+		key := strings.Join(parts, ".")
+		if key == "" || seen[key] {
+			return nil, false
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys, true
+}
+
+func jsonEqual(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+func joinJSONPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func sortedJSONKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SalvagedSpan is a change made to a file that does not parse so that the
+// rest of it can be analyzed: lines "dropped" because they make no sense as
+// Go, including prose around the code, the "trimmed" tail of a declaration
+// that continues past its closing brace, and the brackets "closed" at the end
+// of a truncated declaration. Signature is the first line of the declaration.
+type SalvagedSpan struct {
+	Action    string `json:"action"`
+	Line      int    `json:"line"`
+	EndLine   int    `json:"end_line"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// declStart matches a line that starts a top-level declaration, which gofmt
+// writes at column 1
+var declStart = regexp.MustCompile(`^(func|type|var|const|import)\b`)
+
+// salvageSegment is a run of lines starting a top-level declaration, with
+// the doc comment above it, and what salvage makes of it
+type salvageSegment struct {
+	start, end int
+	// Lines of the segment kept, from start; the rest are blanked
+	keep    int
+	closers string
+	action  string
+}
+
+// salvageSource makes a file that does not parse parseable by dropping the
+// declarations that do not parse on their own, trimming or closing those
+// that do once cut at their end or completed with their missing closing
+// brackets. Dropped lines are blanked rather than removed, so positions in
+// the rest of the file stay those of the original. It also returns the
+// file's syntax errors, and false when the file has no package clause or
+// nothing parses.
+func salvageSource(source string) (string, []SalvagedSpan, []Diagnostic, bool) {
+	lines := strings.Split(source, "\n")
+
+	pkg := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "package ") {
+			pkg = i
+			break
+		}
+	}
+	if pkg < 0 {
+		return "", nil, nil, false
+	}
+
+	spans := []SalvagedSpan{}
+	// Prose ahead of the package clause, unless it is a comment. The parser
+	// stops at it, so the errors after it are those of the file without it.
+	errors := []Diagnostic{}
+	if pkg > 0 && !parsesAlone(strings.Join(lines[:pkg+1], "\n")) {
+		errors = append(errors, syntaxErrors(source, pkg)...)
+		spans = append(spans, SalvagedSpan{Action: "dropped", Line: 1, EndLine: pkg})
+		for i := 0; i < pkg; i++ {
+			lines[i] = ""
+		}
+	}
+	errors = append(errors, syntaxErrors(strings.Join(lines, "\n"), len(lines))...)
+
+	// Markdown fences around or within the code
+	for i := pkg + 1; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+			spans = append(spans, SalvagedSpan{Action: "dropped", Line: i + 1, EndLine: i + 1})
+			lines[i] = ""
+		}
+	}
+
+	segments := []*salvageSegment{}
+	for i := pkg + 1; i < len(lines); i++ {
+		if !declStart.MatchString(lines[i]) {
+			continue
+		}
+		start := i
+		for start > pkg+1 && strings.HasPrefix(lines[start-1], "//") {
+			start--
+		}
+		if len(segments) > 0 {
+			segments[len(segments)-1].end = start
+		}
+		segments = append(segments, &salvageSegment{start: start, end: len(lines)})
+	}
+
+	// Text between the package clause and the first declaration
+	headerEnd := len(lines)
+	if len(segments) > 0 {
+		headerEnd = segments[0].start
+	}
+	if !parsesAlone(strings.Join(lines[pkg:headerEnd], "\n")) {
+		spans = append(spans, SalvagedSpan{Action: "dropped", Line: pkg + 2, EndLine: headerEnd})
+		for i := pkg + 1; i < headerEnd; i++ {
+			lines[i] = ""
+		}
+	}
+
+	for _, segment := range segments {
+		salvageDeclaration(lines, segment)
+	}
+
+	render := func() string {
+		out := make([]string, len(lines))
+		copy(out, lines)
+		for _, segment := range segments {
+			for i := segment.start + segment.keep; i < segment.end; i++ {
+				out[i] = ""
+			}
+			if segment.closers != "" {
+				last := segment.start + segment.keep - 1
+				out[last] = insertClosers(out[last], segment.closers)
+			}
+		}
+		return strings.Join(out, "\n")
+	}
+
+	// Declarations that only fail together, such as two halves of a split
+	// group, are dropped until the file parses
+	salvaged := render()
+	for attempt := 0; attempt <= len(segments); attempt++ {
+		_, err := parser.ParseFile(token.NewFileSet(), "", salvaged, parser.AllErrors)
+		if err == nil {
+			break
+		}
+		list, ok := err.(scanner.ErrorList)
+		if !ok || len(list) == 0 || attempt == len(segments) {
+			return "", nil, nil, false
+		}
+		line := list[0].Pos.Line - 1
+		dropped := false
+		for _, segment := range segments {
+			if segment.keep > 0 && line >= segment.start && line < segment.end {
+				segment.keep, segment.closers, segment.action = 0, "", "dropped"
+				dropped = true
+			}
+		}
+		if !dropped {
+			return "", nil, nil, false
+		}
+		salvaged = render()
+	}
+
+	for _, segment := range segments {
+		signature := segmentSignature(lines, segment)
+		switch segment.action {
+		case "dropped":
+			spans = append(spans, SalvagedSpan{Action: "dropped", Line: segment.start + 1, EndLine: segment.end, Signature: signature})
+		case "trimmed":
+			spans = append(spans, SalvagedSpan{Action: "trimmed", Line: segment.start + segment.keep + 1, EndLine: segment.end, Signature: signature})
+		case "closed":
+			last := segment.start + segment.keep
+			spans = append(spans, SalvagedSpan{Action: "closed", Line: last, EndLine: last, Signature: signature})
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Line < spans[j].Line })
+	return salvaged, spans, errors, true
+}
+
+// salvageDeclaration decides how much of a segment to keep: all of it when
+// it parses, the lines up to where its brackets balance when its tail is
+// something else, all of it with its open brackets closed when it is
+// truncated, or none of it
+func salvageDeclaration(lines []string, segment *salvageSegment) {
+	text := strings.Join(lines[segment.start:segment.end], "\n")
+	segment.keep = segment.end - segment.start
+	if parsesAlone("package p\n" + text) {
+		return
+	}
+
+	// The latest point that makes a whole declaration, as prose after it
+	// may have brackets of its own
+	balanced, open := bracketExtent(text)
+	for i := len(balanced) - 1; i >= 0; i-- {
+		kept := strings.Join(lines[segment.start:segment.start+balanced[i]], "\n")
+		if parsesAlone("package p\n" + kept) {
+			segment.keep, segment.action = balanced[i], "trimmed"
+			return
+		}
+	}
+
+	// Trailing blank lines are kept blank, closers go after the last code
+	for segment.keep > 1 && strings.TrimSpace(lines[segment.start+segment.keep-1]) == "" {
+		segment.keep--
+	}
+	if open != "" {
+		kept := strings.Join(lines[segment.start:segment.start+segment.keep], "\n")
+		last := strings.LastIndex(kept, "\n") + 1
+		if parsesAlone("package p\n" + kept[:last] + insertClosers(kept[last:], open)) {
+			segment.closers, segment.action = open, "closed"
+			return
+		}
+	}
+	segment.keep, segment.action = 0, "dropped"
+}
+
+// bracketExtent scans a declaration and returns the numbers of the lines
+// where its brackets balance again after opening, first to last, and the
+// closers of the brackets still open at its end, innermost first
+func bracketExtent(text string) ([]int, string) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(text))
+	var s scanner.Scanner
+	s.Init(file, []byte(text), func(token.Position, string) {}, 0)
+
+	closers := map[token.Token]string{token.LBRACE: "}", token.LPAREN: ")", token.LBRACK: "]"}
+	stack := []string{}
+	balanced := []int{}
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch tok {
+		case token.LBRACE, token.LPAREN, token.LBRACK:
+			stack = append(stack, closers[tok])
+		case token.RBRACE, token.RPAREN, token.RBRACK:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			line := file.Position(pos).Line
+			if len(stack) == 0 && (len(balanced) == 0 || balanced[len(balanced)-1] != line) {
+				balanced = append(balanced, line)
+			}
+		}
+	}
+
+	open := ""
+	for i := len(stack) - 1; i >= 0; i-- {
+		open += stack[i]
+	}
+	return balanced, open
+}
+
+// insertClosers adds closing brackets to a line after its last token, ahead
+// of any line comment
+func insertClosers(line, closers string) string {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(line))
+	var s scanner.Scanner
+	s.Init(file, []byte(line), func(token.Position, string) {}, scanner.ScanComments)
+
+	end := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.COMMENT || (tok == token.SEMICOLON && lit == "\n") {
+			continue
+		}
+		end = file.Offset(pos) + len(lit)
+		if lit == "" {
+			end = file.Offset(pos) + len(tok.String())
+		}
+	}
+	return line[:end] + closers + line[end:]
+}
+
+// syntaxErrors returns the syntax errors of source up to the given line
+func syntaxErrors(source string, lastLine int) []Diagnostic {
+	errors := []Diagnostic{}
+	_, err := parser.ParseFile(token.NewFileSet(), "", source, parser.AllErrors)
+	if list, ok := err.(scanner.ErrorList); ok {
+		// The parser reports some errors once per construct left open
+		list.RemoveMultiples()
+		for _, e := range list {
+			if e.Pos.Line <= lastLine {
+				errors = append(errors, syntaxDiagnostic(e.Pos.Line, e.Pos.Column, e.Msg))
+			}
+		}
+	}
+	return errors
+}
+
+func parsesAlone(source string) bool {
+	_, err := parser.ParseFile(token.NewFileSet(), "", source, parser.SkipObjectResolution)
+	return err == nil
+}
+
+func segmentSignature(lines []string, segment *salvageSegment) string {
+	for i := segment.start; i < segment.end; i++ {
+		if declStart.MatchString(lines[i]) {
+			return strings.TrimSpace(lines[i])
+		}
+	}
+	return ""
+}
+
+// salvageGoCode analyzes the declarations salvaged from a source that
+// failed to parse with err, reporting all of its syntax errors, or returns
+// nil when err is not a syntax error or nothing could be salvaged
+func salvageGoCode(source string, err error, limits SourceLimits) *Result {
+	if _, ok := err.(scanner.ErrorList); !ok {
+		return nil
+	}
+	salvaged, spans, errors, ok := salvageSource(source)
+	if !ok {
+		return nil
+	}
+	result, err := parseGoCode(salvaged, limits)
+	if err != nil {
+		return nil
+	}
+	result.ParseErrors, result.Salvaged = errors, spans
+	return result
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizeReport describes encoding problems found in a source file and,
+// in fix mode, the cleaned source that was parsed instead.
+type SanitizeReport struct {
+	Mode        string          `json:"mode"`
+	BOM         bool            `json:"bom"`
+	LineEndings string          `json:"line_endings"`
+	InvalidUTF8 []SanitizeIssue `json:"invalid_utf8"`
+	Invisible   []SanitizeIssue `json:"invisible"`
+	Homoglyphs  []SanitizeIssue `json:"homoglyphs"`
+	Changed     bool            `json:"changed"`
+	Source      string          `json:"source,omitempty"`
+}
+
+// SanitizeIssue represents a single suspicious character in the input
+type SanitizeIssue struct {
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	Char        string `json:"char"`
+	Name        string `json:"name,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	InLiteral   bool   `json:"in_literal"`
+}
+
+// invisibleRunes are characters that render as nothing (or as plain
+// whitespace) but are illegal or misleading in Go source
+var invisibleRunes = map[rune]string{
+	'\u00A0': "no-break space",
+	'\u00AD': "soft hyphen",
+	'\u200B': "zero width space",
+	'\u200C': "zero width non-joiner",
+	'\u200D': "zero width joiner",
+	'\u200E': "left-to-right mark",
+	'\u200F': "right-to-left mark",
+	'\u2060': "word joiner",
+	'\u202A': "left-to-right embedding",
+	'\u202B': "right-to-left embedding",
+	'\u202C': "pop directional formatting",
+	'\u202D': "left-to-right override",
+	'\u202E': "right-to-left override",
+	'\u2066': "left-to-right isolate",
+	'\u2067': "right-to-left isolate",
+	'\u2068': "first strong isolate",
+	'\u2069': "pop directional isolate",
+	'\uFEFF': "zero width no-break space",
+}
+
+// homoglyphRunes maps look-alike characters that LLMs occasionally emit in
+// code to the ASCII character that was almost certainly intended
+var homoglyphRunes = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x',
+	'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O',
+	'Р': 'P', 'С': 'C', 'Т': 'T', 'Х': 'X',
+	// Greek
+	'ο': 'o', 'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I',
+	'Κ': 'K', 'Μ': 'M', 'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Χ': 'X',
+	// Typographic punctuation
+	'“': '"', '”': '"', '„': '"', '‘': '\'', '’': '\'',
+	'–': '-', '—': '-', '−': '-',
+}
+
+// lexical states tracked while scanning, so that literals and comments are
+// reported but never rewritten
+const (
+	stateCode = iota
+	stateLineComment
+	stateBlockComment
+	stateBlockCommentEnd
+	stateString
+	stateRawString
+	stateRune
+)
+
+func isValidSanitizeMode(mode string) bool {
+	return mode == "off" || mode == "report" || mode == "fix"
+}
+
+// sanitizeSource scans content for encoding problems. When fix is true the
+// returned report carries the cleaned source in Source.
+func sanitizeSource(content []byte, fix bool) *SanitizeReport {
+	report := &SanitizeReport{
+		Mode:        "report",
+		InvalidUTF8: []SanitizeIssue{},
+		Invisible:   []SanitizeIssue{},
+		Homoglyphs:  []SanitizeIssue{},
+	}
+	if fix {
+		report.Mode = "fix"
+	}
+
+	if len(content) >= 3 && content[0] == 0xEF && content[1] == 0xBB && content[2] == 0xBF {
+		report.BOM = true
+		content = content[3:]
+	}
+
+	report.LineEndings = detectLineEndings(content)
+
+	var out strings.Builder
+	out.Grow(len(content))
+
+	state := stateCode
+	smartQuote := rune(0)
+	line, col := 1, 1
+
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRune(content[i:])
+		startLine, startCol := line, col
+		i += size
+
+		if r == utf8.RuneError && size == 1 {
+			report.InvalidUTF8 = append(report.InvalidUTF8, SanitizeIssue{
+				Line:      startLine,
+				Column:    startCol,
+				Char:      fmt.Sprintf("0x%02X", content[i-1]),
+				InLiteral: state != stateCode,
+			})
+			col++
+			continue
+		}
+
+		// Normalize CRLF and bare CR to LF
+		if r == '\r' {
+			if i < len(content) && content[i] == '\n' {
+				continue
+			}
+			r = '\n'
+		}
+
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+
+		inLiteral := state != stateCode
+		if name, ok := invisibleRunes[r]; ok {
+			issue := SanitizeIssue{
+				Line:      startLine,
+				Column:    startCol,
+				Char:      fmt.Sprintf("U+%04X", r),
+				Name:      name,
+				InLiteral: inLiteral,
+			}
+			// A no-break space in code is meant as a plain space
+			if !inLiteral && r == '\u00A0' {
+				issue.Replacement = " "
+			}
+			report.Invisible = append(report.Invisible, issue)
+
+			if !inLiteral {
+				out.WriteString(issue.Replacement)
+				continue
+			}
+		}
+
+		if replacement, ok := homoglyphRunes[r]; ok && (!inLiteral || (smartQuote != 0 && replacement == smartQuote)) {
+			report.Homoglyphs = append(report.Homoglyphs, SanitizeIssue{
+				Line:        startLine,
+				Column:      startCol,
+				Char:        fmt.Sprintf("U+%04X", r),
+				Name:        string(r),
+				Replacement: string(replacement),
+				InLiteral:   inLiteral,
+			})
+			if inLiteral {
+				// Closing typographic quote of a literal opened with one
+				state = stateCode
+				smartQuote = 0
+				out.WriteRune(replacement)
+				continue
+			}
+			if isSmartQuote(r) {
+				smartQuote = replacement
+			}
+			r = replacement
+		}
+
+		state = nextLexState(state, r, content[i:])
+		if (state == stateString || state == stateRune) && r == '\\' && i < len(content) {
+			// Copy the escaped character verbatim
+			next, nextSize := utf8.DecodeRune(content[i:])
+			out.WriteRune(r)
+			out.WriteRune(next)
+			i += nextSize
+			col++
+			continue
+		}
+		if state != stateString && state != stateRune {
+			smartQuote = 0
+		}
+
+		out.WriteRune(r)
+	}
+
+	cleaned := out.String()
+	report.Changed = report.BOM || report.LineEndings != "lf" ||
+		len(report.InvalidUTF8) > 0 || cleaned != string(content)
+
+	if fix && report.Changed {
+		report.Source = cleaned
+	}
+
+	return report
+}
+
+// issueCount returns the number of individual problems found
+func (r *SanitizeReport) issueCount() int {
+	count := len(r.InvalidUTF8) + len(r.Invisible) + len(r.Homoglyphs)
+	if r.BOM {
+		count++
+	}
+	if r.LineEndings != "lf" {
+		count++
+	}
+	return count
+}
+
+func detectLineEndings(content []byte) string {
+	crlf, lf, cr := 0, 0, 0
+	for i := 0; i < len(content); i++ {
+		switch content[i] {
+		case '\r':
+			if i+1 < len(content) && content[i+1] == '\n' {
+				crlf++
+				i++
+			} else {
+				cr++
+			}
+		case '\n':
+			lf++
+		}
+	}
+
+	kinds := 0
+	for _, n := range []int{crlf, lf, cr} {
+		if n > 0 {
+			kinds++
+		}
+	}
+
+	switch {
+	case kinds > 1:
+		return "mixed"
+	case crlf > 0:
+		return "crlf"
+	case cr > 0:
+		return "cr"
+	default:
+		return "lf"
+	}
+}
+
+// nextLexState advances the lexical state after consuming r; rest is the
+// input following r.
+func nextLexState(state int, r rune, rest []byte) int {
+	switch state {
+	case stateCode:
+		switch r {
+		case '"':
+			return stateString
+		case '`':
+			return stateRawString
+		case '\'':
+			return stateRune
+		case '/':
+			if len(rest) > 0 && rest[0] == '/' {
+				return stateLineComment
+			}
+			if len(rest) > 0 && rest[0] == '*' {
+				return stateBlockComment
+			}
+		}
+	case stateLineComment:
+		if r == '\n' {
+			return stateCode
+		}
+	case stateBlockComment:
+		if r == '*' && len(rest) > 0 && rest[0] == '/' {
+			return stateBlockCommentEnd
+		}
+	case stateBlockCommentEnd:
+		return stateCode
+	case stateString:
+		if r == '"' || r == '\n' {
+			return stateCode
+		}
+	case stateRawString:
+		if r == '`' {
+			return stateCode
+		}
+	case stateRune:
+		if r == '\'' || r == '\n' {
+			return stateCode
+		}
+	}
+	return state
+}
+
+func isSmartQuote(r rune) bool {
+	switch r {
+	case '“', '”', '„', '‘', '’':
+		return true
+	}
+	return false
+}
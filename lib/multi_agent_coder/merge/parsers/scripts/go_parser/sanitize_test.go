@@ -0,0 +1,114 @@
+package main
+
+import "testing"
+
+func TestSanitizeSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		want       string
+		changed    bool
+		lineEnding string
+		invalid    int
+		invisible  int
+		homoglyphs int
+	}{
+		{
+			name:       "clean",
+			input:      "package p\n\nvar x = 1\n",
+			want:       "",
+			lineEnding: "lf",
+		},
+		{
+			name:       "byte order mark",
+			input:      "\xEF\xBB\xBFpackage p\n",
+			want:       "package p\n",
+			changed:    true,
+			lineEnding: "lf",
+		},
+		{
+			name:       "CRLF line endings",
+			input:      "package p\r\n\r\nvar x = 1\r\n",
+			want:       "package p\n\nvar x = 1\n",
+			changed:    true,
+			lineEnding: "crlf",
+		},
+		{
+			name:       "zero width space in code",
+			input:      "package p\n\nvar x\u200b = 1\n",
+			want:       "package p\n\nvar x = 1\n",
+			changed:    true,
+			lineEnding: "lf",
+			invisible:  1,
+		},
+		{
+			name:       "no-break space in code",
+			input:      "package p\n\nvar x =\u00a01\n",
+			want:       "package p\n\nvar x = 1\n",
+			changed:    true,
+			lineEnding: "lf",
+			invisible:  1,
+		},
+		{
+			name:       "invisible character in a literal is kept",
+			input:      "package p\n\nvar s = \"a\u200bb\"\n",
+			want:       "",
+			lineEnding: "lf",
+			invisible:  1,
+		},
+		{
+			name:       "Cyrillic letter in an identifier",
+			input:      "package p\n\nvar \u0430 = 1\n",
+			want:       "package p\n\nvar a = 1\n",
+			changed:    true,
+			lineEnding: "lf",
+			homoglyphs: 1,
+		},
+		{
+			name:       "Cyrillic letter in a literal is kept",
+			input:      "package p\n\nvar s = \"\u0430\"\n",
+			want:       "",
+			lineEnding: "lf",
+		},
+		{
+			name:       "typographic quotes around a literal",
+			input:      "package p\n\nvar s = \u201chi\u201d\n",
+			want:       "package p\n\nvar s = \"hi\"\n",
+			changed:    true,
+			lineEnding: "lf",
+			homoglyphs: 2,
+		},
+		{
+			name:       "invalid UTF-8",
+			input:      "package p\n\n// \xFF\n",
+			want:       "package p\n\n// \n",
+			changed:    true,
+			lineEnding: "lf",
+			invalid:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := sanitizeSource([]byte(tt.input), true)
+			if report.Source != tt.want {
+				t.Errorf("source = %q, want %q", report.Source, tt.want)
+			}
+			if report.Changed != tt.changed {
+				t.Errorf("changed = %v, want %v", report.Changed, tt.changed)
+			}
+			if report.LineEndings != tt.lineEnding {
+				t.Errorf("line endings = %s, want %s", report.LineEndings, tt.lineEnding)
+			}
+			if len(report.InvalidUTF8) != tt.invalid || len(report.Invisible) != tt.invisible || len(report.Homoglyphs) != tt.homoglyphs {
+				t.Errorf("issues = %d invalid, %d invisible, %d homoglyphs; want %d, %d, %d",
+					len(report.InvalidUTF8), len(report.Invisible), len(report.Homoglyphs), tt.invalid, tt.invisible, tt.homoglyphs)
+			}
+
+			// Report mode finds the same issues and leaves the source alone
+			if report := sanitizeSource([]byte(tt.input), false); report.Source != "" || report.Mode != "report" {
+				t.Errorf("report mode returned source %q in mode %s", report.Source, report.Mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import "path/filepath"
+
+// SARIF is the subset of a SARIF 2.1.0 log that go_parser produces, enough
+// for code scanning uploads and IDE viewers
+type SARIF struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+type SARIFDriver struct {
+	Name  string      `json:"name"`
+	Rules []SARIFRule `json:"rules"`
+}
+
+type SARIFRule struct {
+	ID               string       `json:"id"`
+	ShortDescription SARIFMessage `json:"shortDescription"`
+}
+
+type SARIFResult struct {
+	RuleID       string             `json:"ruleId"`
+	Level        string             `json:"level"`
+	Message      SARIFMessage       `json:"message"`
+	Locations    []SARIFLocation    `json:"locations"`
+	Suppressions []SARIFSuppression `json:"suppressions,omitempty"`
+}
+
+// SARIFSuppression marks a result as silenced by a comment in the source
+type SARIFSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification"`
+}
+
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+type SARIFLocation struct {
+	PhysicalLocation SARIFPhysicalLocation `json:"physicalLocation"`
+}
+
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifact `json:"artifactLocation"`
+	Region           SARIFRegion   `json:"region"`
+}
+
+type SARIFArtifact struct {
+	URI string `json:"uri"`
+}
+
+type SARIFRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine,omitempty"`
+}
+
+// newSARIF starts a single-run log for go_parser with the given rules
+func newSARIF(rules []SARIFRule) *SARIF {
+	return &SARIF{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []SARIFRun{{
+			Tool:    SARIFTool{Driver: SARIFDriver{Name: "go_parser", Rules: rules}},
+			Results: []SARIFResult{},
+		}},
+	}
+}
+
+// addResult records a finding at lines start to end of path
+func (s *SARIF) addResult(ruleID, level, message, path string, start, end int) {
+	run := &s.Runs[0]
+	run.Results = append(run.Results, SARIFResult{
+		RuleID:  ruleID,
+		Level:   level,
+		Message: SARIFMessage{Text: message},
+		Locations: []SARIFLocation{{PhysicalLocation: SARIFPhysicalLocation{
+			ArtifactLocation: SARIFArtifact{URI: filepath.ToSlash(path)},
+			Region:           SARIFRegion{StartLine: start, EndLine: end},
+		}}},
+	})
+}
+
+// addSuppressed records a finding an //agentlint:ignore directive silenced,
+// with the directive's reason as justification
+func (s *SARIF) addSuppressed(ruleID, level string, suppression Suppression) {
+	message := ruleID + " suppressed: " + suppression.Reason
+	s.addResult(ruleID, level, message, suppression.File, suppression.TargetLine, 0)
+	run := &s.Runs[0]
+	run.Results[len(run.Results)-1].Suppressions = []SARIFSuppression{{Kind: "inSource", Justification: suppression.Reason}}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sbomModule is a dependency module found for an SBOM. Direct modules are
+// imported by the analyzed files; New ones are missing from the baseline
+// go.mod, or from go.mod itself when Missing is set.
+type sbomModule struct {
+	Path    string
+	Version string
+	Direct  bool
+	New     bool
+	Missing bool
+}
+
+// CycloneDX is the subset of a CycloneDX 1.5 JSON BOM that go_parser emits
+type CycloneDX struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     CycloneDXMetadata     `json:"metadata"`
+	Components   []CycloneDXComponent  `json:"components"`
+	Dependencies []CycloneDXDependency `json:"dependencies"`
+}
+
+type CycloneDXMetadata struct {
+	Timestamp  string              `json:"timestamp"`
+	Tools      CycloneDXTools      `json:"tools"`
+	Component  CycloneDXComponent  `json:"component"`
+	Properties []CycloneDXProperty `json:"properties,omitempty"`
+}
+
+type CycloneDXTools struct {
+	Components []CycloneDXComponent `json:"components"`
+}
+
+type CycloneDXComponent struct {
+	Type       string              `json:"type"`
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Properties []CycloneDXProperty `json:"properties,omitempty"`
+}
+
+type CycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type CycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// SPDX is the subset of an SPDX 2.3 JSON document that go_parser emits
+type SPDX struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      SPDXCreationInfo   `json:"creationInfo"`
+	Packages          []SPDXPackage      `json:"packages"`
+	Relationships     []SPDXRelationship `json:"relationships"`
+}
+
+type SPDXCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+	Comment  string   `json:"comment,omitempty"`
+}
+
+type SPDXPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	ExternalRefs     []SPDXExternalRef `json:"externalRefs,omitempty"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type SPDXExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type SPDXRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func runSBOM(args []string) int {
+	format := "cyclonedx"
+	baseline := ""
+
+	flags := flag.NewFlagSet("sbom", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&format, "format", format, "SBOM format: cyclonedx or spdx")
+	flags.StringVar(&baseline, "baseline", "", "go.mod before the change; modules it does not require are marked new")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if format != "cyclonedx" && format != "spdx" {
+		return fail("Invalid format: %s", format)
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	files, err := collectGoFiles(patterns, true)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+	if len(files) == 0 {
+		return fail("No Go files in %s", strings.Join(patterns, " "))
+	}
+
+	root, modulePath, err := findModule(filepath.Dir(files[0]))
+	if err != nil || root == "" {
+		return fail("No go.mod found for %s", files[0])
+	}
+
+	var baselineRequires map[string]string
+	if baseline != "" {
+		if baselineRequires, err = readModuleRequires(baseline); err != nil {
+			return fail("Failed to read baseline: %v", err)
+		}
+	}
+
+	modules, skipped, err := collectSBOMModules(files, root, modulePath, baselineRequires)
+	if err != nil {
+		return fail("Failed to collect dependencies: %v", err)
+	}
+
+	rootVersion := gitDescribe(root)
+	if format == "spdx" {
+		return printJSON(spdxDocument(modulePath, rootVersion, modules, skipped))
+	}
+	return printJSON(cycloneDXDocument(modulePath, rootVersion, modules, skipped))
+}
+
+// collectSBOMModules lists the modules required by the go.mod at root, plus
+// any module the files import that go.mod does not require, resolved against
+// the module cache. It also returns the files whose imports could not be
+// read.
+func collectSBOMModules(files []string, root, modulePath string, baseline map[string]string) ([]sbomModule, []string, error) {
+	requires, err := readModuleRequires(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	modules := map[string]*sbomModule{}
+	for path, version := range requires {
+		modules[path] = &sbomModule{Path: path, Version: version}
+	}
+
+	skipped := []string{}
+	for _, path := range files {
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+		if err != nil {
+			skipped = append(skipped, path)
+			continue
+		}
+		for _, imp := range file.Imports {
+			importPath, _ := strconv.Unquote(imp.Path.Value)
+			if importPath == "C" || isStdlibPath(importPath) || importPath == modulePath || strings.HasPrefix(importPath, modulePath+"/") {
+				continue
+			}
+			module := importedModule(importPath, modules)
+			if module == nil {
+				module = unrequiredModule(importPath)
+				modules[module.Path] = module
+			}
+			module.Direct = true
+		}
+	}
+
+	list := []sbomModule{}
+	for _, module := range modules {
+		if baseline != nil {
+			if _, ok := baseline[module.Path]; !ok {
+				module.New = true
+			}
+		}
+		list = append(list, *module)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list, skipped, nil
+}
+
+// importedModule returns the known module providing importPath: the one
+// with the longest path that is a prefix of it
+func importedModule(importPath string, modules map[string]*sbomModule) *sbomModule {
+	for prefix := importPath; prefix != "." && prefix != "/"; prefix = filepath.ToSlash(filepath.Dir(prefix)) {
+		if module := modules[prefix]; module != nil {
+			return module
+		}
+	}
+	return nil
+}
+
+// unrequiredModule resolves an import that go.mod does not cover against the
+// module cache, falling back to the import path without a version
+func unrequiredModule(importPath string) *sbomModule {
+	for prefix := importPath; prefix != "." && prefix != "/"; prefix = filepath.ToSlash(filepath.Dir(prefix)) {
+		if _, version, err := findCachedModule(prefix); err == nil {
+			return &sbomModule{Path: prefix, Version: version, New: true, Missing: true}
+		}
+	}
+	return &sbomModule{Path: importPath, New: true, Missing: true}
+}
+
+// gitDescribe names the checked-out version of dir, or "" outside git
+func gitDescribe(dir string) string {
+	output, err := runGit(filepath.Join(dir, "go.mod"), "describe", "--tags", "--always", "--dirty")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// modulePURL is the package URL of a Go module
+func modulePURL(path, version string) string {
+	purl := "pkg:golang/" + path
+	if version != "" {
+		purl += "@" + version
+	}
+	return purl
+}
+
+func cycloneDXDocument(modulePath, version string, modules []sbomModule, skipped []string) *CycloneDX {
+	rootRef := modulePURL(modulePath, version)
+	bom := &CycloneDX{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + randomUUID(),
+		Version:      1,
+		Metadata: CycloneDXMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools:     CycloneDXTools{Components: []CycloneDXComponent{{Type: "application", Name: "go_parser"}}},
+			Component: CycloneDXComponent{Type: "application", BOMRef: rootRef, Name: modulePath, Version: version, PURL: rootRef},
+		},
+		Components:   []CycloneDXComponent{},
+		Dependencies: []CycloneDXDependency{},
+	}
+	for _, path := range skipped {
+		bom.Metadata.Properties = append(bom.Metadata.Properties, CycloneDXProperty{Name: "go_parser:skipped_file", Value: path})
+	}
+
+	direct := []string{}
+	for _, module := range modules {
+		ref := modulePURL(module.Path, module.Version)
+		component := CycloneDXComponent{Type: "library", BOMRef: ref, Name: module.Path, Version: module.Version, PURL: ref}
+		if module.Direct {
+			direct = append(direct, ref)
+		}
+		component.Properties = []CycloneDXProperty{{Name: "go_parser:direct", Value: strconv.FormatBool(module.Direct)}}
+		if module.New {
+			component.Properties = append(component.Properties, CycloneDXProperty{Name: "go_parser:new", Value: "true"})
+		}
+		if module.Missing {
+			component.Properties = append(component.Properties, CycloneDXProperty{Name: "go_parser:missing_from_go_mod", Value: "true"})
+		}
+		bom.Components = append(bom.Components, component)
+	}
+	bom.Dependencies = append(bom.Dependencies, CycloneDXDependency{Ref: rootRef, DependsOn: direct})
+	return bom
+}
+
+func spdxDocument(modulePath, version string, modules []sbomModule, skipped []string) *SPDX {
+	doc := &SPDX{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              modulePath,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + modulePath + "-" + randomUUID(),
+		CreationInfo: SPDXCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: go_parser"},
+		},
+		Packages:      []SPDXPackage{},
+		Relationships: []SPDXRelationship{},
+	}
+	if len(skipped) > 0 {
+		doc.CreationInfo.Comment = "Files whose imports could not be read: " + strings.Join(skipped, ", ")
+	}
+
+	add := func(path, version, comment string) string {
+		id := fmt.Sprintf("SPDXRef-Package-%d", len(doc.Packages))
+		doc.Packages = append(doc.Packages, SPDXPackage{
+			Name:             path,
+			SPDXID:           id,
+			VersionInfo:      version,
+			DownloadLocation: "NOASSERTION",
+			ExternalRefs:     []SPDXExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: modulePURL(path, version)}},
+			Comment:          comment,
+		})
+		return id
+	}
+
+	rootID := add(modulePath, version, "")
+	doc.Relationships = append(doc.Relationships, SPDXRelationship{SPDXElementID: doc.SPDXID, RelationshipType: "DESCRIBES", RelatedSPDXElement: rootID})
+	for _, module := range modules {
+		notes := []string{}
+		if !module.Direct {
+			notes = append(notes, "indirect")
+		}
+		if module.New {
+			notes = append(notes, "new")
+		}
+		if module.Missing {
+			notes = append(notes, "missing from go.mod")
+		}
+		id := add(module.Path, module.Version, strings.Join(notes, "; "))
+		doc.Relationships = append(doc.Relationships, SPDXRelationship{SPDXElementID: rootID, RelationshipType: "DEPENDS_ON", RelatedSPDXElement: id})
+	}
+	return doc
+}
+
+// randomUUID returns a version 4 UUID
+func randomUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFixture writes files, by slash-separated path relative to dir
+func writeFixture(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fixtureModuleCache makes a module cache of the given module@version
+// directories, with their files, the one commands look modules up in for
+// the rest of the test
+func fixtureModuleCache(t *testing.T, modules map[string]map[string]string) string {
+	t.Helper()
+	cache := t.TempDir()
+	for spec, files := range modules {
+		dir := filepath.Join(cache, filepath.FromSlash(escapeModulePath(spec)))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFixture(t, dir, files)
+	}
+	previous, cached := goEnvValues["GOMODCACHE"]
+	goEnvValues["GOMODCACHE"] = cache
+	t.Cleanup(func() {
+		if cached {
+			goEnvValues["GOMODCACHE"] = previous
+		} else {
+			delete(goEnvValues, "GOMODCACHE")
+		}
+	})
+	return cache
+}
+
+// sbomFixture is a module requiring one direct and one indirect dependency,
+// also importing a module go.mod lacks, with a file whose imports cannot be
+// read
+var sbomFixture = map[string]string{
+	"go.mod": `module example.com/app
+
+go 1.21
+
+require (
+	example.com/dep v1.2.0
+	example.com/tool v0.4.1 // indirect
+)
+`,
+	"main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/app/internal/x"
+	"example.com/dep/sub"
+	"example.org/unlisted/pkg"
+)
+
+func main() { fmt.Println(x.X, sub.Y, pkg.Z) }
+`,
+	"internal/x/x.go": "package x\n\nconst X = 1\n",
+	"broken.go":       "package main\n\nimport (\n",
+}
+
+func collectFixtureModules(t *testing.T) (string, []sbomModule, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeFixture(t, dir, sbomFixture)
+	fixtureModuleCache(t, map[string]map[string]string{"example.org/unlisted@v0.3.0": {"pkg/pkg.go": "package pkg\n"}})
+
+	files, err := collectGoFiles([]string{filepath.Join(dir, "...")}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules, skipped, err := collectSBOMModules(files, dir, "example.com/app", map[string]string{"example.com/dep": "v1.1.0"})
+	if err != nil {
+		t.Fatalf("collectSBOMModules: %v", err)
+	}
+	return dir, modules, skipped
+}
+
+func TestCollectSBOMModules(t *testing.T) {
+	dir, modules, skipped := collectFixtureModules(t)
+	want := []sbomModule{
+		{Path: "example.com/dep", Version: "v1.2.0", Direct: true},
+		{Path: "example.com/tool", Version: "v0.4.1", New: true},
+		{Path: "example.org/unlisted", Version: "v0.3.0", Direct: true, New: true, Missing: true},
+	}
+	if len(modules) != len(want) {
+		t.Fatalf("modules = %+v, want %+v", modules, want)
+	}
+	for i := range want {
+		if modules[i] != want[i] {
+			t.Errorf("module %d = %+v, want %+v", i, modules[i], want[i])
+		}
+	}
+	if len(skipped) != 1 || skipped[0] != filepath.Join(dir, "broken.go") {
+		t.Errorf("skipped = %v, want broken.go", skipped)
+	}
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestCycloneDXDocument(t *testing.T) {
+	dir, modules, skipped := collectFixtureModules(t)
+	bom := cycloneDXDocument("example.com/app", "v1.0.0", modules, skipped)
+
+	if bom.BOMFormat != "CycloneDX" || bom.SpecVersion != "1.5" || bom.Version != 1 {
+		t.Errorf("header = %s %s %d", bom.BOMFormat, bom.SpecVersion, bom.Version)
+	}
+	if !uuidPattern.MatchString(strings.TrimPrefix(bom.SerialNumber, "urn:uuid:")) || !strings.HasPrefix(bom.SerialNumber, "urn:uuid:") {
+		t.Errorf("serialNumber = %s", bom.SerialNumber)
+	}
+	if _, err := time.Parse(time.RFC3339, bom.Metadata.Timestamp); err != nil {
+		t.Errorf("timestamp: %v", err)
+	}
+	root := bom.Metadata.Component
+	if root.BOMRef != "pkg:golang/example.com/app@v1.0.0" || root.PURL != root.BOMRef || root.Type != "application" {
+		t.Errorf("metadata component = %+v", root)
+	}
+	if len(bom.Metadata.Properties) != 1 || bom.Metadata.Properties[0].Value != filepath.Join(dir, "broken.go") {
+		t.Errorf("metadata properties = %+v, want the skipped file", bom.Metadata.Properties)
+	}
+
+	properties := func(component CycloneDXComponent) string {
+		list := []string{}
+		for _, property := range component.Properties {
+			list = append(list, property.Name+"="+property.Value)
+		}
+		return strings.Join(list, " ")
+	}
+	want := []struct {
+		purl       string
+		properties string
+	}{
+		{"pkg:golang/example.com/dep@v1.2.0", "go_parser:direct=true"},
+		{"pkg:golang/example.com/tool@v0.4.1", "go_parser:direct=false go_parser:new=true"},
+		{"pkg:golang/example.org/unlisted@v0.3.0", "go_parser:direct=true go_parser:new=true go_parser:missing_from_go_mod=true"},
+	}
+	if len(bom.Components) != len(want) {
+		t.Fatalf("components = %+v", bom.Components)
+	}
+	for i, component := range bom.Components {
+		if component.Type != "library" || component.PURL != want[i].purl || component.BOMRef != component.PURL {
+			t.Errorf("component %d = %+v, want %s", i, component, want[i].purl)
+		}
+		if got := properties(component); got != want[i].properties {
+			t.Errorf("component %s properties = %s, want %s", component.Name, got, want[i].properties)
+		}
+	}
+	if len(bom.Dependencies) != 1 || bom.Dependencies[0].Ref != root.BOMRef ||
+		strings.Join(bom.Dependencies[0].DependsOn, " ") != want[0].purl+" "+want[2].purl {
+		t.Errorf("dependencies = %+v, want the root on its direct modules", bom.Dependencies)
+	}
+
+	// The member names are the specification's, not the Go fields'
+	data, err := json.Marshal(bom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range []string{`"bomFormat":`, `"specVersion":`, `"serialNumber":`, `"bom-ref":`, `"purl":`, `"dependsOn":`} {
+		if !strings.Contains(string(data), member) {
+			t.Errorf("document lacks %s", member)
+		}
+	}
+}
+
+func TestSPDXDocument(t *testing.T) {
+	dir, modules, skipped := collectFixtureModules(t)
+	doc := spdxDocument("example.com/app", "v1.0.0", modules, skipped)
+
+	if doc.SPDXVersion != "SPDX-2.3" || doc.DataLicense != "CC0-1.0" || doc.SPDXID != "SPDXRef-DOCUMENT" || doc.Name != "example.com/app" {
+		t.Errorf("header = %s %s %s %s", doc.SPDXVersion, doc.DataLicense, doc.SPDXID, doc.Name)
+	}
+	if namespace := strings.TrimPrefix(doc.DocumentNamespace, "https://spdx.org/spdxdocs/example.com/app-"); !uuidPattern.MatchString(namespace) {
+		t.Errorf("documentNamespace = %s", doc.DocumentNamespace)
+	}
+	if _, err := time.Parse(time.RFC3339, doc.CreationInfo.Created); err != nil {
+		t.Errorf("created: %v", err)
+	}
+	if !strings.Contains(doc.CreationInfo.Comment, filepath.Join(dir, "broken.go")) {
+		t.Errorf("creation comment = %q, want the skipped file", doc.CreationInfo.Comment)
+	}
+
+	want := []struct {
+		name    string
+		purl    string
+		comment string
+	}{
+		{"example.com/app", "pkg:golang/example.com/app@v1.0.0", ""},
+		{"example.com/dep", "pkg:golang/example.com/dep@v1.2.0", ""},
+		{"example.com/tool", "pkg:golang/example.com/tool@v0.4.1", "indirect; new"},
+		{"example.org/unlisted", "pkg:golang/example.org/unlisted@v0.3.0", "new; missing from go.mod"},
+	}
+	if len(doc.Packages) != len(want) {
+		t.Fatalf("packages = %+v", doc.Packages)
+	}
+	for i, pkg := range doc.Packages {
+		if pkg.Name != want[i].name || pkg.Comment != want[i].comment || pkg.DownloadLocation != "NOASSERTION" {
+			t.Errorf("package %d = %+v, want %s", i, pkg, want[i].name)
+		}
+		if len(pkg.ExternalRefs) != 1 || pkg.ExternalRefs[0].ReferenceType != "purl" || pkg.ExternalRefs[0].ReferenceLocator != want[i].purl {
+			t.Errorf("package %s refs = %+v, want %s", pkg.Name, pkg.ExternalRefs, want[i].purl)
+		}
+	}
+
+	relationships := []string{}
+	for _, r := range doc.Relationships {
+		relationships = append(relationships, r.SPDXElementID+" "+r.RelationshipType+" "+r.RelatedSPDXElement)
+	}
+	wantRelationships := []string{
+		"SPDXRef-DOCUMENT DESCRIBES SPDXRef-Package-0",
+		"SPDXRef-Package-0 DEPENDS_ON SPDXRef-Package-1",
+		"SPDXRef-Package-0 DEPENDS_ON SPDXRef-Package-2",
+		"SPDXRef-Package-0 DEPENDS_ON SPDXRef-Package-3",
+	}
+	if strings.Join(relationships, "\n") != strings.Join(wantRelationships, "\n") {
+		t.Errorf("relationships =\n%s\nwant\n%s", strings.Join(relationships, "\n"), strings.Join(wantRelationships, "\n"))
+	}
+}
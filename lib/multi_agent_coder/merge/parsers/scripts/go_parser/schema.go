@@ -0,0 +1,329 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrorResult is the output of any command that fails
+type ErrorResult struct {
+	Error    string            `json:"error"`
+	Fallback *RecoveredOutline `json:"fallback,omitempty"`
+	Limit    *LimitExceeded    `json:"limit,omitempty"`
+}
+
+// commandOutputs registers the JSON document each command prints. "parse" is
+// the default command, "parse-batch" its output for several files and
+// "parse-tokens", "parse-outline" and "parse-ast" its other formats; "error" is printed by
+// every command on failure. The serve command's results are listed per method, as
+// "serve:<method>", "diff-tree" is diff's output for two directories and
+// "sbom-spdx" the sbom command's --format spdx document.
+// New output types must be added here for the schema subcommand to publish
+// them.
+var commandOutputs = []struct {
+	command string
+	output  interface{}
+}{
+	{"parse", Result{}},
+	{"parse-batch", BatchResult{}},
+	{"parse-tokens", TokenStream{}},
+	{"parse-outline", Outline{}},
+	{"parse-ast", ASTExport{}},
+	{"agreement", AgreementReport{}},
+	{"apply", ApplyResult{}},
+	{"benchcorpus", BenchReport{}},
+	{"change-coupling", ChangeCoupling{}},
+	{"checklist", ReviewChecklist{}},
+	{"compose", ComposeResult{}},
+	{"context", ContextPack{}},
+	{"delete-symbol", EditResult{}},
+	{"describe-change", ChangeDescription{}},
+	{"diff", SourceDiff{}},
+	{"diff-tree", TreeDiff{}},
+	{"difftest", DiffTestReport{}},
+	{"depsummary", DependencySummary{}},
+	{"depimpact", DependencyImpact{}},
+	{"equivalent", Equivalence{}},
+	{"gate", GateReport{}},
+	{"generate", GenerateResult{}},
+	{"hotspots", HotspotReport{}},
+	{"iface-gap", InterfaceGap{}},
+	{"impact", ImpactReport{}},
+	{"insert-symbol", EditResult{}},
+	{"licenses", LicenseReport{}},
+	{"merge", DeclMerge{}},
+	{"merge-body", BodyMerge{}},
+	{"packages", PackageAnalysis{}},
+	{"perf-hints", PerfHints{}},
+	{"pkg-graph", PackageGraph{}},
+	{"policy", PolicyReport{}},
+	{"provenance", ProvenanceQueryResult{}},
+	{"replace-symbol", EditResult{}},
+	{"result-diff", ResultDiff{}},
+	{"sbom", CycloneDX{}},
+	{"sbom-spdx", SPDX{}},
+	{"serve", ServeResponse{}},
+	{"serve:definition", DefinitionResult{}},
+	{"serve:hover", HoverResult{}},
+	{"serve:parse", Result{}},
+	{"serve:references", ReferencesResult{}},
+	{"similarity", SimilarityScore{}},
+	{"splice", EditResult{}},
+	{"test-map", TestMap{}},
+	{"transform", EditResult{}},
+	{"triage", TriageReport{}},
+	{"verify-merge", MergeVerdict{}},
+	{"vulncheck", VulnReport{}},
+	{"vocabulary", Vocabulary{}},
+	{"error", ErrorResult{}},
+}
+
+func runSchema(args []string) int {
+	format := "jsonschema"
+	compat := ""
+
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&format, "format", "jsonschema", "schema format: jsonschema or proto")
+	flags.StringVar(&compat, "compat", "", "describe a legacy output shape: v1")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	legacy, ok := compatOutputs[compat]
+	if compat != "" && !ok {
+		return fail("Invalid compat mode: %s", compat)
+	}
+
+	roots := map[string]reflect.Type{}
+	commands := []string{}
+	for _, entry := range commandOutputs {
+		if len(positional) > 0 && !contains(positional, entry.command) {
+			continue
+		}
+		output := entry.output
+		if legacy[entry.command] != nil {
+			output = legacy[entry.command]
+		}
+		roots[entry.command] = reflect.TypeOf(output)
+		commands = append(commands, entry.command)
+	}
+	for _, name := range positional {
+		if roots[name] == nil {
+			return fail("Unknown command: %s", name)
+		}
+	}
+
+	switch format {
+	case "jsonschema":
+		return printJSON(jsonSchema(commands, roots))
+	case "proto":
+		fmt.Print(protoSchema(commands, roots))
+		return 0
+	}
+	return fail("Invalid format: %s", format)
+}
+
+// jsonField is an exported struct field as encoding/json sees it
+type jsonField struct {
+	name      string
+	omitEmpty bool
+	typ       reflect.Type
+}
+
+// jsonFields lists the fields of a struct type that encoding/json encodes,
+// in declaration order
+func jsonFields(t reflect.Type) []jsonField {
+	fields := []jsonField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{name: name, omitEmpty: contains(parts[1:], "omitempty"), typ: field.Type})
+	}
+	return fields
+}
+
+// jsonSchema builds a draft 2020-12 schema with one definition per struct.
+// A single command's schema references its output type at the root; the
+// full document maps each command to its definition under x-commands.
+func jsonSchema(commands []string, roots map[string]reflect.Type) map[string]interface{} {
+	defs := map[string]interface{}{}
+	var define func(t reflect.Type) map[string]interface{}
+	define = func(t reflect.Type) map[string]interface{} {
+		switch t.Kind() {
+		case reflect.Ptr:
+			return define(t.Elem())
+		case reflect.Struct:
+			if _, ok := defs[t.Name()]; !ok {
+				defs[t.Name()] = nil
+				properties := map[string]interface{}{}
+				required := []string{}
+				for _, field := range jsonFields(t) {
+					schema := define(field.typ)
+					if !field.omitEmpty && nullable(field.typ) {
+						// nil slices, maps and pointers encode as null
+						schema = map[string]interface{}{"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+					}
+					properties[field.name] = schema
+					if !field.omitEmpty {
+						required = append(required, field.name)
+					}
+				}
+				defs[t.Name()] = map[string]interface{}{
+					"type":       "object",
+					"properties": properties,
+					"required":   required,
+				}
+			}
+			return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+		case reflect.Slice, reflect.Array:
+			return map[string]interface{}{"type": "array", "items": define(t.Elem())}
+		case reflect.Map:
+			return map[string]interface{}{"type": "object", "additionalProperties": define(t.Elem())}
+		case reflect.String:
+			return map[string]interface{}{"type": "string"}
+		case reflect.Bool:
+			return map[string]interface{}{"type": "boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return map[string]interface{}{"type": "integer"}
+		case reflect.Float32, reflect.Float64:
+			return map[string]interface{}{"type": "number"}
+		}
+		// interface{} values may hold anything
+		return map[string]interface{}{}
+	}
+
+	schema := map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "go_parser output",
+	}
+	if len(commands) == 1 {
+		schema["title"] = "go_parser " + commands[0] + " output"
+		schema["$ref"] = define(roots[commands[0]])["$ref"]
+	} else {
+		byCommand := map[string]string{}
+		oneOf := []interface{}{}
+		seen := map[string]bool{}
+		for _, command := range commands {
+			ref := define(roots[command])["$ref"].(string)
+			byCommand[command] = ref
+			if !seen[ref] {
+				seen[ref] = true
+				oneOf = append(oneOf, map[string]interface{}{"$ref": ref})
+			}
+		}
+		schema["oneOf"] = oneOf
+		schema["x-commands"] = byCommand
+	}
+	schema["$defs"] = defs
+	return schema
+}
+
+func nullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// protoSchema renders the output types as proto3 messages, numbering fields
+// in declaration order. interface{} fields become google.protobuf.Value.
+func protoSchema(commands []string, roots map[string]reflect.Type) string {
+	messages := map[string]string{}
+	order := []string{}
+	usesValue := false
+
+	var fieldType func(t reflect.Type) string
+	var define func(t reflect.Type)
+	fieldType = func(t reflect.Type) string {
+		switch t.Kind() {
+		case reflect.Ptr:
+			return fieldType(t.Elem())
+		case reflect.Struct:
+			define(t)
+			return t.Name()
+		case reflect.Slice, reflect.Array:
+			return "repeated " + fieldType(t.Elem())
+		case reflect.Map:
+			return "map<" + fieldType(t.Key()) + ", " + fieldType(t.Elem()) + ">"
+		case reflect.String:
+			return "string"
+		case reflect.Bool:
+			return "bool"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return "int64"
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return "uint64"
+		case reflect.Float32, reflect.Float64:
+			return "double"
+		}
+		usesValue = true
+		return "google.protobuf.Value"
+	}
+	define = func(t reflect.Type) {
+		if _, ok := messages[t.Name()]; ok {
+			return
+		}
+		messages[t.Name()] = ""
+		order = append(order, t.Name())
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "message %s {\n", t.Name())
+		for i, field := range jsonFields(t) {
+			typ := fieldType(field.typ)
+			if field.omitEmpty && !strings.HasPrefix(typ, "repeated ") && !strings.HasPrefix(typ, "map<") && field.typ.Kind() != reflect.Ptr {
+				typ = "optional " + typ
+			}
+			fmt.Fprintf(&b, "  %s %s = %d;\n", typ, field.name, i+1)
+		}
+		b.WriteString("}\n")
+		messages[t.Name()] = b.String()
+	}
+
+	for _, command := range commands {
+		define(roots[command])
+	}
+
+	var b strings.Builder
+	b.WriteString("syntax = \"proto3\";\n\npackage go_parser;\n\n")
+	if usesValue {
+		b.WriteString("import \"google/protobuf/struct.proto\";\n\n")
+	}
+	byOutput := map[string][]string{}
+	for _, command := range commands {
+		name := roots[command].Name()
+		byOutput[name] = append(byOutput[name], command)
+	}
+	outputs := make([]string, 0, len(byOutput))
+	for name := range byOutput {
+		outputs = append(outputs, name)
+	}
+	sort.Strings(outputs)
+	for _, name := range outputs {
+		fmt.Fprintf(&b, "// %s: %s\n", strings.Join(byOutput[name], ", "), name)
+	}
+	for _, name := range order {
+		b.WriteString("\n")
+		b.WriteString(messages[name])
+	}
+	return b.String()
+}
@@ -0,0 +1,718 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ServeRequest is one line of input to the serve command, a JSON-RPC 2.0
+// request; one without an id is a notification and gets no response. Positions are
+// 1-based lines and byte columns, as in every other position go_parser
+// reports. Content, Sanitize and Tokenizer are for parse: the source to
+// analyze instead of the file on disk, and the --sanitize and --tokenizer
+// settings.
+type ServeRequest struct {
+	JSONRPC string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  struct {
+		File      string  `json:"file"`
+		Line      int     `json:"line"`
+		Column    int     `json:"column"`
+		Content   *string `json:"content,omitempty"`
+		Sanitize  string  `json:"sanitize,omitempty"`
+		Tokenizer string  `json:"tokenizer,omitempty"`
+	} `json:"params"`
+}
+
+// ServeResponse is the JSON-RPC 2.0 response to a request: its id, null when
+// the request could not be read, and either a result or an error
+type ServeResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *ServeError     `json:"error,omitempty"`
+}
+
+// ServeError is a JSON-RPC 2.0 error. Data holds the error as other commands
+// print it, with the recovered fallback or exceeded limit of a parse request.
+type ServeError struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Data    *ErrorResult `json:"data,omitempty"`
+}
+
+// JSON-RPC 2.0 error codes; a handler's own failures, such as source that
+// does not parse, use the first code of the server error range
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	rpcServerError    = -32000
+)
+
+// paramsError is a request whose params its method cannot use
+type paramsError struct {
+	message string
+}
+
+func (e *paramsError) Error() string {
+	return e.message
+}
+
+func invalidParams(format string, args ...interface{}) error {
+	return &paramsError{message: fmt.Sprintf(format, args...)}
+}
+
+// newServeError builds an error response's error, carrying the message as
+// the data too
+func newServeError(code int, message string) *ServeError {
+	return &ServeError{Code: code, Message: message, Data: &ErrorResult{Error: message}}
+}
+
+// Location is a position in a source file
+type Location struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// HoverResult describes the declaration of the identifier under the cursor
+type HoverResult struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Signature string    `json:"signature"`
+	Doc       string    `json:"doc,omitempty"`
+	Location  *Location `json:"location"`
+}
+
+// DefinitionResult lists where the identifier under the cursor may be
+// declared. Selectors on values resolve by name, so a method or field name
+// declared on several types yields each of them.
+type DefinitionResult struct {
+	Locations []Location `json:"locations"`
+}
+
+// ReferencesResult lists the uses of the identifier under the cursor, and
+// the files of the repository that were skipped because they do not parse
+type ReferencesResult struct {
+	References []SymbolReference `json:"references"`
+	Errors     []FileError       `json:"errors"`
+}
+
+// serveMethods maps a request method to its handler
+var serveMethods = map[string]func(index *repoIndex, req *ServeRequest) (interface{}, error){
+	"hover":      serveHover,
+	"definition": serveDefinition,
+	"references": serveReferences,
+	"parse":      serveParse,
+}
+
+// parseFailure is a parse request's error for source that does not parse,
+// answered with its recovered outline as the fallback, or with the limit it
+// exceeds
+type parseFailure struct {
+	err      error
+	fallback *RecoveredOutline
+	limit    *LimitExceeded
+}
+
+func (f *parseFailure) Error() string {
+	return "Parse error: " + f.err.Error()
+}
+
+func runServe(args []string) int {
+	root := "."
+
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&root, "root", ".", "repository to answer queries over")
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	index, err := newRepoIndex(root)
+	if err != nil {
+		return fail("Failed to index repository: %v", err)
+	}
+	return serve(index, os.Stdin, os.Stdout)
+}
+
+// serve answers line-delimited JSON-RPC requests until EOF or a "shutdown"
+// request. A bad request gets an error response; it never stops the server.
+func serve(index *repoIndex, in io.Reader, out io.Writer) int {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	encoder := json.NewEncoder(out)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var req ServeRequest
+		response := ServeResponse{JSONRPC: "2.0"}
+		if err := json.Unmarshal(line, &req); err != nil {
+			code := rpcInvalidRequest
+			if !json.Valid(line) {
+				code = rpcParseError
+			}
+			response.Error = newServeError(code, fmt.Sprintf("Invalid request: %v", err))
+		} else if req.Method == "shutdown" {
+			encoder.Encode(ServeResponse{JSONRPC: "2.0", ID: req.ID, Result: true})
+			return 0
+		} else {
+			index.compact(minCompaction)
+			response = dispatch(index, &req)
+			if req.ID == nil {
+				continue
+			}
+		}
+		if err := encoder.Encode(response); err != nil {
+			return fail("Failed to write response: %v", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fail("Failed to read request: %v", err)
+	}
+	return 0
+}
+
+// dispatch answers a request with its method's handler. A handler that
+// panics, on input no analysis anticipated, answers with an error so the
+// server keeps serving.
+func dispatch(index *repoIndex, req *ServeRequest) (response ServeResponse) {
+	response.JSONRPC, response.ID = "2.0", req.ID
+	if (req.JSONRPC != "" && req.JSONRPC != "2.0") || req.Method == "" {
+		response.Error = newServeError(rpcInvalidRequest, "Invalid request: not a JSON-RPC 2.0 call")
+		return response
+	}
+	handler, ok := serveMethods[req.Method]
+	if !ok {
+		response.Error = newServeError(rpcMethodNotFound, "Unknown method: "+req.Method)
+		return response
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			response.Result = nil
+			response.Error = newServeError(rpcInternalError, fmt.Sprintf("Internal error in %s: %v", req.Method, recovered))
+		}
+	}()
+	result, err := handler(index, req)
+	if err != nil {
+		code := rpcServerError
+		if _, ok := err.(*paramsError); ok {
+			code = rpcInvalidParams
+		}
+		response.Error = newServeError(code, err.Error())
+		if failure, ok := err.(*parseFailure); ok {
+			response.Error.Data.Fallback, response.Error.Data.Limit = failure.fallback, failure.limit
+		}
+		return response
+	}
+	response.Result = result
+	return response
+}
+
+// repoIndex holds the parsed files of a repository, reparsing any file that
+// changed on disk since it was last read. Reparsed files stay in the shared
+// FileSet, so compact rebuilds it once they outweigh the live ones.
+type repoIndex struct {
+	root  string
+	fset  *token.FileSet
+	files map[string]*indexedFile
+}
+
+type indexedFile struct {
+	modified time.Time
+	file     *ast.File
+}
+
+func newRepoIndex(root string) (*repoIndex, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	index := &repoIndex{root: abs, fset: token.NewFileSet(), files: map[string]*indexedFile{}}
+
+	paths, err := index.repoFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		// Broken files are indexed once they parse
+		index.load(path)
+	}
+	return index, nil
+}
+
+func (index *repoIndex) repoFiles() ([]string, error) {
+	return collectGoFiles([]string{filepath.Join(index.root, "...")}, true)
+}
+
+// minCompaction is the size of the reparsed files, in bytes, to reach before
+// the index's FileSet is rebuilt
+const minCompaction = 16 << 20
+
+// compact rebuilds the index with a fresh FileSet when the files it parsed
+// and no longer uses take more space in the current one than the files it
+// holds, and at least minStale bytes. It runs between requests, as it
+// invalidates every position.
+func (index *repoIndex) compact(minStale int) {
+	live := 0
+	for _, cached := range index.files {
+		live += index.fset.File(cached.file.Pos()).Size() + 1
+	}
+	if stale := index.fset.Base() - 1 - live; stale < minStale || stale < live {
+		return
+	}
+	fresh := &repoIndex{root: index.root, fset: token.NewFileSet(), files: map[string]*indexedFile{}}
+	for path := range index.files {
+		fresh.load(path)
+	}
+	index.fset, index.files = fresh.fset, fresh.files
+}
+
+// load returns the parsed file at path, which may lie outside the root
+func (index *repoIndex) load(path string) (*ast.File, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if cached := index.files[abs]; cached != nil && cached.modified.Equal(info.ModTime()) {
+		return cached.file, nil
+	}
+
+	file, err := parser.ParseFile(index.fset, abs, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	index.files[abs] = &indexedFile{modified: info.ModTime(), file: file}
+	return file, nil
+}
+
+// packageFiles returns the files in dir that belong to package name
+func (index *repoIndex) packageFiles(dir, name string) []*ast.File {
+	paths, err := collectGoFiles([]string{dir}, true)
+	if err != nil {
+		return nil
+	}
+	files := []*ast.File{}
+	for _, path := range paths {
+		if file, err := index.load(path); err == nil && file.Name.Name == name {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// allFiles returns every parseable file of the repository
+func (index *repoIndex) allFiles() []*ast.File {
+	paths, _ := index.repoFiles()
+	files := []*ast.File{}
+	for _, path := range paths {
+		if file, err := index.load(path); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// importedPackage returns the name and files of the package in source, a
+// directory found by packageSourceDir
+func (index *repoIndex) importedPackage(source string) (string, []*ast.File) {
+	if source == "" {
+		return "", nil
+	}
+	paths, err := collectGoFiles([]string{source}, false)
+	if err != nil {
+		return "", nil
+	}
+	for _, path := range paths {
+		if file, err := index.load(path); err == nil {
+			return file.Name.Name, index.packageFiles(source, file.Name.Name)
+		}
+	}
+	return "", nil
+}
+
+func (index *repoIndex) location(pos token.Pos) *Location {
+	position := index.fset.Position(pos)
+	return &Location{File: position.Filename, Line: position.Line, Column: position.Column}
+}
+
+// cursor is the identifier at a request's position and its context
+type cursor struct {
+	file      *ast.File
+	path      string
+	ident     *ast.Ident
+	selector  *ast.SelectorExpr // set when ident is the selected name
+	enclosing *ast.FuncDecl
+}
+
+func (index *repoIndex) cursorAt(req *ServeRequest) (*cursor, error) {
+	if req.Params.File == "" {
+		return nil, invalidParams("no file in request")
+	}
+	file, err := index.load(req.Params.File)
+	if err != nil {
+		return nil, err
+	}
+	tokenFile := index.fset.File(file.Pos())
+	if req.Params.Line < 1 || req.Params.Line > tokenFile.LineCount() || req.Params.Column < 1 {
+		return nil, invalidParams("position %d:%d is outside the file", req.Params.Line, req.Params.Column)
+	}
+	pos := tokenFile.LineStart(req.Params.Line) + token.Pos(req.Params.Column-1)
+
+	c := &cursor{file: file, path: tokenFile.Name()}
+	var parent ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil || pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+		if fn, ok := n.(*ast.FuncDecl); ok {
+			c.enclosing = fn
+		}
+		if ident, ok := n.(*ast.Ident); ok {
+			c.ident = ident
+			if sel, ok := parent.(*ast.SelectorExpr); ok && sel.Sel == ident {
+				c.selector = sel
+			}
+			return false
+		}
+		parent = n
+		return true
+	})
+	if c.ident == nil {
+		return nil, fmt.Errorf("no identifier at %d:%d", req.Params.Line, req.Params.Column)
+	}
+	return c, nil
+}
+
+// declaration is a resolved declaration of the identifier under the cursor
+type declaration struct {
+	name string
+	kind string
+	node ast.Node
+	doc  *ast.CommentGroup
+	// package-level declarations can be searched for references
+	topLevel   bool
+	importPath string
+}
+
+// resolve finds the declarations the cursor's identifier may refer to: the
+// package-level symbol for qualified identifiers, methods and fields by name
+// for other selectors (in the file's package, else anywhere in the
+// repository), the local object the file resolves it to, and
+// otherwise a package-level symbol of the file's package
+func (index *repoIndex) resolve(c *cursor) []declaration {
+	dir := filepath.Dir(c.path)
+
+	if c.selector != nil {
+		if x, ok := c.selector.X.(*ast.Ident); ok && x.Obj == nil {
+			for _, imp := range c.file.Imports {
+				importPath := strings.Trim(imp.Path.Value, `"`)
+				name, files := index.importedPackage(packageSourceDir(importPath, dir))
+				if imp.Name != nil {
+					name = imp.Name.Name
+				}
+				if name == "" || name != x.Name {
+					continue
+				}
+				decls := topLevelDeclarations(files, c.ident.Name)
+				for i := range decls {
+					decls[i].importPath = importPath
+				}
+				return decls
+			}
+		}
+		// Members of types from other packages are looked up repository-wide
+		if decls := memberDeclarations(index.packageFiles(dir, c.file.Name.Name), c); len(decls) > 0 {
+			return decls
+		}
+		return memberDeclarations(index.allFiles(), c)
+	}
+
+	if obj := c.ident.Obj; obj != nil {
+		if decls := topLevelDeclarations([]*ast.File{c.file}, c.ident.Name); len(decls) > 0 && c.file.Scope.Lookup(c.ident.Name) == obj {
+			return decls
+		}
+		if node, ok := obj.Decl.(ast.Node); ok {
+			return []declaration{{name: obj.Name, kind: obj.Kind.String(), node: localDeclNode(node, obj.Name)}}
+		}
+	}
+	return topLevelDeclarations(index.packageFiles(dir, c.file.Name.Name), c.ident.Name)
+}
+
+// topLevelDeclarations finds package-level symbols named name in files.
+// Methods are spelled Type.Method and so never match a plain name.
+func topLevelDeclarations(files []*ast.File, name string) []declaration {
+	decls := []declaration{}
+	for _, file := range files {
+		for _, symbol := range topLevelSymbols(file) {
+			if symbol.name == name {
+				decls = append(decls, declaration{name: name, kind: symbol.kind, node: symbol.node, doc: symbol.doc, topLevel: true})
+			}
+		}
+	}
+	return decls
+}
+
+// memberDeclarations resolves x.Name to the methods and struct fields of
+// the package with that name, narrowed to the enclosing method's receiver
+// type when x is its receiver
+func memberDeclarations(files []*ast.File, c *cursor) []declaration {
+	receiver := ""
+	if x, ok := c.selector.X.(*ast.Ident); ok && c.enclosing != nil && x.Name == receiverVarName(c.enclosing) {
+		receiver = receiverTypeName(c.enclosing)
+	}
+
+	name := c.ident.Name
+	decls := []declaration{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv != nil && d.Name.Name == name && (receiver == "" || receiverTypeName(d) == receiver) {
+					decls = append(decls, declaration{name: symbolName(d), kind: "method", node: d, doc: d.Doc, topLevel: true})
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok || (receiver != "" && ts.Name.Name != receiver) {
+						continue
+					}
+					st, ok := ts.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					for _, field := range st.Fields.List {
+						for _, fieldName := range field.Names {
+							if fieldName.Name == name {
+								decls = append(decls, declaration{name: ts.Name.Name + "." + name, kind: "field", node: field, doc: field.Doc})
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// localDeclNode narrows a local object's declaration to the part naming it
+func localDeclNode(node ast.Node, name string) ast.Node {
+	if assign, ok := node.(*ast.AssignStmt); ok {
+		for _, lhs := range assign.Lhs {
+			if ident, ok := lhs.(*ast.Ident); ok && ident.Name == name {
+				return ident
+			}
+		}
+	}
+	return node
+}
+
+// serveParse analyzes a file as the default command does, with its default
+// thresholds. The file is named by params.file and read from disk unless
+// params.content holds its source.
+func serveParse(index *repoIndex, req *ServeRequest) (interface{}, error) {
+	opts := defaultOptions()
+	opts.tokenizer = req.Params.Tokenizer
+	if req.Params.Sanitize != "" {
+		opts.sanitize = req.Params.Sanitize
+	}
+	if !isValidSanitizeMode(opts.sanitize) {
+		return nil, invalidParams("invalid sanitize mode %s", opts.sanitize)
+	}
+	if _, ok := tokenizers[opts.tokenizer]; opts.tokenizer != "" && !ok {
+		return nil, invalidParams("invalid tokenizer %s", opts.tokenizer)
+	}
+
+	path := req.Params.File
+	var content []byte
+	if req.Params.Content != nil {
+		content = []byte(*req.Params.Content)
+		if path == "" {
+			path = stdinPath
+		}
+	} else {
+		if path == "" {
+			return nil, invalidParams("no file or content in request")
+		}
+		var err error
+		if content, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := analyzeSource(path, content, opts)
+	if err != nil {
+		fallback, limit := parseFallback(content, err)
+		return nil, &parseFailure{err: err, fallback: fallback, limit: limit}
+	}
+	return result, nil
+}
+
+func serveDefinition(index *repoIndex, req *ServeRequest) (interface{}, error) {
+	c, err := index.cursorAt(req)
+	if err != nil {
+		return nil, err
+	}
+	result := &DefinitionResult{Locations: []Location{}}
+	for _, decl := range index.resolve(c) {
+		result.Locations = append(result.Locations, *index.location(declNamePos(decl.node, c.ident.Name)))
+	}
+	return result, nil
+}
+
+func serveHover(index *repoIndex, req *ServeRequest) (interface{}, error) {
+	c, err := index.cursorAt(req)
+	if err != nil {
+		return nil, err
+	}
+	decls := index.resolve(c)
+	if len(decls) == 0 {
+		return nil, fmt.Errorf("no declaration found for %s", c.ident.Name)
+	}
+
+	decl := decls[0]
+	hover := &HoverResult{
+		Name:      decl.name,
+		Kind:      decl.kind,
+		Signature: hoverSignature(index.fset, decl),
+		Location:  index.location(declNamePos(decl.node, c.ident.Name)),
+	}
+	if decl.doc != nil {
+		hover.Doc = strings.TrimSpace(decl.doc.Text())
+	}
+	return hover, nil
+}
+
+// serveReferences finds package-level symbols' references across the
+// repository by name, as delete-symbol does, and a local's uses by the
+// object the file resolves them to
+func serveReferences(index *repoIndex, req *ServeRequest) (interface{}, error) {
+	c, err := index.cursorAt(req)
+	if err != nil {
+		return nil, err
+	}
+	decls := index.resolve(c)
+	if len(decls) == 0 {
+		return nil, fmt.Errorf("no declaration found for %s", c.ident.Name)
+	}
+	decl := decls[0]
+	result := &ReferencesResult{References: []SymbolReference{}, Errors: []FileError{}}
+
+	if !decl.topLevel {
+		obj := c.ident.Obj
+		ast.Inspect(c.file, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && obj != nil && ident.Obj == obj && ident.Pos() != declNamePos(decl.node, ident.Name) {
+				pos := index.fset.Position(ident.Pos())
+				result.References = append(result.References, SymbolReference{File: pos.Filename, Line: pos.Line, Column: pos.Column})
+			}
+			return true
+		})
+		return result, nil
+	}
+
+	declFile := index.fset.Position(decl.node.Pos()).Filename
+	file, err := loadEditFile(declFile)
+	if err != nil {
+		return nil, err
+	}
+	symbol := findSymbol(file.file, decl.name)
+	if symbol == nil {
+		return nil, fmt.Errorf("%s is no longer declared in %s", decl.name, declFile)
+	}
+	target, err := newReferenceTarget(file, symbol)
+	if err != nil {
+		return nil, err
+	}
+	if decl.importPath != "" {
+		target.importPath = decl.importPath
+	}
+
+	paths, err := index.repoFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		indexed, err := index.load(path)
+		if err != nil {
+			result.Errors = append(result.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+		result.References = append(result.References, fileReferences(index.fset, path, indexed, target)...)
+	}
+	return result, nil
+}
+
+// declNamePos returns the position of name within a declaration node
+func declNamePos(node ast.Node, name string) token.Pos {
+	switch d := node.(type) {
+	case *ast.FuncDecl:
+		return d.Name.Pos()
+	case *ast.TypeSpec:
+		return d.Name.Pos()
+	}
+
+	pos, found := node.Pos(), false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && !found && ident.Name == name {
+			pos, found = ident.Pos(), true
+		}
+		return !found
+	})
+	return pos
+}
+
+// hoverSignature formats a declaration's header: functions without their
+// body, grouped specs with their keyword, locals with their declared type
+func hoverSignature(fset *token.FileSet, decl declaration) string {
+	switch node := decl.node.(type) {
+	case ast.Decl:
+		return declSignature(fset, node)
+	case *ast.TypeSpec:
+		spec := *node
+		spec.Doc, spec.Comment = nil, nil
+		return "type " + formatNode(fset, &spec)
+	case *ast.ValueSpec:
+		spec := *node
+		spec.Doc, spec.Comment = nil, nil
+		return decl.kind + " " + formatNode(fset, &spec)
+	case *ast.Field:
+		return decl.kind + " " + decl.name + " " + types.ExprString(node.Type)
+	}
+	return decl.kind + " " + decl.name
+}
+
+func formatNode(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
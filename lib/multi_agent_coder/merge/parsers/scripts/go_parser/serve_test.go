@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeErrors(t *testing.T) {
+	serveMethods["panic"] = func(*repoIndex, *ServeRequest) (interface{}, error) {
+		panic("boom")
+	}
+	defer delete(serveMethods, "panic")
+
+	index, err := newRepoIndex(t.TempDir())
+	if err != nil {
+		t.Fatalf("newRepoIndex: %v", err)
+	}
+	requests := []string{
+		`not json`,
+		`[1, 2]`,
+		`{"jsonrpc": "2.0", "id": 1, "method": "rename"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "panic"}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "parse", "params": {"content": "}}}"}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "parse", "params": {"content": "package p\n\nconst X = true + 1\n"}}`,
+		`{"jsonrpc": "2.0", "method": "parse", "params": {"content": "package p\n"}}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "hover", "params": {}}`,
+		`{"jsonrpc": "1.0", "id": 6, "method": "parse"}`,
+		`{"jsonrpc": "2.0", "id": 7, "method": "shutdown"}`,
+		`{"jsonrpc": "2.0", "id": 8, "method": "parse"}`,
+	}
+	var out bytes.Buffer
+	if code := serve(index, strings.NewReader(strings.Join(requests, "\n")), &out); code != 0 {
+		t.Fatalf("serve exited with %d", code)
+	}
+
+	tests := []struct {
+		id      string
+		code    int
+		message string
+	}{
+		{"null", rpcParseError, "Invalid request"},
+		{"null", rpcInvalidRequest, "Invalid request"},
+		{"1", rpcMethodNotFound, "Unknown method: rename"},
+		{"2", rpcInternalError, "Internal error in panic: boom"},
+		{"3", rpcServerError, "Parse error"},
+		{"4", 0, ""},
+		{"5", rpcInvalidParams, "no file in request"},
+		{"6", rpcInvalidRequest, "Invalid request"},
+		{"7", 0, ""},
+	}
+	decoder := json.NewDecoder(&out)
+	for _, tt := range tests {
+		var response ServeResponse
+		if err := decoder.Decode(&response); err != nil {
+			t.Fatalf("response %s: %v", tt.id, err)
+		}
+		if response.JSONRPC != "2.0" || string(response.ID) != tt.id {
+			t.Errorf("jsonrpc, id = %q, %s, want \"2.0\", %s", response.JSONRPC, response.ID, tt.id)
+		}
+		switch {
+		case tt.code == 0 && response.Error != nil:
+			t.Errorf("response %s: unexpected error %+v", tt.id, response.Error)
+		case tt.code != 0 && response.Error == nil:
+			t.Errorf("response %s: no error, want code %d", tt.id, tt.code)
+		case tt.code != 0 && (response.Error.Code != tt.code || !strings.HasPrefix(response.Error.Message, tt.message)):
+			t.Errorf("response %s: error = %d %q, want %d %q", tt.id, response.Error.Code, response.Error.Message, tt.code, tt.message)
+		}
+	}
+	if decoder.More() {
+		t.Error("a notification or a request after shutdown was answered")
+	}
+}
+
+// TestServeEnvelope checks a request's id comes back exactly as sent, and a
+// result and an error each round-trip as JSON-RPC 2.0 members
+func TestServeEnvelope(t *testing.T) {
+	index, err := newRepoIndex(t.TempDir())
+	if err != nil {
+		t.Fatalf("newRepoIndex: %v", err)
+	}
+	requests := []string{
+		`{"jsonrpc": "2.0", "id": "a-1", "method": "parse", "params": {"content": "package p\n\nfunc F() {}\n"}}`,
+		`{"jsonrpc": "2.0", "id": 42, "method": "parse", "params": {"content": "}}}"}}`,
+	}
+	var out bytes.Buffer
+	if code := serve(index, strings.NewReader(strings.Join(requests, "\n")), &out); code != 0 {
+		t.Fatalf("serve exited with %d", code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d responses, want 2:\n%s", len(lines), out.String())
+	}
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(lines[0]), &result); err != nil {
+		t.Fatal(err)
+	}
+	if string(result["jsonrpc"]) != `"2.0"` || string(result["id"]) != `"a-1"` || result["result"] == nil {
+		t.Errorf("result response = %s", lines[0])
+	}
+	if _, ok := result["error"]; ok {
+		t.Errorf("result response has an error member: %s", lines[0])
+	}
+
+	var failure struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  json.RawMessage `json:"result"`
+		Error   struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Data    struct {
+				Error    string          `json:"error"`
+				Fallback json.RawMessage `json:"fallback"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &failure); err != nil {
+		t.Fatal(err)
+	}
+	if failure.JSONRPC != "2.0" || string(failure.ID) != "42" || failure.Result != nil {
+		t.Errorf("error response = %s", lines[1])
+	}
+	if failure.Error.Code != rpcServerError || failure.Error.Message == "" || failure.Error.Data.Error != failure.Error.Message || failure.Error.Data.Fallback == nil {
+		t.Errorf("error member = %+v", failure.Error)
+	}
+}
+
+func TestServeReferences(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":    "module example.com/m\n",
+		"a.go":      "package m\n\nfunc Helper() {}\n",
+		"b.go":      "package m\n\nfunc Use() { Helper() }\n",
+		"broken.go": "}}}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index, err := newRepoIndex(dir)
+	if err != nil {
+		t.Fatalf("newRepoIndex: %v", err)
+	}
+
+	references := func() *ReferencesResult {
+		t.Helper()
+		req := &ServeRequest{Method: "references"}
+		req.Params.File, req.Params.Line, req.Params.Column = filepath.Join(dir, "a.go"), 3, 6
+		result, err := serveReferences(index, req)
+		if err != nil {
+			t.Fatalf("references: %v", err)
+		}
+		return result.(*ReferencesResult)
+	}
+
+	result := references()
+	if len(result.References) != 1 || filepath.Base(result.References[0].File) != "b.go" || result.References[0].Column != 14 {
+		t.Errorf("references = %+v, want the call in b.go", result.References)
+	}
+	if len(result.Errors) != 1 || filepath.Base(result.Errors[0].Path) != "broken.go" {
+		t.Errorf("errors = %+v, want broken.go", result.Errors)
+	}
+
+	// Reparsing a changed file leaves the old one in the FileSet until the
+	// index is compacted
+	path := filepath.Join(dir, "b.go")
+	for i := 1; i <= 3; i++ {
+		modified := time.Now().Add(time.Duration(i) * time.Second)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := index.load(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := index.fset.Base()
+	index.compact(0)
+	if after := index.fset.Base(); after >= before {
+		t.Errorf("FileSet base = %d after compaction, was %d", after, before)
+	}
+	if result := references(); len(result.References) != 1 || result.References[0].Column != 14 {
+		t.Errorf("references after compaction = %+v", result.References)
+	}
+}
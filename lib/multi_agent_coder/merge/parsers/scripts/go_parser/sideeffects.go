@@ -0,0 +1,205 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// SideEffectCall is a call or reference with an effect outside the
+// function: Call is the name as qualified by the package's own name, such as
+// "os.ReadFile" or "exec.Command", whatever the file imports it as. Function
+// is the enclosing declaration, "Type.Method" for methods, and empty at the
+// package level.
+type SideEffectCall struct {
+	Category string `json:"category"`
+	Call     string `json:"call"`
+	Function string `json:"function,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// sideEffectCategoryOrder is the taxonomy, in the order side_effects lists
+// the categories a file has
+var sideEffectCategoryOrder = []string{"filesystem", "network", "process", "environment", "time", "randomness", "console", "global_state"}
+
+// sideEffectCalls classifies the standard (and a few common third-party)
+// functions and variables by effect, keyed by package name and member
+var sideEffectCalls = map[string]string{
+	"os.Create": "filesystem", "os.CreateTemp": "filesystem", "os.Open": "filesystem", "os.OpenFile": "filesystem",
+	"os.ReadFile": "filesystem", "os.WriteFile": "filesystem", "os.ReadDir": "filesystem", "os.Remove": "filesystem",
+	"os.RemoveAll": "filesystem", "os.Rename": "filesystem", "os.Mkdir": "filesystem", "os.MkdirAll": "filesystem",
+	"os.MkdirTemp": "filesystem", "os.Stat": "filesystem", "os.Lstat": "filesystem", "os.Chmod": "filesystem",
+	"os.Chown": "filesystem", "os.Chtimes": "filesystem", "os.Symlink": "filesystem", "os.Link": "filesystem",
+	"os.Readlink": "filesystem", "os.Truncate": "filesystem", "os.DirFS": "filesystem", "os.CopyFS": "filesystem",
+	"ioutil.ReadFile": "filesystem", "ioutil.WriteFile": "filesystem", "ioutil.ReadDir": "filesystem",
+	"ioutil.TempDir": "filesystem", "ioutil.TempFile": "filesystem",
+	"filepath.Walk": "filesystem", "filepath.WalkDir": "filesystem", "filepath.Glob": "filesystem",
+	"filepath.EvalSymlinks": "filesystem", "filepath.Abs": "filesystem",
+
+	"http.Get": "network", "http.Head": "network", "http.Post": "network", "http.PostForm": "network",
+	"http.ListenAndServe": "network", "http.ListenAndServeTLS": "network", "http.Serve": "network",
+	"http.ServeTLS": "network", "http.DefaultClient": "network",
+	"smtp.SendMail": "network", "smtp.Dial": "network", "rpc.Dial": "network", "rpc.DialHTTP": "network",
+	"tls.Dial": "network", "tls.DialWithDialer": "network", "tls.Listen": "network",
+	"grpc.Dial": "network", "grpc.DialContext": "network", "grpc.NewClient": "network",
+
+	"exec.Command": "process", "exec.CommandContext": "process", "exec.LookPath": "process",
+	"os.StartProcess": "process", "os.FindProcess": "process", "os.Exit": "process",
+	"syscall.Exec": "process", "syscall.ForkExec": "process", "syscall.Kill": "process",
+	"signal.Notify": "process", "signal.NotifyContext": "process", "signal.Ignore": "process",
+
+	"os.Getenv": "environment", "os.Setenv": "environment", "os.Unsetenv": "environment",
+	"os.LookupEnv": "environment", "os.Environ": "environment", "os.Clearenv": "environment",
+	"os.ExpandEnv": "environment", "os.Hostname": "environment", "os.Getwd": "environment",
+	"os.Chdir": "environment", "os.UserHomeDir": "environment", "os.UserConfigDir": "environment",
+	"os.UserCacheDir": "environment", "os.TempDir": "environment", "os.Executable": "environment",
+	"os.Getpid": "environment", "os.Getuid": "environment", "os.Args": "environment",
+
+	"time.Now": "time", "time.Since": "time", "time.Until": "time", "time.Sleep": "time",
+	"time.After": "time", "time.AfterFunc": "time", "time.Tick": "time", "time.NewTimer": "time",
+	"time.NewTicker": "time",
+
+	"rand.Reader": "randomness",
+
+	"fmt.Print": "console", "fmt.Printf": "console", "fmt.Println": "console",
+	"log.Print": "console", "log.Printf": "console", "log.Println": "console", "log.Fatal": "console",
+	"log.Fatalf": "console", "log.Fatalln": "console", "log.Panic": "console", "log.Panicf": "console",
+	"log.Panicln": "console", "log.Output": "console", "slog.Debug": "console", "slog.Info": "console",
+	"slog.Warn": "console", "slog.Error": "console", "slog.Log": "console", "slog.LogAttrs": "console",
+	"os.Stdin": "console", "os.Stdout": "console", "os.Stderr": "console",
+	"print": "console", "println": "console",
+
+	"sync.Once": "global_state", "sync.OnceFunc": "global_state", "sync.OnceValue": "global_state",
+	"sync.OnceValues": "global_state",
+}
+
+// Members of net and math/rand, crypto/rand and math/rand/v2 are classified
+// by prefix: net's dialers, listeners and resolvers, and every random
+// function except the constructors and types, which draw nothing
+var (
+	networkPrefixes = []string{"net.Dial", "net.Listen", "net.Lookup", "net.Resolve", "net.FileConn", "net.FileListener"}
+	randSafeMembers = map[string]bool{
+		"New": true, "NewSource": true, "NewZipf": true, "NewPCG": true, "NewChaCha8": true,
+		"Rand": true, "Source": true, "Source64": true, "Zipf": true, "PCG": true, "ChaCha8": true,
+	}
+)
+
+// sideEffectCategory returns the category of a qualified name such as
+// "os.Getenv", or "" when it has no effect the taxonomy tracks
+func sideEffectCategory(name string) string {
+	if category, ok := sideEffectCalls[name]; ok {
+		return category
+	}
+	for _, prefix := range networkPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return "network"
+		}
+	}
+	if member, ok := strings.CutPrefix(name, "rand."); ok && !randSafeMembers[member] && !strings.Contains(member, ".") {
+		return "randomness"
+	}
+	return ""
+}
+
+// findSideEffects lists the effect sites of a file by enclosing declaration,
+// and the categories they fall in. Package names are resolved through the
+// file's imports, so an aliased import is recognized too. Global state is
+// an init function, sync.Once and its kin, and each assignment, increment,
+// delete or clear in a function of a package variable the file declares,
+// the call being the variable's name.
+func findSideEffects(fset *token.FileSet, file *ast.File) ([]string, []SideEffectCall) {
+	packages := map[string]string{}
+	for _, imp := range file.Imports {
+		info := importInfo{path: strings.Trim(imp.Path.Value, `"`)}
+		if imp.Name != nil {
+			info.name = imp.Name.Name
+		}
+		packages[info.localName()] = importInfo{path: info.path}.localName()
+	}
+
+	calls := []SideEffectCall{}
+	found := map[string]bool{}
+	for _, decl := range file.Decls {
+		function := ""
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			function = symbolName(fn)
+			if fn.Recv == nil && fn.Name.Name == "init" {
+				pos := fset.Position(fn.Pos())
+				calls = append(calls, SideEffectCall{Category: "global_state", Call: "init", Function: function, Line: pos.Line, Column: pos.Column})
+				found["global_state"] = true
+			}
+		}
+		mutated := func(n ast.Node, target ast.Expr) {
+			if ident := packageVar(file, target); ident != nil && function != "" {
+				pos := fset.Position(n.Pos())
+				calls = append(calls, SideEffectCall{Category: "global_state", Call: ident.Name, Function: function, Line: pos.Line, Column: pos.Column})
+				found["global_state"] = true
+			}
+		}
+		ast.Inspect(decl, func(n ast.Node) bool {
+			name := ""
+			switch node := n.(type) {
+			case *ast.AssignStmt:
+				if node.Tok != token.DEFINE {
+					for _, lhs := range node.Lhs {
+						mutated(node, lhs)
+					}
+				}
+			case *ast.IncDecStmt:
+				mutated(node, node.X)
+			case *ast.SelectorExpr:
+				if pkg, ok := node.X.(*ast.Ident); ok && pkg.Obj == nil && packages[pkg.Name] != "" {
+					name = packages[pkg.Name] + "." + node.Sel.Name
+				}
+			case *ast.CallExpr:
+				if ident, ok := node.Fun.(*ast.Ident); ok && ident.Obj == nil && (ident.Name == "print" || ident.Name == "println") {
+					name = ident.Name
+				}
+				if ident, ok := node.Fun.(*ast.Ident); ok && ident.Obj == nil && (ident.Name == "delete" || ident.Name == "clear") && len(node.Args) > 0 {
+					mutated(node, node.Args[0])
+				}
+			}
+			category := sideEffectCategory(name)
+			if name == "" || category == "" {
+				return true
+			}
+			pos := fset.Position(n.Pos())
+			calls = append(calls, SideEffectCall{Category: category, Call: name, Function: function, Line: pos.Line, Column: pos.Column})
+			found[category] = true
+			return true
+		})
+	}
+
+	categories := []string{}
+	for _, category := range sideEffectCategoryOrder {
+		if found[category] {
+			categories = append(categories, category)
+		}
+	}
+	return categories, calls
+}
+
+// packageVar returns the package variable an assigned expression such as
+// registry[name] or config.Timeout writes to, when the file declares it
+func packageVar(file *ast.File, expr ast.Expr) *ast.Ident {
+	for {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			if obj := file.Scope.Lookup(e.Name); obj != nil && obj == e.Obj && obj.Kind == ast.Var {
+				return e
+			}
+			return nil
+		case *ast.SelectorExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		default:
+			return nil
+		}
+	}
+}
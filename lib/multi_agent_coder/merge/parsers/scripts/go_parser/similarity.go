@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"go/scanner"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// SimilarityScore is the structural similarity of two files, from 0 for
+// nothing in common to 1 for the same structure. The files' tokens, with
+// identifiers and literal values replaced by their kind and comments and
+// semicolons left out, are cut into runs of K tokens; Score is the share
+// of runs the files have in common, counting repeats, so renames and
+// reformatting do not lower it. Files need not parse.
+type SimilarityScore struct {
+	A            string  `json:"a"`
+	B            string  `json:"b"`
+	Score        float64 `json:"score"`
+	Method       string  `json:"method"`
+	K            int     `json:"k"`
+	TokensA      int     `json:"tokens_a"`
+	TokensB      int     `json:"tokens_b"`
+	SharedRuns   int     `json:"shared_runs"`
+	DistinctRuns int     `json:"distinct_runs"`
+}
+
+func runSimilarity(args []string) int {
+	k := 4
+	keepIdentifiers := false
+
+	flags := flag.NewFlagSet("similarity", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.IntVar(&k, "k", k, "tokens per compared run")
+	flags.BoolVar(&keepIdentifiers, "keep-identifiers", false, "compare identifiers by name rather than as placeholders")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(positional) != 2 || k < 1 {
+		return fail("Usage: similarity [--k N] [--keep-identifiers] a.go b.go")
+	}
+
+	sources := make([][]byte, 2)
+	for i, path := range positional {
+		if sources[i], err = os.ReadFile(path); err != nil {
+			return fail("Failed to read %s: %v", path, err)
+		}
+	}
+	score := shingleSimilarity(structuralTokens(sources[0], keepIdentifiers), structuralTokens(sources[1], keepIdentifiers), k)
+	score.A, score.B = positional[0], positional[1]
+	return printJSON(score)
+}
+
+// structuralTokens lists the tokens of a file that make up its structure:
+// keywords and operators as written, identifiers and literals by kind, and
+// no comments or semicolons. The package clause
+// is left out, so files of differently named packages compare by their code.
+func structuralTokens(source []byte, keepIdentifiers bool) []string {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(source))
+	var s scanner.Scanner
+	s.Init(file, source, func(token.Position, string) {}, 0)
+
+	tokens := []string{}
+	for skip := 0; ; {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch {
+		case tok == token.PACKAGE && len(tokens) == 0:
+			skip = 1
+			continue
+		case skip > 0:
+			skip--
+			continue
+		case tok == token.SEMICOLON:
+			// Written or inserted at a line end, they are formatting
+			continue
+		case tok == token.IDENT && keepIdentifiers:
+			tokens = append(tokens, lit)
+		default:
+			// An identifier or literal prints as its kind
+			tokens = append(tokens, tok.String())
+		}
+	}
+	return tokens
+}
+
+// shingleSimilarity compares two token lists by their runs of k tokens as
+// multisets: the runs they share over all the runs either has. A list
+// shorter than k is a single run.
+func shingleSimilarity(a, b []string, k int) *SimilarityScore {
+	score := &SimilarityScore{Method: "token-shingles", K: k, TokensA: len(a), TokensB: len(b)}
+	runsA, runsB := tokenRuns(a, k), tokenRuns(b, k)
+	if len(runsA) == 0 && len(runsB) == 0 {
+		score.Score = 1
+		return score
+	}
+
+	shared, total := 0, 0
+	for run, countA := range runsA {
+		countB := runsB[run]
+		shared += min(countA, countB)
+		total += max(countA, countB)
+	}
+	for run, countB := range runsB {
+		if _, ok := runsA[run]; !ok {
+			total += countB
+		}
+	}
+	score.SharedRuns, score.DistinctRuns = shared, total-shared
+	score.Score = roundTo(float64(shared)/float64(total), 3)
+	return score
+}
+
+func tokenRuns(tokens []string, k int) map[string]int {
+	runs := map[string]int{}
+	if len(tokens) == 0 {
+		return runs
+	}
+	if len(tokens) < k {
+		runs[strings.Join(tokens, " ")]++
+		return runs
+	}
+	for i := 0; i+k <= len(tokens); i++ {
+		runs[strings.Join(tokens[i:i+k], " ")]++
+	}
+	return runs
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// Singleton is a package-level instance shared by the whole program. Kind is
+// sync_once (assigned inside a sync.Once, or built by sync.OnceValue),
+// lazy_nil_check (assigned behind an "== nil" check) or declaration (built
+// where it is declared). Accessor is the function that hands it out, for the
+// lazy kinds.
+type Singleton struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	Kind     string `json:"kind"`
+	Accessor string `json:"accessor,omitempty"`
+	Line     int    `json:"line"`
+
+	span SourceSpan
+}
+
+// idiomaticGlobals are package-level initializers that are constants in
+// spirit, such as sentinel errors and compiled patterns, not singletons
+var idiomaticGlobals = []string{
+	"errors.New", "fmt.Errorf", "regexp.MustCompile", "template.Must",
+	"flag.String", "flag.Bool", "flag.Int", "flag.Duration",
+}
+
+// findSingletons reports package-level variables that hold a single shared
+// instance of a type
+func findSingletons(fset *token.FileSet, file *ast.File) []Singleton {
+	singletons := []Singleton{}
+
+	globals := map[string]*ast.ValueSpec{}
+	onces := map[string]bool{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for _, name := range vs.Names {
+				globals[name.Name] = vs
+			}
+			if vs.Type != nil && types.ExprString(vs.Type) == "sync.Once" {
+				for _, name := range vs.Names {
+					onces[name.Name] = true
+				}
+			}
+		}
+	}
+
+	found := map[string]bool{}
+	add := func(s Singleton) {
+		if !found[s.Name] {
+			found[s.Name] = true
+			singletons = append(singletons, s)
+		}
+	}
+	typeOf := func(name string) string {
+		if vs := globals[name]; vs != nil && vs.Type != nil {
+			return types.ExprString(vs.Type)
+		}
+		return ""
+	}
+
+	// Lazily initialized instances, found from the functions assigning them
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.CallExpr:
+				sel, ok := node.Fun.(*ast.SelectorExpr)
+				if !ok || sel.Sel.Name != "Do" || len(node.Args) != 1 {
+					return true
+				}
+				if x, ok := sel.X.(*ast.Ident); !ok || !onces[x.Name] {
+					return true
+				}
+				for _, name := range assignedGlobals(node.Args[0], globals) {
+					add(Singleton{Name: name, Type: typeOf(name), Kind: "sync_once", Accessor: symbolName(fn), Line: fset.Position(globals[name].Pos()).Line, span: sourceSpan(fset, globals[name])})
+				}
+
+			case *ast.IfStmt:
+				name := nilCheckedGlobal(node.Cond, globals)
+				if name == "" || onces[name] {
+					return true
+				}
+				for _, assigned := range assignedGlobals(node.Body, globals) {
+					if assigned == name {
+						add(Singleton{Name: name, Type: typeOf(name), Kind: "lazy_nil_check", Accessor: symbolName(fn), Line: fset.Position(globals[name].Pos()).Line, span: sourceSpan(fset, globals[name])})
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	// Instances built where they are declared
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, value := range vs.Values {
+				if i >= len(vs.Names) || vs.Names[i].Name == "_" {
+					continue
+				}
+				if call, ok := value.(*ast.CallExpr); ok && strings.HasPrefix(getFuncName(call.Fun), "sync.OnceValue") {
+					add(Singleton{Name: vs.Names[i].Name, Kind: "sync_once", Accessor: vs.Names[i].Name, Line: fset.Position(vs.Names[i].Pos()).Line, span: sourceSpan(fset, vs.Names[i])})
+					continue
+				}
+				instanceType, ok := instanceInitializer(value)
+				if !ok {
+					continue
+				}
+				if vs.Type != nil {
+					instanceType = types.ExprString(vs.Type)
+				}
+				add(Singleton{
+					Name: vs.Names[i].Name,
+					Type: instanceType,
+					Kind: "declaration",
+					Line: fset.Position(vs.Names[i].Pos()).Line,
+					span: sourceSpan(fset, vs.Names[i]),
+				})
+			}
+		}
+	}
+
+	return singletons
+}
+
+// assignedGlobals lists the package-level variables assigned within node
+func assignedGlobals(node ast.Node, globals map[string]*ast.ValueSpec) []string {
+	names := []string{}
+	ast.Inspect(node, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || assign.Tok != token.ASSIGN {
+			return true
+		}
+		for _, lhs := range assign.Lhs {
+			// A local shadowing the global resolves to its own declaration
+			ident, ok := lhs.(*ast.Ident)
+			if !ok || globals[ident.Name] == nil {
+				continue
+			}
+			if ident.Obj != nil && ident.Obj.Decl != globals[ident.Name] {
+				continue
+			}
+			names = append(names, ident.Name)
+		}
+		return true
+	})
+	return names
+}
+
+// nilCheckedGlobal returns the global compared with nil in cond, if any
+func nilCheckedGlobal(cond ast.Expr, globals map[string]*ast.ValueSpec) string {
+	binary, ok := cond.(*ast.BinaryExpr)
+	if !ok || binary.Op != token.EQL {
+		return ""
+	}
+	for _, pair := range [][2]ast.Expr{{binary.X, binary.Y}, {binary.Y, binary.X}} {
+		ident, isIdent := pair[0].(*ast.Ident)
+		null, isNil := pair[1].(*ast.Ident)
+		if isIdent && isNil && null.Name == "nil" && globals[ident.Name] != nil {
+			return ident.Name
+		}
+	}
+	return ""
+}
+
+// instanceInitializer reports whether value builds an object: a struct
+// literal, its address, or a constructor call. It returns the built type
+// when it can be read from the expression.
+func instanceInitializer(value ast.Expr) (string, bool) {
+	pointer := ""
+	if unary, ok := value.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+		value, pointer = unary.X, "*"
+	}
+
+	switch v := value.(type) {
+	case *ast.CompositeLit:
+		// Map and slice tables are data, not instances
+		switch v.Type.(type) {
+		case *ast.Ident, *ast.SelectorExpr:
+			return pointer + types.ExprString(v.Type), true
+		}
+
+	case *ast.CallExpr:
+		name := getFuncName(v.Fun)
+		if contains(idiomaticGlobals, name) {
+			return "", false
+		}
+		base := name[strings.LastIndex(name, ".")+1:]
+		if strings.HasPrefix(base, "New") || strings.HasPrefix(base, "new") || base == "Default" {
+			return "", true
+		}
+	}
+	return "", false
+}
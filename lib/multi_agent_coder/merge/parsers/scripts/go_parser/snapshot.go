@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// snapshotHelpers are the declarations shared by the snapshot tests of a
+// package. They are generated with the first target's tests and reused by
+// later ones.
+const snapshotHelpers = `
+var updateSnapshots = flag.Bool(%q, false, "rewrite the golden files under testdata/snapshots")
+
+// snapshotValues turns a function's results into the values recorded,
+// errors by their message
+func snapshotValues(values ...interface{}) []interface{} {
+	for i, v := range values {
+		if err, ok := v.(error); ok {
+			values[i] = err.Error()
+		}
+	}
+	return values
+}
+
+// checkSnapshot compares got, as indented JSON, with the golden file of
+// name, or rewrites the file when the tests run with the update flag
+func checkSnapshot(t *testing.T, name string, got interface{}) {
+	t.Helper()
+	data, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatalf("cannot record %%s: %%v", name, err)
+	}
+	data = append(data, '\n')
+
+	path := filepath.Join("testdata", "snapshots", name+".json")
+	if *updateSnapshots {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("no snapshot of %%s, record one with go test -run %%s -%s: %%v", name, t.Name(), err)
+	}
+	if string(data) != string(want) {
+		t.Errorf("%%s differs from %%s:\ngot:\n%%s\nwant:\n%%s", name, path, data, want)
+	}
+}
+`
+
+// generateSnapshotTests writes a TestSnapshotXxx for each pure function of
+// the file whose results can be recorded as JSON. Each test calls the
+// function with the zero and small fuzz seeds and compares the results with
+// a golden file under testdata/snapshots, which running the tests with the
+// update flag records, so later changes to the function's behavior fail the
+// test even where nobody wrote assertions.
+func generateSnapshotTests(file *editFile, result *GenerateResult) (string, error) {
+	used := map[string]bool{}
+	var tests strings.Builder
+	for _, fn := range generatableFunctions(file, result, snapshotResultProblem) {
+		name := fn.Name.Name
+		testName := generatedName(file, used, "TestSnapshot", name)
+		writeSnapshotTest(&tests, testName, name, fieldParams(fn.Type.Params))
+		result.Generated = append(result.Generated, GeneratedTarget{Name: testName, Function: name})
+	}
+	if len(result.Generated) == 0 {
+		return "", nil
+	}
+
+	shared, updateFlag := packageSnapshotHelpers(file, result.outputPath)
+	imports := `import "testing"`
+	helpers := ""
+	if !shared {
+		imports = "import (\n\t\"encoding/json\"\n\t\"flag\"\n\t\"os\"\n\t\"path/filepath\"\n\t\"testing\"\n)"
+		helpers = fmt.Sprintf(snapshotHelpers, updateFlag, updateFlag)
+	}
+	return fmt.Sprintf("// Code generated by go_parser generate snapshot-tests. DO NOT EDIT.\n\npackage %s\n\n%s\n%s%s", file.file.Name.Name, imports, helpers, tests.String()), nil
+}
+
+// snapshotResultProblem rejects results that do not record as JSON, or not
+// faithfully: only basic types, slices of them and maps keyed by strings,
+// plus errors at the top level, are recorded
+func snapshotResultProblem(results []ParamInfo) string {
+	for _, result := range results {
+		if result.Type != "error" && !snapshotSerializable(result.Type) {
+			return "has a result of type " + result.Type + ", which is not recorded as JSON"
+		}
+	}
+	return ""
+}
+
+func snapshotSerializable(typ string) bool {
+	switch {
+	case strings.HasPrefix(typ, "[]"):
+		return snapshotSerializable(typ[2:])
+	case strings.HasPrefix(typ, "map[string]"):
+		return snapshotSerializable(typ[len("map[string]"):])
+	}
+	_, ok := fuzzSeeds[typ]
+	return ok
+}
+
+func writeSnapshotTest(b *strings.Builder, testName, function string, params []ParamInfo) {
+	zero := make([]string, len(params))
+	small := make([]string, len(params))
+	for i, param := range params {
+		zero[i] = fuzzSeeds[param.Type][0]
+		small[i] = fuzzSeeds[param.Type][1]
+	}
+
+	fmt.Fprintf(b, "\nfunc %s(t *testing.T) {\n", testName)
+	b.WriteString("\tgot := map[string][]interface{}{\n")
+	fmt.Fprintf(b, "\t\t\"zero\":  snapshotValues(%s(%s)),\n", function, strings.Join(zero, ", "))
+	fmt.Fprintf(b, "\t\t\"small\": snapshotValues(%s(%s)),\n", function, strings.Join(small, ", "))
+	b.WriteString("\t}\n")
+	fmt.Fprintf(b, "\tcheckSnapshot(t, %q, got)\n}\n", function)
+}
+
+// packageSnapshotHelpers looks through the other test files of the target's
+// package: shared is true when one of them already declares the snapshot
+// helpers, and updateFlag is the name of the update flag to declare
+// otherwise, "update" unless another test file defines a flag of that name
+func packageSnapshotHelpers(file *editFile, outputPath string) (bool, string) {
+	shared := false
+	updateFlag := "update"
+
+	paths, _ := filepath.Glob(filepath.Join(filepath.Dir(file.path), "*_test.go"))
+	for _, path := range paths {
+		if same, err := sameFile(path, outputPath); err == nil && same {
+			continue
+		}
+		test, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil || test.Name.Name != file.file.Name.Name {
+			continue
+		}
+		switch {
+		case test.Scope.Lookup("checkSnapshot") != nil:
+			shared = true
+		case definesFlag(test, "update"):
+			updateFlag = "update-snapshots"
+		}
+	}
+	return shared, updateFlag
+}
+
+// definesFlag reports whether the file defines a boolean flag called name
+// with flag.Bool or flag.BoolVar
+func definesFlag(file *ast.File, name string) bool {
+	found := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || found {
+			return !found
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "flag" {
+			return true
+		}
+		arg := -1
+		switch sel.Sel.Name {
+		case "Bool":
+			arg = 0
+		case "BoolVar":
+			arg = 1
+		}
+		if arg >= 0 && len(call.Args) > arg {
+			if lit, ok := call.Args[arg].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				if value, err := strconv.Unquote(lit.Value); err == nil && value == name {
+					found = true
+				}
+			}
+		}
+		return true
+	})
+	return found
+}
+
+func sameFile(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"os"
+)
+
+func runSplice(args []string) int {
+	var name, fromPath, after, outputPath string
+	policy := "related"
+	dryRun := false
+
+	flags := flag.NewFlagSet("splice", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&name, "name", "", "function or method to transplant, e.g. ParseConfig or Server.Start")
+	flags.StringVar(&fromPath, "from", "", "file containing the function")
+	flags.StringVar(&after, "after", "", "insert a new function after this declaration, e.g. TypeDecl:Config or Server.Start")
+	flags.StringVar(&policy, "policy", "related", "placement of a new function without --after: related, alphabetical or end")
+	flags.StringVar(&outputPath, "o", "", "write the result here instead of over the target")
+	flags.BoolVar(&dryRun, "dry-run", false, "do not write; the result source is returned in the output")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	if name == "" || fromPath == "" || len(positional) != 1 {
+		return fail("Usage: splice target.go --from source.go --name Func [--after Kind:Name | --policy related|alphabetical|end] [-o out.go] [--dry-run]")
+	}
+	if !contains(insertPolicies, policy) {
+		return fail("Invalid policy: %s", policy)
+	}
+
+	target := positional[0]
+	if outputPath == "" {
+		outputPath = target
+	}
+
+	file, err := loadEditFile(target)
+	if err != nil {
+		return fail("Failed to load target: %v", err)
+	}
+
+	source, err := loadSnippet(fromPath)
+	if err != nil {
+		return fail("Failed to load source: %v", err)
+	}
+
+	decl := findSymbol(source.file, name)
+	if decl == nil || decl.fn == nil {
+		return fail("function %s not found in %s", normalizeSymbolName(name), fromPath)
+	}
+
+	result := &EditResult{Target: target, Symbol: decl.name, Missing: missingDecls(file, source, decl.fn)}
+	var spliced string
+	if existing := findSymbol(file.file, decl.name); existing != nil {
+		if spliced, _, result.AddedImports, err = replaceSymbol(file, source, decl.name); err != nil {
+			return fail("%v", err)
+		}
+		// Imports only the replaced function used go with it
+		if edited, err := parseEditSource(target, spliced); err == nil {
+			result.RemovedImports = orphanedImports(file, existing.node, edited)
+			spliced = removeImports(edited, result.RemovedImports)
+		}
+	} else if spliced, result.Inserted, result.AddedImports, err = insertDecls(file, source, []symbolDecl{*decl}, after, policy); err != nil {
+		return fail("%v", err)
+	}
+
+	if err := finishEdit(result, spliced, outputPath, dryRun); err != nil {
+		return fail("%v", err)
+	}
+	return printEditResult(result)
+}
+
+// missingDecls lists the package-level names of source that fn uses and
+// target does not declare, which the transplanted function still needs
+func missingDecls(target, source *editFile, fn *ast.FuncDecl) []string {
+	declared := map[string]bool{}
+	for _, decl := range topLevelSymbols(target.file) {
+		declared[decl.name] = true
+	}
+
+	missing := map[string]bool{}
+	ast.Inspect(fn, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		// Identifiers resolved to the file scope are the source's own
+		// top-level declarations
+		if ok && ident.Obj != nil && source.file.Scope.Lookup(ident.Name) == ident.Obj && ident.Name != fn.Name.Name && !declared[ident.Name] {
+			missing[ident.Name] = true
+		}
+		return true
+	})
+	return sortedKeys(missing)
+}
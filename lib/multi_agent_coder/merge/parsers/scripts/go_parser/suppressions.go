@@ -0,0 +1,98 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// suppressionDirective starts a comment that silences a finding:
+// //agentlint:ignore rule_id reason
+const suppressionDirective = "//agentlint:ignore"
+
+// Suppression is an //agentlint:ignore directive, listed whether or not it
+// silenced anything so every override stays visible. It covers findings of
+// Rule on TargetLine: its own line when it trails code, otherwise the line
+// after its comment block, and the whole file when that is the package
+// clause. Suppressed counts the findings it silenced. A directive without
+// a rule or reason has an Error and silences nothing.
+type Suppression struct {
+	File       string `json:"file,omitempty"`
+	Rule       string `json:"rule"`
+	Reason     string `json:"reason"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	TargetLine int    `json:"target_line"`
+	Suppressed int    `json:"suppressed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// suppressionSet is a file's directives, and the line of its package
+// clause, which file-level findings are reported against
+type suppressionSet struct {
+	list        []Suppression
+	packageLine int
+}
+
+// findSuppressions reads the directives in a file parsed with its comments
+func findSuppressions(fset *token.FileSet, file *ast.File, source []byte) *suppressionSet {
+	set := &suppressionSet{list: []Suppression{}, packageLine: fset.Position(file.Package).Line}
+	tokenFile := fset.File(file.Pos())
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if comment.Text != suppressionDirective && !strings.HasPrefix(comment.Text, suppressionDirective+" ") {
+				continue
+			}
+			pos := fset.Position(comment.Pos())
+			suppression := Suppression{Line: pos.Line, Column: pos.Column}
+			fields := strings.Fields(strings.TrimPrefix(comment.Text, suppressionDirective))
+			switch {
+			case len(fields) == 0:
+				suppression.Error = "missing rule"
+			case len(fields) == 1:
+				suppression.Rule, suppression.Error = fields[0], "missing reason"
+			default:
+				suppression.Rule, suppression.Reason = fields[0], strings.Join(fields[1:], " ")
+			}
+
+			// A directive after code on its line covers that line
+			suppression.TargetLine = fset.Position(group.End()).Line + 1
+			lineStart := tokenFile.Offset(tokenFile.LineStart(pos.Line))
+			if before := source[lineStart:tokenFile.Offset(comment.Pos())]; strings.TrimSpace(string(before)) != "" {
+				suppression.TargetLine = pos.Line
+			}
+			set.list = append(set.list, suppression)
+		}
+	}
+	return set
+}
+
+// suppress reports whether a directive covers a finding of rule on line,
+// and counts it as silenced by the first that does
+func (s *suppressionSet) suppress(rule string, line int) bool {
+	for i := range s.list {
+		suppression := &s.list[i]
+		if suppression.Error == "" && suppression.Rule == rule && suppression.TargetLine == line {
+			suppression.Suppressed++
+			return true
+		}
+	}
+	return false
+}
+
+// suppressFile reports whether a directive above the package clause covers
+// a file-level finding of rule
+func (s *suppressionSet) suppressFile(rule string) bool {
+	return s.suppress(rule, s.packageLine)
+}
+
+// inFile returns the directives with their file set, for reports across
+// files
+func (s *suppressionSet) inFile(path string) []Suppression {
+	list := make([]Suppression, len(s.list))
+	for i, suppression := range s.list {
+		suppression.File = path
+		list[i] = suppression
+	}
+	return list
+}
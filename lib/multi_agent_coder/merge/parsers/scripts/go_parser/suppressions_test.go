@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGateSuppression(t *testing.T) {
+	source := `package p
+
+//agentlint:ignore cyclomatic_complexity dispatch table, split in a follow-up
+func Suppressed(a int) int {
+	if a > 1 {
+		return 1
+	}
+	return 0
+}
+
+//agentlint:ignore cyclomatic-complexity the old ID silences nothing
+func OldID(a int) int {
+	if a > 1 {
+		return 1
+	}
+	return 0
+}
+
+//agentlint:ignore cyclomatic_complexity
+func NoReason(a int) int {
+	if a > 1 {
+		return 1
+	}
+	return 0
+}
+`
+	path := filepath.Join(t.TempDir(), "p.go")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := checkGate([]string{path}, 1, 0)
+	names := []string{}
+	for _, violation := range report.Violations {
+		names = append(names, violation.Name)
+	}
+	if len(names) != 2 || names[0] != "OldID" || names[1] != "NoReason" {
+		t.Errorf("violations = %v, want OldID and NoReason", names)
+	}
+	if len(report.Suppressions) != 3 {
+		t.Fatalf("suppressions = %+v", report.Suppressions)
+	}
+	if s := report.Suppressions[0]; s.Rule != "cyclomatic_complexity" || s.TargetLine != 4 || s.Suppressed != 1 {
+		t.Errorf("suppression = %+v, want one finding silenced on line 4", s)
+	}
+	if s := report.Suppressions[2]; s.Error != "missing reason" || s.Suppressed != 0 {
+		t.Errorf("suppression without a reason = %+v", s)
+	}
+
+	sarif := gateSARIF(report)
+	results := sarif.Runs[0].Results
+	suppressed := 0
+	for _, result := range results {
+		if len(result.Suppressions) > 0 {
+			suppressed++
+			if result.RuleID != "cyclomatic_complexity" {
+				t.Errorf("suppressed SARIF result has rule %s", result.RuleID)
+			}
+		}
+	}
+	if len(results) != 3 || suppressed != 1 {
+		t.Errorf("SARIF results = %+v, want two violations and one suppressed", results)
+	}
+}
+
+func TestBudgetSuppression(t *testing.T) {
+	source := `//agentlint:ignore max_file_lines generated table
+package p
+
+//agentlint:ignore max_parameters mirrors the C API
+func Wide(a, b, c int) {}
+
+func AlsoWide(a, b, c int) {}
+
+func Narrow(a int) {} //agentlint:ignore max_parameters nothing to silence
+`
+	opts := defaultOptions()
+	opts.budgets = &SizeBudgets{MaxParameters: 2, MaxFileLines: 3}
+	result, err := analyzeSource("p.go", []byte(source), opts)
+	if err != nil {
+		t.Fatalf("analyzeSource: %v", err)
+	}
+	if len(result.BudgetViolations) != 1 || result.BudgetViolations[0].Symbol != "AlsoWide" {
+		t.Errorf("budget violations = %+v, want AlsoWide only", result.BudgetViolations)
+	}
+	want := map[string]int{"max_file_lines": 1, "mirrors the C API": 1, "nothing to silence": 0}
+	for _, s := range result.Suppressions {
+		key := s.Rule
+		if s.Rule == "max_parameters" {
+			key = s.Reason
+		}
+		if suppressed, ok := want[key]; !ok || s.Suppressed != suppressed {
+			t.Errorf("suppression %+v, want %d silenced", s, suppressed)
+		}
+	}
+	if len(result.Suppressions) != len(want) {
+		t.Errorf("suppressions = %+v", result.Suppressions)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// symbolIDs assigns the top-level declarations of a file IDs that persist
+// while the code does: a hash of the declaration's kind and code with its own
+// name left out, so a rename or a move to another file or position keeps
+// the ID, and an edit to the code gives a new one. A receiver is part of a
+// method's code; doc comments and comments in the code are not. A name in a
+// group or a spec of several names is told apart by the spec that gives its
+// value and its place after it, so an iota constant keeps its ID across
+// renames of its group. A declaration that repeats the code of an earlier
+// one gets its ID with a -2, -3, ... suffix. IDs are keyed by the name's
+// identifier in the declaration.
+func symbolIDs(fset *token.FileSet, file *ast.File) map[*ast.Ident]string {
+	ids := map[*ast.Ident]string{}
+	seen := map[string]int{}
+	assign := func(name *ast.Ident, kind, content string) {
+		sum := sha256.Sum256([]byte(kind + "\n" + content))
+		id := kind + ":" + hex.EncodeToString(sum[:6])
+		seen[id]++
+		if seen[id] > 1 {
+			id = fmt.Sprintf("%s-%d", id, seen[id])
+		}
+		ids[name] = id
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			kind := "func"
+			if d.Recv != nil {
+				kind = "method"
+			}
+			copied := *d
+			copied.Doc, copied.Name = nil, ast.NewIdent("_")
+			assign(d.Name, kind, formatNode(fset, &copied))
+
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			kind := d.Tok.String()
+			// The spec a constant without values repeats, and how far back
+			var governing *ast.ValueSpec
+			distance := 0
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					copied := *s
+					copied.Doc, copied.Comment, copied.Name = nil, nil, ast.NewIdent("_")
+					assign(s.Name, kind, formatNode(fset, &copied))
+
+				case *ast.ValueSpec:
+					if len(s.Values) > 0 || d.Tok == token.VAR || governing == nil {
+						governing, distance = s, 0
+					} else {
+						distance++
+					}
+					copied := *governing
+					copied.Doc, copied.Comment = nil, nil
+					copied.Names = make([]*ast.Ident, len(governing.Names))
+					for i := range copied.Names {
+						copied.Names[i] = ast.NewIdent("_")
+					}
+					for i, name := range s.Names {
+						if name.Name == "_" {
+							continue
+						}
+						assign(name, kind, fmt.Sprintf("%s\n%d %d", formatNode(fset, &copied), distance, i))
+					}
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// symbolIDsByName indexes the IDs of a file's top-level declarations by
+// their names as topLevelSymbols gives them, the first declaration's for a
+// name declared more than once
+func symbolIDsByName(fset *token.FileSet, file *ast.File) map[string]string {
+	ids := symbolIDs(fset, file)
+	byName := map[string]string{}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if _, ok := byName[symbolName(d)]; !ok && ids[d.Name] != "" {
+				byName[symbolName(d)] = ids[d.Name]
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				names := []*ast.Ident{}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, s.Name)
+				case *ast.ValueSpec:
+					names = s.Names
+				}
+				for _, name := range names {
+					if _, ok := byName[name.Name]; !ok && ids[name] != "" {
+						byName[name.Name] = ids[name]
+					}
+				}
+			}
+		}
+	}
+	return byName
+}
@@ -0,0 +1,33 @@
+package fetch
+
+import (
+	"io"
+	"net"
+	"net/http"
+)
+
+// Client fetches documents
+type Client struct {
+	Base string
+	http *http.Client
+}
+
+// Get fetches path from the client's base URL
+func (c *Client) Get(path string) ([]byte, error) {
+	resp, err := http.Get(c.Base + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Ping dials address and reports whether it answered
+func Ping(address string) bool {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,18 @@
+package fetch
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Report prints the status of each URL
+func Report(urls []string) {
+	for _, url := range urls {
+		resp, err := http.Head(url)
+		if err != nil {
+			fmt.Println(url, err)
+			continue
+		}
+		fmt.Printf("%s %d\n", url, resp.StatusCode)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// TestMap relates the tests of each package to the production functions
+// they exercise
+type TestMap struct {
+	Packages []PackageTestMap `json:"packages"`
+	Errors   []FileError      `json:"errors"`
+}
+
+// PackageTestMap is the test mapping of one package directory. Untested
+// lists production functions no test reaches.
+type PackageTestMap struct {
+	Path     string         `json:"path"`
+	Dir      string         `json:"dir"`
+	Tests    []TestCoverage `json:"tests"`
+	Untested []string       `json:"untested"`
+}
+
+// TestCoverage is a single test and the production functions it calls
+// directly and reaches through other calls
+type TestCoverage struct {
+	Name    string   `json:"name"`
+	File    string   `json:"file"`
+	Kind    string   `json:"kind"`
+	Direct  []string `json:"direct"`
+	Reaches []string `json:"reaches"`
+}
+
+func runTestMap(args []string) int {
+	flags := flag.NewFlagSet("test-map", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	strict := false
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	testMap, err := buildTestMap(patterns)
+	if err != nil {
+		return fail("Failed to build test map: %v", err)
+	}
+	if err := strictFailure(testMap.Errors, strict); err != nil {
+		return fail("Failed to build test map: %v", err)
+	}
+	return printJSON(testMap)
+}
+
+// buildTestMap groups the matched files by directory and maps each
+// package's tests
+func buildTestMap(patterns []string) (*TestMap, error) {
+	files, err := collectGoFiles(patterns, true)
+	if err != nil {
+		return nil, err
+	}
+
+	byDir := map[string][]string{}
+	dirs := []string{}
+	for _, path := range files {
+		dir := filepath.Dir(path)
+		if byDir[dir] == nil {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], path)
+	}
+	sort.Strings(dirs)
+
+	testMap := &TestMap{Packages: []PackageTestMap{}, Errors: []FileError{}}
+	for _, dir := range dirs {
+		pkg, errors, err := mapPackageTests(dir, byDir[dir])
+		if err != nil {
+			return nil, err
+		}
+		testMap.Errors = append(testMap.Errors, errors...)
+		if pkg != nil {
+			testMap.Packages = append(testMap.Packages, *pkg)
+		}
+	}
+	return testMap, nil
+}
+
+// callGraphNode is a function declared in the package or its tests
+type callGraphNode struct {
+	name  string
+	file  string
+	test  bool
+	fn    *ast.FuncDecl
+	calls map[string]bool
+}
+
+// mapPackageTests resolves references by name within the package: plain
+// identifiers to functions, selectors to methods (on the caller's own
+// receiver when it matches, otherwise every method of that name), and
+// qualified identifiers in external _test packages to the package under test.
+// Files that do not parse are left out and returned as errors.
+func mapPackageTests(dir string, paths []string) (*PackageTestMap, []FileError, error) {
+	root, modulePath, err := findModule(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	importPath := packageImportPath(root, modulePath, dir)
+
+	fset := token.NewFileSet()
+	nodes := map[string]*callGraphNode{}
+	order := []string{}
+	type parsedFile struct {
+		path string
+		file *ast.File
+	}
+	parsed := []parsedFile{}
+	errors := []FileError{}
+
+	for _, path := range paths {
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			errors = append(errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+		parsed = append(parsed, parsedFile{path, file})
+		isTest := strings.HasSuffix(path, "_test.go")
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			name := symbolName(fn)
+			if isTest {
+				// External test packages may reuse production names
+				name = testNodeName(file, name)
+			}
+			if nodes[name] != nil {
+				continue
+			}
+			nodes[name] = &callGraphNode{name: name, file: path, test: isTest, fn: fn, calls: map[string]bool{}}
+			order = append(order, name)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errors, nil
+	}
+
+	methodsByName := map[string][]string{}
+	for _, name := range order {
+		if i := strings.LastIndex(name, "."); i >= 0 && nodes[name].fn.Recv != nil {
+			method := name[i+1:]
+			methodsByName[method] = append(methodsByName[method], name)
+		}
+	}
+
+	for _, pf := range parsed {
+		external := strings.HasSuffix(pf.file.Name.Name, "_test")
+		qualifiers := map[string]bool{}
+		for _, imp := range pf.file.Imports {
+			path := strings.Trim(imp.Path.Value, `"`)
+			if path != importPath {
+				continue
+			}
+			name := path[strings.LastIndex(path, "/")+1:]
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			qualifiers[name] = true
+		}
+
+		for _, decl := range pf.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			caller := symbolName(fn)
+			if strings.HasSuffix(pf.path, "_test.go") {
+				caller = testNodeName(pf.file, caller)
+			}
+			node := nodes[caller]
+			if node == nil || node.fn != fn {
+				continue
+			}
+			receiver := receiverTypeName(fn)
+			recvVar := receiverVarName(fn)
+			local := func(name string) string {
+				if external {
+					return testNodeName(pf.file, name)
+				}
+				return name
+			}
+
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				switch expr := n.(type) {
+				case *ast.SelectorExpr:
+					if x, ok := expr.X.(*ast.Ident); ok {
+						switch {
+						case qualifiers[x.Name]:
+							node.calls[expr.Sel.Name] = true
+							return false
+						case x.Name == recvVar && nodes[receiver+"."+expr.Sel.Name] != nil:
+							node.calls[receiver+"."+expr.Sel.Name] = true
+							return false
+						}
+					}
+					for _, method := range methodsByName[expr.Sel.Name] {
+						node.calls[method] = true
+					}
+					ast.Inspect(expr.X, func(n ast.Node) bool {
+						if ident, ok := n.(*ast.Ident); ok && nodes[local(ident.Name)] != nil {
+							node.calls[local(ident.Name)] = true
+						}
+						return true
+					})
+					return false
+
+				case *ast.Ident:
+					if nodes[local(expr.Name)] != nil {
+						node.calls[local(expr.Name)] = true
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	pkg := &PackageTestMap{
+		Path:     importPath,
+		Dir:      dir,
+		Tests:    []TestCoverage{},
+		Untested: []string{},
+	}
+	reachedByAny := map[string]bool{}
+
+	for _, name := range order {
+		node := nodes[name]
+		kind := testKind(node)
+		if kind == "" {
+			continue
+		}
+
+		coverage := TestCoverage{Name: node.fn.Name.Name, File: node.file, Kind: kind, Direct: []string{}, Reaches: []string{}}
+		for callee := range node.calls {
+			if target := nodes[callee]; target != nil && !target.test {
+				coverage.Direct = append(coverage.Direct, callee)
+			}
+		}
+		sort.Strings(coverage.Direct)
+
+		seen := map[string]bool{name: true}
+		queue := []string{name}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for callee := range nodes[current].calls {
+				if seen[callee] || nodes[callee] == nil {
+					continue
+				}
+				seen[callee] = true
+				queue = append(queue, callee)
+				if !nodes[callee].test {
+					coverage.Reaches = append(coverage.Reaches, callee)
+					reachedByAny[callee] = true
+				}
+			}
+		}
+		sort.Strings(coverage.Reaches)
+
+		pkg.Tests = append(pkg.Tests, coverage)
+	}
+
+	for _, name := range order {
+		node := nodes[name]
+		if !node.test && !reachedByAny[name] && node.fn.Name.Name != "init" {
+			pkg.Untested = append(pkg.Untested, name)
+		}
+	}
+
+	return pkg, errors, nil
+}
+
+// testNodeName keeps declarations of an external _test package apart from
+// the production declarations they may shadow
+func testNodeName(file *ast.File, name string) string {
+	if strings.HasSuffix(file.Name.Name, "_test") {
+		return file.Name.Name + "." + name
+	}
+	return name
+}
+
+// testKind classifies a test file function by the go test naming rules:
+// Test, Benchmark, Fuzz or Example followed by nothing or a non-lowercase
+// letter. Helpers, TestMain and production code return "".
+func testKind(node *callGraphNode) string {
+	if !node.test || node.fn.Recv != nil || node.fn.Name.Name == "TestMain" {
+		return ""
+	}
+	name := node.fn.Name.Name
+	for _, kind := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+		if !strings.HasPrefix(name, kind) {
+			continue
+		}
+		rest := name[len(kind):]
+		if rest == "" || !unicode.IsLower([]rune(rest)[0]) {
+			return strings.ToLower(kind)
+		}
+	}
+	return ""
+}
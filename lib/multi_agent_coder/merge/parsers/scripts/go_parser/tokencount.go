@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// TokenCount is the approximate size of a file in a model's tokens, as
+// estimated by the named tokenizer heuristic
+type TokenCount struct {
+	Tokenizer string `json:"tokenizer"`
+	Bytes     int    `json:"bytes"`
+	Tokens    int    `json:"tokens"`
+}
+
+// tokenizer approximates a provider family's tokenizer on Go source. BPE
+// vocabularies merge runs of spaces and tabs, so indentation and alignment
+// count once per run when collapseSpace is set; the remaining bytes are
+// divided by bytesPerToken, measured on Go code for the family.
+type tokenizer struct {
+	bytesPerToken float64
+	collapseSpace bool
+}
+
+// tokenizers are the heuristics --tokenizer selects; bytes is the plain four
+// bytes per token estimate
+var tokenizers = map[string]tokenizer{
+	"anthropic": {bytesPerToken: 3.5, collapseSpace: true},
+	"bytes":     {bytesPerToken: 4},
+	"gemini":    {bytesPerToken: 4, collapseSpace: true},
+	"llama":     {bytesPerToken: 3.3, collapseSpace: true},
+	"openai":    {bytesPerToken: 3.8, collapseSpace: true},
+}
+
+// defaultTokenizer is the heuristic used when none is named
+const defaultTokenizer = "bytes"
+
+func tokenizerNames() []string {
+	names := make([]string, 0, len(tokenizers))
+	for name := range tokenizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// count estimates the tokens of text, rounding up so that any non-empty text
+// is at least one token
+func (t tokenizer) count(text string) int {
+	size := len(text)
+	if t.collapseSpace {
+		size = 0
+		space := false
+		for i := 0; i < len(text); i++ {
+			blank := text[i] == ' ' || text[i] == '\t'
+			if !blank || !space {
+				size++
+			}
+			space = blank
+		}
+	}
+	return int(math.Ceil(float64(size) / t.bytesPerToken))
+}
+
+// annotateTokens adds the token count of the file and of each function and
+// type, over the source lines each declaration spans
+func annotateTokens(result *Result, content string, name string) {
+	t := tokenizers[name]
+	lines := strings.SplitAfter(content, "\n")
+	spanTokens := func(span SourceSpan) int {
+		if span.Line < 1 || span.EndLine > len(lines) || span.Line > span.EndLine {
+			return 0
+		}
+		return t.count(strings.Join(lines[span.Line-1:span.EndLine], ""))
+	}
+
+	result.TokenCount = &TokenCount{Tokenizer: name, Bytes: len(content), Tokens: t.count(content)}
+	for i := range result.Functions {
+		result.Functions[i].Tokens = spanTokens(result.Functions[i].SourceSpan)
+	}
+	for i := range result.Structs {
+		result.Structs[i].Tokens = spanTokens(result.Structs[i].SourceSpan)
+	}
+	for i := range result.Interfaces {
+		result.Interfaces[i].Tokens = spanTokens(result.Interfaces[i].SourceSpan)
+	}
+}
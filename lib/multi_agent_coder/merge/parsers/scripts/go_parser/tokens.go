@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"go/scanner"
+	"go/token"
+)
+
+// TokenStream is the classified tokens of a source file, for syntax
+// highlighting. Files that do not parse are still tokenized; scanner errors
+// are listed and the offending text is an "invalid" token.
+type TokenStream struct {
+	Tokens []SourceToken `json:"tokens"`
+	Errors []Diagnostic  `json:"errors"`
+}
+
+// SourceToken is one token and its span. Kind is keyword, ident, literal,
+// operator, comment or invalid; LiteralKind is string, char, int, float or
+// imag for literals. Offsets are byte offsets, End exclusive.
+type SourceToken struct {
+	Kind        string `json:"kind"`
+	LiteralKind string `json:"literal_kind,omitempty"`
+	Offset      int    `json:"offset"`
+	End         int    `json:"end"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	EndLine     int    `json:"end_line"`
+	EndColumn   int    `json:"end_column"`
+}
+
+// tokenizeSource scans source with go/scanner, keeping comments and dropping
+// the semicolons the scanner inserts at line ends
+func tokenizeSource(source []byte) *TokenStream {
+	stream := &TokenStream{Tokens: []SourceToken{}, Errors: []Diagnostic{}}
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(source))
+	var s scanner.Scanner
+	s.Init(file, source, func(pos token.Position, msg string) {
+		stream.Errors = append(stream.Errors, syntaxDiagnostic(pos.Line, pos.Column, msg))
+	}, scanner.ScanComments)
+
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+
+		start := file.Offset(pos)
+		end := tokenEnd(source, start, tok, lit)
+		startPos, endPos := file.Position(pos), file.Position(file.Pos(end))
+
+		t := SourceToken{
+			Kind:      tokenKind(tok),
+			Offset:    start,
+			End:       end,
+			Line:      startPos.Line,
+			Column:    startPos.Column,
+			EndLine:   endPos.Line,
+			EndColumn: endPos.Column,
+		}
+		switch tok {
+		case token.STRING:
+			t.LiteralKind = "string"
+		case token.CHAR:
+			t.LiteralKind = "char"
+		case token.INT:
+			t.LiteralKind = "int"
+		case token.FLOAT:
+			t.LiteralKind = "float"
+		case token.IMAG:
+			t.LiteralKind = "imag"
+		}
+		stream.Tokens = append(stream.Tokens, t)
+	}
+	return stream
+}
+
+// tokenEnd returns the offset just past a token. The scanner strips carriage
+// returns from comments and raw strings, so their ends are found in the
+// source rather than from the literal's length.
+func tokenEnd(source []byte, start int, tok token.Token, lit string) int {
+	end := start + len(tok.String())
+	if lit != "" {
+		end = start + len(lit)
+	}
+
+	rest := source[start:]
+	switch {
+	case tok == token.COMMENT && bytes.HasPrefix(rest, []byte("//")):
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			end = start + len(bytes.TrimSuffix(rest[:i], []byte("\r")))
+		} else {
+			end = len(source)
+		}
+	case tok == token.COMMENT:
+		if i := bytes.Index(rest[2:], []byte("*/")); i >= 0 {
+			end = start + i + 4
+		} else {
+			end = len(source)
+		}
+	case tok == token.STRING && bytes.HasPrefix(rest, []byte("`")):
+		if i := bytes.IndexByte(rest[1:], '`'); i >= 0 {
+			end = start + i + 2
+		} else {
+			end = len(source)
+		}
+	}
+
+	if end > len(source) {
+		end = len(source)
+	}
+	return end
+}
+
+func tokenKind(tok token.Token) string {
+	switch {
+	case tok == token.COMMENT:
+		return "comment"
+	case tok == token.IDENT:
+		return "ident"
+	case tok == token.ILLEGAL:
+		return "invalid"
+	case tok.IsKeyword():
+		return "keyword"
+	case tok.IsLiteral():
+		return "literal"
+	}
+	return "operator"
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"sort"
+	"strings"
+)
+
+// transformOptions holds the settings shared by all transforms
+type transformOptions struct {
+	minDuplicates int
+	// Sensitivity rules and placeholder mapping files of redact and unredact
+	rules   string
+	mapping string
+}
+
+// transforms maps a transform name to its implementation, which returns the
+// rewritten source and a description of each change made
+var transforms = map[string]func(file *editFile, opts transformOptions) (string, []string, error){
+	"extract-strings": extractStrings,
+	"order-decls":     orderDecls,
+	"redact":          redact,
+	"unredact":        unredact,
+}
+
+func runTransform(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fail("Usage: transform <%s> target.go [-o out.go] [--dry-run]", strings.Join(transformNames(), "|"))
+	}
+	name := args[0]
+	transform, ok := transforms[name]
+	if !ok {
+		return fail("Unknown transform: %s", name)
+	}
+
+	var outputPath string
+	dryRun := false
+	opts := transformOptions{}
+
+	flags := flag.NewFlagSet("transform "+name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&outputPath, "o", "", "write the result here instead of over the target")
+	flags.BoolVar(&dryRun, "dry-run", false, "do not write; the result source is returned in the output")
+	flags.IntVar(&opts.minDuplicates, "min-duplicates", defaultMinDuplicates, "extract-strings: uses of a literal that warrant a constant")
+	flags.StringVar(&opts.rules, "rules", "", "redact: YAML or JSON file of {\"rules\": [{name, pattern}]} matched against string literals and comments")
+	flags.StringVar(&opts.mapping, "mapping", "", "redact, unredact: JSON file of the placeholders and the values they stand for")
+
+	positional, err := parseFlags(flags, args[1:])
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if len(positional) != 1 {
+		return fail("Usage: transform %s target.go [-o out.go] [--dry-run]", name)
+	}
+
+	target := positional[0]
+	if outputPath == "" {
+		outputPath = target
+	}
+
+	file, err := loadEditFile(target)
+	if err != nil {
+		return fail("Failed to load target: %v", err)
+	}
+
+	source, changes, err := transform(file, opts)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	result := &EditResult{Target: target, Transform: name, Changes: changes, AddedImports: []string{}}
+	if len(changes) == 0 && !dryRun && outputPath == target {
+		// Nothing to do; leave the file untouched
+		return printEditResult(result)
+	}
+	if err := finishEdit(result, source, outputPath, dryRun); err != nil {
+		return fail("%v", err)
+	}
+	return printEditResult(result)
+}
+
+func transformNames() []string {
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
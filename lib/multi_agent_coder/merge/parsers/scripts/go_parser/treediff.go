@@ -0,0 +1,303 @@
+package main
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TreeDiff is the semantic difference between two directory trees, package
+// by package, with a roll-up of what changed across them
+type TreeDiff struct {
+	Old      string          `json:"old"`
+	New      string          `json:"new"`
+	Summary  TreeDiffSummary `json:"summary"`
+	Packages []PackageDiff   `json:"packages"`
+	// Symbols moved between packages, and the changes the files of the new
+	// tree that still use them through the old package need
+	Moves    []SymbolMove    `json:"moves"`
+	Rewrites []ImportRewrite `json:"import_rewrites"`
+	Errors   []FileError     `json:"errors"`
+}
+
+// PackageDiff is a package directory, relative to the compared roots, whose
+// Go files differ. Status is added, removed or modified. Files lists the
+// files that differ, with the diff of each; a file only one side has is
+// compared with an empty file of the package.
+type PackageDiff struct {
+	Dir    string         `json:"dir"`
+	Status string         `json:"status"`
+	Files  []FileDiffItem `json:"files"`
+}
+
+// FileDiffItem is a file of a package that differs. Status is added, removed
+// or modified.
+type FileDiffItem struct {
+	Path   string      `json:"path"`
+	Status string      `json:"status"`
+	Diff   *SourceDiff `json:"diff"`
+}
+
+// TreeDiffSummary rolls the package diffs up: counts of packages and files,
+// the declarations changed only in formatting, the changes to the exported
+// API outside test files, as dir.Name or dir.Type.Method, and the side
+// effects functions gained
+type TreeDiffSummary struct {
+	PackagesChanged int              `json:"packages_changed"`
+	PackagesAdded   int              `json:"packages_added"`
+	PackagesRemoved int              `json:"packages_removed"`
+	FilesChanged    int              `json:"files_changed"`
+	FormattingOnly  int              `json:"formatting_only"`
+	API             APIDelta         `json:"api"`
+	SideEffects     []SideEffectGain `json:"new_side_effects"`
+}
+
+// APIDelta lists exported symbols added, removed, renamed (as old -> new)
+// and changed in signature or definition
+type APIDelta struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Renamed []string `json:"renamed"`
+	Changed []string `json:"changed"`
+}
+
+// SideEffectGain is a category of side effect a function has on the new
+// side and did not have on the old, new functions included, with the call
+// that gives it
+type SideEffectGain struct {
+	File     string `json:"file"`
+	Function string `json:"function"`
+	Category string `json:"category"`
+	Call     string `json:"call"`
+	Line     int    `json:"line"`
+}
+
+// packageDiffJob is a package both trees are compared on, and its outcome
+type packageDiffJob struct {
+	dir            string
+	files          []string
+	diff           *PackageDiff
+	gains          []SideEffectGain
+	formattingOnly int
+	errors         []FileError
+}
+
+// diffTrees compares the Go files of two trees paired by their path below
+// the roots, up to jobs packages at a time
+func diffTrees(oldRoot, newRoot string, jobs int) (*TreeDiff, error) {
+	oldFiles, err := changeTreeFiles(oldRoot)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := changeTreeFiles(newRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	byDir := map[string][]string{}
+	for rel := range oldFiles {
+		byDir[path.Dir(rel)] = append(byDir[path.Dir(rel)], rel)
+	}
+	for rel := range newFiles {
+		if _, ok := oldFiles[rel]; !ok {
+			byDir[path.Dir(rel)] = append(byDir[path.Dir(rel)], rel)
+		}
+	}
+	dirs := []string{}
+	for dir, files := range byDir {
+		sort.Strings(files)
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	queue := make(chan *packageDiffJob)
+	results := make([]*packageDiffJob, len(dirs))
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				job.run(oldFiles, newFiles)
+			}
+		}()
+	}
+	for i, dir := range dirs {
+		results[i] = &packageDiffJob{dir: dir, files: byDir[dir]}
+		queue <- results[i]
+	}
+	close(queue)
+	wg.Wait()
+
+	tree := &TreeDiff{
+		Old:      oldRoot,
+		New:      newRoot,
+		Packages: []PackageDiff{},
+		Moves:    []SymbolMove{},
+		Rewrites: []ImportRewrite{},
+		Errors:   []FileError{},
+		Summary: TreeDiffSummary{
+			API:         APIDelta{Added: []string{}, Removed: []string{}, Renamed: []string{}, Changed: []string{}},
+			SideEffects: []SideEffectGain{},
+		},
+	}
+	for _, job := range results {
+		tree.Errors = append(tree.Errors, job.errors...)
+		tree.Summary.FormattingOnly += job.formattingOnly
+		if job.diff == nil {
+			continue
+		}
+		tree.Packages = append(tree.Packages, *job.diff)
+		tree.Summary.add(job.diff)
+		tree.Summary.SideEffects = append(tree.Summary.SideEffects, job.gains...)
+	}
+	detectMoves(tree, oldFiles, newFiles)
+	return tree, nil
+}
+
+// run diffs the files of the job's package, or leaves its diff nil when
+// they are all the same
+func (job *packageDiffJob) run(oldFiles, newFiles map[string]string) {
+	diff := &PackageDiff{Dir: job.dir, Files: []FileDiffItem{}}
+	inOld, inNew := false, false
+	for _, rel := range job.files {
+		oldPath, hasOld := oldFiles[rel]
+		newPath, hasNew := newFiles[rel]
+		inOld, inNew = inOld || hasOld, inNew || hasNew
+
+		var oldFile, newFile *editFile
+		var err error
+		if hasOld {
+			if oldFile, err = loadEditFile(oldPath); err != nil {
+				job.errors = append(job.errors, FileError{Path: oldPath, Error: err.Error()})
+				continue
+			}
+		}
+		if hasNew {
+			if newFile, err = loadEditFile(newPath); err != nil {
+				job.errors = append(job.errors, FileError{Path: newPath, Error: err.Error()})
+				continue
+			}
+		}
+		if oldFile != nil && newFile != nil && oldFile.source == newFile.source {
+			continue
+		}
+
+		status := "modified"
+		switch {
+		case oldFile == nil:
+			status, oldFile = "added", emptyPackageFile(oldPath, newFile)
+		case newFile == nil:
+			status, newFile = "removed", emptyPackageFile(newPath, oldFile)
+		}
+		fileDiff := diffSources(oldFile, newFile)
+		job.formattingOnly += fileDiff.FormattingOnly
+		if fileDiff.Equal && status == "modified" {
+			continue
+		}
+		diff.Files = append(diff.Files, FileDiffItem{Path: rel, Status: status, Diff: fileDiff})
+		job.gains = append(job.gains, sideEffectGains(rel, oldFile, newFile)...)
+	}
+	if len(diff.Files) == 0 {
+		return
+	}
+	diff.Status = "modified"
+	switch {
+	case !inOld:
+		diff.Status = "added"
+	case !inNew:
+		diff.Status = "removed"
+	}
+	job.diff = diff
+}
+
+// emptyPackageFile stands for the missing side of a file added or removed:
+// a file of the other side's package that declares nothing
+func emptyPackageFile(filePath string, other *editFile) *editFile {
+	file, _ := parseEditSource(filePath, "package "+other.file.Name.Name+"\n")
+	return file
+}
+
+// sideEffectGains lists the side effect categories each function of the new
+// file has and its namesake in the old file does not
+func sideEffectGains(rel string, oldFile, newFile *editFile) []SideEffectGain {
+	_, before := findSideEffects(oldFile.fset, oldFile.file)
+	had := map[[2]string]bool{}
+	for _, call := range before {
+		had[[2]string{call.Function, call.Category}] = true
+	}
+
+	gains := []SideEffectGain{}
+	_, after := findSideEffects(newFile.fset, newFile.file)
+	for _, call := range after {
+		key := [2]string{call.Function, call.Category}
+		if call.Function == "" || had[key] {
+			continue
+		}
+		had[key] = true
+		gains = append(gains, SideEffectGain{File: rel, Function: call.Function, Category: call.Category, Call: call.Call, Line: call.Line})
+	}
+	return gains
+}
+
+// add counts a package's diff and its exported API changes, outside test
+// files, into the summary
+func (s *TreeDiffSummary) add(diff *PackageDiff) {
+	switch diff.Status {
+	case "added":
+		s.PackagesAdded++
+	case "removed":
+		s.PackagesRemoved++
+	}
+	s.PackagesChanged++
+	s.FilesChanged += len(diff.Files)
+
+	qualify := func(name string) string { return diff.Dir + "." + name }
+	for _, file := range diff.Files {
+		if isTestFile(file.Path) {
+			continue
+		}
+		for _, decls := range []DeclDiff{file.Diff.Functions, file.Diff.Types, file.Diff.Values} {
+			for _, decl := range decls.Added {
+				if symbolExported(decl.Name) {
+					s.API.Added = append(s.API.Added, qualify(decl.Name))
+				}
+			}
+			for _, decl := range decls.Removed {
+				if symbolExported(decl.Name) {
+					s.API.Removed = append(s.API.Removed, qualify(decl.Name))
+				}
+			}
+			for _, rename := range decls.Renamed {
+				if symbolExported(rename.Old) || symbolExported(rename.New) {
+					s.API.Renamed = append(s.API.Renamed, qualify(rename.Old)+" -> "+qualify(rename.New))
+				}
+			}
+			for _, change := range decls.Modified {
+				if symbolExported(change.Name) && (contains(change.Aspects, "signature") || contains(change.Aspects, "definition")) {
+					s.API.Changed = append(s.API.Changed, qualify(change.Name))
+				}
+			}
+		}
+	}
+}
+
+func isTestFile(name string) bool {
+	return strings.HasSuffix(name, "_test.go")
+}
+
+// treeRoots reports whether both diff arguments are directories
+func treeRoots(oldPath, newPath string) bool {
+	oldInfo, err := os.Stat(oldPath)
+	if err != nil || !oldInfo.IsDir() {
+		return false
+	}
+	newInfo, err := os.Stat(newPath)
+	return err == nil && newInfo.IsDir()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TriageReport narrows a failing test down to the functions it reaches that
+// changed most recently, by merge or by commit, and so to the providers and
+// tasks that most likely introduced the regression
+type TriageReport struct {
+	Test         string              `json:"test"`
+	Package      string              `json:"package"`
+	Suspects     []TriageSuspect     `json:"suspects"`
+	Attributions []TriageAttribution `json:"attributions"`
+}
+
+// TriageSuspect is a function reachable from the test, Depth calls away.
+// Provenance is the merge that last contributed its code; Modified is set
+// when the store only knows other code for it, so it was edited since.
+// Touched is the newer of the merge and the last commit of its lines, or
+// the time of the run for lines not yet committed.
+type TriageSuspect struct {
+	Symbol     string            `json:"symbol"`
+	File       string            `json:"file"`
+	Line       int               `json:"line"`
+	Depth      int               `json:"depth"`
+	Provenance *ProvenanceRecord `json:"provenance,omitempty"`
+	Modified   bool              `json:"modified,omitempty"`
+	Blame      *BlameInfo        `json:"blame,omitempty"`
+	Touched    string            `json:"touched,omitempty"`
+}
+
+// TriageAttribution groups the suspects merged from one provider's
+// candidate for one task, newest first
+type TriageAttribution struct {
+	Provider string   `json:"provider"`
+	Task     string   `json:"task,omitempty"`
+	Symbols  []string `json:"symbols"`
+	Newest   string   `json:"newest"`
+}
+
+// triageFunc is a function of the package under triage
+type triageFunc struct {
+	file *editFile
+	fn   *ast.FuncDecl
+}
+
+func runTriage(args []string) int {
+	var test, dbPath string
+
+	flags := flag.NewFlagSet("triage", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&test, "test", "", "failing test function, e.g. TestParseConfig")
+	flags.StringVar(&dbPath, "db", "", "provenance store written by compose --provenance-db")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if test == "" || len(positional) > 1 {
+		return fail("Usage: triage --test TestName [--db provenance.jsonl] [package-dir]")
+	}
+	dir := "."
+	if len(positional) == 1 {
+		dir = positional[0]
+	}
+
+	records := []ProvenanceRecord{}
+	if dbPath != "" {
+		if records, err = loadProvenance(dbPath); err != nil {
+			return fail("Failed to read provenance store: %v", err)
+		}
+	}
+
+	report, err := triageTest(dir, test, records)
+	if err != nil {
+		return fail("%v", err)
+	}
+	return printJSON(report)
+}
+
+// triageTest follows the references from the test through the functions of
+// its directory, breadth first, and ranks the functions reached by when
+// they were last touched. Calls are resolved by name, a method call to
+// every method of that name, so the set errs on the side of reaching more.
+func triageTest(dir, test string, records []ProvenanceRecord) (*TriageReport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := map[string]triageFunc{}
+	methods := map[string][]string{}
+	var start *triageFunc
+	for _, path := range paths {
+		if match, err := build.Default.MatchFile(dir, filepath.Base(path)); err != nil || !match {
+			continue
+		}
+		file, err := loadEditFile(path)
+		if err != nil {
+			continue
+		}
+		for _, decl := range file.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			entry := triageFunc{file: file, fn: fn}
+			if fn.Recv == nil && fn.Name.Name == test && strings.HasSuffix(path, "_test.go") {
+				start = &entry
+				continue
+			}
+			// An external test package's copy of a name does not shadow the
+			// package's own
+			if _, ok := funcs[symbolName(fn)]; ok && strings.HasSuffix(file.file.Name.Name, "_test") {
+				continue
+			}
+			funcs[symbolName(fn)] = entry
+			if fn.Recv != nil {
+				methods[fn.Name.Name] = append(methods[fn.Name.Name], symbolName(fn))
+			}
+		}
+	}
+	if start == nil {
+		return nil, fmt.Errorf("no test %s in %s", test, dir)
+	}
+
+	report := &TriageReport{Test: test, Package: filepath.ToSlash(dir), Suspects: []TriageSuspect{}, Attributions: []TriageAttribution{}}
+	depths := map[string]int{}
+	order := []string{}
+	queue := []triageFunc{*start}
+	queueDepth := []int{0}
+	for len(queue) > 0 {
+		current, depth := queue[0], queueDepth[0]
+		queue, queueDepth = queue[1:], queueDepth[1:]
+		ast.Inspect(current.fn.Body, func(n ast.Node) bool {
+			targets := []string{}
+			switch node := n.(type) {
+			case *ast.Ident:
+				targets = append(targets, node.Name)
+			case *ast.SelectorExpr:
+				// The selector's own identifier is visited too, for pkg.Func
+				// from an external test package
+				targets = append(targets, methods[node.Sel.Name]...)
+			}
+			for _, name := range targets {
+				if _, seen := depths[name]; seen {
+					continue
+				}
+				if entry, ok := funcs[name]; ok {
+					depths[name] = depth + 1
+					order = append(order, name)
+					queue, queueDepth = append(queue, entry), append(queueDepth, depth+1)
+				}
+			}
+			return true
+		})
+	}
+
+	blames := map[string][]*blameCommit{}
+	now := time.Now()
+	for _, name := range order {
+		entry := funcs[name]
+		path := entry.file.path
+		suspect := TriageSuspect{Symbol: name, File: path, Line: entry.file.fset.Position(entry.fn.Pos()).Line, Depth: depths[name]}
+
+		hash := declHash(entry.file, entry.fn)
+		for i := len(records) - 1; i >= 0; i-- {
+			record := records[i]
+			if !contains(record.Symbols, name) {
+				continue
+			}
+			if record.Hash == hash {
+				suspect.Provenance, suspect.Modified = &records[i], false
+				break
+			}
+			suspect.Modified = true
+		}
+		if suspect.Provenance != nil {
+			suspect.Touched = suspect.Provenance.Timestamp
+		}
+
+		if _, ok := blames[path]; !ok {
+			// Outside a repository, or for new files, only the merges count
+			blames[path], _ = blameLines(path)
+		}
+		if lines := blames[path]; lines != nil {
+			suspect.Blame = newestBlame(lines, sourceSpan(entry.file.fset, entry.fn), now)
+			if suspect.Blame != nil && suspect.Blame.Time > suspect.Touched {
+				suspect.Touched = suspect.Blame.Time
+			}
+		}
+		report.Suspects = append(report.Suspects, suspect)
+	}
+
+	sort.SliceStable(report.Suspects, func(i, j int) bool {
+		a, b := report.Suspects[i], report.Suspects[j]
+		if a.Touched != b.Touched {
+			return a.Touched > b.Touched
+		}
+		return a.Depth < b.Depth
+	})
+
+	byOrigin := map[[2]string]*TriageAttribution{}
+	for _, suspect := range report.Suspects {
+		if suspect.Provenance == nil {
+			continue
+		}
+		key := [2]string{suspect.Provenance.Provider, suspect.Provenance.Task}
+		attribution := byOrigin[key]
+		if attribution == nil {
+			attribution = &TriageAttribution{Provider: key[0], Task: key[1], Symbols: []string{}}
+			byOrigin[key] = attribution
+		}
+		attribution.Symbols = append(attribution.Symbols, suspect.Symbol)
+		if suspect.Provenance.Timestamp > attribution.Newest {
+			attribution.Newest = suspect.Provenance.Timestamp
+		}
+	}
+	for _, attribution := range byOrigin {
+		report.Attributions = append(report.Attributions, *attribution)
+	}
+	sort.Slice(report.Attributions, func(i, j int) bool {
+		a, b := report.Attributions[i], report.Attributions[j]
+		if a.Newest != b.Newest {
+			return a.Newest > b.Newest
+		}
+		return a.Provider+a.Task < b.Provider+b.Task
+	})
+	return report, nil
+}
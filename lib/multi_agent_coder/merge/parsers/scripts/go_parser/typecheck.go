@@ -0,0 +1,102 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// Diagnostic is a positioned error or warning about a source file. Category
+// and Symbols classify errors, as classifyError does.
+type Diagnostic struct {
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Message  string   `json:"message"`
+	Category string   `json:"category,omitempty"`
+	Symbols  []string `json:"symbols,omitempty"`
+}
+
+// fallbackImporter resolves imports from the installed toolchain and
+// substitutes an empty package for anything it cannot find, remembering the
+// local names of those packages, with their paths, so errors about them can
+// be discarded
+type fallbackImporter struct {
+	base    types.Importer
+	missing map[string]string
+}
+
+func newFallbackImporter(fset *token.FileSet) *fallbackImporter {
+	return &fallbackImporter{
+		base:    importer.ForCompiler(fset, "source", nil),
+		missing: map[string]string{},
+	}
+}
+
+func (i *fallbackImporter) Import(path string) (*types.Package, error) {
+	if pkg, err := i.base.Import(path); err == nil {
+		return pkg, nil
+	}
+
+	name := path[strings.LastIndex(path, "/")+1:]
+	pkg := types.NewPackage(path, name)
+	pkg.MarkComplete()
+	i.missing[name] = path
+	return pkg, nil
+}
+
+// typeCheckFile runs go/types over a single file and returns its type errors,
+// ignoring the ones caused by imports that could not be resolved
+func typeCheckFile(fset *token.FileSet, file *ast.File) []Diagnostic {
+	diagnostics, _ := checkFile(fset, file, nil, nil)
+	return diagnostics
+}
+
+// checkFile type checks file as part of a package with the other files, if
+// any, recording into info when it is not nil. It returns the errors in file
+// alone, by position, and the importer, which knows the imports it could not
+// resolve.
+func checkFile(fset *token.FileSet, file *ast.File, others []*ast.File, info *types.Info) ([]Diagnostic, *fallbackImporter) {
+	imp := newFallbackImporter(fset)
+	diagnostics := []Diagnostic{}
+	filename := fset.File(file.Pos()).Name()
+
+	config := types.Config{
+		Importer: imp,
+		Error: func(err error) {
+			typeErr, ok := err.(types.Error)
+			if !ok {
+				return
+			}
+			if imp.refersToMissing(typeErr.Msg) {
+				return
+			}
+			pos := fset.Position(typeErr.Pos)
+			if pos.Filename != filename {
+				return
+			}
+			diagnostics = append(diagnostics, diagnostic(pos.Line, pos.Column, typeErr.Msg))
+		},
+	}
+
+	config.Check(file.Name.Name, fset, append([]*ast.File{file}, others...), info)
+
+	sort.SliceStable(diagnostics, func(a, b int) bool {
+		if diagnostics[a].Line != diagnostics[b].Line {
+			return diagnostics[a].Line < diagnostics[b].Line
+		}
+		return diagnostics[a].Column < diagnostics[b].Column
+	})
+	return diagnostics, imp
+}
+
+func (i *fallbackImporter) refersToMissing(msg string) bool {
+	for name := range i.missing {
+		if strings.Contains(msg, name+".") || strings.Contains(msg, `"`+name+`"`) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TypeCheckReport is what go/types makes of a file: the types of the names
+// it declares, the identifiers it uses without declaring and its type errors.
+// Imports that cannot be resolved from the toolchain or module cache are
+// replaced by empty packages and listed in UnresolvedImports, and the errors
+// they cause are left out. PackageFiles are the other files of the package
+// on disk that were checked with it.
+type TypeCheckReport struct {
+	Types             []ResolvedType `json:"types"`
+	Undefined         []string       `json:"undefined"`
+	Errors            []Diagnostic   `json:"errors"`
+	UnresolvedImports []string       `json:"unresolved_imports"`
+	PackageFiles      []string       `json:"package_files"`
+}
+
+// ResolvedType is the type of a declared name: a function's signature, the
+// underlying type of a type, or the type of a constant or variable, inferred
+// ones included. Function is the declaration a local name is declared in.
+type ResolvedType struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Type     string `json:"type"`
+	Function string `json:"function,omitempty"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// typeCheckSource type checks a parsed file with the other files of its
+// package in the directory of path, if path is on disk
+func typeCheckSource(fset *token.FileSet, file *ast.File, path string) *TypeCheckReport {
+	report := &TypeCheckReport{Types: []ResolvedType{}, Undefined: []string{}, UnresolvedImports: []string{}, PackageFiles: []string{}}
+	others := packageFiles(fset, file, path)
+	for _, other := range others {
+		report.PackageFiles = append(report.PackageFiles, fset.File(other.Pos()).Name())
+	}
+
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}}
+	var imp *fallbackImporter
+	report.Errors, imp = checkFile(fset, file, others, info)
+	for _, importPath := range imp.missing {
+		report.UnresolvedImports = append(report.UnresolvedImports, importPath)
+	}
+	sort.Strings(report.UnresolvedImports)
+
+	undefined := map[string]bool{}
+	for _, d := range report.Errors {
+		if name := undefinedName(d); name != "" {
+			undefined[name] = true
+		}
+	}
+	report.Undefined = sortedKeys(undefined)
+
+	filename := fset.File(file.Pos()).Name()
+	for ident, obj := range info.Defs {
+		pos := fset.Position(ident.Pos())
+		if obj == nil || ident.Name == "_" || pos.Filename != filename {
+			continue
+		}
+		resolved := ResolvedType{Name: ident.Name, Line: pos.Line, Column: pos.Column, Function: enclosingFunction(file, ident.Pos())}
+		qualifier := func(pkg *types.Package) string {
+			if pkg == obj.Pkg() {
+				return ""
+			}
+			return pkg.Name()
+		}
+		switch o := obj.(type) {
+		case *types.Func:
+			resolved.Kind = "func"
+			if recv := o.Type().(*types.Signature).Recv(); recv != nil {
+				resolved.Kind = "method"
+				resolved.Function = ""
+				if fn, ok := enclosingDecl(file, ident.Pos()); ok {
+					resolved.Name = symbolName(fn)
+				}
+			}
+			resolved.Type = types.TypeString(o.Type(), qualifier)
+		case *types.TypeName:
+			resolved.Kind = "type"
+			resolved.Type = types.TypeString(o.Type().Underlying(), qualifier)
+		case *types.Const:
+			resolved.Kind = "const"
+			resolved.Type = types.TypeString(o.Type(), qualifier)
+		case *types.Var:
+			if o.IsField() {
+				continue
+			}
+			resolved.Kind = "var"
+			resolved.Type = types.TypeString(o.Type(), qualifier)
+		default:
+			continue
+		}
+		report.Types = append(report.Types, resolved)
+	}
+	sort.Slice(report.Types, func(i, j int) bool {
+		if report.Types[i].Line != report.Types[j].Line {
+			return report.Types[i].Line < report.Types[j].Line
+		}
+		return report.Types[i].Column < report.Types[j].Column
+	})
+	return report
+}
+
+// undefinedName returns the identifier an error says is undefined, as
+// "T.Method" for a missing method or field of T or *T, or "" for other errors
+func undefinedName(d Diagnostic) string {
+	switch {
+	case d.Category == "undefined" && len(d.Symbols) == 2:
+		return strings.TrimPrefix(d.Symbols[0], "*") + "." + d.Symbols[1]
+	case (d.Category == "undefined" || d.Category == "missing_import") && strings.HasPrefix(d.Message, "undefined: "):
+		return d.Symbols[0]
+	}
+	return ""
+}
+
+func enclosingDecl(file *ast.File, pos token.Pos) (*ast.FuncDecl, bool) {
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Pos() <= pos && pos < fn.End() {
+			return fn, true
+		}
+	}
+	return nil, false
+}
+
+// enclosingFunction names the function declaration pos is inside of, other
+// than in its name, or "" for the package level
+func enclosingFunction(file *ast.File, pos token.Pos) string {
+	fn, ok := enclosingDecl(file, pos)
+	if !ok || fn.Name.Pos() == pos {
+		return ""
+	}
+	return symbolName(fn)
+}
+
+// packageFiles parses the other files of the package in the directory of
+// path that the build constraints select, the package's tests too when path
+// is a test file. It returns none for a file not on disk.
+func packageFiles(fset *token.FileSet, file *ast.File, path string) []*ast.File {
+	if path == "" || path == stdinPath {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	test := strings.HasSuffix(path, "_test.go")
+
+	files := []*ast.File{}
+	for _, other := range paths {
+		if same, err := sameFile(other, path); err != nil || same {
+			continue
+		}
+		if strings.HasSuffix(other, "_test.go") && !test {
+			continue
+		}
+		if match, err := build.Default.MatchFile(dir, filepath.Base(other)); err != nil || !match {
+			continue
+		}
+		parsed, err := parser.ParseFile(fset, other, nil, 0)
+		if err != nil || parsed.Name.Name != file.Name.Name {
+			continue
+		}
+		files = append(files, parsed)
+	}
+	return files
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+)
+
+// ValueInfo is a package-level constant or variable. Type and Expr, the
+// initializer, are as written, or for a constant repeating the previous line
+// of its group, as that line has them. Value is a constant's value when it
+// can be computed from the file, as in enums, and a variable's when it is
+// initialized with a literal; Kind is the kind of that value.
+type ValueInfo struct {
+	Name     string      `json:"name"`
+	ID       string      `json:"id,omitempty"`
+	Exported bool        `json:"exported"`
+	Type     string      `json:"type,omitempty"`
+	Expr     string      `json:"expr,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+	Kind     string      `json:"kind,omitempty"`
+	Doc      string      `json:"doc,omitempty"`
+	Summary  string      `json:"summary,omitempty"`
+	SourceSpan
+}
+
+// extractValues lists the package-level constants and variables of a file
+// in source order. Constants are evaluated in order, as extractEnums does,
+// so later ones can refer to earlier ones. ids are the file's symbolIDs.
+func extractValues(fset *token.FileSet, file *ast.File, ids map[*ast.Ident]string) ([]ValueInfo, []ValueInfo) {
+	constants, variables := []ValueInfo{}, []ValueInfo{}
+	env := map[string]constant.Value{}
+
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || (genDecl.Tok != token.CONST && genDecl.Tok != token.VAR) {
+			continue
+		}
+
+		var prevType ast.Expr
+		var prevValues []ast.Expr
+		for iota, spec := range genDecl.Specs {
+			valueSpec, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			var node ast.Node = valueSpec
+			doc := valueSpec.Doc
+			// An ungrouped declaration's comment is on the GenDecl
+			if !genDecl.Lparen.IsValid() {
+				node = genDecl
+				if doc == nil {
+					doc = genDecl.Doc
+				}
+			}
+
+			typeExpr, values := valueSpec.Type, valueSpec.Values
+			if genDecl.Tok == token.CONST {
+				// A spec without values repeats the previous type and expressions
+				if len(values) > 0 {
+					prevType, prevValues = typeExpr, values
+				}
+				typeExpr, values = prevType, prevValues
+			}
+
+			for i, name := range valueSpec.Names {
+				info := ValueInfo{Name: name.Name, ID: ids[name], Exported: isExported(name.Name), SourceSpan: sourceSpan(fset, node)}
+				info.Doc, info.Summary = docComment(doc)
+				if typeExpr != nil {
+					info.Type = types.ExprString(typeExpr)
+				}
+
+				// a, b = f() share the call
+				if len(values) == 1 && len(valueSpec.Names) > 1 {
+					info.Expr = types.ExprString(values[0])
+				}
+				value := constant.MakeUnknown()
+				if i < len(values) {
+					info.Expr = types.ExprString(values[i])
+					if genDecl.Tok == token.CONST {
+						value = evalConst(values[i], iota, env)
+					} else if isLiteralExpr(values[i]) {
+						value = evalConst(values[i], 0, nil)
+					}
+				}
+				if value.Kind() != constant.Unknown {
+					info.Value, info.Kind = constantToJSON(value), constantKind(value)
+				}
+
+				if name.Name == "_" {
+					continue
+				}
+				if genDecl.Tok == token.CONST {
+					env[name.Name] = value
+					constants = append(constants, info)
+				} else {
+					variables = append(variables, info)
+				}
+			}
+		}
+	}
+	return constants, variables
+}
+
+// isLiteralExpr reports whether expr is a basic literal, a signed one or a
+// boolean
+func isLiteralExpr(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.ParenExpr:
+		return isLiteralExpr(e.X)
+	case *ast.UnaryExpr:
+		_, ok := e.X.(*ast.BasicLit)
+		return ok && (e.Op == token.SUB || e.Op == token.ADD)
+	case *ast.Ident:
+		return e.Name == "true" || e.Name == "false"
+	}
+	return false
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MergeVerdict is the outcome of applying a merge plan in a scratch
+// worktree. Stage names the first stage that failed, and each later stage is
+// skipped.
+type MergeVerdict struct {
+	Passed   bool          `json:"passed"`
+	Stage    string        `json:"stage,omitempty"`
+	Revision string        `json:"revision"`
+	Written  []string      `json:"written"`
+	Deleted  []string      `json:"deleted"`
+	Stages   []VerifyStage `json:"stages"`
+	Tested   []string      `json:"tested"`
+}
+
+// VerifyStage is one step of the verification: parse, typecheck, build or
+// test. Status is passed, failed or skipped; Output is the tail of the go
+// command's output for build and test. A failed typecheck or build has a
+// reproducer of its first diagnostic.
+type VerifyStage struct {
+	Name        string             `json:"name"`
+	Status      string             `json:"status"`
+	DurationMS  int64              `json:"duration_ms"`
+	Diagnostics []VerifyDiagnostic `json:"diagnostics"`
+	Output      string             `json:"output,omitempty"`
+	Reproducer  *BuildReproducer   `json:"reproducer,omitempty"`
+}
+
+// VerifyDiagnostic is an error located in a file of the worktree, relative
+// to the repository root, classified as Diagnostic is
+type VerifyDiagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Message  string   `json:"message"`
+	Category string   `json:"category"`
+	Symbols  []string `json:"symbols"`
+}
+
+// mergePlan is the document verify-merge applies: the merged content of each
+// file by repository-relative path, as the merge engine produces it, and the
+// files to remove
+type mergePlan struct {
+	Files  map[string]string `json:"files"`
+	Delete []string          `json:"delete"`
+}
+
+// maxStageOutput bounds the go command output kept per stage
+const maxStageOutput = 8192
+
+// goErrorLine matches the file:line:col: message lines of go build and vet
+var goErrorLine = regexp.MustCompile(`^(?:\./)?([^\s:]+\.go):(\d+):(?:(\d+):)? (.*)$`)
+
+func runVerifyMerge(args []string) int {
+	planPath, repo, revision := "", ".", "HEAD"
+	runTests, keep := false, false
+	reproAttempts := defaultReproAttempts
+
+	flags := flag.NewFlagSet("verify-merge", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&planPath, "plan", "", "JSON merge plan: {\"files\": {path: content}, \"delete\": [path]}")
+	flags.StringVar(&repo, "repo", ".", "git checkout the plan applies to")
+	flags.StringVar(&revision, "revision", "HEAD", "revision to check out in the scratch worktree")
+	flags.BoolVar(&runTests, "test", false, "run the tests of the packages the plan affects after building")
+	flags.BoolVar(&keep, "keep", false, "leave the scratch worktree in place and print its path on stderr")
+	flags.IntVar(&reproAttempts, "repro-attempts", reproAttempts, "checks spent reducing a typecheck or build failure to a reproducer (0 disables)")
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if planPath == "" {
+		return fail("--plan is required")
+	}
+
+	data, err := os.ReadFile(planPath)
+	if err != nil {
+		return fail("Failed to read plan: %v", err)
+	}
+	var plan mergePlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return fail("Invalid plan: %v", err)
+	}
+	for _, path := range append(sortedPlanFiles(plan), plan.Delete...) {
+		if filepath.IsAbs(path) || strings.HasPrefix(filepath.Clean(path), "..") {
+			return fail("Plan path %s is outside the repository", path)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "go_parser-verify-")
+	if err != nil {
+		return fail("Failed to create worktree: %v", err)
+	}
+	os.Remove(dir)
+	anchor := filepath.Join(repo, "go.mod")
+	if _, err := runGit(anchor, "worktree", "add", "--detach", dir, revision); err != nil {
+		return fail("Failed to create worktree: %v", err)
+	}
+	if keep {
+		fmt.Fprintln(os.Stderr, dir)
+	} else {
+		defer runGit(anchor, "worktree", "remove", "--force", dir)
+	}
+
+	// Plan paths are relative to --repo, which may be below the top level
+	prefix, err := runGit(anchor, "rev-parse", "--show-prefix")
+	if err != nil {
+		return fail("Failed to locate %s in its checkout: %v", repo, err)
+	}
+
+	verdict, err := verifyMerge(filepath.Join(dir, strings.TrimSpace(string(prefix))), plan, runTests, reproAttempts)
+	if err != nil {
+		return fail("Verification failed: %v", err)
+	}
+	if sha, err := runGit(anchor, "rev-parse", revision); err == nil {
+		verdict.Revision = strings.TrimSpace(string(sha))
+	}
+
+	code := printJSON(verdict)
+	if code == 0 && !verdict.Passed {
+		return exitViolations
+	}
+	return code
+}
+
+// verifyMerge applies plan to the worktree at dir and runs the stages in
+// order until one fails, reducing a typecheck or build failure with up to
+// reproAttempts checks
+func verifyMerge(dir string, plan mergePlan, runTests bool, reproAttempts int) (*MergeVerdict, error) {
+	verdict := &MergeVerdict{Passed: true, Written: []string{}, Deleted: []string{}, Stages: []VerifyStage{}, Tested: []string{}}
+
+	for _, path := range sortedPlanFiles(plan) {
+		target := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, []byte(plan.Files[path]), 0o644); err != nil {
+			return nil, err
+		}
+		verdict.Written = append(verdict.Written, filepath.ToSlash(filepath.Clean(path)))
+	}
+	for _, path := range plan.Delete {
+		if err := os.Remove(filepath.Join(dir, path)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		verdict.Deleted = append(verdict.Deleted, filepath.ToSlash(filepath.Clean(path)))
+	}
+
+	// The typecheck and test stages resolve imports and packages from the
+	// working directory
+	previous, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return nil, err
+	}
+	defer os.Chdir(previous)
+
+	changed := append(append([]string{}, verdict.Written...), verdict.Deleted...)
+	stages := []verifyStep{
+		{"parse", func(s *VerifyStage) { parseStage(s, verdict.Written) }},
+		{"typecheck", func(s *VerifyStage) { typecheckStage(s, changed) }},
+		{"build", func(s *VerifyStage) { goStage(s, "build", "./...") }},
+	}
+	if runTests {
+		stages = append(stages, verifyStep{"test", func(s *VerifyStage) {
+			if impact := changedPackages(changed); impact != nil {
+				verdict.Tested = impact.Test
+			}
+			if len(verdict.Tested) > 0 {
+				goStage(s, append([]string{"test", "-count=1"}, verdict.Tested...)...)
+			}
+		}})
+	}
+
+	for _, stage := range stages {
+		result := VerifyStage{Name: stage.name, Status: "skipped", Diagnostics: []VerifyDiagnostic{}}
+		if verdict.Passed {
+			start := time.Now()
+			result.Status = "passed"
+			stage.run(&result)
+			result.DurationMS = time.Since(start).Milliseconds()
+			if result.Status == "failed" {
+				verdict.Passed, verdict.Stage = false, stage.name
+				if check := reproChecks[stage.name]; check != nil && reproAttempts > 0 {
+					result.Reproducer = minimizeFailure(&result, check, reproAttempts)
+				}
+			}
+		}
+		verdict.Stages = append(verdict.Stages, result)
+	}
+	return verdict, nil
+}
+
+// verifyStep is a stage of verifyMerge; run marks the stage failed and adds
+// its diagnostics
+type verifyStep struct {
+	name string
+	run  func(*VerifyStage)
+}
+
+// reproChecks rerun a stage on a single package directory
+var reproChecks = map[string]func(dir string) []VerifyDiagnostic{
+	"typecheck": typecheckDir,
+	"build":     buildDirDiagnostics,
+}
+
+func sortedPlanFiles(plan mergePlan) []string {
+	paths := make([]string, 0, len(plan.Files))
+	for path := range plan.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// parseStage parses every written Go file
+func parseStage(stage *VerifyStage, written []string) {
+	for _, path := range written {
+		if !strings.HasSuffix(path, ".go") {
+			continue
+		}
+		_, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.AllErrors)
+		if list, ok := err.(scanner.ErrorList); ok {
+			for _, e := range list {
+				stage.Diagnostics = append(stage.Diagnostics, VerifyDiagnostic{File: path, Line: e.Pos.Line, Column: e.Pos.Column, Message: e.Msg, Category: "syntax", Symbols: []string{}})
+			}
+		} else if err != nil {
+			stage.Diagnostics = append(stage.Diagnostics, VerifyDiagnostic{File: path, Message: err.Error(), Category: "syntax", Symbols: []string{}})
+		}
+	}
+	if len(stage.Diagnostics) > 0 {
+		stage.Status = "failed"
+	}
+}
+
+// typecheckStage type-checks the non-test files of every package the change
+// rebuilds, reporting the errors go/types finds before compiling
+func typecheckStage(stage *VerifyStage, changed []string) {
+	dirs := map[string]bool{}
+	for _, path := range changed {
+		if strings.HasSuffix(path, ".go") {
+			dirs[filepath.Dir(path)] = true
+		}
+	}
+	if impact := changedPackages(changed); impact != nil {
+		for _, pkg := range impact.Packages {
+			if pkg.Rebuild {
+				dirs[pkg.Dir] = true
+			}
+		}
+	}
+
+	for _, dir := range sortedKeys(dirs) {
+		stage.Diagnostics = append(stage.Diagnostics, typecheckDir(dir)...)
+	}
+	if len(stage.Diagnostics) > 0 {
+		stage.Status = "failed"
+	}
+}
+
+// typecheckDir type-checks each package of the non-test files in dir
+func typecheckDir(dir string) []VerifyDiagnostic {
+	diagnostics := []VerifyDiagnostic{}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	fset := token.NewFileSet()
+	byPackage := map[string][]*ast.File{}
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			continue
+		}
+		byPackage[file.Name.Name] = append(byPackage[file.Name.Name], file)
+	}
+
+	for _, files := range byPackage {
+		imp := newFallbackImporter(fset)
+		config := types.Config{
+			Importer: imp,
+			Error: func(err error) {
+				if typeErr, ok := err.(types.Error); ok && !imp.refersToMissing(typeErr.Msg) {
+					pos := fset.Position(typeErr.Pos)
+					diagnostics = append(diagnostics, verifyDiagnostic(filepath.ToSlash(pos.Filename), pos.Line, pos.Column, typeErr.Msg))
+				}
+			},
+		}
+		config.Check(files[0].Name.Name, fset, files, nil)
+	}
+	return diagnostics
+}
+
+// goStage runs the go command in the working directory and turns its
+// file:line:col errors into diagnostics
+func goStage(stage *VerifyStage, args ...string) {
+	var output bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err := cmd.Run()
+
+	for _, line := range strings.Split(output.String(), "\n") {
+		match := goErrorLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		lineNo, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[3])
+		stage.Diagnostics = append(stage.Diagnostics, verifyDiagnostic(match[1], lineNo, column, match[4]))
+	}
+
+	text := output.String()
+	if len(text) > maxStageOutput {
+		text = "..." + text[len(text)-maxStageOutput:]
+	}
+	stage.Output = text
+	if err != nil {
+		stage.Status = "failed"
+	}
+}
+
+// changedPackages computes the impact of the changed files on the packages
+// below the working directory, or nil when the graph cannot be built
+func changedPackages(changed []string) *ImpactReport {
+	goFiles := []string{}
+	for _, path := range changed {
+		if strings.HasSuffix(path, ".go") {
+			goFiles = append(goFiles, path)
+		}
+	}
+	graph, err := buildPackageGraph([]string{"./..."}, goFiles)
+	if err != nil {
+		return nil
+	}
+	return changeImpact(graph, changed)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Vocabulary is the naming of a codebase, ranked by use, for prompts that
+// should reuse it: the identifiers it declares, the receiver names of each
+// type, the words its identifiers are built from and how its error messages
+// are phrased
+type Vocabulary struct {
+	Files       []string        `json:"files"`
+	Identifiers []VocabTerm     `json:"identifiers"`
+	Receivers   []VocabReceiver `json:"receivers"`
+	Words       []VocabWord     `json:"words"`
+	ErrorStyles []ErrorStyle    `json:"error_styles"`
+	Errors      []FileError     `json:"errors"`
+}
+
+// VocabTerm is a declared identifier. Uses counts references by name in the
+// analyzed files, declarations excluded, and only x.Name selectors for
+// fields and methods.
+type VocabTerm struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	Uses int    `json:"uses"`
+}
+
+// VocabReceiver is the receiver name a type's methods use most, out of
+// Methods methods
+type VocabReceiver struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Pointer bool   `json:"pointer"`
+	Methods int    `json:"methods"`
+	Count   int    `json:"count"`
+}
+
+// VocabWord is a lower-cased component of the declared identifiers, split at
+// case changes, digits and underscores
+type VocabWord struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// ErrorStyle groups error messages by their first two words. Wraps counts
+// the messages that wrap another error with %w.
+type ErrorStyle struct {
+	Phrase   string   `json:"phrase"`
+	Count    int      `json:"count"`
+	Wraps    int      `json:"wraps"`
+	Examples []string `json:"examples"`
+}
+
+// errorConstructors are the calls whose first argument is an error message
+var errorConstructors = map[string]bool{"errors.New": true, "fmt.Errorf": true}
+
+// maxErrorExamples bounds the messages kept per error style
+const maxErrorExamples = 3
+
+func runVocabulary(args []string) int {
+	top := 50
+	strict := false
+
+	flags := flag.NewFlagSet("vocabulary", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.IntVar(&top, "top", 50, "entries to keep per section (0 keeps all)")
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	files, err := collectGoFiles(patterns, false)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+
+	vocabulary := buildVocabulary(files, top)
+	if err := strictFailure(vocabulary.Errors, strict); err != nil {
+		return fail("Vocabulary failed: %v", err)
+	}
+	return printJSON(vocabulary)
+}
+
+// receiverUse counts the receiver names of one type
+type receiverUse struct {
+	names   map[string]int
+	pointer map[string]bool
+	methods int
+}
+
+func buildVocabulary(paths []string, top int) *Vocabulary {
+	vocabulary := &Vocabulary{Files: []string{}, Identifiers: []VocabTerm{}, Receivers: []VocabReceiver{}, Words: []VocabWord{}, ErrorStyles: []ErrorStyle{}, Errors: []FileError{}}
+
+	kinds := map[string]string{}
+	// References by bare name and as the selector of x.name
+	uses, selected := map[string]int{}, map[string]int{}
+	receivers := map[string]*receiverUse{}
+	styles := map[string]*ErrorStyle{}
+
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			vocabulary.Errors = append(vocabulary.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+		vocabulary.Files = append(vocabulary.Files, path)
+
+		declared := map[*ast.Ident]bool{file.Name: true}
+		declare := func(ident *ast.Ident, kind string) {
+			declared[ident] = true
+			if ident.Name != "_" && ident.Name != "init" && kinds[ident.Name] == "" {
+				kinds[ident.Name] = kind
+			}
+		}
+
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					declare(decl.Name, "func")
+					continue
+				}
+				declare(decl.Name, "method")
+				owner := receiverTypeName(decl)
+				if receivers[owner] == nil {
+					receivers[owner] = &receiverUse{names: map[string]int{}, pointer: map[string]bool{}}
+				}
+				use := receivers[owner]
+				use.methods++
+				if name := receiverVarName(decl); name != "" && name != "_" {
+					use.names[name]++
+					_, star := decl.Recv.List[0].Type.(*ast.StarExpr)
+					use.pointer[name] = use.pointer[name] || star
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						declare(spec.Name, "type")
+						if st, ok := spec.Type.(*ast.StructType); ok {
+							for _, field := range st.Fields.List {
+								for _, name := range field.Names {
+									declare(name, "field")
+								}
+							}
+						}
+					case *ast.ValueSpec:
+						kind := "var"
+						if decl.Tok == token.CONST {
+							kind = "const"
+						}
+						for _, name := range spec.Names {
+							declare(name, kind)
+						}
+					}
+				}
+			}
+		}
+
+		selectors := map[*ast.Ident]bool{}
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch node := n.(type) {
+			case *ast.ImportSpec:
+				return false
+			case *ast.SelectorExpr:
+				selectors[node.Sel] = true
+			case *ast.Ident:
+				switch {
+				case declared[node]:
+				case selectors[node]:
+					selected[node.Name]++
+				default:
+					uses[node.Name]++
+				}
+			case *ast.CallExpr:
+				if errorConstructors[getFuncName(node.Fun)] && len(node.Args) > 0 {
+					if lit, ok := node.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						if message, err := strconv.Unquote(lit.Value); err == nil {
+							addErrorStyle(styles, message)
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	words := map[string]int{}
+	for name, kind := range kinds {
+		count := selected[name]
+		// Fields and methods are only reached through a selector
+		if kind != "field" && kind != "method" {
+			count += uses[name]
+		}
+		vocabulary.Identifiers = append(vocabulary.Identifiers, VocabTerm{Name: name, Kind: kind, Uses: count})
+		for _, word := range splitIdentifier(name) {
+			if len(word) > 1 {
+				words[word]++
+			}
+		}
+	}
+	sort.Slice(vocabulary.Identifiers, func(i, j int) bool {
+		a, b := vocabulary.Identifiers[i], vocabulary.Identifiers[j]
+		if a.Uses != b.Uses {
+			return a.Uses > b.Uses
+		}
+		return a.Name < b.Name
+	})
+
+	for owner, use := range receivers {
+		best := ""
+		for name, count := range use.names {
+			if best == "" || count > use.names[best] || (count == use.names[best] && name < best) {
+				best = name
+			}
+		}
+		if best != "" {
+			vocabulary.Receivers = append(vocabulary.Receivers, VocabReceiver{Type: owner, Name: best, Pointer: use.pointer[best], Methods: use.methods, Count: use.names[best]})
+		}
+	}
+	sort.Slice(vocabulary.Receivers, func(i, j int) bool {
+		a, b := vocabulary.Receivers[i], vocabulary.Receivers[j]
+		if a.Methods != b.Methods {
+			return a.Methods > b.Methods
+		}
+		return a.Type < b.Type
+	})
+
+	for word, count := range words {
+		vocabulary.Words = append(vocabulary.Words, VocabWord{Word: word, Count: count})
+	}
+	sort.Slice(vocabulary.Words, func(i, j int) bool {
+		a, b := vocabulary.Words[i], vocabulary.Words[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Word < b.Word
+	})
+
+	for _, style := range styles {
+		vocabulary.ErrorStyles = append(vocabulary.ErrorStyles, *style)
+	}
+	sort.Slice(vocabulary.ErrorStyles, func(i, j int) bool {
+		a, b := vocabulary.ErrorStyles[i], vocabulary.ErrorStyles[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Phrase < b.Phrase
+	})
+
+	if top > 0 {
+		vocabulary.Identifiers = vocabulary.Identifiers[:min(top, len(vocabulary.Identifiers))]
+		vocabulary.Receivers = vocabulary.Receivers[:min(top, len(vocabulary.Receivers))]
+		vocabulary.Words = vocabulary.Words[:min(top, len(vocabulary.Words))]
+		vocabulary.ErrorStyles = vocabulary.ErrorStyles[:min(top, len(vocabulary.ErrorStyles))]
+	}
+	return vocabulary
+}
+
+// addErrorStyle files message under its first two words, with format verbs
+// dropped
+func addErrorStyle(styles map[string]*ErrorStyle, message string) {
+	words := []string{}
+	for _, word := range strings.Fields(message) {
+		if strings.HasPrefix(word, "%") {
+			break
+		}
+		words = append(words, strings.TrimRight(word, ":,."))
+		if len(words) == 2 || strings.HasSuffix(word, ":") {
+			break
+		}
+	}
+	if len(words) == 0 {
+		return
+	}
+
+	phrase := strings.Join(words, " ")
+	style := styles[phrase]
+	if style == nil {
+		style = &ErrorStyle{Phrase: phrase, Examples: []string{}}
+		styles[phrase] = style
+	}
+	style.Count++
+	if strings.Contains(message, "%w") {
+		style.Wraps++
+	}
+	if len(style.Examples) < maxErrorExamples && !contains(style.Examples, message) {
+		style.Examples = append(style.Examples, message)
+	}
+}
+
+// splitIdentifier breaks an identifier into lower-case words: parseHTTPRequest
+// gives parse, http and request
+func splitIdentifier(name string) []string {
+	runes := []rune(name)
+	words := []string{}
+	start := 0
+	flush := func(end int) {
+		if end > start {
+			words = append(words, strings.ToLower(string(runes[start:end])))
+		}
+		start = end
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '_' || unicode.IsDigit(r):
+			flush(i)
+			start = i + 1
+		case i > start && unicode.IsUpper(r):
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				flush(i)
+			}
+		}
+	}
+	flush(len(runes))
+	return words
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// VulnReport lists the known vulnerabilities of the modules a tree
+// requires, most reachable first
+type VulnReport struct {
+	Database string        `json:"database"`
+	Entries  int           `json:"entries"`
+	Modules  int           `json:"modules"`
+	Findings []VulnFinding `json:"findings"`
+	Errors   []FileError   `json:"errors"`
+}
+
+// VulnFinding is one advisory affecting a required module version.
+// Reachability is "called" when the code uses a vulnerable symbol,
+// "imported" when it only imports an affected package and "required" when
+// the module is only in go.mod; Calls are the uses found.
+type VulnFinding struct {
+	ID           string     `json:"id"`
+	Aliases      []string   `json:"aliases"`
+	Summary      string     `json:"summary"`
+	Module       string     `json:"module"`
+	Version      string     `json:"version"`
+	FixedVersion string     `json:"fixed_version,omitempty"`
+	Reachability string     `json:"reachability"`
+	Packages     []string   `json:"packages"`
+	Symbols      []string   `json:"symbols"`
+	Calls        []VulnCall `json:"calls"`
+	URL          string     `json:"url,omitempty"`
+}
+
+// VulnCall is a use of a vulnerable symbol. Methods are matched by name on
+// any value in a file importing the package.
+type VulnCall struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Symbol string `json:"symbol"`
+}
+
+// osvEntry is the part of an OSV advisory the check reads, in the format of
+// the Go vulnerability database
+type osvEntry struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Details  string   `json:"details"`
+	Affected []struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced   string `json:"introduced"`
+				Fixed        string `json:"fixed"`
+				LastAffected string `json:"last_affected"`
+			} `json:"events"`
+		} `json:"ranges"`
+		EcosystemSpecific struct {
+			Imports []struct {
+				Path    string   `json:"path"`
+				Symbols []string `json:"symbols"`
+			} `json:"imports"`
+		} `json:"ecosystem_specific"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		URL string `json:"url"`
+	} `json:"database_specific"`
+}
+
+// reachabilityRank orders findings from most to least reachable
+var reachabilityRank = map[string]int{"called": 0, "imported": 1, "required": 2}
+
+func runVulncheck(args []string) int {
+	db := ""
+	if value := os.Getenv("GOVULNDB"); strings.HasPrefix(value, "file://") {
+		db = strings.TrimPrefix(value, "file://")
+	}
+	strict := false
+
+	flags := flag.NewFlagSet("vulncheck", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	flags.StringVar(&db, "db", db, "directory of OSV advisories, such as a copy of vuln.go.dev (default GOVULNDB when it is a file:// URL)")
+	flags.BoolVar(&strict, "strict", false, "fail on the first file that cannot be parsed")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return fail("Invalid arguments: %v", err)
+	}
+	if db == "" {
+		return fail("No vulnerability database: pass --db or set GOVULNDB to a file:// URL; nothing is downloaded")
+	}
+
+	patterns := positional
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	files, err := collectGoFiles(patterns, false)
+	if err != nil {
+		return fail("Failed to collect files: %v", err)
+	}
+	if len(files) == 0 {
+		return fail("No Go files in %s", strings.Join(patterns, " "))
+	}
+
+	root, modulePath, err := findModule(filepath.Dir(files[0]))
+	if err != nil || root == "" {
+		return fail("No go.mod found for %s", files[0])
+	}
+
+	entries, err := loadOSVDatabase(db)
+	if err != nil {
+		return fail("Failed to read the vulnerability database: %v", err)
+	}
+	modules, _, err := collectSBOMModules(files, root, modulePath, nil)
+	if err != nil {
+		return fail("Failed to collect dependencies: %v", err)
+	}
+
+	report := checkVulnerabilities(files, modules, entries)
+	report.Database = db
+	if err := strictFailure(report.Errors, strict); err != nil {
+		return fail("Vulncheck failed: %v", err)
+	}
+
+	code := printJSON(report)
+	if code == 0 && len(report.Findings) > 0 && report.Findings[0].Reachability == "called" {
+		return exitViolations
+	}
+	return code
+}
+
+// loadOSVDatabase reads every advisory under dir. Index files and other
+// JSON documents without an id are skipped.
+func loadOSVDatabase(dir string) ([]osvEntry, error) {
+	entries := []osvEntry{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var entry osvEntry
+		if json.Unmarshal(data, &entry) != nil || entry.ID == "" {
+			return nil
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// osvUse is a reference in the analyzed code to a package-level name or a
+// method of an imported package
+type osvUse struct {
+	file   string
+	line   int
+	name   string
+	method bool
+}
+
+func checkVulnerabilities(files []string, modules []sbomModule, entries []osvEntry) *VulnReport {
+	report := &VulnReport{Entries: len(entries), Findings: []VulnFinding{}, Errors: []FileError{}}
+
+	// Uses per imported package path
+	uses := map[string][]osvUse{}
+	imported := map[string]bool{}
+	for _, path := range files {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			report.Errors = append(report.Errors, FileError{Path: path, Error: err.Error()})
+			continue
+		}
+
+		local := map[string]string{}
+		for _, imp := range file.Imports {
+			info := importInfo{path: strings.Trim(imp.Path.Value, `"`)}
+			if imp.Name != nil {
+				info.name = imp.Name.Name
+			}
+			imported[info.path] = true
+			local[info.localName()] = info.path
+		}
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			line := fset.Position(sel.Sel.Pos()).Line
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil && local[x.Name] != "" {
+				uses[local[x.Name]] = append(uses[local[x.Name]], osvUse{file: path, line: line, name: sel.Sel.Name})
+				return true
+			}
+			for _, importPath := range local {
+				uses[importPath] = append(uses[importPath], osvUse{file: path, line: line, name: sel.Sel.Name, method: true})
+			}
+			return true
+		})
+	}
+
+	for _, module := range modules {
+		if module.Version == "" {
+			continue
+		}
+		report.Modules++
+		for _, entry := range entries {
+			if finding, ok := matchAdvisory(entry, module, imported, uses); ok {
+				report.Findings = append(report.Findings, finding)
+			}
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if reachabilityRank[a.Reachability] != reachabilityRank[b.Reachability] {
+			return reachabilityRank[a.Reachability] < reachabilityRank[b.Reachability]
+		}
+		return a.ID < b.ID
+	})
+	return report
+}
+
+// matchAdvisory reports whether entry affects the module's version and how
+// far the code reaches into it
+func matchAdvisory(entry osvEntry, module sbomModule, imported map[string]bool, uses map[string][]osvUse) (VulnFinding, bool) {
+	finding := VulnFinding{
+		ID:           entry.ID,
+		Aliases:      entry.Aliases,
+		Summary:      entry.Summary,
+		Module:       module.Path,
+		Version:      module.Version,
+		Reachability: "required",
+		Packages:     []string{},
+		Symbols:      []string{},
+		Calls:        []VulnCall{},
+		URL:          entry.DatabaseSpecific.URL,
+	}
+	if finding.Aliases == nil {
+		finding.Aliases = []string{}
+	}
+	if finding.Summary == "" {
+		finding.Summary = strings.SplitN(entry.Details, "\n", 2)[0]
+	}
+
+	matched := false
+	for _, affected := range entry.Affected {
+		if affected.Package.Name != module.Path || (affected.Package.Ecosystem != "" && affected.Package.Ecosystem != "Go") {
+			continue
+		}
+		for _, r := range affected.Ranges {
+			if r.Type != "SEMVER" {
+				continue
+			}
+			inRange := false
+			for _, event := range r.Events {
+				if event.Introduced != "" && (event.Introduced == "0" || compareVersions(module.Version, event.Introduced) >= 0) {
+					inRange = true
+				}
+				if event.Fixed != "" && compareVersions(module.Version, event.Fixed) >= 0 {
+					inRange = false
+				}
+				if event.LastAffected != "" && compareVersions(module.Version, event.LastAffected) > 0 {
+					inRange = false
+				}
+				if event.Fixed != "" && compareVersions(module.Version, event.Fixed) < 0 && finding.FixedVersion == "" {
+					finding.FixedVersion = "v" + strings.TrimPrefix(event.Fixed, "v")
+				}
+			}
+			matched = matched || inRange
+		}
+
+		for _, imp := range affected.EcosystemSpecific.Imports {
+			finding.Packages = append(finding.Packages, imp.Path)
+			finding.Symbols = append(finding.Symbols, imp.Symbols...)
+			if !imported[imp.Path] {
+				continue
+			}
+			if finding.Reachability == "required" {
+				finding.Reachability = "imported"
+			}
+			for _, use := range uses[imp.Path] {
+				if symbol, ok := vulnerableSymbol(imp.Symbols, use); ok {
+					finding.Reachability = "called"
+					finding.Calls = append(finding.Calls, VulnCall{File: use.file, Line: use.line, Symbol: symbol})
+				}
+			}
+		}
+	}
+	return finding, matched
+}
+
+// vulnerableSymbol matches a use against an advisory's symbols, which name
+// functions as "Parse" and methods as "Reader.Read". An empty list means the
+// whole package is affected.
+func vulnerableSymbol(symbols []string, use osvUse) (string, bool) {
+	if len(symbols) == 0 {
+		return use.name, !use.method
+	}
+	for _, symbol := range symbols {
+		_, method, isMethod := strings.Cut(symbol, ".")
+		if isMethod == use.method && (symbol == use.name || method == use.name) {
+			return symbol, true
+		}
+	}
+	return "", false
+}
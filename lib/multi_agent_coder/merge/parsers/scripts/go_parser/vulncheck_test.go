@@ -0,0 +1,147 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// vulnFixture calls a vulnerable function and method of example.com/dep/sub
+// and only imports example.com/other
+var vulnFixture = map[string]string{
+	"go.mod": `module example.com/app
+
+go 1.21
+
+require (
+	example.com/dep v1.2.0
+	example.com/other v0.1.0
+)
+`,
+	"main.go": `package main
+
+import (
+	"os"
+
+	"example.com/dep/sub"
+	_ "example.com/other"
+)
+
+func main() {
+	r := sub.Parse(os.Args[1])
+	r.Read(nil)
+}
+`,
+}
+
+// vulnDatabase holds advisories that match at each reachability, ones that
+// do not match and an index file without an id
+var vulnDatabase = map[string]string{
+	"index/modules.json": `[{"path": "example.com/dep"}]`,
+	"ID/GO-2026-0001.json": `{"id": "GO-2026-0001", "aliases": ["CVE-2026-1111"], "summary": "Parse overflows",
+		"affected": [{"package": {"name": "example.com/dep", "ecosystem": "Go"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.3.0"}]}],
+			"ecosystem_specific": {"imports": [{"path": "example.com/dep/sub", "symbols": ["Parse", "Reader.Read"]}]}}],
+		"database_specific": {"url": "https://pkg.go.dev/vuln/GO-2026-0001"}}`,
+	"ID/GO-2026-0002.json": `{"id": "GO-2026-0002", "summary": "Fixed before the required version",
+		"affected": [{"package": {"name": "example.com/dep", "ecosystem": "Go"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "1.0.0"}, {"fixed": "1.2.0"}]}],
+			"ecosystem_specific": {"imports": [{"path": "example.com/dep/sub", "symbols": ["Parse"]}]}}]}`,
+	"ID/GO-2026-0003.json": `{"id": "GO-2026-0003", "details": "Do races\nwith itself.",
+		"affected": [{"package": {"name": "example.com/dep", "ecosystem": "Go"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}],
+			"ecosystem_specific": {"imports": [{"path": "example.com/dep/internal/race", "symbols": ["Do"]}]}}]}`,
+	"ID/GO-2026-0004.json": `{"id": "GO-2026-0004", "summary": "The package leaks",
+		"affected": [{"package": {"name": "example.com/other", "ecosystem": "Go"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"last_affected": "0.1.0"}]}],
+			"ecosystem_specific": {"imports": [{"path": "example.com/other"}]}}]}`,
+	"ID/PYSEC-2026-1.json": `{"id": "PYSEC-2026-1", "summary": "Same name, other ecosystem",
+		"affected": [{"package": {"name": "example.com/dep", "ecosystem": "PyPI"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}]}]}`,
+}
+
+func TestCheckVulnerabilities(t *testing.T) {
+	dir, db := t.TempDir(), t.TempDir()
+	writeFixture(t, dir, vulnFixture)
+	writeFixture(t, db, vulnDatabase)
+
+	entries, err := loadOSVDatabase(db)
+	if err != nil {
+		t.Fatalf("loadOSVDatabase: %v", err)
+	}
+	if len(entries) != 5 {
+		t.Errorf("entries = %d, want the 5 advisories", len(entries))
+	}
+	files, err := collectGoFiles([]string{filepath.Join(dir, "...")}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules, _, err := collectSBOMModules(files, dir, "example.com/app", nil)
+	if err != nil {
+		t.Fatalf("collectSBOMModules: %v", err)
+	}
+
+	report := checkVulnerabilities(files, modules, entries)
+	if report.Modules != 2 || len(report.Errors) != 0 {
+		t.Errorf("modules, errors = %d, %+v", report.Modules, report.Errors)
+	}
+	want := []struct {
+		id           string
+		module       string
+		reachability string
+		fixed        string
+		summary      string
+		calls        string
+	}{
+		{"GO-2026-0001", "example.com/dep", "called", "v1.3.0", "Parse overflows", "Parse:11 Reader.Read:12"},
+		{"GO-2026-0004", "example.com/other", "imported", "", "The package leaks", ""},
+		{"GO-2026-0003", "example.com/dep", "required", "", "Do races", ""},
+	}
+	if len(report.Findings) != len(want) {
+		t.Fatalf("findings = %+v", report.Findings)
+	}
+	for i, finding := range report.Findings {
+		calls := []string{}
+		for _, call := range finding.Calls {
+			if filepath.Base(call.File) != "main.go" {
+				t.Errorf("call in %s", call.File)
+			}
+			calls = append(calls, call.Symbol+":"+strconv.Itoa(call.Line))
+		}
+		got := []string{finding.ID, finding.Module, finding.Reachability, finding.FixedVersion, finding.Summary, strings.Join(calls, " ")}
+		expected := []string{want[i].id, want[i].module, want[i].reachability, want[i].fixed, want[i].summary, want[i].calls}
+		if strings.Join(got, "|") != strings.Join(expected, "|") {
+			t.Errorf("finding %d = %s, want %s", i, strings.Join(got, "|"), strings.Join(expected, "|"))
+		}
+		if finding.Version == "" || finding.Aliases == nil || finding.Packages == nil || finding.Symbols == nil {
+			t.Errorf("finding %s has unset fields: %+v", finding.ID, finding)
+		}
+	}
+	if first := report.Findings[0]; len(first.Aliases) != 1 || first.Aliases[0] != "CVE-2026-1111" || first.URL != "https://pkg.go.dev/vuln/GO-2026-0001" {
+		t.Errorf("aliases, url = %v, %s", first.Aliases, first.URL)
+	}
+}
+
+func TestVulnerableSymbol(t *testing.T) {
+	tests := []struct {
+		symbols []string
+		use     osvUse
+		want    string
+		ok      bool
+	}{
+		{[]string{"Parse"}, osvUse{name: "Parse"}, "Parse", true},
+		{[]string{"Parse"}, osvUse{name: "Parse", method: true}, "", false},
+		{[]string{"Reader.Read"}, osvUse{name: "Read", method: true}, "Reader.Read", true},
+		{[]string{"Reader.Read"}, osvUse{name: "Read"}, "", false},
+		{[]string{"Parse"}, osvUse{name: "Format"}, "", false},
+		{nil, osvUse{name: "Anything"}, "Anything", true},
+		{nil, osvUse{name: "Close", method: true}, "Close", false},
+	}
+	for _, tt := range tests {
+		symbol, ok := vulnerableSymbol(tt.symbols, tt.use)
+		if ok != tt.ok || (ok && symbol != tt.want) {
+			t.Errorf("vulnerableSymbol(%v, %+v) = %q, %v, want %q, %v", tt.symbols, tt.use, symbol, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseYAML reads the subset of YAML that configuration files use: block
+// mappings and sequences by indentation, "- key: value" items, one-line flow
+// sequences such as [a, "b"], plain, single- and double-quoted scalars,
+// booleans, null, numbers and comments. Anchors, tags, multi-line scalars and
+// flow mappings are not supported; a document that is JSON, which YAML
+// includes, is read as JSON. The result holds the types encoding/json
+// decodes into, so it can be re-marshaled into a struct.
+func parseYAML(data []byte) (interface{}, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err == nil {
+			return doc, nil
+		}
+	}
+
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		text := stripYAMLComment(raw)
+		if strings.TrimSpace(text) == "" || strings.TrimSpace(text) == "---" {
+			continue
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		if strings.HasPrefix(text[indent:], "\t") {
+			return nil, fmt.Errorf("line %d: tabs cannot indent YAML", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{number: i + 1, indent: indent, text: strings.TrimSpace(text)})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	doc, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return doc, nil
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// block reads the mapping, sequence or scalar starting at the current line,
+// which is at indent
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	line := p.lines[p.pos]
+	if isYAMLSequenceItem(line.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return p.mapping(indent)
+	}
+	p.pos++
+	return yamlScalar(line.text), nil
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	items := []interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		rest := strings.TrimSpace(line.text[1:])
+		if rest == "" {
+			p.pos++
+			item, err := p.nested(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		// The item's content continues as a block at the column it starts
+		// at, so "- name: x" is followed by the item's other keys
+		column := line.indent + len(line.text) - len(rest)
+		p.lines[p.pos] = yamlLine{number: line.number, indent: column, text: rest}
+		item, err := p.block(column)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	object := map[string]interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", line.number)
+		}
+		if _, duplicate := object[key]; duplicate {
+			return nil, fmt.Errorf("line %d: duplicate key %s", line.number, key)
+		}
+		p.pos++
+		if value != "" {
+			object[key] = yamlScalar(value)
+			continue
+		}
+		// A sequence may be indented as far as its key
+		child, err := p.nested(indent, true)
+		if err != nil {
+			return nil, err
+		}
+		object[key] = child
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return object, nil
+}
+
+// nested reads the block under a key or item without a value, or returns
+// nil when there is none
+func (p *yamlParser) nested(indent int, sequenceAtIndent bool) (interface{}, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	switch {
+	case next.indent > indent:
+		return p.block(next.indent)
+	case sequenceAtIndent && next.indent == indent && isYAMLSequenceItem(next.text):
+		return p.sequence(indent)
+	}
+	return nil, nil
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" at the first colon outside quotes that
+// ends the line or is followed by a space
+func splitYAMLKey(text string) (string, string, bool) {
+	quote := byte(0)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case opensYAMLQuote(text, i):
+			quote = c
+		case c == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if key == "" {
+				return "", "", false
+			}
+			if unquoted, ok := yamlScalar(key).(string); ok {
+				key = unquoted
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripYAMLComment removes a comment: a # outside quotes at the start of the
+// line or after a space
+func stripYAMLComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case opensYAMLQuote(line, i):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlScalar converts a scalar or a one-line flow sequence
+func yamlScalar(text string) interface{} {
+	switch {
+	case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+		items := []interface{}{}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return items
+		}
+		for _, item := range splitYAMLFlow(inner) {
+			items = append(items, yamlScalar(strings.TrimSpace(item)))
+		}
+		return items
+	case len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"':
+		if value, err := strconv.Unquote(text); err == nil {
+			return value
+		}
+	case len(text) >= 2 && text[0] == '\'' && text[len(text)-1] == '\'':
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'")
+	}
+
+	switch text {
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case "null", "Null", "NULL", "~":
+		return nil
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n
+	}
+	// Not inf or nan, which JSON cannot carry
+	if f, err := strconv.ParseFloat(text, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return text
+}
+
+// opensYAMLQuote reports whether text has a quote at i that starts a quoted
+// scalar rather than being part of a plain one, such as the apostrophe of
+// don't
+func opensYAMLQuote(text string, i int) bool {
+	if text[i] != '"' && text[i] != '\'' {
+		return false
+	}
+	return i == 0 || strings.ContainsRune(" \t[,:", rune(text[i-1]))
+}
+
+// splitYAMLFlow splits the items of a flow sequence at commas outside quotes
+func splitYAMLFlow(text string) []string {
+	items := []string{}
+	quote := byte(0)
+	start := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case opensYAMLQuote(text, i):
+			quote = c
+		case c == ',':
+			items = append(items, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, text[start:])
+}
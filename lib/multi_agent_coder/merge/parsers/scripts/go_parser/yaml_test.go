@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want interface{}
+	}{
+		{
+			name: "scalars",
+			yaml: "name: gate\ncount: 3\nratio: 0.5\nenabled: true\nmissing: ~\n",
+			want: map[string]interface{}{"name": "gate", "count": int64(3), "ratio": 0.5, "enabled": true, "missing": nil},
+		},
+		{
+			name: "comments",
+			yaml: "# policy\nname: x # trailing\nurl: http://host/#anchor\nquoted: \"a # b\"\n  # indented comment\n",
+			want: map[string]interface{}{"name": "x", "url": "http://host/#anchor", "quoted": "a # b"},
+		},
+		{
+			name: "flow lists",
+			yaml: "empty: []\nitems: [a, \"b, c\", 'd', 1, true]\n",
+			want: map[string]interface{}{"empty": []interface{}{}, "items": []interface{}{"a", "b, c", "d", int64(1), true}},
+		},
+		{
+			name: "quoted keys",
+			yaml: "\"a: b\": 1\n'it''s': 2\n\"x\\ty\": 3\n",
+			want: map[string]interface{}{"a: b": int64(1), "it's": int64(2), "x\ty": int64(3)},
+		},
+		{
+			name: "quoted scalars",
+			yaml: "single: 'don''t'\ndouble: \"tab\\there\"\nnumber: \"1\"\napostrophe: don't\n",
+			want: map[string]interface{}{"single": "don't", "double": "tab\there", "number": "1", "apostrophe": "don't"},
+		},
+		{
+			name: "sequence of mappings",
+			yaml: "rules:\n  - name: a\n    paths:\n      - x/...\n  - name: b\n    deny_imports: [unsafe]\n",
+			want: map[string]interface{}{"rules": []interface{}{
+				map[string]interface{}{"name": "a", "paths": []interface{}{"x/..."}},
+				map[string]interface{}{"name": "b", "deny_imports": []interface{}{"unsafe"}},
+			}},
+		},
+		{
+			name: "sequence at the key's indentation",
+			yaml: "---\nitems:\n- a\n- b\nnext: 1\n",
+			want: map[string]interface{}{"items": []interface{}{"a", "b"}, "next": int64(1)},
+		},
+		{
+			name: "json",
+			yaml: "{\"rules\": [{\"name\": \"a\"}]}",
+			want: map[string]interface{}{"rules": []interface{}{map[string]interface{}{"name": "a"}}},
+		},
+		{
+			name: "empty",
+			yaml: "# nothing\n\n",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		error string
+	}{
+		{"tab indentation", "rules:\n\t- a\n", "line 2: tabs cannot indent YAML"},
+		{"duplicate key", "a: 1\nb: 2\na: 3\n", "line 3: duplicate key a"},
+		{"deeper line after a value", "a: 1\n  b: 2\n", "line 2: unexpected indentation"},
+		{"not a key", "a: 1\njust text\n", "line 2: expected key: value"},
+		{"item deeper than its sequence", "- a\n  - b\n", "line 2: unexpected indentation"},
+		{"mapping after a sequence", "- a\nb: 1\n", "line 2: unexpected indentation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("parseYAML error = %v, want %q", err, tt.error)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+defmodule MultiAgentCoder.Merge.Parsers.GoParserTest do
+  use ExUnit.Case, async: false
+
+  alias MultiAgentCoder.Merge.Parsers.GoParser
+
+  @moduletag :go_parser
+
+  describe "parse_files/1" do
+    test "maps every result back to the caller's path" do
+      # More than ten files, so the index-named temporary files do not sort
+      # in the order they were given
+      files =
+        for i <- 0..11 do
+          {"pkg/file_#{i}.go", "package pkg\n\nfunc F#{i}() int { return #{i} }\n"}
+        end
+
+      assert {:ok, results} = GoParser.parse_files(files)
+      assert map_size(results) == 12
+
+      for i <- 0..11 do
+        assert {:ok, ast} = Map.fetch!(results, "pkg/file_#{i}.go")
+        assert [%{name: name}] = GoParser.extract_functions(ast)
+        assert name == "F#{i}"
+      end
+    end
+
+    test "accepts a map of path to content" do
+      files = %{
+        "a.go" => "package a\n\nfunc A() {}\n",
+        "b.go" => "package a\n\nfunc B() {}\n"
+      }
+
+      assert {:ok, %{"a.go" => {:ok, a}, "b.go" => {:ok, b}}} = GoParser.parse_files(files)
+      assert [%{name: "A"}] = GoParser.extract_functions(a)
+      assert [%{name: "B"}] = GoParser.extract_functions(b)
+    end
+
+    test "reports a file that does not parse under its own path" do
+      files = [
+        {"good.go", "package p\n\nfunc Good() {}\n"},
+        {"bad.go", "}}}"}
+      ]
+
+      assert {:ok, results} = GoParser.parse_files(files)
+      assert {:ok, _ast} = results["good.go"]
+      assert {:error, reason} = results["bad.go"]
+      assert is_binary(reason)
+      assert reason =~ "expected"
+    end
+
+    test "returns an empty map for no files" do
+      assert {:ok, results} = GoParser.parse_files([])
+      assert results == %{}
+    end
+  end
+end